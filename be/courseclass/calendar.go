@@ -0,0 +1,194 @@
+package courseclass
+
+import (
+	"HNLP/be/internal/db"
+	"HNLP/be/internal/semester"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// icalTimeLayout is the UTC date-time format of iCalendar
+	icalTimeLayout = "20060102T150405Z"
+	// icalLineLength is the maximum length of a line in octets, the longer lines are folded
+	icalLineLength = 75
+	// feedTokenBytes is the number of random bytes of a calendar feed token, hex encoded in its URL
+	feedTokenBytes = 32
+)
+
+// ExportCalendar returns the weekly sessions of the caller in a semester as an iCalendar feed (RFC 5545).
+// Each session repeats every week from its first day in the semester to the end of the semester,
+// the sessions whose lesson range isn't in the timetable are left out.
+func (s *ServiceImpl) ExportCalendar(ctx context.Context, req ExportCalendarRequest) ([]byte, error) {
+	sem, err := s.resolveSemester(ctx, req.Semester)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.scheduleOf(ctx, sem)
+	if err != nil {
+		return nil, err
+	}
+
+	location := s.timetable.Location()
+	// The times are written in UTC, the recurrences keep their clock time as long as the time zone has no DST
+	until := clockIn(sem.EndDate, 24*60, location).Add(-time.Second).UTC().Format(icalTimeLayout)
+	stamp := s.now().UTC().Format(icalTimeLayout)
+
+	var calendar strings.Builder
+	writeLine(&calendar, "BEGIN:VCALENDAR")
+	writeLine(&calendar, "VERSION:2.0")
+	writeLine(&calendar, "PRODID:-//HNLP//Schedule//VI")
+	writeLine(&calendar, "CALSCALE:GREGORIAN")
+	writeLine(&calendar, "METHOD:PUBLISH")
+	writeLine(&calendar, "X-WR-CALNAME:"+escapeText("Thời khóa biểu "+sem.Code))
+	writeLine(&calendar, "X-WR-TIMEZONE:"+location.String())
+	for _, entry := range entries {
+		slot, ok := s.timetable.Slot(entry.LessonRange)
+		if !ok {
+			continue
+		}
+		first, ok := firstDateOf(sem, entry.DayOfWeek)
+		if !ok {
+			continue
+		}
+
+		writeLine(&calendar, "BEGIN:VEVENT")
+		writeLine(&calendar, fmt.Sprintf("UID:schedule-%d-%s@hnlp", entry.ID, sem.Code))
+		writeLine(&calendar, "DTSTAMP:"+stamp)
+		writeLine(&calendar, "DTSTART:"+clockIn(first, slot.Start, location).UTC().Format(icalTimeLayout))
+		writeLine(&calendar, "DTEND:"+clockIn(first, slot.End, location).UTC().Format(icalTimeLayout))
+		writeLine(&calendar, "RRULE:FREQ=WEEKLY;UNTIL="+until)
+		writeLine(&calendar, "SUMMARY:"+escapeText(eventSummary(entry)))
+		if entry.Location != "" {
+			writeLine(&calendar, "LOCATION:"+escapeText(entry.Location))
+		}
+		writeLine(&calendar, "DESCRIPTION:"+escapeText(eventDescription(entry)))
+		writeLine(&calendar, "END:VEVENT")
+	}
+	writeLine(&calendar, "END:VCALENDAR")
+	return []byte(calendar.String()), nil
+}
+
+// CreateCalendarFeed returns a new secret token of the calendar feed of the caller. The calendar apps can't send the
+// Authorization header when they subscribe, so the token in the URL of the feed identifies the caller instead.
+// Only its hash is stored and creating a new feed revokes the previous one.
+func (s *ServiceImpl) CreateCalendarFeed(ctx context.Context) (string, error) {
+	caller := db.CallerFrom(ctx)
+	if caller.Role != "student" && caller.Role != "professor" {
+		return "", ErrNoSchedule
+	}
+	userId, _ := ctx.Value("userId").(int)
+	random := make([]byte, feedTokenBytes)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(random)
+	err := s.repo.SaveCalendarFeed(ctx, hashFeedToken(token), CalendarFeed{UserID: userId, Role: caller.Role, SpecificID: caller.SpecificID})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RevokeCalendarFeed deletes the calendar feed of the caller, the subscribed calendar apps stop getting the schedule
+func (s *ServiceImpl) RevokeCalendarFeed(ctx context.Context) error {
+	userId, _ := ctx.Value("userId").(int)
+	return s.repo.DeleteCalendarFeed(ctx, userId)
+}
+
+// ExportFeedCalendar returns the calendar of the owner of the feed token, or ErrInvalidFeedToken if it was revoked
+func (s *ServiceImpl) ExportFeedCalendar(ctx context.Context, token string, req ExportCalendarRequest) ([]byte, error) {
+	if len(token) != 2*feedTokenBytes {
+		return nil, ErrInvalidFeedToken
+	}
+	feed, err := s.repo.GetCalendarFeed(ctx, hashFeedToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidFeedToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	ctx = context.WithValue(ctx, "userId", feed.UserID)
+	ctx = context.WithValue(ctx, "specificId", feed.SpecificID)
+	ctx = context.WithValue(ctx, "userRole", feed.Role)
+	return s.ExportCalendar(ctx, req)
+}
+
+// ------------------Private helper function------------------
+
+// hashFeedToken returns the stored form of a calendar feed token
+func hashFeedToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// firstDateOf returns the first date of the semester on a day of week like "3" for Tuesday
+func firstDateOf(sem semester.Semester, dayOfWeek string) (time.Time, bool) {
+	offset, ok := dayOffset(dayOfWeek)
+	if !ok {
+		return time.Time{}, false
+	}
+	date := weekStartOf(sem, 1).AddDate(0, 0, offset)
+	if date.Before(sem.StartDate) {
+		date = date.AddDate(0, 0, 7)
+	}
+	return date, !date.After(sem.EndDate)
+}
+
+// clockIn returns the time of the day of a date at the minutes since midnight in the location
+func clockIn(date time.Time, minutes int, location *time.Location) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, minutes, 0, 0, location)
+}
+
+func eventSummary(entry ScheduleEntry) string {
+	summary := fmt.Sprintf("%s (%s)", entry.CourseName, entry.ClassCode)
+	if entry.SessionType != nil && *entry.SessionType != "" {
+		summary += " - " + *entry.SessionType
+	}
+	return summary
+}
+
+func eventDescription(entry ScheduleEntry) string {
+	lines := []string{"Môn học: " + entry.CourseCode}
+	if entry.LessonRange != nil {
+		lines = append(lines, "Tiết: "+*entry.LessonRange)
+	}
+	if entry.Group != nil && *entry.Group != "" {
+		lines = append(lines, "Nhóm: "+*entry.Group)
+	}
+	if entry.Instructors != "" {
+		lines = append(lines, "Giảng viên: "+entry.Instructors)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// escapeText escapes a TEXT value of iCalendar
+func escapeText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(text)
+}
+
+// writeLine writes a content line ending with CRLF, folded into lines of at most 75 octets without splitting a character
+func writeLine(builder *strings.Builder, line string) {
+	limit := icalLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		builder.WriteString(line[:cut])
+		builder.WriteString("\r\n ")
+		line = line[cut:]
+		// The continuation lines start with a space
+		limit = icalLineLength - 1
+	}
+	builder.WriteString(line)
+	builder.WriteString("\r\n")
+}
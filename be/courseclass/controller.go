@@ -0,0 +1,116 @@
+package courseclass
+
+import (
+	"HNLP/be/internal/auth"
+	"HNLP/be/internal/db"
+	"HNLP/be/internal/middleware"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"strings"
+)
+
+// calendarFeedPath is the path of the calendar feeds, followed by the token and ".ics"
+const calendarFeedPath = "/api/v1/schedule/feed/"
+
+type Controller struct {
+	service Service
+}
+
+func NewController(service Service) *Controller {
+	return &Controller{service: service}
+}
+
+// GetMySchedule returns the schedule of the caller, e.g. /api/v1/schedule?semester=2024-2025-1&date=2024-10-15
+func (c *Controller) GetMySchedule(ctx *gin.Context) {
+	var request GetMyScheduleRequest
+	if err := ctx.ShouldBindQuery(&request); err != nil {
+		ctx.JSON(400, gin.H{"error": "invalid request"})
+		return
+	}
+
+	response, err := c.service.GetMySchedule(middleware.RequestContext(ctx), request)
+	if err != nil {
+		c.writeError(ctx, err)
+		return
+	}
+	ctx.JSON(200, response)
+}
+
+// ExportCalendar returns the schedule of the caller as an iCalendar file, e.g. /api/v1/schedule/calendar.ics?semester=2024-2025-1
+func (c *Controller) ExportCalendar(ctx *gin.Context) {
+	var request ExportCalendarRequest
+	if err := ctx.ShouldBindQuery(&request); err != nil {
+		ctx.JSON(400, gin.H{"error": "invalid request"})
+		return
+	}
+
+	calendar, err := c.service.ExportCalendar(middleware.RequestContext(ctx), request)
+	if err != nil {
+		c.writeError(ctx, err)
+		return
+	}
+	ctx.Header("Content-Disposition", `attachment; filename="schedule.ics"`)
+	ctx.Data(200, "text/calendar; charset=utf-8", calendar)
+}
+
+// CreateCalendarFeed returns the URL of a new calendar feed of the caller to subscribe to in a calendar app,
+// the previous feed of the caller stops working
+func (c *Controller) CreateCalendarFeed(ctx *gin.Context) {
+	token, err := c.service.CreateCalendarFeed(middleware.RequestContext(ctx))
+	if err != nil {
+		c.writeError(ctx, err)
+		return
+	}
+	ctx.JSON(200, CalendarFeedResponse{Token: token, URL: calendarFeedPath + token + ".ics"})
+}
+
+// RevokeCalendarFeed revokes the calendar feed of the caller
+func (c *Controller) RevokeCalendarFeed(ctx *gin.Context) {
+	if err := c.service.RevokeCalendarFeed(middleware.RequestContext(ctx)); err != nil {
+		c.writeError(ctx, err)
+		return
+	}
+	ctx.Status(204)
+}
+
+// ExportFeedCalendar returns the calendar of a feed without authentication, the token of the URL identifies the user,
+// e.g. /api/v1/schedule/feed/3f9a...c1.ics?semester=2024-2025-1
+func (c *Controller) ExportFeedCalendar(ctx *gin.Context) {
+	var request ExportCalendarRequest
+	if err := ctx.ShouldBindQuery(&request); err != nil {
+		ctx.JSON(400, gin.H{"error": "invalid request"})
+		return
+	}
+
+	token := strings.TrimSuffix(ctx.Param("file"), ".ics")
+	calendar, err := c.service.ExportFeedCalendar(ctx.Request.Context(), token, request)
+	if err != nil {
+		c.writeError(ctx, err)
+		return
+	}
+	ctx.Data(200, "text/calendar; charset=utf-8", calendar)
+}
+
+func (c *Controller) RegisterRoutes(router *gin.Engine, jwtService *auth.ServiceImpl) {
+	router.GET("/api/v1/schedule", middleware.Authenticate(jwtService), c.GetMySchedule)
+	// A one-off download, the calendar apps subscribe to the feed instead
+	router.GET("/api/v1/schedule/calendar.ics", middleware.Authenticate(jwtService), c.ExportCalendar)
+	router.POST("/api/v1/schedule/feed", middleware.Authenticate(jwtService), c.CreateCalendarFeed)
+	router.DELETE("/api/v1/schedule/feed", middleware.Authenticate(jwtService), c.RevokeCalendarFeed)
+	router.GET(calendarFeedPath+":file", c.ExportFeedCalendar)
+}
+
+// ------------------Private helper function------------------
+
+func (c *Controller) writeError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrNoSchedule), errors.Is(err, db.ErrForbidden):
+		ctx.JSON(403, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrOutsideSemester), errors.Is(err, ErrInvalidDate):
+		ctx.JSON(400, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrInvalidFeedToken):
+		ctx.JSON(404, gin.H{"error": err.Error()})
+	default:
+		ctx.JSON(500, gin.H{"error": "failed to get the schedule"})
+	}
+}
@@ -1,16 +1,97 @@
 package courseclass
 
-import "context"
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrNoSchedule is returned for the callers who are neither a student nor a professor
+	ErrNoSchedule = errors.New("only the students and the professors have a schedule")
+	// ErrOutsideSemester is returned for a week or a date outside the semester
+	ErrOutsideSemester = errors.New("outside the semester")
+	// ErrInvalidDate is returned for a date which isn't like 2024-10-15
+	ErrInvalidDate = errors.New("invalid date")
+	// ErrInvalidFeedToken is returned for a calendar feed token which doesn't exist or was revoked
+	ErrInvalidFeedToken = errors.New("invalid calendar feed token")
+)
 
 type CourseClass struct {
 	ID         int    `json:"id" db:"id"`
 	Code       string `json:"code" db:"code"`
 	CourseID   int    `json:"course_id" db:"course_id"`
-	SemesterID int    `json:"semester_id" db:"semester_id"`
+	SemesterID string `json:"semester_id" db:"semester_id"`
+}
+
+// ClassSchedule is a weekly session of a course class, Instructors are the names of its professors.
+// StartTime and EndTime are the clock times of its lesson range like "09:00".
+type ClassSchedule struct {
+	ID            int     `json:"-" db:"id"`
+	CourseClassID int     `json:"-" db:"course_class_id"`
+	DayOfWeek     string  `json:"day_of_week" db:"day_of_week"`
+	LessonRange   *string `json:"lesson_range,omitempty" db:"lesson_range"`
+	SessionType   *string `json:"session_type,omitempty" db:"session_type"`
+	Group         *string `json:"group,omitempty" db:"group_identifier"`
+	Location      string  `json:"location" db:"location"`
+	Instructors   string  `json:"instructors,omitempty" db:"instructors"`
+	StartTime     string  `json:"start_time,omitempty" db:"-"`
+	EndTime       string  `json:"end_time,omitempty" db:"-"`
+}
+
+// ClassInfo is a course class with its course and its weekly sessions
+type ClassInfo struct {
+	ID         int             `json:"-" db:"id"`
+	Code       string          `json:"code" db:"code"`
+	Semester   string          `json:"semester" db:"semester_id"`
+	CourseCode string          `json:"course_code" db:"course_code"`
+	CourseName string          `json:"course_name" db:"course_name"`
+	Schedules  []ClassSchedule `json:"schedules" db:"-"`
+}
+
+// ScheduleEntry is a session of the schedule of a user, Date is set for the schedule of a week
+type ScheduleEntry struct {
+	ClassSchedule
+	ClassCode  string `json:"class_code" db:"class_code"`
+	CourseCode string `json:"course_code" db:"course_code"`
+	CourseName string `json:"course_name" db:"course_name"`
+	Date       string `json:"date,omitempty" db:"-"`
+}
+
+// ClassStudent is a student enrolled in a course class
+type ClassStudent struct {
+	ID                  int     `json:"id" db:"id"`
+	Code                string  `json:"code" db:"code"`
+	Name                string  `json:"name" db:"name"`
+	Email               *string `json:"email,omitempty" db:"email"`
+	AdministrativeClass *string `json:"administrative_class,omitempty" db:"administrative_class"`
+	EnrollmentType      *string `json:"enrollment_type,omitempty" db:"enrollment_type"`
 }
 
 type Repository interface {
 	GetByCode(ctx context.Context, code string) (CourseClass, error)
+	// FindClasses returns the classes of the semesters whose course has the code or a name containing the course
+	FindClasses(ctx context.Context, course string, semesters []string) ([]ClassInfo, error)
+	// GetClass returns the class with the code in the semester
+	GetClass(ctx context.Context, code string, semester string) (ClassInfo, error)
+	// GetSchedules returns the weekly sessions of the classes
+	GetSchedules(ctx context.Context, classIds []int) ([]ClassSchedule, error)
+	GetScheduleOfStudent(ctx context.Context, studentId int, semester string) ([]ScheduleEntry, error)
+	GetScheduleOfProfessor(ctx context.Context, professorId int, semester string) ([]ScheduleEntry, error)
+	// TeachesClass reports whether the professor teaches a session of the class
+	TeachesClass(ctx context.Context, professorId int, classId int) (bool, error)
+	GetStudentsOfClass(ctx context.Context, classId int) ([]ClassStudent, error)
+	// SaveCalendarFeed stores the hash of the calendar feed token of the user, replacing their previous feed
+	SaveCalendarFeed(ctx context.Context, tokenHash string, feed CalendarFeed) error
+	// GetCalendarFeed returns the feed of the token hash
+	GetCalendarFeed(ctx context.Context, tokenHash string) (CalendarFeed, error)
+	DeleteCalendarFeed(ctx context.Context, userId int) error
+}
+
+// CalendarFeed is the owner of a calendar feed token, the calendar apps read the feed without authenticating
+type CalendarFeed struct {
+	UserID     int    `db:"user_id"`
+	Role       string `db:"role"`
+	SpecificID int    `db:"specific_id"`
 }
 
 type GetCourseClassRequest struct {
@@ -21,6 +102,67 @@ type GetCourseClassResponse struct {
 	CourseClass CourseClass `json:"course_class"`
 }
 
+type FindCourseClassesRequest struct {
+	Course   string `json:"course" jsonschema:"description=Code or name of the course,example=INT3306,minLength=1"`
+	Semester string `json:"semester,omitempty" jsonschema:"description=A semester code like 2024-2025-1 or the words of the user like 'kỳ sau', the current semester by default"`
+}
+
+type FindCourseClassesResponse struct {
+	Classes []ClassInfo `json:"classes"`
+}
+
+type ListStudentsInClassRequest struct {
+	ClassCode string `json:"class_code" jsonschema:"description=Code of the course class,example=INT3306 1,minLength=1"`
+	Semester  string `json:"semester,omitempty" jsonschema:"description=A semester code like 2024-2025-1 or the words of the user like 'kỳ trước', the current semester by default"`
+}
+
+type ListStudentsInClassResponse struct {
+	Class    ClassInfo      `json:"class"`
+	Students []ClassStudent `json:"students"`
+}
+
+type GetMyScheduleRequest struct {
+	Semester string `json:"semester,omitempty" form:"semester" jsonschema:"description=A semester code like 2024-2025-1 or the words of the user like 'kỳ này', the current semester by default"`
+	Week     *int   `json:"week,omitempty" form:"week" jsonschema:"description=Week of the semester starting from 1 to get the sessions with their dates, the weekly timetable if omitted,minimum=1"`
+	Date     string `json:"date,omitempty" form:"date" jsonschema:"description=A date of the semester like 2024-10-15 to get the sessions of that day, e.g. for 'what do I have on Tuesday?',format=date"`
+}
+
+// Conflict is a pair of sessions of the schedule overlapping on the same day
+type Conflict struct {
+	First  ScheduleEntry `json:"first"`
+	Second ScheduleEntry `json:"second"`
+}
+
+type GetMyScheduleResponse struct {
+	Semester  string          `json:"semester"`
+	Week      *int            `json:"week,omitempty"`
+	WeekStart string          `json:"week_start,omitempty"`
+	WeekEnd   string          `json:"week_end,omitempty"`
+	Date      string          `json:"date,omitempty"`
+	Sessions  []ScheduleEntry `json:"sessions"`
+	Conflicts []Conflict      `json:"conflicts,omitempty"`
+}
+
+type ExportCalendarRequest struct {
+	Semester string `form:"semester"`
+}
+
 type Service interface {
 	GetCourseClass(ctx context.Context, req GetCourseClassRequest) (*GetCourseClassResponse, error)
+	FindCourseClasses(ctx context.Context, req FindCourseClassesRequest) (FindCourseClassesResponse, error)
+	ListStudentsInClass(ctx context.Context, req ListStudentsInClassRequest) (ListStudentsInClassResponse, error)
+	GetMySchedule(ctx context.Context, req GetMyScheduleRequest) (GetMyScheduleResponse, error)
+	// ExportCalendar returns the weekly sessions of the caller in a semester as an iCalendar feed
+	ExportCalendar(ctx context.Context, req ExportCalendarRequest) ([]byte, error)
+	// CreateCalendarFeed returns a new secret token of the calendar feed of the caller, revoking the previous one
+	CreateCalendarFeed(ctx context.Context) (string, error)
+	RevokeCalendarFeed(ctx context.Context) error
+	// ExportFeedCalendar is ExportCalendar for the owner of the feed token
+	ExportFeedCalendar(ctx context.Context, token string, req ExportCalendarRequest) ([]byte, error)
+}
+
+type CalendarFeedResponse struct {
+	Token string `json:"token"`
+	// URL is the path of the feed to subscribe to in the calendar apps
+	URL string `json:"url"`
 }
@@ -0,0 +1,150 @@
+package courseclass
+
+import (
+	"HNLP/be/internal/db"
+	"context"
+	"github.com/lib/pq"
+)
+
+// scheduleColumns are the columns of a ScheduleEntry, the query joins ccs (course_class_schedule),
+// cc (course_class) and c (course)
+const scheduleColumns = `ccs.id,
+       ccs.course_class_id,
+       ccs.day_of_week,
+       ccs.lesson_range,
+       ccs.session_type,
+       ccs.group_identifier,
+       ccs.location,
+       COALESCE((SELECT string_agg(p.name, ', ' ORDER BY p.name)
+                 FROM course_schedule_instructor i
+                          JOIN professor p ON p.id = i.professor_id
+                 WHERE i.course_class_schedule_id = ccs.id), '') AS instructors,
+       cc.code                                                    AS class_code,
+       c.code                                                     AS course_code,
+       COALESCE(c.name, '')                                       AS course_name`
+
+type RepositoryImpl struct {
+	db db.HDb
+}
+
+func NewRepositoryImpl(db db.HDb) *RepositoryImpl {
+	return &RepositoryImpl{db: db}
+}
+
+func (r *RepositoryImpl) GetByCode(ctx context.Context, code string) (CourseClass, error) {
+	var courseClass CourseClass
+	err := r.db.GetContext(ctx, &courseClass, "SELECT id, code, course_id, semester_id FROM course_class WHERE code = $1 ORDER BY semester_id DESC LIMIT 1", code)
+	return courseClass, err
+}
+
+func (r *RepositoryImpl) FindClasses(ctx context.Context, course string, semesters []string) ([]ClassInfo, error) {
+	var classes []ClassInfo
+	err := r.db.SelectContext(ctx, &classes, `SELECT cc.id, cc.code, cc.semester_id, c.code AS course_code, COALESCE(c.name, '') AS course_name
+FROM course_class cc
+         JOIN course c ON c.id = cc.course_id
+WHERE cc.semester_id = ANY ($1)
+  AND (c.code ILIKE $2 OR c.name ILIKE '%' || $2 || '%' OR c.english_name ILIKE '%' || $2 || '%')
+ORDER BY cc.semester_id, cc.code`, pq.Array(semesters), course)
+	return classes, err
+}
+
+func (r *RepositoryImpl) GetClass(ctx context.Context, code string, semester string) (ClassInfo, error) {
+	var class ClassInfo
+	err := r.db.GetContext(ctx, &class, `SELECT cc.id, cc.code, cc.semester_id, c.code AS course_code, COALESCE(c.name, '') AS course_name
+FROM course_class cc
+         JOIN course c ON c.id = cc.course_id
+WHERE cc.code = $1
+  AND cc.semester_id = $2`, code, semester)
+	return class, err
+}
+
+func (r *RepositoryImpl) GetSchedules(ctx context.Context, classIds []int) ([]ClassSchedule, error) {
+	var schedules []ClassSchedule
+	err := r.db.SelectContext(ctx, &schedules, `SELECT ccs.id,
+       ccs.course_class_id,
+       ccs.day_of_week,
+       ccs.lesson_range,
+       ccs.session_type,
+       ccs.group_identifier,
+       ccs.location,
+       COALESCE(string_agg(p.name, ', ' ORDER BY p.name), '') AS instructors
+FROM course_class_schedule ccs
+         LEFT JOIN course_schedule_instructor csi ON csi.course_class_schedule_id = ccs.id
+         LEFT JOIN professor p ON p.id = csi.professor_id
+WHERE ccs.course_class_id = ANY ($1)
+GROUP BY ccs.id
+ORDER BY ccs.course_class_id, ccs.id`, pq.Array(classIds))
+	return schedules, err
+}
+
+func (r *RepositoryImpl) GetScheduleOfStudent(ctx context.Context, studentId int, semester string) ([]ScheduleEntry, error) {
+	var entries []ScheduleEntry
+	err := r.db.SelectContext(ctx, &entries, `SELECT `+scheduleColumns+`
+FROM student_course_class_schedule sccs
+         JOIN course_class_enrollment cce ON cce.id = sccs.course_class_enrollment_id
+         JOIN course_class_schedule ccs ON ccs.id = sccs.course_class_schedule_id
+         JOIN course_class cc ON cc.id = ccs.course_class_id
+         JOIN course c ON c.id = cc.course_id
+WHERE cce.student_id = $1
+  AND cc.semester_id = $2`, studentId, semester)
+	return entries, err
+}
+
+func (r *RepositoryImpl) GetScheduleOfProfessor(ctx context.Context, professorId int, semester string) ([]ScheduleEntry, error) {
+	var entries []ScheduleEntry
+	err := r.db.SelectContext(ctx, &entries, `SELECT `+scheduleColumns+`
+FROM course_schedule_instructor csi
+         JOIN course_class_schedule ccs ON ccs.id = csi.course_class_schedule_id
+         JOIN course_class cc ON cc.id = ccs.course_class_id
+         JOIN course c ON c.id = cc.course_id
+WHERE csi.professor_id = $1
+  AND cc.semester_id = $2`, professorId, semester)
+	return entries, err
+}
+
+func (r *RepositoryImpl) TeachesClass(ctx context.Context, professorId int, classId int) (bool, error) {
+	var teaches bool
+	err := r.db.GetContext(ctx, &teaches, `SELECT EXISTS (SELECT 1
+               FROM course_class_schedule ccs
+                        JOIN course_schedule_instructor csi ON csi.course_class_schedule_id = ccs.id
+               WHERE ccs.course_class_id = $2
+                 AND csi.professor_id = $1)`, professorId, classId)
+	return teaches, err
+}
+
+func (r *RepositoryImpl) GetStudentsOfClass(ctx context.Context, classId int) ([]ClassStudent, error) {
+	var students []ClassStudent
+	err := r.db.SelectContext(ctx, &students, `SELECT s.id,
+       s.code,
+       COALESCE(s.name, '') AS name,
+       s.email,
+       ac.name              AS administrative_class,
+       cce.enrollment_type
+FROM course_class_enrollment cce
+         JOIN student s ON s.id = cce.student_id
+         LEFT JOIN administrative_class ac ON ac.id = s.administrative_class_id
+WHERE cce.course_class_id = $1
+ORDER BY s.code`, classId)
+	return students, err
+}
+
+func (r *RepositoryImpl) SaveCalendarFeed(ctx context.Context, tokenHash string, feed CalendarFeed) error {
+	_, err := r.db.ExecContext(ctx, `INSERT INTO calendar_feed (user_id, token_hash, role, specific_id)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id) DO UPDATE SET token_hash  = EXCLUDED.token_hash,
+                                    role        = EXCLUDED.role,
+                                    specific_id = EXCLUDED.specific_id,
+                                    created_at  = NOW()`, feed.UserID, tokenHash, feed.Role, feed.SpecificID)
+	return err
+}
+
+func (r *RepositoryImpl) GetCalendarFeed(ctx context.Context, tokenHash string) (CalendarFeed, error) {
+	var feed CalendarFeed
+	err := r.db.GetContext(ctx, &feed, "SELECT user_id, role, specific_id FROM calendar_feed WHERE token_hash = $1", tokenHash)
+	return feed, err
+}
+
+func (r *RepositoryImpl) DeleteCalendarFeed(ctx context.Context, userId int) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM calendar_feed WHERE user_id = $1", userId)
+	return err
+}
@@ -1,48 +1,48 @@
 package courseclass
 
 import (
-	"HNLP/be/internal/course"
 	"HNLP/be/internal/db"
-)
-
-import (
+	"HNLP/be/internal/semester"
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// dayOffsets are the days after Monday of the values of course_class_schedule.day_of_week
+var dayOffsets = map[string]int{"2": 0, "3": 1, "4": 2, "5": 3, "6": 4, "7": 5, "8": 6, "cn": 6}
+
 type ServiceImpl struct {
-	courseService course.Service
-	repo          Repository
-	authService   db.AuthorizationServiceImpl
+	repo        Repository
+	semesterSrv semester.Service
+	timetable   *Timetable
+	// policy masks the columns of the students read outside of ExecuteQuery
+	policy *db.AuthorizationPolicy
+	// now returns the current time, it is replaced in the tests
+	now func() time.Time
 }
 
-func NewServiceImpl(repo Repository, courseService course.Service) *ServiceImpl {
+func NewServiceImpl(repo Repository, semesterSrv semester.Service, timetable *Timetable, policy *db.AuthorizationPolicy) *ServiceImpl {
 	return &ServiceImpl{
-		repo:          repo,
-		courseService: courseService,
+		repo:        repo,
+		semesterSrv: semesterSrv,
+		timetable:   timetable,
+		policy:      policy,
+		now:         time.Now,
 	}
 }
 
 func (s *ServiceImpl) GetCourseClass(ctx context.Context, req GetCourseClassRequest) (*GetCourseClassResponse, error) {
-	var courseClass CourseClass
-	var err error
-	// Get User ID from context
-	userID := ctx.Value("userID").(int)
-	if userID == 0 {
-		return nil, errors.New("user not found")
-	}
-	role := ctx.Value("role").(string)
-	if role == "" {
+	if db.CallerFrom(ctx).Role == "" {
 		return nil, errors.New("role not found")
 	}
 
-	// Try ID first if provided
 	if req.Code != nil {
-		courseClass, err = s.repo.GetByCode(ctx, *req.Code)
-
-		if role == "student" {
-		}
-
+		courseClass, err := s.repo.GetByCode(ctx, *req.Code)
 		if err == nil {
 			return &GetCourseClassResponse{
 				CourseClass: courseClass,
@@ -53,3 +53,267 @@ func (s *ServiceImpl) GetCourseClass(ctx context.Context, req GetCourseClassRequ
 	// If we reach here, no course class was found
 	return nil, errors.New("course class not found")
 }
+
+// FindCourseClasses returns the classes of a course in the semesters with their sessions and professors,
+// a year expression like "năm học 2024-2025" covers all its semesters
+func (s *ServiceImpl) FindCourseClasses(ctx context.Context, req FindCourseClassesRequest) (FindCourseClassesResponse, error) {
+	semesters, err := s.resolveSemesters(ctx, req.Semester)
+	if err != nil {
+		return FindCourseClassesResponse{}, err
+	}
+	codes := make([]string, 0, len(semesters))
+	for _, sem := range semesters {
+		codes = append(codes, sem.Code)
+	}
+
+	classes, err := s.repo.FindClasses(ctx, strings.TrimSpace(req.Course), codes)
+	if err != nil {
+		return FindCourseClassesResponse{}, err
+	}
+	if err := s.attachSchedules(ctx, classes); err != nil {
+		return FindCourseClassesResponse{}, err
+	}
+	if classes == nil {
+		classes = []ClassInfo{}
+	}
+	return FindCourseClassesResponse{Classes: classes}, nil
+}
+
+// ListStudentsInClass returns the students enrolled in a class, the professors can only list the classes they teach
+func (s *ServiceImpl) ListStudentsInClass(ctx context.Context, req ListStudentsInClassRequest) (ListStudentsInClassResponse, error) {
+	sem, err := s.resolveSemester(ctx, req.Semester)
+	if err != nil {
+		return ListStudentsInClassResponse{}, err
+	}
+	class, err := s.repo.GetClass(ctx, req.ClassCode, sem.Code)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ListStudentsInClassResponse{}, fmt.Errorf("class %s not found in the semester %s", req.ClassCode, sem.Code)
+	}
+	if err != nil {
+		return ListStudentsInClassResponse{}, err
+	}
+
+	caller := db.CallerFrom(ctx)
+	switch caller.Role {
+	case "admin":
+	case "professor":
+		teaches, err := s.repo.TeachesClass(ctx, caller.SpecificID, class.ID)
+		if err != nil {
+			return ListStudentsInClassResponse{}, err
+		}
+		if !teaches {
+			return ListStudentsInClassResponse{}, db.ErrForbidden
+		}
+	default:
+		return ListStudentsInClassResponse{}, db.ErrForbidden
+	}
+
+	students, err := s.repo.GetStudentsOfClass(ctx, class.ID)
+	if err != nil {
+		return ListStudentsInClassResponse{}, err
+	}
+	if students == nil {
+		students = []ClassStudent{}
+	}
+	for i := range students {
+		students[i].Email = s.policy.MaskValue("student", caller.Role, "email", students[i].Email)
+	}
+	class.Schedules = []ClassSchedule{}
+	return ListStudentsInClassResponse{Class: class, Students: students}, nil
+}
+
+// GetMySchedule returns the weekly timetable of the caller in a semester, the classes they attend for a student
+// and the classes they teach for a professor. With a week, the sessions of the week are returned with their dates,
+// with a date only the sessions of that day. The sessions overlapping on the same day are reported as conflicts.
+func (s *ServiceImpl) GetMySchedule(ctx context.Context, req GetMyScheduleRequest) (GetMyScheduleResponse, error) {
+	sem, err := s.resolveSemester(ctx, req.Semester)
+	if err != nil {
+		return GetMyScheduleResponse{}, err
+	}
+	entries, err := s.scheduleOf(ctx, sem)
+	if err != nil {
+		return GetMyScheduleResponse{}, err
+	}
+
+	response := GetMyScheduleResponse{Semester: sem.Code, Sessions: []ScheduleEntry{}}
+	if strings.TrimSpace(req.Date) != "" {
+		date, err := time.Parse(semester.DateLayout, strings.TrimSpace(req.Date))
+		if err != nil {
+			return GetMyScheduleResponse{}, fmt.Errorf("%w %q, a date like 2024-10-15 is expected", ErrInvalidDate, req.Date)
+		}
+		if !sem.Contains(date) {
+			return GetMyScheduleResponse{}, fmt.Errorf("%w: %s isn't in the semester %s", ErrOutsideSemester, req.Date, sem.Code)
+		}
+		week := weekOf(sem, date)
+		req.Week = &week
+		response.Date = date.Format(semester.DateLayout)
+	}
+	if req.Week == nil {
+		if entries != nil {
+			response.Sessions = entries
+		}
+		response.Conflicts = s.findConflicts(response.Sessions)
+		return response, nil
+	}
+
+	weekStart := weekStartOf(sem, *req.Week)
+	if *req.Week < 1 || weekStart.After(sem.EndDate) {
+		return GetMyScheduleResponse{}, fmt.Errorf("%w: the semester %s only has %d weeks", ErrOutsideSemester, sem.Code, weekCount(sem))
+	}
+	response.Week = req.Week
+	response.WeekStart = weekStart.Format(semester.DateLayout)
+	response.WeekEnd = weekStart.AddDate(0, 0, 6).Format(semester.DateLayout)
+	for _, entry := range entries {
+		offset, ok := dayOffset(entry.DayOfWeek)
+		if !ok {
+			continue
+		}
+		// The first and the last weeks may be partly outside the semester
+		date := weekStart.AddDate(0, 0, offset)
+		if !sem.Contains(date) {
+			continue
+		}
+		entry.Date = date.Format(semester.DateLayout)
+		if response.Date != "" && entry.Date != response.Date {
+			continue
+		}
+		response.Sessions = append(response.Sessions, entry)
+	}
+	response.Conflicts = s.findConflicts(response.Sessions)
+	return response, nil
+}
+
+// ------------------Private helper function------------------
+
+// resolveSemesters resolves the semester expression of the user, the current semester if it is empty
+func (s *ServiceImpl) resolveSemesters(ctx context.Context, expression string) ([]semester.Semester, error) {
+	if strings.TrimSpace(expression) == "" {
+		current, err := s.semesterSrv.GetCurrentSemester(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return []semester.Semester{current}, nil
+	}
+	resolved, err := s.semesterSrv.ResolveSemester(ctx, semester.ResolveSemesterRequest{Expression: expression})
+	if err != nil {
+		return nil, err
+	}
+	return resolved.Semesters, nil
+}
+
+// resolveSemester resolves an expression which must be a single semester
+func (s *ServiceImpl) resolveSemester(ctx context.Context, expression string) (semester.Semester, error) {
+	semesters, err := s.resolveSemesters(ctx, expression)
+	if err != nil {
+		return semester.Semester{}, err
+	}
+	if len(semesters) != 1 {
+		return semester.Semester{}, fmt.Errorf("%q is %d semesters, a single semester is expected", expression, len(semesters))
+	}
+	return semesters[0], nil
+}
+
+// scheduleOf returns the weekly sessions of the caller in the semester with their clock times, ordered by day and lesson
+func (s *ServiceImpl) scheduleOf(ctx context.Context, sem semester.Semester) ([]ScheduleEntry, error) {
+	var entries []ScheduleEntry
+	var err error
+	caller := db.CallerFrom(ctx)
+	switch caller.Role {
+	case "student":
+		entries, err = s.repo.GetScheduleOfStudent(ctx, caller.SpecificID, sem.Code)
+	case "professor":
+		entries, err = s.repo.GetScheduleOfProfessor(ctx, caller.SpecificID, sem.Code)
+	default:
+		return nil, ErrNoSchedule
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		s.timetable.annotate(&entries[i].ClassSchedule)
+	}
+	sortSessions(entries)
+	return entries, nil
+}
+
+// findConflicts returns the pairs of sessions overlapping on the same day, the sessions without clock times are ignored
+func (s *ServiceImpl) findConflicts(entries []ScheduleEntry) []Conflict {
+	var conflicts []Conflict
+	for i := range entries {
+		for j := i + 1; j < len(entries); j++ {
+			if entries[i].Date == entries[j].Date && s.timetable.Overlaps(entries[i].ClassSchedule, entries[j].ClassSchedule) {
+				conflicts = append(conflicts, Conflict{First: entries[i], Second: entries[j]})
+			}
+		}
+	}
+	return conflicts
+}
+
+// attachSchedules loads the sessions of the classes
+func (s *ServiceImpl) attachSchedules(ctx context.Context, classes []ClassInfo) error {
+	if len(classes) == 0 {
+		return nil
+	}
+	ids := make([]int, 0, len(classes))
+	for _, class := range classes {
+		ids = append(ids, class.ID)
+	}
+	schedules, err := s.repo.GetSchedules(ctx, ids)
+	if err != nil {
+		return err
+	}
+	byClass := make(map[int][]ClassSchedule, len(classes))
+	for _, schedule := range schedules {
+		s.timetable.annotate(&schedule)
+		byClass[schedule.CourseClassID] = append(byClass[schedule.CourseClassID], schedule)
+	}
+	for i := range classes {
+		classes[i].Schedules = byClass[classes[i].ID]
+		if classes[i].Schedules == nil {
+			classes[i].Schedules = []ClassSchedule{}
+		}
+	}
+	return nil
+}
+
+// weekStartOf returns the Monday of the week of the semester, the first week is the one of the start date
+func weekStartOf(sem semester.Semester, week int) time.Time {
+	sinceMonday := (int(sem.StartDate.Weekday()) + 6) % 7
+	return sem.StartDate.AddDate(0, 0, 7*(week-1)-sinceMonday)
+}
+
+// weekOf returns the week of the semester of a date
+func weekOf(sem semester.Semester, date time.Time) int {
+	return int(date.Sub(weekStartOf(sem, 1)).Hours()/24)/7 + 1
+}
+
+func weekCount(sem semester.Semester) int {
+	return weekOf(sem, sem.EndDate)
+}
+
+// sortSessions orders the sessions by day then by their first lesson, "10-11" comes after "3-4"
+func sortSessions(entries []ScheduleEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		dayI, _ := dayOffset(entries[i].DayOfWeek)
+		dayJ, _ := dayOffset(entries[j].DayOfWeek)
+		if dayI != dayJ {
+			return dayI < dayJ
+		}
+		return firstLesson(entries[i].LessonRange) < firstLesson(entries[j].LessonRange)
+	})
+}
+
+// dayOffset returns the days after Monday of a day of week like "2" for Monday or "CN" for Sunday
+func dayOffset(dayOfWeek string) (int, bool) {
+	offset, ok := dayOffsets[strings.ToLower(strings.TrimSpace(dayOfWeek))]
+	return offset, ok
+}
+
+func firstLesson(lessonRange *string) int {
+	if lessonRange == nil {
+		return 0
+	}
+	first, _, _ := strings.Cut(*lessonRange, "-")
+	lesson, _ := strconv.Atoi(strings.TrimSpace(first))
+	return lesson
+}
@@ -1,8 +1,21 @@
 package courseclass
 
 import (
+	"HNLP/be/internal/config"
 	"HNLP/be/internal/course"
+	"HNLP/be/internal/db"
+	"HNLP/be/internal/semester"
+	"HNLP/be/internal/testutil"
 	"context"
+	"database/sql"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
 )
 
 type MockCourseService struct {
@@ -19,3 +32,359 @@ func (m *MockCourseService) GetCourse(ctx context.Context, req course.GetCourseR
 		EnglishName: "Computer Science 101",
 	}, nil
 }
+
+// MockRepository implements the Repository interface for testing
+type MockRepository struct {
+	mock.Mock
+}
+
+func (m *MockRepository) GetByCode(ctx context.Context, code string) (CourseClass, error) {
+	args := m.Called(ctx, code)
+	return args.Get(0).(CourseClass), args.Error(1)
+}
+
+func (m *MockRepository) FindClasses(ctx context.Context, course string, semesters []string) ([]ClassInfo, error) {
+	args := m.Called(ctx, course, semesters)
+	return args.Get(0).([]ClassInfo), args.Error(1)
+}
+
+func (m *MockRepository) GetClass(ctx context.Context, code string, semester string) (ClassInfo, error) {
+	args := m.Called(ctx, code, semester)
+	return args.Get(0).(ClassInfo), args.Error(1)
+}
+
+func (m *MockRepository) GetSchedules(ctx context.Context, classIds []int) ([]ClassSchedule, error) {
+	args := m.Called(ctx, classIds)
+	return args.Get(0).([]ClassSchedule), args.Error(1)
+}
+
+func (m *MockRepository) GetScheduleOfStudent(ctx context.Context, studentId int, semester string) ([]ScheduleEntry, error) {
+	args := m.Called(ctx, studentId, semester)
+	return args.Get(0).([]ScheduleEntry), args.Error(1)
+}
+
+func (m *MockRepository) GetScheduleOfProfessor(ctx context.Context, professorId int, semester string) ([]ScheduleEntry, error) {
+	args := m.Called(ctx, professorId, semester)
+	return args.Get(0).([]ScheduleEntry), args.Error(1)
+}
+
+func (m *MockRepository) TeachesClass(ctx context.Context, professorId int, classId int) (bool, error) {
+	args := m.Called(ctx, professorId, classId)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) GetStudentsOfClass(ctx context.Context, classId int) ([]ClassStudent, error) {
+	args := m.Called(ctx, classId)
+	return args.Get(0).([]ClassStudent), args.Error(1)
+}
+
+func (m *MockRepository) SaveCalendarFeed(ctx context.Context, tokenHash string, feed CalendarFeed) error {
+	args := m.Called(ctx, tokenHash, feed)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetCalendarFeed(ctx context.Context, tokenHash string) (CalendarFeed, error) {
+	args := m.Called(ctx, tokenHash)
+	return args.Get(0).(CalendarFeed), args.Error(1)
+}
+
+func (m *MockRepository) DeleteCalendarFeed(ctx context.Context, userId int) error {
+	args := m.Called(ctx, userId)
+	return args.Error(0)
+}
+
+var (
+	// The semester starts on a Sunday
+	testSemester = semester.Semester{
+		Code:      "2024-2025-1",
+		Name:      "Học kỳ 1 năm học 2024-2025",
+		StartDate: time.Date(2024, time.September, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2025, time.January, 15, 0, 0, 0, 0, time.UTC),
+	}
+	testNextSemester = semester.Semester{
+		Code:      "2024-2025-2",
+		StartDate: time.Date(2025, time.February, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2025, time.June, 30, 0, 0, 0, 0, time.UTC),
+	}
+)
+
+func callerContext(role string, specificId int) context.Context {
+	ctx := context.WithValue(context.Background(), "userRole", role)
+	return context.WithValue(ctx, "specificId", specificId)
+}
+
+func newTestService(repo *MockRepository) *ServiceImpl {
+	semesterSrv := &testutil.MockSemesterService{}
+	semesterSrv.On("GetCurrentSemester", mock.Anything).Return(testSemester, nil)
+	semesterSrv.On("ResolveSemester", mock.Anything, semester.ResolveSemesterRequest{Expression: "kỳ sau"}).
+		Return(semester.ResolveSemesterResponse{Semesters: []semester.Semester{testNextSemester}, Current: testSemester}, nil)
+	semesterSrv.On("ResolveSemester", mock.Anything, semester.ResolveSemesterRequest{Expression: "năm học 2024-2025"}).
+		Return(semester.ResolveSemesterResponse{Semesters: []semester.Semester{testSemester, testNextSemester}, Current: testSemester}, nil)
+	timetable, err := NewTimetable(config.ScheduleConfig{})
+	if err != nil {
+		panic(err)
+	}
+	service := NewServiceImpl(repo, semesterSrv, timetable, db.DefaultAuthorizationPolicy())
+	service.now = func() time.Time { return time.Date(2024, time.August, 20, 3, 0, 0, 0, time.UTC) }
+	return service
+}
+
+// session returns a session of the schedule, the lessons of the default timetable start every hour from 07:00
+func session(day string, lessons string, class string) ScheduleEntry {
+	entry := ScheduleEntry{ClassSchedule: ClassSchedule{DayOfWeek: day, LessonRange: &lessons, Location: "208-GĐ3"}, ClassCode: class}
+	first, last := firstLesson(&lessons), firstLesson(&lessons)
+	if _, end, ok := strings.Cut(lessons, "-"); ok {
+		last, _ = strconv.Atoi(end)
+	}
+	entry.StartTime = fmt.Sprintf("%02d:00", 6+first)
+	entry.EndTime = fmt.Sprintf("%02d:50", 6+last)
+	return entry
+}
+
+func TestServiceImpl_GetMySchedule(t *testing.T) {
+	entries := []ScheduleEntry{session("CN", "1-2", "INT3401 1"), session("3", "10-11", "INT3306 1"), session("3", "3-4", "MAT1093 2"), session("2", "7-8", "INT2210 1")}
+
+	tests := []struct {
+		name      string
+		week      *int
+		expected  []ScheduleEntry
+		weekStart string
+		errSubstr string
+	}{
+		{
+			name:     "Weekly timetable in order",
+			expected: []ScheduleEntry{session("2", "7-8", "INT2210 1"), session("3", "3-4", "MAT1093 2"), session("3", "10-11", "INT3306 1"), session("CN", "1-2", "INT3401 1")},
+		},
+		{
+			// The first week starts on the Monday before the start of the semester, only its Sunday is in the semester
+			name:      "First week",
+			week:      intPtr(1),
+			weekStart: "2024-08-26",
+			expected:  []ScheduleEntry{withDate(session("CN", "1-2", "INT3401 1"), "2024-09-01")},
+		},
+		{
+			name:      "Second week",
+			week:      intPtr(2),
+			weekStart: "2024-09-02",
+			expected: []ScheduleEntry{
+				withDate(session("2", "7-8", "INT2210 1"), "2024-09-02"),
+				withDate(session("3", "3-4", "MAT1093 2"), "2024-09-03"),
+				withDate(session("3", "10-11", "INT3306 1"), "2024-09-03"),
+				withDate(session("CN", "1-2", "INT3401 1"), "2024-09-08"),
+			},
+		},
+		{name: "After the semester", week: intPtr(30), errSubstr: "only has 21 weeks"},
+		{name: "Before the semester", week: intPtr(0), errSubstr: "only has 21 weeks"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &MockRepository{}
+			repo.On("GetScheduleOfStudent", mock.Anything, 5, "2024-2025-1").Return(append([]ScheduleEntry(nil), entries...), nil)
+
+			response, err := newTestService(repo).GetMySchedule(callerContext("student", 5), GetMyScheduleRequest{Week: tt.week})
+			if tt.errSubstr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errSubstr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "2024-2025-1", response.Semester)
+			assert.Equal(t, tt.weekStart, response.WeekStart)
+			assert.Equal(t, tt.expected, response.Sessions)
+		})
+	}
+
+	t.Run("Sessions of a date", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("GetScheduleOfStudent", mock.Anything, 5, "2024-2025-1").Return(append([]ScheduleEntry(nil), entries...), nil)
+
+		response, err := newTestService(repo).GetMySchedule(callerContext("student", 5), GetMyScheduleRequest{Date: "2024-09-03"})
+		require.NoError(t, err)
+		assert.Equal(t, "2024-09-03", response.Date)
+		assert.Equal(t, 2, *response.Week)
+		assert.Equal(t, []ScheduleEntry{
+			withDate(session("3", "3-4", "MAT1093 2"), "2024-09-03"),
+			withDate(session("3", "10-11", "INT3306 1"), "2024-09-03"),
+		}, response.Sessions)
+		assert.Equal(t, "09:00", response.Sessions[0].StartTime)
+		assert.Equal(t, "10:50", response.Sessions[0].EndTime)
+
+		_, err = newTestService(repo).GetMySchedule(callerContext("student", 5), GetMyScheduleRequest{Date: "2025-01-20"})
+		assert.ErrorIs(t, err, ErrOutsideSemester)
+		_, err = newTestService(repo).GetMySchedule(callerContext("student", 5), GetMyScheduleRequest{Date: "thứ 3"})
+		assert.ErrorIs(t, err, ErrInvalidDate)
+	})
+
+	t.Run("Professor of the next semester", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("GetScheduleOfProfessor", mock.Anything, 2, "2024-2025-2").Return([]ScheduleEntry(nil), nil)
+
+		response, err := newTestService(repo).GetMySchedule(callerContext("professor", 2), GetMyScheduleRequest{Semester: "kỳ sau"})
+		require.NoError(t, err)
+		assert.Equal(t, GetMyScheduleResponse{Semester: "2024-2025-2", Sessions: []ScheduleEntry{}}, response)
+	})
+
+	t.Run("Academic year", func(t *testing.T) {
+		_, err := newTestService(&MockRepository{}).GetMySchedule(callerContext("student", 5), GetMyScheduleRequest{Semester: "năm học 2024-2025"})
+		assert.EqualError(t, err, `"năm học 2024-2025" is 2 semesters, a single semester is expected`)
+	})
+
+	t.Run("Admin", func(t *testing.T) {
+		_, err := newTestService(&MockRepository{}).GetMySchedule(callerContext("admin", 1), GetMyScheduleRequest{})
+		assert.ErrorIs(t, err, ErrNoSchedule)
+	})
+}
+
+func TestServiceImpl_GetMySchedule_Conflicts(t *testing.T) {
+	// INT3306 1 shares the lesson 4 with MAT1093 2 and the lesson 5 with INT2210 1, which follows MAT1093 2 without overlapping
+	entries := []ScheduleEntry{session("3", "4-5", "INT3306 1"), session("3", "3-4", "MAT1093 2"), session("3", "5", "INT2210 1"), session("4", "3-4", "INT3401 1")}
+	repo := &MockRepository{}
+	repo.On("GetScheduleOfProfessor", mock.Anything, 2, "2024-2025-1").Return(entries, nil)
+
+	response, err := newTestService(repo).GetMySchedule(callerContext("professor", 2), GetMyScheduleRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, []Conflict{
+		{First: session("3", "3-4", "MAT1093 2"), Second: session("3", "4-5", "INT3306 1")},
+		{First: session("3", "4-5", "INT3306 1"), Second: session("3", "5", "INT2210 1")},
+	}, response.Conflicts)
+
+	response, err = newTestService(repo).GetMySchedule(callerContext("professor", 2), GetMyScheduleRequest{Week: intPtr(2)})
+	require.NoError(t, err)
+	assert.Len(t, response.Conflicts, 2)
+	assert.Equal(t, "2024-09-03", response.Conflicts[0].First.Date)
+}
+
+func TestServiceImpl_ExportCalendar(t *testing.T) {
+	group := "1"
+	entry := session("CN", "1-2", "INT3401 1")
+	entry.ID = 7
+	entry.CourseCode = "INT3401"
+	entry.CourseName = "Trí tuệ nhân tạo"
+	entry.Group = &group
+	entry.Instructors = "Nguyễn Văn Bình, Trần Thị Hoa"
+	repo := &MockRepository{}
+	repo.On("GetScheduleOfStudent", mock.Anything, 5, "2024-2025-1").Return([]ScheduleEntry{entry, session("2", "15-16", "INT2210 1")}, nil)
+
+	calendar, err := newTestService(repo).ExportCalendar(callerContext("student", 5), ExportCalendarRequest{})
+	require.NoError(t, err)
+	content := string(calendar)
+	for _, line := range strings.Split(strings.TrimSuffix(content, "\r\n"), "\r\n") {
+		assert.LessOrEqual(t, len(line), 75)
+	}
+	unfolded := strings.ReplaceAll(content, "\r\n ", "")
+	// The sessions of Sunday start on the first day of the semester at 07:00 in Hanoi
+	assert.Contains(t, unfolded, "BEGIN:VEVENT\r\nUID:schedule-7-2024-2025-1@hnlp\r\nDTSTAMP:20240820T030000Z\r\n"+
+		"DTSTART:20240901T000000Z\r\nDTEND:20240901T015000Z\r\nRRULE:FREQ=WEEKLY;UNTIL=20250115T165959Z\r\n"+
+		"SUMMARY:Trí tuệ nhân tạo (INT3401 1)\r\nLOCATION:208-GĐ3\r\n"+
+		"DESCRIPTION:Môn học: INT3401\\nTiết: 1-2\\nNhóm: 1\\nGiảng viên: Nguyễn Văn Bình\\, Trần Thị Hoa\r\nEND:VEVENT\r\n")
+	// The lessons 15-16 aren't in the timetable
+	assert.Equal(t, 1, strings.Count(content, "BEGIN:VEVENT"))
+	assert.True(t, strings.HasSuffix(content, "END:VCALENDAR\r\n"))
+}
+
+func TestServiceImpl_CalendarFeed(t *testing.T) {
+	repo := &MockRepository{}
+	feed := CalendarFeed{UserID: 12, Role: "student", SpecificID: 5}
+	var tokenHash string
+	repo.On("SaveCalendarFeed", mock.Anything, mock.AnythingOfType("string"), feed).
+		Run(func(args mock.Arguments) { tokenHash = args.String(1) }).Return(nil)
+	repo.On("DeleteCalendarFeed", mock.Anything, 12).Return(nil)
+	repo.On("GetScheduleOfStudent", mock.Anything, 5, "2024-2025-1").Return([]ScheduleEntry{session("CN", "1-2", "INT3401 1")}, nil)
+	service := newTestService(repo)
+
+	ctx := context.WithValue(callerContext("student", 5), "userId", 12)
+	token, err := service.CreateCalendarFeed(ctx)
+	require.NoError(t, err)
+	assert.Len(t, token, 64)
+	// Only the hash of the token is stored
+	assert.NotEqual(t, token, tokenHash)
+	repo.On("GetCalendarFeed", mock.Anything, tokenHash).Return(feed, nil).Once()
+
+	calendar, err := service.ExportFeedCalendar(context.Background(), token, ExportCalendarRequest{})
+	require.NoError(t, err)
+	assert.Contains(t, string(calendar), "SUMMARY: (INT3401 1)")
+
+	require.NoError(t, service.RevokeCalendarFeed(ctx))
+	repo.On("GetCalendarFeed", mock.Anything, tokenHash).Return(CalendarFeed{}, sql.ErrNoRows)
+	_, err = service.ExportFeedCalendar(context.Background(), token, ExportCalendarRequest{})
+	assert.ErrorIs(t, err, ErrInvalidFeedToken)
+
+	_, err = service.ExportFeedCalendar(context.Background(), "not-a-token", ExportCalendarRequest{})
+	assert.ErrorIs(t, err, ErrInvalidFeedToken)
+
+	// An admin has no schedule to subscribe to
+	_, err = service.CreateCalendarFeed(callerContext("admin", 1))
+	assert.ErrorIs(t, err, ErrNoSchedule)
+	repo.AssertExpectations(t)
+}
+
+func TestServiceImpl_FindCourseClasses(t *testing.T) {
+	repo := &MockRepository{}
+	repo.On("FindClasses", mock.Anything, "INT3306", []string{"2024-2025-1", "2024-2025-2"}).Return([]ClassInfo{
+		{ID: 1, Code: "INT3306 1", Semester: "2024-2025-1", CourseCode: "INT3306"},
+		{ID: 2, Code: "INT3306 1", Semester: "2024-2025-2", CourseCode: "INT3306"},
+	}, nil)
+	repo.On("GetSchedules", mock.Anything, []int{1, 2}).Return([]ClassSchedule{
+		{ID: 10, CourseClassID: 1, DayOfWeek: "2", Location: "208-GĐ3", Instructors: "Nguyễn Văn Bình"},
+		{ID: 11, CourseClassID: 1, DayOfWeek: "4", Location: "PM 313-G2"},
+	}, nil)
+
+	response, err := newTestService(repo).FindCourseClasses(callerContext("student", 5), FindCourseClassesRequest{Course: " INT3306 ", Semester: "năm học 2024-2025"})
+	require.NoError(t, err)
+	require.Len(t, response.Classes, 2)
+	assert.Len(t, response.Classes[0].Schedules, 2)
+	assert.Equal(t, "Nguyễn Văn Bình", response.Classes[0].Schedules[0].Instructors)
+	assert.Equal(t, []ClassSchedule{}, response.Classes[1].Schedules)
+}
+
+func TestServiceImpl_ListStudentsInClass(t *testing.T) {
+	class := ClassInfo{ID: 1, Code: "INT3306 1", Semester: "2024-2025-1", CourseCode: "INT3306"}
+	email := "nguyenvanan@vnu.edu.vn"
+
+	tests := []struct {
+		name     string
+		role     string
+		teaches  bool
+		expected *string
+		wantErr  error
+	}{
+		// The email is masked by the column rules of the professors
+		{name: "Professor teaching the class", role: "professor", teaches: true, expected: strPtr("n***@vnu.edu.vn")},
+		{name: "Professor not teaching the class", role: "professor", wantErr: db.ErrForbidden},
+		{name: "Admin", role: "admin", expected: &email},
+		{name: "Student", role: "student", wantErr: db.ErrForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &MockRepository{}
+			repo.On("GetClass", mock.Anything, "INT3306 1", "2024-2025-1").Return(class, nil)
+			repo.On("TeachesClass", mock.Anything, 2, 1).Return(tt.teaches, nil)
+			repo.On("GetStudentsOfClass", mock.Anything, 1).Return([]ClassStudent{{ID: 5, Code: "21020005", Name: "Nguyễn Văn An", Email: strPtr(email)}}, nil)
+
+			response, err := newTestService(repo).ListStudentsInClass(callerContext(tt.role, 2), ListStudentsInClassRequest{ClassCode: "INT3306 1"})
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				repo.AssertNotCalled(t, "GetStudentsOfClass", mock.Anything, mock.Anything)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, []ClassStudent{{ID: 5, Code: "21020005", Name: "Nguyễn Văn An", Email: tt.expected}}, response.Students)
+			assert.Equal(t, "INT3306 1", response.Class.Code)
+		})
+	}
+}
+
+func withDate(entry ScheduleEntry, date string) ScheduleEntry {
+	entry.Date = date
+	return entry
+}
+
+func intPtr(value int) *int {
+	return &value
+}
+
+func strPtr(value string) *string {
+	return &value
+}
@@ -0,0 +1,144 @@
+package courseclass
+
+import (
+	"HNLP/be/internal/config"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimeZone is the time zone of the periods if the config has none
+const DefaultTimeZone = "Asia/Ho_Chi_Minh"
+
+// Slot is the clock time of a session in minutes since midnight
+type Slot struct {
+	Start int
+	End   int
+}
+
+// Overlaps reports whether the two slots share a minute
+func (s Slot) Overlaps(other Slot) bool {
+	return s.Start < other.End && other.Start < s.End
+}
+
+// Timetable converts the lesson ranges of the sessions like "3-4" to clock times
+type Timetable struct {
+	periods  map[int]Slot
+	location *time.Location
+}
+
+// NewTimetable builds the timetable of the periods of the config, 12 lessons of 50 minutes every hour from 07:00 by default
+func NewTimetable(cfg config.ScheduleConfig) (*Timetable, error) {
+	timeZone := cfg.TimeZone
+	if timeZone == "" {
+		timeZone = DefaultTimeZone
+	}
+	location, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone of the schedule: %w", err)
+	}
+
+	periods := cfg.Periods
+	if len(periods) == 0 {
+		periods = defaultPeriods()
+	}
+	timetable := &Timetable{periods: make(map[int]Slot, len(periods)), location: location}
+	for _, period := range periods {
+		start, err := parseClock(period.Start)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start of the lesson %d: %w", period.Lesson, err)
+		}
+		end, err := parseClock(period.End)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end of the lesson %d: %w", period.Lesson, err)
+		}
+		if end <= start {
+			return nil, fmt.Errorf("the lesson %d ends before it starts", period.Lesson)
+		}
+		if _, exists := timetable.periods[period.Lesson]; exists {
+			return nil, fmt.Errorf("the lesson %d is configured twice", period.Lesson)
+		}
+		timetable.periods[period.Lesson] = Slot{Start: start, End: end}
+	}
+	return timetable, nil
+}
+
+// Location is the time zone of the clock times
+func (t *Timetable) Location() *time.Location {
+	return t.location
+}
+
+// Slot returns the clock time of a lesson range like "3-4" or "5", from the start of its first lesson to the end of its last one
+func (t *Timetable) Slot(lessonRange *string) (Slot, bool) {
+	if lessonRange == nil {
+		return Slot{}, false
+	}
+	firstText, lastText, isRange := strings.Cut(*lessonRange, "-")
+	first, err := strconv.Atoi(strings.TrimSpace(firstText))
+	if err != nil {
+		return Slot{}, false
+	}
+	last := first
+	if isRange {
+		if last, err = strconv.Atoi(strings.TrimSpace(lastText)); err != nil {
+			return Slot{}, false
+		}
+	}
+	start, ok := t.periods[first]
+	if !ok {
+		return Slot{}, false
+	}
+	end, ok := t.periods[last]
+	if !ok || end.End <= start.Start {
+		return Slot{}, false
+	}
+	return Slot{Start: start.Start, End: end.End}, true
+}
+
+// Overlaps reports whether two weekly sessions are on the same day of week and share a minute,
+// the sessions whose day or lesson range isn't known never overlap
+func (t *Timetable) Overlaps(a ClassSchedule, b ClassSchedule) bool {
+	dayA, okA := dayOffset(a.DayOfWeek)
+	dayB, okB := dayOffset(b.DayOfWeek)
+	if !okA || !okB || dayA != dayB {
+		return false
+	}
+	slotA, okA := t.Slot(a.LessonRange)
+	slotB, okB := t.Slot(b.LessonRange)
+	return okA && okB && slotA.Overlaps(slotB)
+}
+
+// annotate sets the clock times of a session, they stay empty if its lesson range isn't in the timetable
+func (t *Timetable) annotate(schedule *ClassSchedule) {
+	slot, ok := t.Slot(schedule.LessonRange)
+	if !ok {
+		return
+	}
+	schedule.StartTime = formatClock(slot.Start)
+	schedule.EndTime = formatClock(slot.End)
+}
+
+// ------------------Private helper function------------------
+
+func defaultPeriods() []config.PeriodConfig {
+	periods := make([]config.PeriodConfig, 0, 12)
+	for lesson := 1; lesson <= 12; lesson++ {
+		start := (6 + lesson) * 60
+		periods = append(periods, config.PeriodConfig{Lesson: lesson, Start: formatClock(start), End: formatClock(start + 50)})
+	}
+	return periods
+}
+
+// parseClock parses a clock time like "07:00" to minutes since midnight
+func parseClock(clock string) (int, error) {
+	parsed, err := time.Parse("15:04", strings.TrimSpace(clock))
+	if err != nil {
+		return 0, fmt.Errorf("%q isn't a clock time like 07:00", clock)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+func formatClock(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
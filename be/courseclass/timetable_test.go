@@ -0,0 +1,59 @@
+package courseclass
+
+import (
+	"HNLP/be/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestTimetable_Slot(t *testing.T) {
+	timetable, err := NewTimetable(config.ScheduleConfig{Periods: []config.PeriodConfig{
+		{Lesson: 1, Start: "07:00", End: "07:50"},
+		{Lesson: 2, Start: "07:55", End: "08:45"},
+		{Lesson: 3, Start: "09:00", End: "09:50"},
+	}})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		lessonRange string
+		expected    Slot
+		ok          bool
+	}{
+		{name: "Range", lessonRange: "1-3", expected: Slot{Start: 7 * 60, End: 9*60 + 50}, ok: true},
+		{name: "Single lesson", lessonRange: " 2 ", expected: Slot{Start: 7*60 + 55, End: 8*60 + 45}, ok: true},
+		{name: "Unknown lesson", lessonRange: "3-4"},
+		{name: "Reversed range", lessonRange: "3-1"},
+		{name: "Not a lesson", lessonRange: "sáng"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slot, ok := timetable.Slot(&tt.lessonRange)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, slot)
+		})
+	}
+}
+
+func TestNewTimetable_Errors(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       config.ScheduleConfig
+		errSubstr string
+	}{
+		{name: "Unknown time zone", cfg: config.ScheduleConfig{TimeZone: "Mars/Olympus"}, errSubstr: "invalid time zone"},
+		{name: "Invalid clock", cfg: config.ScheduleConfig{Periods: []config.PeriodConfig{{Lesson: 1, Start: "7h", End: "07:50"}}}, errSubstr: `"7h" isn't a clock time`},
+		{name: "Ends before it starts", cfg: config.ScheduleConfig{Periods: []config.PeriodConfig{{Lesson: 1, Start: "08:00", End: "07:50"}}}, errSubstr: "the lesson 1 ends before it starts"},
+		{name: "Lesson configured twice", cfg: config.ScheduleConfig{Periods: []config.PeriodConfig{{Lesson: 1, Start: "07:00", End: "07:50"}, {Lesson: 1, Start: "08:00", End: "08:50"}}}, errSubstr: "configured twice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewTimetable(tt.cfg)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errSubstr)
+		})
+	}
+}
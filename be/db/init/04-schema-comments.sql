@@ -0,0 +1,32 @@
+-- Column comments, they are read by the schema introspection to describe the columns to the LLM
+
+COMMENT ON COLUMN professor.academic_rank IS 'Học hàm (e.g., Professor)';
+COMMENT ON COLUMN professor.degree IS 'Học vị (e.g., PhD)';
+
+COMMENT ON COLUMN program.code IS 'Mã tuyển sinh';
+COMMENT ON COLUMN program.name IS 'Tên ngành/chương trình đào tạo';
+COMMENT ON COLUMN program.degree_type IS 'Loại bằng tốt nghiệp (e.g., ''Cử nhân'', ''Kỹ sư'')';
+COMMENT ON COLUMN program.training_duration IS 'Thời gian đào tạo (e.g., 4.0, 4.5 years)';
+COMMENT ON COLUMN program.abbreviation IS 'Tên viết tắt';
+
+COMMENT ON COLUMN course.code IS 'Course code, e.g., ''CS101''';
+COMMENT ON COLUMN course.name IS 'Course name, e.g., ''Introduction to Programming''';
+COMMENT ON COLUMN course.english_name IS 'English name of the course';
+COMMENT ON COLUMN course.credits IS 'Credit hours for the course';
+COMMENT ON COLUMN course.practice_hours IS 'Hours dedicated to practice sessions';
+COMMENT ON COLUMN course.theory_hours IS 'Hours dedicated to theory sessions';
+COMMENT ON COLUMN course.self_learn_hours IS 'Hours dedicated to self-study';
+-- prerequisite has no foreign key constraint, so the comment is the only hint of the relation
+COMMENT ON COLUMN course.prerequisite IS 'Id of the prerequisite course (course.id)';
+
+COMMENT ON COLUMN course_class_schedule.day_of_week IS 'e.g. ''2'' for Monday or use full names if preferred';
+COMMENT ON COLUMN course_class_schedule.lesson_range IS 'e.g. ''3-4'' or ''7-8'' or ''9-10''';
+COMMENT ON COLUMN course_class_schedule.session_type IS 'e.g. ''theory'' or ''practice''';
+COMMENT ON COLUMN course_class_schedule.group_identifier IS 'e.g. ''CL'' for theory, ''1'', ''2'' for practice sessions';
+COMMENT ON COLUMN course_class_schedule.location IS 'e.g. ''208-GĐ3'', ''214-GĐ3''';
+
+COMMENT ON COLUMN student.code IS 'Student code/ID (e.g., "S12345678")';
+COMMENT ON COLUMN student.name IS 'Student''s full name';
+COMMENT ON COLUMN student.gender IS 'Gender (e.g., ''Male'', ''Female'', ''Non-binary'')';
+COMMENT ON COLUMN student.birthday IS 'Birthday (e.g., ''2000-01-15'')';
+COMMENT ON COLUMN student.email IS 'Email address';
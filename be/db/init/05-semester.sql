@@ -0,0 +1,36 @@
+-- Public: Accessible to all roles
+-- A semester of an academic year, its code is yyyy-yyyy-x where x is 1, 2 or 3 for the summer semester
+CREATE TABLE IF NOT EXISTS semester
+(
+    id                 SERIAL PRIMARY KEY,
+    code               VARCHAR(11) UNIQUE NOT NULL,
+    name               VARCHAR(100)       NOT NULL,
+    start_date         DATE               NOT NULL,
+    end_date           DATE               NOT NULL,
+    registration_start DATE,
+    registration_end   DATE,
+    CHECK (start_date <= end_date),
+    CHECK (registration_start <= registration_end)
+);
+
+COMMENT ON COLUMN semester.code IS 'Semester code yyyy-yyyy-x, e.g. ''2024-2025-1'', referenced by course_class.semester_id';
+COMMENT ON COLUMN semester.registration_start IS 'First day of the course registration of the semester';
+COMMENT ON COLUMN semester.registration_end IS 'Last day of the course registration of the semester';
+
+INSERT INTO semester (code, name, start_date, end_date, registration_start, registration_end)
+VALUES
+    ('2021-2022-1', 'Học kỳ 1 năm học 2021-2022', '2021-09-01', '2022-01-15', '2021-08-01', '2021-08-25'),
+    ('2021-2022-2', 'Học kỳ 2 năm học 2021-2022', '2022-02-01', '2022-06-30', '2022-01-05', '2022-01-25'),
+    ('2022-2023-1', 'Học kỳ 1 năm học 2022-2023', '2022-09-01', '2023-01-15', '2022-08-01', '2022-08-25'),
+    ('2022-2023-2', 'Học kỳ 2 năm học 2022-2023', '2023-02-01', '2023-06-30', '2023-01-05', '2023-01-25'),
+    ('2023-2024-1', 'Học kỳ 1 năm học 2023-2024', '2023-09-01', '2024-01-15', '2023-08-01', '2023-08-25'),
+    ('2023-2024-2', 'Học kỳ 2 năm học 2023-2024', '2024-02-01', '2024-06-30', '2024-01-05', '2024-01-25'),
+    ('2024-2025-1', 'Học kỳ 1 năm học 2024-2025', '2024-09-01', '2025-01-15', '2024-08-01', '2024-08-25'),
+    ('2024-2025-2', 'Học kỳ 2 năm học 2024-2025', '2025-02-01', '2025-06-30', '2025-01-05', '2025-01-25'),
+    ('2025-2026-1', 'Học kỳ 1 năm học 2025-2026', '2025-09-01', '2026-01-15', '2025-08-01', '2025-08-25'),
+    ('2025-2026-2', 'Học kỳ 2 năm học 2025-2026', '2026-02-01', '2026-06-30', '2026-01-05', '2026-01-25')
+ON CONFLICT (code) DO NOTHING;
+
+ALTER TABLE course_class
+    ADD CONSTRAINT fk_course_class_semester
+        FOREIGN KEY (semester_id) REFERENCES semester (code);
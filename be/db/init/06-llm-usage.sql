@@ -0,0 +1,22 @@
+-- Internal: not described to the LLM
+-- The token usage of each LLM call of the chatbot, with its cost when it was made
+CREATE TABLE IF NOT EXISTS llm_usage
+(
+    id                SERIAL PRIMARY KEY,
+    user_id           INTEGER        NOT NULL,
+    role              VARCHAR(20)    NOT NULL,
+    conversation_id   INTEGER,
+    stage             VARCHAR(20)    NOT NULL, -- tool_planning, answer, validation or summarization
+    model             VARCHAR(100)   NOT NULL, -- The model which answered
+    prompt_tokens     INTEGER        NOT NULL DEFAULT 0,
+    completion_tokens INTEGER        NOT NULL DEFAULT 0,
+    total_tokens      INTEGER        NOT NULL DEFAULT 0,
+    cost              NUMERIC(12, 6) NOT NULL DEFAULT 0, -- USD
+    created_at        TIMESTAMP               DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES user_account (id) ON DELETE CASCADE,
+    FOREIGN KEY (conversation_id) REFERENCES conversation (id) ON DELETE SET NULL
+);
+
+-- The quotas sum the usage of a user since the beginning of the day or the month
+CREATE INDEX IF NOT EXISTS idx_llm_usage_user_id_created_at ON llm_usage (user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_llm_usage_created_at ON llm_usage (created_at);
@@ -0,0 +1,9 @@
+-- Public: Accessible to all roles
+-- The requirements of the training programs checked by the degree audit
+ALTER TABLE program
+    ADD COLUMN IF NOT EXISTS required_credits INT; -- Số tín chỉ tích lũy tối thiểu để tốt nghiệp
+ALTER TABLE course_program
+    ADD COLUMN IF NOT EXISTS mandatory BOOLEAN NOT NULL DEFAULT TRUE; -- Học phần bắt buộc hay tự chọn
+
+COMMENT ON COLUMN program.required_credits IS 'Số tín chỉ tích lũy tối thiểu để tốt nghiệp, tổng số tín chỉ của chương trình nếu NULL';
+COMMENT ON COLUMN course_program.mandatory IS 'TRUE nếu học phần là bắt buộc, FALSE nếu là tự chọn';
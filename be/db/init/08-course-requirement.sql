@@ -0,0 +1,27 @@
+-- Public: Accessible to all roles
+-- The requirements of a course: the courses of a group are alternatives (OR) and every group is required (AND).
+-- A prerequisite must be passed before taking the course, a co-requisite can also be taken in the same semester.
+CREATE TABLE IF NOT EXISTS course_requirement
+(
+    id                 SERIAL PRIMARY KEY,
+    course_id          INT         NOT NULL,                      -- Foreign key to the course
+    required_course_id INT         NOT NULL,                      -- Foreign key to the required course
+    type               VARCHAR(20) NOT NULL DEFAULT 'prerequisite', -- 'prerequisite' or 'corequisite'
+    group_no           INT         NOT NULL DEFAULT 1,            -- Requirement group of the course
+    UNIQUE (course_id, required_course_id, type),
+    CHECK (type IN ('prerequisite', 'corequisite')),
+    CHECK (course_id <> required_course_id),
+    FOREIGN KEY (course_id) REFERENCES course (id),
+    FOREIGN KEY (required_course_id) REFERENCES course (id)
+);
+
+COMMENT ON COLUMN course_requirement.type IS 'prerequisite: phải qua trước khi học, corequisite: có thể học cùng kỳ';
+COMMENT ON COLUMN course_requirement.group_no IS 'Các học phần cùng nhóm là lựa chọn thay thế (OR), phải thỏa mãn mọi nhóm (AND)';
+
+-- The single prerequisite of course.prerequisite is the first group of the course
+INSERT INTO course_requirement (course_id, required_course_id)
+SELECT id, prerequisite
+FROM course
+WHERE prerequisite IS NOT NULL
+  AND prerequisite <> id
+ON CONFLICT DO NOTHING;
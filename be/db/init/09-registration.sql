@@ -0,0 +1,25 @@
+-- Public: Accessible to all roles
+-- The seats of the course classes, the students register for a class while it has free seats
+ALTER TABLE course_class
+    ADD COLUMN IF NOT EXISTS capacity INT CHECK (capacity >= 0); -- Số chỗ của lớp học phần, không giới hạn nếu NULL
+
+COMMENT ON COLUMN course_class.capacity IS 'Số sinh viên tối đa của lớp học phần, không giới hạn nếu NULL';
+
+-- Students can only view their own waitlist entries.
+-- The students registering for a full class wait in order of registration, the first one takes the seat freed by a drop.
+CREATE TABLE IF NOT EXISTS course_class_waitlist
+(
+    id               SERIAL PRIMARY KEY,
+    student_id       INT       NOT NULL,               -- Foreign key to the student
+    course_class_id  INT       NOT NULL,               -- Foreign key to the course class
+    group_identifier VARCHAR(20),                      -- Practice group chosen by the student, e.g. '1', '2'
+    created_at       TIMESTAMP NOT NULL DEFAULT NOW(), -- Time of the registration
+    UNIQUE (student_id, course_class_id),
+    FOREIGN KEY (student_id) REFERENCES student (id),
+    FOREIGN KEY (course_class_id) REFERENCES course_class (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_course_class_waitlist_class ON course_class_waitlist (course_class_id, created_at, id);
+
+COMMENT ON TABLE course_class_waitlist IS 'Danh sách chờ của các lớp học phần đã đủ chỗ, theo thứ tự đăng ký';
+COMMENT ON COLUMN course_class_waitlist.group_identifier IS 'Nhóm thực hành sinh viên chọn, NULL nếu lớp không có nhóm thực hành';
@@ -0,0 +1,46 @@
+-- Public: Accessible to all roles
+-- The professors enter the grades of the classes of a semester until its deadline, the grades are locked after it
+ALTER TABLE semester
+    ADD COLUMN IF NOT EXISTS grade_deadline DATE; -- Hạn cuối nhập điểm của học kỳ
+
+COMMENT ON COLUMN semester.grade_deadline IS 'Hạn cuối giảng viên nhập điểm, điểm bị khóa sau ngày này, không khóa nếu NULL';
+
+-- Only the admins can read the grade history.
+-- Every change of the grades of an enrollment is appended with its author and reason, the rows are never updated nor deleted.
+CREATE TABLE IF NOT EXISTS grade_history
+(
+    id                         SERIAL PRIMARY KEY,
+    course_class_enrollment_id INT         NOT NULL,               -- Foreign key to the enrollment
+    changed_by                 INT         NOT NULL,               -- Foreign key to the user_account of the author
+    changed_by_role            VARCHAR(20) NOT NULL,               -- Role of the author, 'professor' or 'admin'
+    old_midterm_grade          NUMERIC(3, 1),
+    new_midterm_grade          NUMERIC(3, 1),
+    old_final_grade            NUMERIC(3, 1),
+    new_final_grade            NUMERIC(3, 1),
+    old_grade                  VARCHAR(5),
+    new_grade                  VARCHAR(5),
+    old_gpa                    NUMERIC(3, 1),
+    new_gpa                    NUMERIC(3, 1),
+    reason                     TEXT        NOT NULL,               -- Why the grades were changed
+    changed_at                 TIMESTAMP   NOT NULL DEFAULT NOW(), -- Time of the change
+    FOREIGN KEY (course_class_enrollment_id) REFERENCES course_class_enrollment (id),
+    FOREIGN KEY (changed_by) REFERENCES user_account (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_grade_history_enrollment ON grade_history (course_class_enrollment_id, changed_at);
+
+COMMENT ON TABLE grade_history IS 'Lịch sử thay đổi điểm: ai sửa, sửa gì, khi nào và lý do';
+
+CREATE OR REPLACE FUNCTION reject_grade_history_change() RETURNS TRIGGER AS
+$$
+BEGIN
+    RAISE EXCEPTION 'grade_history is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS grade_history_append_only ON grade_history;
+CREATE TRIGGER grade_history_append_only
+    BEFORE UPDATE OR DELETE
+    ON grade_history
+    FOR EACH ROW
+EXECUTE FUNCTION reject_grade_history_change();
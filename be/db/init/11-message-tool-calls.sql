@@ -0,0 +1,4 @@
+-- Internal: not described to the LLM
+-- The tool calls made by the bot to answer a message, with their results
+ALTER TABLE message
+    ADD COLUMN IF NOT EXISTS tool_calls JSONB;
@@ -0,0 +1,10 @@
+-- course.prerequisite is replaced by course_requirement, the column is kept for the old data but not read anymore.
+-- The prerequisites set in the column since 08-course-requirement.sql are copied again before deprecating it.
+INSERT INTO course_requirement (course_id, required_course_id)
+SELECT id, prerequisite
+FROM course
+WHERE prerequisite IS NOT NULL
+  AND prerequisite <> id
+ON CONFLICT DO NOTHING;
+
+COMMENT ON COLUMN course.prerequisite IS 'Deprecated: use course_requirement (type = ''prerequisite'') for the prerequisites of the course';
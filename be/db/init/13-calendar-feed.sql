@@ -0,0 +1,11 @@
+-- Internal: not described to the LLM
+-- The secret calendar feed of each user, the calendar apps subscribe to it without the Authorization header.
+-- Only the SHA-256 hash of the token is stored, deleting the row revokes the feed.
+CREATE TABLE IF NOT EXISTS calendar_feed
+(
+    user_id     INTEGER PRIMARY KEY REFERENCES user_account (id) ON DELETE CASCADE,
+    token_hash  CHAR(64)    NOT NULL UNIQUE,
+    role        VARCHAR(20) NOT NULL, -- student or professor
+    specific_id INTEGER     NOT NULL, -- Id of the student or of the professor
+    created_at  TIMESTAMP   NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,53 @@
+package audit
+
+import (
+	"HNLP/be/internal/auth"
+	"HNLP/be/internal/db"
+	"HNLP/be/internal/middleware"
+	"errors"
+	"github.com/gin-gonic/gin"
+)
+
+type Controller struct {
+	service Service
+}
+
+func NewController(service Service) *Controller {
+	return &Controller{service: service}
+}
+
+// AuditProgress returns the degree audit of a student, e.g. /api/v1/audit?student_id=1
+func (c *Controller) AuditProgress(ctx *gin.Context) {
+	var request AuditProgressRequest
+	if err := ctx.ShouldBindQuery(&request); err != nil {
+		ctx.JSON(400, gin.H{"error": "invalid request"})
+		return
+	}
+
+	// The services read the caller from the context like for the chatbot tools
+	reqCtx := middleware.RequestContext(ctx)
+
+	response, err := c.service.AuditProgress(reqCtx, request)
+	if errors.Is(err, db.ErrForbidden) {
+		ctx.JSON(403, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, db.ErrStudentRequired) {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, ErrNoProgram) {
+		ctx.JSON(404, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(500, gin.H{"error": "failed to audit the progress"})
+		return
+	}
+
+	ctx.JSON(200, response)
+}
+
+func (c *Controller) RegisterRoutes(router *gin.Engine, jwtService *auth.ServiceImpl) {
+	router.GET("/api/v1/audit", middleware.Authenticate(jwtService), c.AuditProgress)
+}
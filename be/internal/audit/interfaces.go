@@ -0,0 +1,74 @@
+package audit
+
+import (
+	"HNLP/be/internal/course"
+	"HNLP/be/internal/prerequisite"
+	"context"
+	"errors"
+)
+
+// ErrNoProgram is returned when the student isn't in a training program
+var ErrNoProgram = errors.New("the student isn't in a program")
+
+type Service interface {
+	AuditProgress(ctx context.Context, req AuditProgressRequest) (AuditProgressResponse, error)
+}
+
+type Repository interface {
+	GetProgramOfStudent(ctx context.Context, studentId int) (course.Program, error)
+	// GetRequirements returns the courses of the curriculum of the program
+	GetRequirements(ctx context.Context, programId int) ([]Requirement, error)
+}
+
+// Requirements is the prerequisite graph of the courses, prerequisite.ServiceImpl implements it
+type Requirements interface {
+	GetGraph(ctx context.Context) (*prerequisite.Graph, error)
+}
+
+// StudentAccess checks that the caller can access the data of a student, course.ServiceImpl implements it
+type StudentAccess interface {
+	// AccessibleStudent returns the student asked by the caller, the caller themselves for a student by default.
+	// A professor must advise the student, the audit reads their whole record.
+	AccessibleStudent(ctx context.Context, studentId *int) (int, error)
+}
+
+type AuditProgressRequest struct {
+	StudentId *int `json:"student_id,omitempty" form:"student_id" jsonschema:"description=Id of the student, the current student by default,minimum=1"`
+}
+
+type AuditProgressResponse struct {
+	StudentID int            `json:"student_id"`
+	Program   course.Program `json:"program"`
+	// The credits only count the courses of the curriculum, InProgressCredits are the ones of the current classes without grade
+	RequiredCredits   int `json:"required_credits"`
+	CompletedCredits  int `json:"completed_credits"`
+	InProgressCredits int `json:"in_progress_credits"`
+	RemainingCredits  int `json:"remaining_credits"`
+	// MissingCourses are the mandatory courses not passed yet
+	MissingCourses []MissingCourse `json:"missing_courses"`
+	// Eligible is true if the student completed the requirements of the program
+	Eligible bool `json:"eligible"`
+	// CreditsPerSemester is the pace of the student used for the projection
+	CreditsPerSemester float64 `json:"credits_per_semester"`
+	// ProjectedGraduation is the semester the student is expected to finish in at their pace,
+	// ExpectedGraduation the last semester of the training duration of the program
+	ProjectedGraduation string `json:"projected_graduation"`
+	ExpectedGraduation  string `json:"expected_graduation,omitempty"`
+	OnTrack             bool   `json:"on_track"`
+}
+
+type MissingCourse struct {
+	Code       string `json:"code"`
+	Name       string `json:"name"`
+	Credits    int    `json:"credits"`
+	InProgress bool   `json:"in_progress,omitempty"`
+	// UnmetPrerequisites are the prerequisites of the chains not passed yet, each one before its own prerequisites.
+	// A group of alternative prerequisites is listed whole.
+	UnmetPrerequisites []Prerequisite `json:"unmet_prerequisites,omitempty"`
+}
+
+type Prerequisite struct {
+	Code       string `json:"code"`
+	Name       string `json:"name"`
+	InProgress bool   `json:"in_progress,omitempty"`
+}
@@ -0,0 +1,9 @@
+package audit
+
+// Requirement is a course of the curriculum of a program
+type Requirement struct {
+	Code      string `db:"code"`
+	Name      string `db:"name"`
+	Credits   int    `db:"credits"`
+	Mandatory bool   `db:"mandatory"`
+}
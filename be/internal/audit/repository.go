@@ -0,0 +1,38 @@
+package audit
+
+import (
+	"HNLP/be/internal/course"
+	"HNLP/be/internal/db"
+	"context"
+)
+
+type RepositoryImpl struct {
+	db db.HDb
+}
+
+func NewRepositoryImpl(db db.HDb) *RepositoryImpl {
+	return &RepositoryImpl{db: db}
+}
+
+func (r *RepositoryImpl) GetProgramOfStudent(ctx context.Context, studentId int) (course.Program, error) {
+	var program course.Program
+	err := r.db.GetContext(ctx, &program, `SELECT p.*
+FROM student s
+         JOIN administrative_class ac ON ac.id = s.administrative_class_id
+         JOIN program p ON p.id = ac.program_id
+WHERE s.id = $1`, studentId)
+	return program, err
+}
+
+func (r *RepositoryImpl) GetRequirements(ctx context.Context, programId int) ([]Requirement, error) {
+	var requirements []Requirement
+	err := r.db.SelectContext(ctx, &requirements, `SELECT c.code,
+       COALESCE(c.name, '')   AS name,
+       COALESCE(c.credits, 0) AS credits,
+       cp.mandatory
+FROM course_program cp
+         JOIN course c ON c.id = cp.course_id
+WHERE cp.program_id = $1
+ORDER BY c.code`, programId)
+	return requirements, err
+}
@@ -0,0 +1,227 @@
+package audit
+
+import (
+	"HNLP/be/internal/config"
+	"HNLP/be/internal/grade"
+	"HNLP/be/internal/prerequisite"
+	"HNLP/be/internal/semester"
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+)
+
+// defaultCreditsPerSemester is the pace of the students without history if none is configured
+const defaultCreditsPerSemester = 18
+
+type ServiceImpl struct {
+	repo         Repository
+	gradeRepo    grade.Repository
+	students     StudentAccess
+	requirements Requirements
+	semesterSrv  semester.Service
+	scale        grade.Scale
+	cfg          config.AuditConfig
+}
+
+func NewServiceImpl(repo Repository, gradeRepo grade.Repository, students StudentAccess, requirements Requirements, semesterSrv semester.Service, scale grade.Scale, cfg config.AuditConfig) *ServiceImpl {
+	if cfg.CreditsPerSemester <= 0 {
+		cfg.CreditsPerSemester = defaultCreditsPerSemester
+	}
+	return &ServiceImpl{
+		repo:         repo,
+		gradeRepo:    gradeRepo,
+		students:     students,
+		requirements: requirements,
+		semesterSrv:  semesterSrv,
+		scale:        scale,
+		cfg:          cfg,
+	}
+}
+
+// AuditProgress checks the courses passed by a student against the curriculum of their program
+// and projects the semester they will graduate in at their pace.
+func (s *ServiceImpl) AuditProgress(ctx context.Context, req AuditProgressRequest) (AuditProgressResponse, error) {
+	studentId, err := s.students.AccessibleStudent(ctx, req.StudentId)
+	if err != nil {
+		return AuditProgressResponse{}, err
+	}
+	program, err := s.repo.GetProgramOfStudent(ctx, studentId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return AuditProgressResponse{}, ErrNoProgram
+	}
+	if err != nil {
+		return AuditProgressResponse{}, err
+	}
+	requirements, err := s.repo.GetRequirements(ctx, program.ID)
+	if err != nil {
+		return AuditProgressResponse{}, err
+	}
+	graph, err := s.requirements.GetGraph(ctx)
+	if err != nil {
+		return AuditProgressResponse{}, err
+	}
+	attempts, err := s.gradeRepo.GetAttempts(ctx, studentId)
+	if err != nil {
+		return AuditProgressResponse{}, err
+	}
+	current, err := s.semesterSrv.GetCurrentSemester(ctx)
+	if err != nil {
+		return AuditProgressResponse{}, err
+	}
+
+	passed, inProgress := s.scale.CourseStatuses(attempts, current.Code)
+
+	response := AuditProgressResponse{StudentID: studentId, Program: program, MissingCourses: []MissingCourse{}}
+	curriculumCredits, missingCredits, depth := 0, 0, 0
+	for _, requirement := range requirements {
+		curriculumCredits += requirement.Credits
+		switch {
+		case passed[requirement.Code]:
+			response.CompletedCredits += requirement.Credits
+		case inProgress[requirement.Code]:
+			response.InProgressCredits += requirement.Credits
+		}
+		if !requirement.Mandatory || passed[requirement.Code] {
+			continue
+		}
+		missing := MissingCourse{
+			Code:               requirement.Code,
+			Name:               requirement.Name,
+			Credits:            requirement.Credits,
+			InProgress:         inProgress[requirement.Code],
+			UnmetPrerequisites: unmetPrerequisites(graph, requirement.Code, passed, inProgress),
+		}
+		if !missing.InProgress {
+			missingCredits += requirement.Credits
+			depth = max(depth, chainDepth(graph, requirement.Code, passed, inProgress, map[string]bool{}))
+		}
+		response.MissingCourses = append(response.MissingCourses, missing)
+	}
+
+	response.RequiredCredits = curriculumCredits
+	if program.RequiredCredits != nil {
+		response.RequiredCredits = *program.RequiredCredits
+	}
+	response.RemainingCredits = max(response.RequiredCredits-response.CompletedCredits-response.InProgressCredits, missingCredits, 0)
+	response.Eligible = response.CompletedCredits >= response.RequiredCredits && len(response.MissingCourses) == 0
+	response.CreditsPerSemester = s.pace(attempts, current.Code)
+
+	// The remaining courses are taken from the next semester, at the pace of the student and one prerequisite level a semester
+	semesters := max(int(math.Ceil(float64(response.RemainingCredits)/response.CreditsPerSemester)), depth)
+	response.ProjectedGraduation, err = addRegularSemesters(current.Code, semesters)
+	if err != nil {
+		return AuditProgressResponse{}, err
+	}
+	if len(attempts) > 0 {
+		response.ExpectedGraduation, err = expectedGraduation(attempts[0].Semester, program.TrainingDuration)
+		if err != nil {
+			return AuditProgressResponse{}, err
+		}
+	}
+	response.OnTrack = response.ExpectedGraduation == "" || response.ProjectedGraduation <= response.ExpectedGraduation
+	return response, nil
+}
+
+// ------------------Private helper function------------------
+
+// pace averages the credits taken in the regular semesters before the current one, the configured pace without history
+func (s *ServiceImpl) pace(attempts []grade.Attempt, current string) float64 {
+	credits := make(map[string]int)
+	for _, attempt := range attempts {
+		if attempt.Semester >= current {
+			continue
+		}
+		if _, term, err := semester.ParseCode(attempt.Semester); err != nil || term == 3 {
+			continue
+		}
+		credits[attempt.Semester] += attempt.Credits
+	}
+	total := 0
+	for _, semesterCredits := range credits {
+		total += semesterCredits
+	}
+	if total == 0 {
+		return float64(s.cfg.CreditsPerSemester)
+	}
+	return math.Round(float64(total)/float64(len(credits))*10) / 10
+}
+
+// unmetPrerequisites follows the unmet prerequisite groups of the course depth first, a passed course ends its chain
+func unmetPrerequisites(graph *prerequisite.Graph, code string, passed map[string]bool, inProgress map[string]bool) []Prerequisite {
+	var unmet []Prerequisite
+	seen := map[string]bool{code: true}
+	var visit func(code string)
+	visit = func(code string) {
+		for _, group := range graph.Unmet(code, passed, inProgress) {
+			if group.Type != prerequisite.Prerequisite {
+				continue
+			}
+			for _, course := range group.Courses {
+				if seen[course.Code] {
+					continue
+				}
+				seen[course.Code] = true
+				unmet = append(unmet, Prerequisite{Code: course.Code, Name: course.Name, InProgress: inProgress[course.Code]})
+				visit(course.Code)
+			}
+		}
+	}
+	visit(code)
+	return unmet
+}
+
+// chainDepth is the number of semesters needed to take the course and its prerequisites one after the other,
+// the quickest course of each group counts and the courses in progress are done at the end of the current semester
+func chainDepth(graph *prerequisite.Graph, code string, passed map[string]bool, inProgress map[string]bool, visiting map[string]bool) int {
+	if passed[code] || inProgress[code] || visiting[code] {
+		return 0
+	}
+	visiting[code] = true
+	defer delete(visiting, code)
+	depth := 0
+	for _, group := range graph.Unmet(code, passed, inProgress) {
+		if group.Type != prerequisite.Prerequisite {
+			continue
+		}
+		quickest := -1
+		for _, course := range group.Courses {
+			courseDepth := chainDepth(graph, course.Code, passed, inProgress, visiting)
+			if quickest < 0 || courseDepth < quickest {
+				quickest = courseDepth
+			}
+		}
+		depth = max(depth, quickest)
+	}
+	return depth + 1
+}
+
+// addRegularSemesters returns the n-th regular semester after the semester, skipping the summer semesters
+func addRegularSemesters(code string, n int) (string, error) {
+	startYear, term, err := semester.ParseCode(code)
+	if err != nil {
+		return "", err
+	}
+	for i := 0; i < n; i++ {
+		if term == 1 {
+			term = 2
+		} else {
+			startYear, term = startYear+1, 1
+		}
+	}
+	return semester.FormatCode(startYear, term), nil
+}
+
+// expectedGraduation returns the last regular semester of the training duration in years from the first semester of the student
+func expectedGraduation(first string, trainingDuration float64) (string, error) {
+	_, term, err := semester.ParseCode(first)
+	if err != nil {
+		return "", err
+	}
+	semesters := int(math.Ceil(trainingDuration * 2))
+	if term == 3 {
+		// A summer semester isn't part of the duration
+		semesters++
+	}
+	return addRegularSemesters(first, semesters-1)
+}
@@ -0,0 +1,230 @@
+package audit
+
+import (
+	"HNLP/be/internal/config"
+	"HNLP/be/internal/course"
+	"HNLP/be/internal/db"
+	"HNLP/be/internal/grade"
+	"HNLP/be/internal/prerequisite"
+	"HNLP/be/internal/semester"
+	"HNLP/be/internal/testutil"
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// MockRepository implements the Repository interface for testing
+type MockRepository struct {
+	mock.Mock
+}
+
+func (m *MockRepository) GetProgramOfStudent(ctx context.Context, studentId int) (course.Program, error) {
+	args := m.Called(ctx, studentId)
+	return args.Get(0).(course.Program), args.Error(1)
+}
+
+func (m *MockRepository) GetRequirements(ctx context.Context, programId int) ([]Requirement, error) {
+	args := m.Called(ctx, programId)
+	return args.Get(0).([]Requirement), args.Error(1)
+}
+
+// staticRequirements implements the Requirements interface with a fixed graph
+type staticRequirements struct {
+	graph *prerequisite.Graph
+}
+
+func (r staticRequirements) GetGraph(ctx context.Context) (*prerequisite.Graph, error) {
+	return r.graph, nil
+}
+
+// testRequirements has a chain of 3 mandatory courses, an elective and a mandatory course whose prerequisite is outside the curriculum
+var testRequirements = []Requirement{
+	{Code: "INT1008", Name: "Nhập môn lập trình", Credits: 3, Mandatory: true},
+	{Code: "INT2210", Name: "Cấu trúc dữ liệu và giải thuật", Credits: 4, Mandatory: true},
+	{Code: "INT3209", Name: "Khai phá dữ liệu", Credits: 3, Mandatory: true},
+	{Code: "INT3401", Name: "Trí tuệ nhân tạo", Credits: 3, Mandatory: true},
+	{Code: "INT3402", Name: "Chương trình dịch", Credits: 3, Mandatory: true},
+	{Code: "INT3507", Name: "Các vấn đề hiện đại", Credits: 3},
+	{Code: "MAT1093", Name: "Đại số", Credits: 4, Mandatory: true},
+}
+
+var testCourses = []prerequisite.Course{
+	{ID: 1, Code: "INT1008", Name: "Nhập môn lập trình", Credits: 3},
+	{ID: 2, Code: "INT2210", Name: "Cấu trúc dữ liệu và giải thuật", Credits: 4},
+	{ID: 3, Code: "INT3209", Name: "Khai phá dữ liệu", Credits: 3},
+	{ID: 4, Code: "INT3401", Name: "Trí tuệ nhân tạo", Credits: 3},
+	{ID: 5, Code: "INT3402", Name: "Chương trình dịch", Credits: 3},
+	{ID: 6, Code: "INT3507", Name: "Các vấn đề hiện đại", Credits: 3},
+	{ID: 7, Code: "MAT1093", Name: "Đại số", Credits: 4},
+	{ID: 8, Code: "MAT1101", Name: "Xác suất thống kê", Credits: 2},
+}
+
+var testEdges = []prerequisite.Edge{
+	{CourseCode: "INT2210", RequiredCode: "INT1008", Type: prerequisite.Prerequisite, GroupNo: 1},
+	{CourseCode: "INT3209", RequiredCode: "MAT1101", Type: prerequisite.Prerequisite, GroupNo: 1},
+	{CourseCode: "INT3401", RequiredCode: "INT2210", Type: prerequisite.Prerequisite, GroupNo: 1},
+	{CourseCode: "INT3402", RequiredCode: "INT3401", Type: prerequisite.Prerequisite, GroupNo: 1},
+	// The co-requisite isn't a prerequisite of the chain
+	{CourseCode: "INT3402", RequiredCode: "INT3507", Type: prerequisite.Corequisite, GroupNo: 1},
+}
+
+// testAttempts has a failed course retaken and a class of the current semester without grade
+var testAttempts = []grade.Attempt{
+	{Semester: "2023-2024-1", CourseCode: "INT1008", Credits: 3, FinalGrade: floatPtr(8.0)},
+	{Semester: "2023-2024-1", CourseCode: "MAT1093", Credits: 4, FinalGrade: floatPtr(3.0)},
+	{Semester: "2023-2024-2", CourseCode: "INT3507", Credits: 3, Grade: strPtr("B")},
+	{Semester: "2023-2024-2", CourseCode: "MAT1093", Credits: 4, FinalGrade: floatPtr(6.0)},
+	{Semester: "2024-2025-1", CourseCode: "INT2210", Credits: 4},
+}
+
+var testCurrent = semester.Semester{Code: "2024-2025-1"}
+
+func TestServiceImpl_AuditProgress(t *testing.T) {
+	missing := []MissingCourse{
+		{Code: "INT2210", Name: "Cấu trúc dữ liệu và giải thuật", Credits: 4, InProgress: true},
+		{Code: "INT3209", Name: "Khai phá dữ liệu", Credits: 3, UnmetPrerequisites: []Prerequisite{{Code: "MAT1101", Name: "Xác suất thống kê"}}},
+		{Code: "INT3401", Name: "Trí tuệ nhân tạo", Credits: 3, UnmetPrerequisites: []Prerequisite{{Code: "INT2210", Name: "Cấu trúc dữ liệu và giải thuật", InProgress: true}}},
+		{Code: "INT3402", Name: "Chương trình dịch", Credits: 3, UnmetPrerequisites: []Prerequisite{
+			{Code: "INT3401", Name: "Trí tuệ nhân tạo"},
+			{Code: "INT2210", Name: "Cấu trúc dữ liệu và giải thuật", InProgress: true},
+		}},
+	}
+
+	tests := []struct {
+		name     string
+		program  course.Program
+		expected AuditProgressResponse
+	}{
+		{
+			name:    "On track",
+			program: course.Program{ID: 1, Code: "CN1", TrainingDuration: 4},
+			expected: AuditProgressResponse{
+				RequiredCredits: 23, CompletedCredits: 10, InProgressCredits: 4, RemainingCredits: 9,
+				MissingCourses:     missing,
+				CreditsPerSemester: 7,
+				// 9 credits at 7 credits a semester and 2 levels of prerequisites
+				ProjectedGraduation: "2025-2026-1",
+				ExpectedGraduation:  "2026-2027-2",
+				OnTrack:             true,
+			},
+		},
+		{
+			name:    "Behind the training duration",
+			program: course.Program{ID: 1, Code: "CN1", TrainingDuration: 1.5},
+			expected: AuditProgressResponse{
+				RequiredCredits: 23, CompletedCredits: 10, InProgressCredits: 4, RemainingCredits: 9,
+				MissingCourses:      missing,
+				CreditsPerSemester:  7,
+				ProjectedGraduation: "2025-2026-1",
+				ExpectedGraduation:  "2024-2025-1",
+			},
+		},
+		{
+			name:    "Required credits of the program",
+			program: course.Program{ID: 1, Code: "CN1", TrainingDuration: 4, RequiredCredits: intPtr(40)},
+			expected: AuditProgressResponse{
+				RequiredCredits: 40, CompletedCredits: 10, InProgressCredits: 4, RemainingCredits: 26,
+				MissingCourses:      missing,
+				CreditsPerSemester:  7,
+				ProjectedGraduation: "2026-2027-1",
+				ExpectedGraduation:  "2026-2027-2",
+				OnTrack:             true,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &MockRepository{}
+			repo.On("GetProgramOfStudent", mock.Anything, 5).Return(tt.program, nil)
+			repo.On("GetRequirements", mock.Anything, 1).Return(testRequirements, nil)
+
+			response, err := newTestService(t, repo, testAttempts, testEdges).AuditProgress(context.Background(), AuditProgressRequest{})
+			require.NoError(t, err)
+			tt.expected.StudentID = 5
+			tt.expected.Program = tt.program
+			assert.Equal(t, tt.expected, response)
+		})
+	}
+
+	t.Run("Student without history", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("GetProgramOfStudent", mock.Anything, 5).Return(course.Program{ID: 1, TrainingDuration: 4}, nil)
+		repo.On("GetRequirements", mock.Anything, 1).Return([]Requirement{{Code: "INT1008", Credits: 3, Mandatory: true}}, nil)
+
+		response, err := newTestService(t, repo, []grade.Attempt{}, testEdges).AuditProgress(context.Background(), AuditProgressRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, 18.0, response.CreditsPerSemester)
+		assert.Equal(t, "2024-2025-2", response.ProjectedGraduation)
+		assert.Empty(t, response.ExpectedGraduation)
+		assert.True(t, response.OnTrack)
+		assert.False(t, response.Eligible)
+	})
+
+	t.Run("Group of alternative prerequisites", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("GetProgramOfStudent", mock.Anything, 5).Return(course.Program{ID: 1, TrainingDuration: 4}, nil)
+		repo.On("GetRequirements", mock.Anything, 1).Return([]Requirement{{Code: "INT3209", Name: "Khai phá dữ liệu", Credits: 3, Mandatory: true}}, nil)
+		alternatives := []prerequisite.Edge{
+			{CourseCode: "INT3209", RequiredCode: "MAT1101", Type: prerequisite.Prerequisite, GroupNo: 1},
+			{CourseCode: "INT3209", RequiredCode: "INT3402", Type: prerequisite.Prerequisite, GroupNo: 1},
+			{CourseCode: "INT3402", RequiredCode: "INT3401", Type: prerequisite.Prerequisite, GroupNo: 1},
+			{CourseCode: "INT3401", RequiredCode: "INT2210", Type: prerequisite.Prerequisite, GroupNo: 1},
+		}
+
+		response, err := newTestService(t, repo, testAttempts, alternatives).AuditProgress(context.Background(), AuditProgressRequest{})
+		require.NoError(t, err)
+		// The whole group is listed, MAT1101 is quicker to take than the chain of INT3402 and decides the projection
+		assert.Equal(t, []MissingCourse{{Code: "INT3209", Name: "Khai phá dữ liệu", Credits: 3, UnmetPrerequisites: []Prerequisite{
+			{Code: "INT3402", Name: "Chương trình dịch"},
+			{Code: "INT3401", Name: "Trí tuệ nhân tạo"},
+			{Code: "INT2210", Name: "Cấu trúc dữ liệu và giải thuật", InProgress: true},
+			{Code: "MAT1101", Name: "Xác suất thống kê"},
+		}}}, response.MissingCourses)
+		assert.Equal(t, "2025-2026-1", response.ProjectedGraduation)
+	})
+
+	t.Run("Without program", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("GetProgramOfStudent", mock.Anything, 5).Return(course.Program{}, sql.ErrNoRows)
+
+		_, err := newTestService(t, repo, testAttempts, testEdges).AuditProgress(context.Background(), AuditProgressRequest{})
+		assert.ErrorIs(t, err, ErrNoProgram)
+	})
+
+	t.Run("Forbidden", func(t *testing.T) {
+		students := &testutil.MockStudentAccess{}
+		students.On("AccessibleStudent", mock.Anything, intPtr(9)).Return(0, db.ErrForbidden)
+		service := NewServiceImpl(&MockRepository{}, &testutil.MockGradeRepository{}, students, staticRequirements{}, &testutil.MockSemesterService{}, grade.NewScale(nil), config.AuditConfig{})
+
+		_, err := service.AuditProgress(context.Background(), AuditProgressRequest{StudentId: intPtr(9)})
+		assert.ErrorIs(t, err, db.ErrForbidden)
+	})
+}
+
+func newTestService(t *testing.T, repo Repository, attempts []grade.Attempt, edges []prerequisite.Edge) *ServiceImpl {
+	graph, err := prerequisite.NewGraph(testCourses, edges)
+	require.NoError(t, err)
+	gradeRepo := &testutil.MockGradeRepository{}
+	gradeRepo.On("GetAttempts", mock.Anything, 5).Return(attempts, nil)
+	students := &testutil.MockStudentAccess{}
+	students.On("AccessibleStudent", mock.Anything, mock.Anything).Return(5, nil)
+	semesterSrv := &testutil.MockSemesterService{}
+	semesterSrv.On("GetCurrentSemester", mock.Anything).Return(testCurrent, nil)
+	return NewServiceImpl(repo, gradeRepo, students, staticRequirements{graph: graph}, semesterSrv, grade.NewScale(nil), config.AuditConfig{})
+}
+
+func floatPtr(value float64) *float64 {
+	return &value
+}
+
+func strPtr(value string) *string {
+	return &value
+}
+
+func intPtr(value int) *int {
+	return &value
+}
@@ -1,13 +1,19 @@
 package chatbot
 
 import (
+	"HNLP/be/internal/chatmanagement"
 	"HNLP/be/internal/db"
 	"HNLP/be/internal/llm"
 	"HNLP/be/internal/search"
+	"HNLP/be/internal/semester"
+	"HNLP/be/internal/testutil"
+	"HNLP/be/internal/usage"
 	"bytes"
 	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
+	"github.com/jmoiron/sqlx"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 	"github.com/sashabaranov/go-openai"
@@ -17,6 +23,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 // MockAIProvider implements the llm.AIProvider interface for testing
@@ -44,7 +51,7 @@ type MockHDb struct {
 	mock.Mock
 }
 
-func (m *MockHDb) ExecuteQuery(ctx context.Context, query string) (*db.QueryResult, error) {
+func (m *MockHDb) ExecuteQuery(ctx context.Context, query db.QueryRequest) (*db.QueryResult, error) {
 	args := m.Called(ctx, query)
 	if result, ok := args.Get(0).(*db.QueryResult); ok {
 		return result, args.Error(1)
@@ -57,11 +64,49 @@ func (m *MockHDb) LoadDDL() (string, error) {
 	return args.String(0), args.Error(1)
 }
 
+func (m *MockHDb) LoadSchema(ctx context.Context, role string) (*db.DatabaseSchema, error) {
+	args := m.Called(ctx, role)
+	if schema, ok := args.Get(0).(*db.DatabaseSchema); ok {
+		return schema, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
 func (m *MockHDb) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
 	args = append([]interface{}{ctx, dest, query}, args...)
 	return m.Called(args...).Error(0)
 }
 
+func (m *MockHDb) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	args = append([]interface{}{ctx, query}, args...)
+	called := m.Called(args...)
+	if result, ok := called.Get(0).(sql.Result); ok {
+		return result, called.Error(1)
+	}
+	return nil, called.Error(1)
+}
+
+func (m *MockHDb) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	args = append([]interface{}{ctx, dest, query}, args...)
+	return m.Called(args...).Error(0)
+}
+
+func (m *MockHDb) QueryRowx(query string, args ...interface{}) *sqlx.Row {
+	args = append([]interface{}{query}, args...)
+	if row, ok := m.Called(args...).Get(0).(*sqlx.Row); ok {
+		return row
+	}
+	return nil
+}
+
+func (m *MockHDb) BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error) {
+	called := m.Called(ctx, opts)
+	if tx, ok := called.Get(0).(*sqlx.Tx); ok {
+		return tx, called.Error(1)
+	}
+	return nil, called.Error(1)
+}
+
 // MockSearchService implements the search.Service interface for testing
 type MockSearchService struct {
 	mock.Mock
@@ -77,9 +122,71 @@ func (m *MockSearchService) Search(ctx context.Context, keywords []string) ([]se
 	return nil, args.Error(1)
 }
 
+// MockUsageService implements the usage.Service interface for testing
+type MockUsageService struct {
+	mock.Mock
+}
+
+func (m *MockUsageService) RecordUsage(ctx context.Context, req usage.RecordUsageRequest) error {
+	args := m.Called(ctx, req)
+	return args.Error(0)
+}
+
+func (m *MockUsageService) CheckQuota(ctx context.Context, req usage.CheckQuotaRequest) error {
+	args := m.Called(ctx, req)
+	return args.Error(0)
+}
+
+func (m *MockUsageService) GetSpend(ctx context.Context, req usage.GetSpendRequest) (usage.GetSpendResponse, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).(usage.GetSpendResponse), args.Error(1)
+}
+
+// MockChatManagementService implements the chatmanagement.Service interface for testing
+type MockChatManagementService struct {
+	mock.Mock
+}
+
+func (m *MockChatManagementService) GetConversations(ctx context.Context, req chatmanagement.GetConversationsRequest) (chatmanagement.GetConversationsResponse, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).(chatmanagement.GetConversationsResponse), args.Error(1)
+}
+
+func (m *MockChatManagementService) EditConversation(ctx context.Context, req chatmanagement.EditConversationRequest) (int, error) {
+	args := m.Called(ctx, req)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockChatManagementService) DeleteConversation(ctx context.Context, id int) (bool, error) {
+	args := m.Called(ctx, id)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockChatManagementService) CreateConversation(ctx context.Context, req chatmanagement.CreateConversationRequest) (int, error) {
+	args := m.Called(ctx, req)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockChatManagementService) GetMessagesByConversation(ctx context.Context, req chatmanagement.GetMessagesRequest) (chatmanagement.GetMessagesResponse, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).(chatmanagement.GetMessagesResponse), args.Error(1)
+}
+
+func (m *MockChatManagementService) CreateMessage(ctx context.Context, req chatmanagement.CreateMessageRequest) (chatmanagement.CreateMessageResponse, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).(chatmanagement.CreateMessageResponse), args.Error(1)
+}
+
 // mockChatServiceInstance is used to implement the singleton pattern
 var mockChatServiceInstance *ChatService
 
+var testCurrentSemester = semester.Semester{
+	Code:      "2024-2025-1",
+	Name:      "Học kỳ 1 năm học 2024-2025",
+	StartDate: time.Date(2024, time.September, 1, 0, 0, 0, 0, time.UTC),
+	EndDate:   time.Date(2025, time.January, 15, 0, 0, 0, 0, time.UTC),
+}
+
 // GetTestChatService creates a mock ChatService with mocked dependencies as a singleton
 func GetTestChatService() *ChatService {
 	if mockChatServiceInstance == nil {
@@ -94,17 +201,36 @@ func GetTestChatService() *ChatService {
 			log.Printf("Warning: OPENAI_API_KEY not found in environment")
 		}
 		// Initialize the mock dependencies
+		chatManagement := &MockChatManagementService{}
+		chatManagement.On("CreateMessage", mock.Anything, mock.Anything).Return(chatmanagement.CreateMessageResponse{ConversationId: 1}, nil)
+		semesterSrv := &testutil.MockSemesterService{}
+		semesterSrv.On("GetCurrentSemester", mock.Anything).Return(testCurrentSemester, nil)
+		usageSrv := &MockUsageService{}
+		usageSrv.On("CheckQuota", mock.Anything, mock.Anything).Return(nil).Maybe()
+		usageSrv.On("RecordUsage", mock.Anything, mock.Anything).Return(nil).Maybe()
 
 		mockChatServiceInstance = &ChatService{
-			aiProvider:   llm.NewOpenAIProvider(openai.NewClient(openAIKey)),
-			db:           &MockHDb{},
-			searchSrv:    &MockSearchService{},
-			funcRegistry: GetTestFuncRegistry(),
+			aiProvider:     llm.NewOpenAIProvider(openai.NewClient(openAIKey)),
+			db:             &MockHDb{},
+			searchSrv:      &MockSearchService{},
+			funcRegistry:   GetTestFuncRegistry(),
+			chatManagement: chatManagement,
+			semesterSrv:    semesterSrv,
+			usageSrv:       usageSrv,
 		}
 	}
 	return mockChatServiceInstance
 }
 
+// skipWithoutOpenAIKey skips the tests calling the real OpenAI provider in short mode or when no API key is set.
+// It must be called after GetTestChatService which loads the .env file.
+func skipWithoutOpenAIKey(t *testing.T) {
+	t.Helper()
+	if testing.Short() || os.Getenv("OPENAI_API_KEY") == "" {
+		t.Skip("Skipping integration test with real OpenAI API")
+	}
+}
+
 // GetTestFuncRegistry returns a singleton instance of the test function registry
 func GetTestFuncRegistry() llm.FuncRegistry {
 	if testFuncRegistryInstance == nil {
@@ -396,6 +522,7 @@ func registerTestFunctionDefinition() {
 func TestChatService_StreamChatResponseV2_WithTools(t *testing.T) {
 	// Get test service
 	srv := GetTestChatService()
+	skipWithoutOpenAIKey(t)
 
 	// Create request asking for student's own information
 	req := ChatRequest{
@@ -407,7 +534,9 @@ func TestChatService_StreamChatResponseV2_WithTools(t *testing.T) {
 				Id:      "msg_1",
 			},
 		},
-		SessionID: "test-session-123",
+		SessionID:  "test-session-123",
+		SpecificID: 123,
+		Role:       "student",
 	}
 
 	// Create the mock and store a reference to it
@@ -415,7 +544,11 @@ func TestChatService_StreamChatResponseV2_WithTools(t *testing.T) {
 	srv.db = mockDb
 
 	// Configure mock to return schema
-	mockDb.On("LoadDDL").Return("CREATE TABLE IF NOT EXISTS student (id INTEGER PRIMARY KEY, name TEXT, major TEXT, gpa REAL);", nil)
+	mockDb.On("LoadSchema", mock.Anything, "student").Return(&db.DatabaseSchema{Tables: []db.TableSchema{{
+		Name:       "student",
+		Columns:    []db.ColumnSchema{{Name: "id", Type: "integer"}, {Name: "name", Type: "text"}, {Name: "major", Type: "text"}, {Name: "gpa", Type: "real"}},
+		PrimaryKey: []string{"id"},
+	}}}, nil)
 
 	// Mock query execution for student information
 	studentResult := &db.QueryResult{
@@ -437,16 +570,16 @@ func TestChatService_StreamChatResponseV2_WithTools(t *testing.T) {
 	}
 
 	// Mock the ExecuteQuery method to return student data when queried with user ID
-	mockDb.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+	mockDb.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query db.QueryRequest) bool {
 		// Simple check if query contains student ID
-		return query != "" && query != "LOAD DDL"
+		return query.Query != "" && query.Query != "LOAD DDL"
 	})).Return(studentResult, nil)
 
 	// Buffer to collect streamed response
 	var responseBuffer bytes.Buffer
 
 	// Call the function being tested with student context and student ID
-	err := srv.StreamChatResponseV2(context.Background(), req, &responseBuffer, 123, "student")
+	err := srv.StreamChatResponseV2(context.Background(), req, &responseBuffer)
 
 	// Verify no error occurred
 	assert.Nil(t, err, "Expected no error, got: %v", err)
@@ -595,10 +728,8 @@ func TestValidateUserQuery_Query_WithRealAI(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Skip this test in short mode as it uses real AI calls
-			if testing.Short() {
-				t.Skip("Skipping test in short mode")
-			}
+			// Skip this test as it uses real AI calls
+			skipWithoutOpenAIKey(t)
 
 			result, err := svc.validateUserQuery(context.Background(), tt.query, tt.userId, tt.role)
 
@@ -749,10 +880,8 @@ func TestValidateUserQuery_WithRealAI(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Skip this test in short mode as it uses real AI calls
-			if testing.Short() {
-				t.Skip("Skipping test in short mode")
-			}
+			// Skip this test as it uses real AI calls
+			skipWithoutOpenAIKey(t)
 
 			result, err := svc.validateUserQuery(context.Background(), tt.query, tt.userId, tt.role)
 
@@ -769,17 +898,16 @@ func TestValidateUserQuery_WithRealAI(t *testing.T) {
 }
 
 func TestGetToolCallsByAI_WithRealAI_Extended(t *testing.T) {
-	// Skip this test in short mode as it uses real AI calls
-	if testing.Short() {
-		t.Skip("Skipping test in short mode")
-	}
-
-	// Get the service with real AI provider
+	// Get the service with real AI provider, skip this test as it uses real AI calls
 	svc := GetTestChatService()
+	skipWithoutOpenAIKey(t)
 	if err := godotenv.Load("../../config/.env"); err != nil {
 		log.Printf("Warning: failed to load .env file: %v", err)
 	}
-	myDb, _ := db.NewHDb("postgres", os.Getenv("DATABASE_URL"))
+	myDb, err := db.NewHDb("postgres", os.Getenv("DATABASE_URL"), nil, db.AuthorizationModeReject)
+	if err != nil {
+		t.Skipf("Skipping test, the database is not available: %v", err)
+	}
 	ddl, _ := myDb.LoadDDL()
 
 	tests := []struct {
@@ -924,12 +1052,12 @@ func TestGetToolCallsByAI_WithRealAI_Extended(t *testing.T) {
 	}
 
 	// Get the function definitions
-	funcDefs := svc.funcRegistry.GetFuncDefinitions()
+	funcDefs := svc.funcRegistry.GetFuncDefinitions(context.Background())
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Format the tool prompt with the query, now including user context
-			toolPrompt := fmt.Sprintf(ToolPromptTemplate, ddl, tt.userId, tt.userRole, tt.query)
+			toolPrompt := fmt.Sprintf(ToolPromptTemplate, ddl, tt.userId, tt.userRole, "2024-10-17", testCurrentSemester.String(), tt.query)
 
 			// Call the method being tested
 			response, err := svc.getToolCallsByAI(context.Background(), toolPrompt, funcDefs)
@@ -999,17 +1127,16 @@ func TestGetToolCallsByAI_WithRealAI_Extended(t *testing.T) {
 }
 
 func TestGetToolCallsByAI_MultipleTools(t *testing.T) {
-	// Skip this test in short mode as it uses real AI calls
-	if testing.Short() {
-		t.Skip("Skipping test in short mode")
-	}
-
-	// Get the service with real AI provider
+	// Get the service with real AI provider, skip this test as it uses real AI calls
 	svc := GetTestChatService()
+	skipWithoutOpenAIKey(t)
 	if err := godotenv.Load("../../config/.env"); err != nil {
 		log.Printf("Warning: failed to load .env file: %v", err)
 	}
-	myDb, _ := db.NewHDb("postgres", os.Getenv("DATABASE_URL"))
+	myDb, err := db.NewHDb("postgres", os.Getenv("DATABASE_URL"), nil, db.AuthorizationModeReject)
+	if err != nil {
+		t.Skipf("Skipping test, the database is not available: %v", err)
+	}
 	ddl, _ := myDb.LoadDDL()
 
 	// Query that likely requires multiple tool calls
@@ -1018,10 +1145,10 @@ func TestGetToolCallsByAI_MultipleTools(t *testing.T) {
 	userRole := "student"
 
 	// Format the tool prompt with the query and user context
-	toolPrompt := fmt.Sprintf(ToolPromptTemplate, ddl, userId, userRole, query)
+	toolPrompt := fmt.Sprintf(ToolPromptTemplate, ddl, userId, userRole, "2024-10-17", testCurrentSemester.String(), query)
 
 	// Get the function definitions
-	funcDefs := svc.funcRegistry.GetFuncDefinitions()
+	funcDefs := svc.funcRegistry.GetFuncDefinitions(context.Background())
 
 	// Call the method being tested
 	response, err := svc.getToolCallsByAI(context.Background(), toolPrompt, funcDefs)
@@ -1046,17 +1173,16 @@ func TestGetToolCallsByAI_MultipleTools(t *testing.T) {
 }
 
 func TestGetToolCallsByAI_MalformedQueries(t *testing.T) {
-	// Skip this test in short mode as it uses real AI calls
-	if testing.Short() {
-		t.Skip("Skipping test in short mode")
-	}
-
-	// Get the service with real AI provider
+	// Get the service with real AI provider, skip this test as it uses real AI calls
 	svc := GetTestChatService()
+	skipWithoutOpenAIKey(t)
 	if err := godotenv.Load("../../config/.env"); err != nil {
 		log.Printf("Warning: failed to load .env file: %v", err)
 	}
-	myDb, _ := db.NewHDb("postgres", os.Getenv("DATABASE_URL"))
+	myDb, err := db.NewHDb("postgres", os.Getenv("DATABASE_URL"), nil, db.AuthorizationModeReject)
+	if err != nil {
+		t.Skipf("Skipping test, the database is not available: %v", err)
+	}
 	ddl, _ := myDb.LoadDDL()
 
 	malformedQueries := []struct {
@@ -1104,12 +1230,12 @@ func TestGetToolCallsByAI_MalformedQueries(t *testing.T) {
 	}
 
 	// Get the function definitions
-	funcDefs := svc.funcRegistry.GetFuncDefinitions()
+	funcDefs := svc.funcRegistry.GetFuncDefinitions(context.Background())
 
 	for _, mq := range malformedQueries {
 		t.Run(mq.name, func(t *testing.T) {
 			// Format the tool prompt with the query and user context
-			toolPrompt := fmt.Sprintf(ToolPromptTemplate, ddl, mq.userId, mq.userRole, mq.query)
+			toolPrompt := fmt.Sprintf(ToolPromptTemplate, ddl, mq.userId, mq.userRole, "2024-10-17", testCurrentSemester.String(), mq.query)
 
 			// Call the method being tested
 			response, err := svc.getToolCallsByAI(context.Background(), toolPrompt, funcDefs)
@@ -3,6 +3,7 @@ package chatbot
 import (
 	"HNLP/be/internal/auth"
 	"HNLP/be/internal/middleware"
+	"HNLP/be/internal/usage"
 	"context"
 	"errors"
 	"github.com/gin-gonic/gin"
@@ -70,6 +71,14 @@ func (cc *ChatController) ChatStreamHandler(ctx *gin.Context) {
 			log.Println("Client disconnected during streaming")
 			return
 		}
+		if errors.Is(err, usage.ErrQuotaExceeded) {
+			ctx.String(http.StatusTooManyRequests, "%v", err)
+			return
+		}
+		if errors.Is(err, ErrModelNotAllowed) {
+			ctx.String(http.StatusBadRequest, "Invalid request: %v", err)
+			return
+		}
 		log.Printf("Service error: %v", err)
 		ctx.String(http.StatusInternalServerError, "Failed to stream response: %v", err)
 		return
@@ -78,6 +87,12 @@ func (cc *ChatController) ChatStreamHandler(ctx *gin.Context) {
 	log.Println("Request handled successfully")
 }
 
+// HealthHandler returns the circuit breaker states of the LLM providers
+func (cc *ChatController) HealthHandler(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"providers": cc.chatService.ProviderHealth()})
+}
+
 func (cc *ChatController) RegisterRoutes(router *gin.Engine, jwtService *auth.ServiceImpl) {
 	router.POST("/api/v1/chat/completions", middleware.Authenticate(jwtService), cc.ChatStreamHandler)
+	router.GET("/api/v1/chat/health", middleware.Authenticate(jwtService), middleware.HasAnyRole("admin"), cc.HealthHandler)
 }
@@ -0,0 +1,231 @@
+package chatbot
+
+import (
+	"HNLP/be/internal/chatmanagement"
+	"HNLP/be/internal/config"
+	"HNLP/be/internal/llm"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"log"
+	"strings"
+	"sync"
+)
+
+const (
+	// SummaryPromptTemplate asks the LLM to summarize the oldest turns of a conversation which don't fit in the token budget
+	SummaryPromptTemplate = `Summarize the following conversation between a user and the chatbot of the university.
+Keep the facts which can be needed to answer the next questions: the names, codes, semesters, courses and results mentioned by the user or the chatbot.
+Answer with the summary only, in the language of the conversation.
+
+%s
+`
+	// SummaryPrefix is the beginning of the system message replacing the summarized turns
+	SummaryPrefix = "Summary of the earlier conversation: "
+
+	// DefaultHistoryTokens is the token budget of the history for the models without a configured budget
+	DefaultHistoryTokens = 4000
+
+	// maxCachedSummaries is the number of conversations whose summary is kept in memory
+	maxCachedSummaries = 1000
+)
+
+// historySummary is the summary of the first Covered messages of a conversation
+type historySummary struct {
+	Covered int
+	// Digest identifies the covered messages, the summary isn't reused if they changed, e.g. a message was deleted
+	Digest  string
+	Summary string
+}
+
+// summaryCache keeps the last summary of each conversation, so that it isn't rebuilt on every turn
+type summaryCache struct {
+	mutex     sync.Mutex
+	summaries map[int]historySummary
+}
+
+func (c *summaryCache) get(conversationId int) (historySummary, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	summary, ok := c.summaries[conversationId]
+	return summary, ok
+}
+
+func (c *summaryCache) set(conversationId int, summary historySummary) {
+	if conversationId == 0 {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.summaries == nil {
+		c.summaries = make(map[int]historySummary)
+	}
+	if _, ok := c.summaries[conversationId]; !ok && len(c.summaries) >= maxCachedSummaries {
+		// Evict any conversation, the evicted summary is only rebuilt if the conversation continues
+		for id := range c.summaries {
+			delete(c.summaries, id)
+			break
+		}
+	}
+	c.summaries[conversationId] = summary
+}
+
+// loadHistory returns the previous turns of the conversation and the id of the conversation of the request.
+// The turns are loaded from the stored messages if the user owns the conversation, otherwise from the request,
+// whose system messages are sent as user messages: only the server gives system instructions.
+// The conversation id is 0 if the request doesn't have a conversation of the user, so a new one is created.
+func (cs *ChatService) loadHistory(ctx context.Context, req ChatRequest) ([]llm.Message, int) {
+	var history []llm.Message
+	for _, message := range req.Messages[:len(req.Messages)-1] {
+		if role := toLLMRole(message.Role); role != "" && message.Content != "" {
+			if role == openai.ChatMessageRoleSystem {
+				role = openai.ChatMessageRoleUser
+			}
+			history = append(history, llm.Message{Role: role, Content: message.Content})
+		}
+	}
+
+	if req.ConversationId == 0 {
+		return history, 0
+	}
+	if !cs.ownsConversation(ctx, req.UserID, req.ConversationId) {
+		log.Printf("User %d doesn't own conversation %d, a new conversation is created", req.UserID, req.ConversationId)
+		return history, 0
+	}
+
+	response, err := cs.chatManagement.GetMessagesByConversation(ctx, chatmanagement.GetMessagesRequest{ConversationId: req.ConversationId})
+	if err != nil {
+		log.Printf("Failed to load messages of conversation %d, using the history of the request: %v", req.ConversationId, err)
+		return history, req.ConversationId
+	}
+
+	history = make([]llm.Message, 0, len(response.Messages))
+	for _, message := range response.Messages {
+		if role := toLLMRole(string(message.SenderType)); role != "" && message.Content != "" {
+			history = append(history, llm.Message{Role: role, Content: message.Content})
+		}
+	}
+	return history, req.ConversationId
+}
+
+func (cs *ChatService) ownsConversation(ctx context.Context, userId int, conversationId int) bool {
+	response, err := cs.chatManagement.GetConversations(ctx, chatmanagement.GetConversationsRequest{UserId: userId})
+	if err != nil {
+		log.Printf("Failed to get conversations of user %d: %v", userId, err)
+		return false
+	}
+	for _, conversation := range response.Conversations {
+		if conversation.ID == conversationId {
+			return true
+		}
+	}
+	return false
+}
+
+// trimHistory fits the history in the token budget.
+// The newest turns are kept in 3/4 of the budget and the oldest ones are replaced by their summary.
+// The summary of the conversation of the context is cached and reused by the next turns while they fit in the budget,
+// then the cached summary and the turns after it are summarized again.
+// The tokens are estimated with llm.EstimateTokens, so the budget should keep a margin.
+func (cs *ChatService) trimHistory(ctx context.Context, history []llm.Message, budget int) []llm.Message {
+	if budget <= 0 || llm.EstimateTokens(history) <= budget {
+		return history
+	}
+
+	conversationId, _ := ctx.Value("conversationId").(int)
+	start, previous := 0, ""
+	if cached, ok := cs.summaries.get(conversationId); ok && cached.Covered <= len(history) && cached.Digest == digestMessages(history[:cached.Covered]) {
+		trimmed := append([]llm.Message{summaryMessage(cached.Summary)}, history[cached.Covered:]...)
+		if llm.EstimateTokens(trimmed) <= budget {
+			return trimmed
+		}
+		start, previous = cached.Covered, cached.Summary
+	}
+
+	split := len(history)
+	for split > start && llm.EstimateTokens(history[split-1:]) <= budget*3/4 {
+		split--
+	}
+	if split == start && previous != "" {
+		// No new turn to summarize, the newest turns alone don't fit in the budget
+		return append([]llm.Message{summaryMessage(previous)}, history[start:]...)
+	}
+	newest := history[split:]
+
+	summary, err := cs.summarizeHistory(ctx, previous, history[start:split])
+	if err != nil {
+		log.Printf("Failed to summarize %d messages, dropping them: %v", split-start, err)
+		return newest
+	}
+	cs.summaries.set(conversationId, historySummary{Covered: split, Digest: digestMessages(history[:split]), Summary: summary})
+	return append([]llm.Message{summaryMessage(summary)}, newest...)
+}
+
+// summarizeHistory summarizes the messages, following the previous summary of the conversation if it isn't empty
+func (cs *ChatService) summarizeHistory(ctx context.Context, previous string, history []llm.Message) (string, error) {
+	var transcript strings.Builder
+	if previous != "" {
+		transcript.WriteString(SummaryPrefix + previous + "\n")
+	}
+	for _, message := range history {
+		transcript.WriteString(fmt.Sprintf("%s: %s\n", message.Role, message.Content))
+	}
+
+	model := cs.modelFor(ctx, StageSummarization)
+	response, err := cs.complete(ctx, StageSummarization, llm.CompletionRequest{
+		Messages: []llm.Message{
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: fmt.Sprintf(SummaryPromptTemplate, transcript.String()),
+			},
+		},
+		Model:    model.Model,
+		Provider: model.Provider,
+	})
+	if err != nil {
+		return "", err
+	}
+	return response.Content, nil
+}
+
+// historyBudget returns the token budget of the history, which must fit in the requests of both the tool and the answer models
+func (cs *ChatService) historyBudget(toolModel config.ModelConfig, answerModel config.ModelConfig) int {
+	return min(cs.historyTokens(toolModel.Model), cs.historyTokens(answerModel.Model))
+}
+
+func (cs *ChatService) historyTokens(model string) int {
+	if tokens, ok := cs.cfg.HistoryTokens[model]; ok {
+		return tokens
+	}
+	return DefaultHistoryTokens
+}
+
+// toLLMRole converts the role of a message of the frontend or of the database to the role of the LLM message.
+// It returns an empty string for the unknown roles.
+func toLLMRole(role string) string {
+	switch role {
+	case openai.ChatMessageRoleUser:
+		return openai.ChatMessageRoleUser
+	case string(chatmanagement.SenderTypeBot), openai.ChatMessageRoleAssistant:
+		return openai.ChatMessageRoleAssistant
+	case openai.ChatMessageRoleSystem:
+		return openai.ChatMessageRoleSystem
+	default:
+		return ""
+	}
+}
+
+func summaryMessage(summary string) llm.Message {
+	return llm.Message{Role: openai.ChatMessageRoleSystem, Content: SummaryPrefix + summary}
+}
+
+// digestMessages hashes the roles and the contents of the messages
+func digestMessages(messages []llm.Message) string {
+	hash := sha256.New()
+	for _, message := range messages {
+		fmt.Fprintf(hash, "%s\x00%s\x00", message.Role, message.Content)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
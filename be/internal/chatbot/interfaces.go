@@ -9,9 +9,9 @@ type MessageRequest struct {
 
 type ChatRequest struct {
 	Messages       []MessageRequest `json:"messages"`
-	SessionID      string           `json:"session_id, omitempty"` // We don't support session yet
-	Model          string           `json:"model,omitempty"`       // un-support yet
-	Stream         bool             `json:"stream,omitempty"`      // un-support yet
+	SessionID      string           `json:"session_id,omitempty"` // We don't support session yet
+	Model          string           `json:"model,omitempty"`      // Optional, one of the allowed models of the config
+	Stream         bool             `json:"stream,omitempty"`     // un-support yet
 	UserID         int              `json:"user_id"`
 	SpecificID     int              `json:"specific_id"`
 	Role           string           `json:"role"`
@@ -20,6 +20,34 @@ type ChatRequest struct {
 
 type StreamResponse struct {
 	Choices []Choice `json:"choices"`
+	// Step is only set on the events reporting the progress of the agent loop, their choices are empty
+	Step *AgentStep `json:"step,omitempty"`
+	// ConversationId is sent in the first event, the conversation is created if the request doesn't have one
+	ConversationId int `json:"conversation_id,omitempty"`
+}
+
+// AgentStep is a round of tool calls made by the agent before answering
+type AgentStep struct {
+	Index     int              `json:"index"`
+	Status    string           `json:"status"` // running | completed
+	ToolCalls []ToolCallStatus `json:"tool_calls"`
+}
+
+type ToolCallStatus struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ToolCallRecord is a tool call saved with the bot message, with its result
+type ToolCallRecord struct {
+	Step      int    `json:"step"`
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+	Result    string `json:"result,omitempty"`
+	Error     string `json:"error,omitempty"`
 }
 
 type Choice struct {
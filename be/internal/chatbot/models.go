@@ -0,0 +1,68 @@
+package chatbot
+
+import (
+	"HNLP/be/internal/config"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"strings"
+)
+
+// Stage is a step of the chatbot which is configured with its own model
+type Stage string
+
+const (
+	// StageToolPlanning chooses the tool calls
+	StageToolPlanning Stage = "tool_planning"
+	// StageAnswer writes the answer from the results of the tool calls
+	StageAnswer Stage = "answer"
+	// StageValidation checks the user query against the policy of the role
+	StageValidation Stage = "validation"
+	// StageSummarization summarizes the oldest turns of the conversation
+	StageSummarization Stage = "summarization"
+)
+
+// ErrModelNotAllowed is returned when a chat request chooses a model which isn't allowed
+var ErrModelNotAllowed = errors.New("model not allowed")
+
+// DefaultStageModels are the models of the stages which aren't configured, they are sent to the first provider
+var DefaultStageModels = map[Stage]config.ModelConfig{
+	StageToolPlanning:  {Model: ToolModel},
+	StageAnswer:        {Model: AnswerModel},
+	StageValidation:    {Model: openai.GPT4oMini20240718},
+	StageSummarization: {Model: AnswerModel},
+}
+
+// modelFor returns the model of the stage for the role of the user in the context
+func (cs *ChatService) modelFor(ctx context.Context, stage Stage) config.ModelConfig {
+	role, _ := ctx.Value("userRole").(string)
+	return cs.stageModel(stage, role)
+}
+
+// stageModel returns the model of the stage for the role: the override of the role, then the model of the stage,
+// then the default model of the stage
+func (cs *ChatService) stageModel(stage Stage, role string) config.ModelConfig {
+	// viper lowercases the keys of the maps
+	if model, ok := cs.cfg.Models.Roles[strings.ToLower(role)][string(stage)]; ok && model.Model != "" {
+		return model
+	}
+	if model, ok := cs.cfg.Models.Stages[string(stage)]; ok && model.Model != "" {
+		return model
+	}
+	return DefaultStageModels[stage]
+}
+
+// answerModel returns the model writing the answer, the model chosen by the request if any.
+// It returns ErrModelNotAllowed if the chosen model isn't in the allowed models.
+func (cs *ChatService) answerModel(ctx context.Context, requested string) (config.ModelConfig, error) {
+	if requested == "" {
+		return cs.modelFor(ctx, StageAnswer), nil
+	}
+	for _, model := range cs.cfg.Models.Allowed {
+		if model.Model == requested {
+			return model, nil
+		}
+	}
+	return config.ModelConfig{}, fmt.Errorf("%w: %s", ErrModelNotAllowed, requested)
+}
@@ -0,0 +1,86 @@
+package chatbot
+
+import (
+	"HNLP/be/internal/config"
+	"HNLP/be/internal/db"
+	"HNLP/be/internal/llm"
+	"bytes"
+	"context"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+var testModelCatalog = config.ModelCatalogConfig{
+	Stages: map[string]config.ModelConfig{
+		"tool_planning": {Provider: "local", Model: "qwen2.5:14b"},
+		"answer":        {Provider: "openai", Model: openai.GPT4oMini20240718},
+	},
+	Roles: map[string]map[string]config.ModelConfig{
+		"admin": {"tool_planning": {Provider: "openai", Model: openai.O3Mini20250131}},
+	},
+	Allowed: []config.ModelConfig{{Provider: "gemini", Model: "gemini-2.0-flash"}},
+}
+
+func TestChatService_StageModel(t *testing.T) {
+	srv := &ChatService{cfg: config.ChatbotConfig{Models: testModelCatalog}}
+
+	tests := []struct {
+		name     string
+		stage    Stage
+		role     string
+		expected config.ModelConfig
+	}{
+		{name: "Configured stage", stage: StageToolPlanning, role: "student", expected: config.ModelConfig{Provider: "local", Model: "qwen2.5:14b"}},
+		{name: "Role override", stage: StageToolPlanning, role: "Admin", expected: config.ModelConfig{Provider: "openai", Model: openai.O3Mini20250131}},
+		{name: "Stage without override", stage: StageAnswer, role: "admin", expected: config.ModelConfig{Provider: "openai", Model: openai.GPT4oMini20240718}},
+		{name: "Default model", stage: StageSummarization, role: "student", expected: config.ModelConfig{Model: AnswerModel}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, srv.stageModel(tt.stage, tt.role))
+		})
+	}
+}
+
+func TestChatService_StreamChatResponseV2_UsesModelCatalog(t *testing.T) {
+	newService := func() (*ChatService, *MockAIProvider) {
+		return newAgentTestService(config.ChatbotConfig{Models: testModelCatalog}, func(ctx context.Context, req db.QueryRequest) (*db.QueryResult, error) {
+			return &db.QueryResult{}, nil
+		})
+	}
+	request := func(model string) ChatRequest {
+		return ChatRequest{
+			Messages: []MessageRequest{{Role: "user", Content: "Điểm của tôi?"}},
+			Model:    model,
+			Role:     "student",
+		}
+	}
+
+	t.Run("Allowed model", func(t *testing.T) {
+		srv, aiProvider := newService()
+		aiProvider.On("Complete", mock.Anything, mock.MatchedBy(func(req llm.CompletionRequest) bool {
+			return req.Provider == "local" && req.Model == "qwen2.5:14b"
+		})).Return(llm.Message{Role: openai.ChatMessageRoleAssistant}, nil).Once()
+		aiProvider.On("StreamComplete", mock.Anything, mock.MatchedBy(func(req llm.CompletionRequest) bool {
+			return req.Provider == "gemini" && req.Model == "gemini-2.0-flash"
+		})).Return(streamOf("Done"), nil).Once()
+
+		var response bytes.Buffer
+		require.NoError(t, srv.StreamChatResponseV2(context.Background(), request("gemini-2.0-flash"), &response))
+		aiProvider.AssertExpectations(t)
+	})
+
+	t.Run("Model not allowed", func(t *testing.T) {
+		srv, aiProvider := newService()
+
+		var response bytes.Buffer
+		err := srv.StreamChatResponseV2(context.Background(), request("gpt-4.5-preview"), &response)
+		assert.ErrorIs(t, err, ErrModelNotAllowed)
+		assert.Empty(t, response.String())
+		aiProvider.AssertNotCalled(t, "Complete", mock.Anything, mock.Anything)
+	})
+}
@@ -0,0 +1,138 @@
+package chatbot
+
+import (
+	"HNLP/be/internal/db"
+	"HNLP/be/internal/llm"
+	"context"
+	"github.com/sashabaranov/go-openai"
+	"log"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+const (
+	// The weights of the matches of the question with the terms of a table
+	tableNameWeight    = 3
+	tableKeywordWeight = 3
+	nameWordWeight     = 1
+	columnNameWeight   = 1
+	// neighbourWeight is the share of the score given to the tables linked by a foreign key, they are needed to join the matched tables
+	neighbourWeight = 0.25
+)
+
+// schemaForPrompt renders the tables the role can read which are the most relevant to the user query
+func (cs *ChatService) schemaForPrompt(ctx context.Context, role string, history []llm.Message, userQuery string) string {
+	schema, err := cs.db.LoadSchema(ctx, role)
+	if err != nil {
+		log.Printf("Failed to load the database schema: %v", err)
+		return ""
+	}
+
+	// A follow-up question is about the tables of the previous question, e.g. "and what about last semester?"
+	question := userQuery
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Role == openai.ChatMessageRoleUser {
+			question = history[i].Content + " " + question
+			break
+		}
+	}
+	return selectRelevantTables(schema, question, cs.cfg.TableKeywords, cs.cfg.MaxSchemaTables).Render()
+}
+
+// selectRelevantTables keeps the maxTables tables of the schema which are the most relevant to the question.
+// The relevance is a keyword match of the question with the names of the tables and their columns, and with the
+// configured keywords of the tables, e.g. the Vietnamese names of the tables.
+// All the tables are kept if maxTables is 0 or if no table matches the question.
+func selectRelevantTables(schema *db.DatabaseSchema, question string, tableKeywords map[string][]string, maxTables int) *db.DatabaseSchema {
+	if maxTables <= 0 || len(schema.Tables) <= maxTables {
+		return schema
+	}
+
+	question = " " + normalizeText(question) + " "
+	scores := make(map[string]float64, len(schema.Tables))
+	for _, table := range schema.Tables {
+		scores[table.Name] = scoreTable(table, question, tableKeywords[table.Name])
+	}
+
+	// Spread the scores along the foreign keys, in both directions
+	totalScores := make(map[string]float64, len(schema.Tables))
+	for _, table := range schema.Tables {
+		totalScores[table.Name] += scores[table.Name]
+		for _, fk := range table.ForeignKeys {
+			if _, ok := scores[fk.ReferencedTable]; ok {
+				totalScores[table.Name] += neighbourWeight * scores[fk.ReferencedTable]
+				totalScores[fk.ReferencedTable] += neighbourWeight * scores[table.Name]
+			}
+		}
+	}
+
+	ranked := make([]string, 0, len(schema.Tables))
+	for _, table := range schema.Tables {
+		if totalScores[table.Name] > 0 {
+			ranked = append(ranked, table.Name)
+		}
+	}
+	if len(ranked) == 0 {
+		return schema
+	}
+	slices.SortStableFunc(ranked, func(a, b string) int {
+		switch {
+		case totalScores[a] > totalScores[b]:
+			return -1
+		case totalScores[a] < totalScores[b]:
+			return 1
+		default:
+			return 0
+		}
+	})
+	selected := ranked[:min(maxTables, len(ranked))]
+
+	// Keep the order of the schema in the prompt
+	return schema.Filter(
+		func(table string) bool {
+			return slices.Contains(selected, table)
+		},
+		func(table string, column string) bool {
+			return true
+		},
+	)
+}
+
+func scoreTable(table db.TableSchema, question string, keywords []string) float64 {
+	score := 0.0
+	name := normalizeText(table.Name)
+	if containsTerm(question, name) {
+		score += tableNameWeight
+	}
+	for _, word := range strings.Fields(name) {
+		if containsTerm(question, word) {
+			score += nameWordWeight
+		}
+	}
+	for _, keyword := range keywords {
+		if containsTerm(question, normalizeText(keyword)) {
+			score += tableKeywordWeight
+		}
+	}
+	for _, column := range table.Columns {
+		// The columns like id are in every table, they don't tell which table is relevant
+		if column.Name != "id" && containsTerm(question, normalizeText(column.Name)) {
+			score += columnNameWeight
+		}
+	}
+	return score
+}
+
+// containsTerm reports whether the normalized question, padded with spaces, contains the term as whole words
+func containsTerm(question string, term string) bool {
+	return term != "" && strings.Contains(question, " "+term+" ")
+}
+
+// normalizeText lowercases the text and replaces everything but the letters and the digits by single spaces,
+// so the snake case names of the schema can be matched against the words of the question
+func normalizeText(text string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
@@ -0,0 +1,75 @@
+package chatbot
+
+import (
+	"HNLP/be/internal/db"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSelectRelevantTables(t *testing.T) {
+	schema := &db.DatabaseSchema{Tables: []db.TableSchema{
+		{Name: "faculty", Columns: []db.ColumnSchema{{Name: "id"}, {Name: "name"}}},
+		{Name: "course", Columns: []db.ColumnSchema{{Name: "id"}, {Name: "code"}, {Name: "credits"}}},
+		{Name: "course_class", Columns: []db.ColumnSchema{{Name: "id"}, {Name: "course_id"}, {Name: "semester_id"}},
+			ForeignKeys: []db.ForeignKey{{Columns: []string{"course_id"}, ReferencedTable: "course", ReferencedColumns: []string{"id"}}}},
+		{Name: "course_class_enrollment", Columns: []db.ColumnSchema{{Name: "id"}, {Name: "course_class_id"}, {Name: "grade"}},
+			ForeignKeys: []db.ForeignKey{{Columns: []string{"course_class_id"}, ReferencedTable: "course_class", ReferencedColumns: []string{"id"}}}},
+		{Name: "student", Columns: []db.ColumnSchema{{Name: "id"}, {Name: "name"}}},
+	}}
+	keywords := map[string][]string{
+		"course":                  {"môn học"},
+		"course_class":            {"lớp học phần", "học kỳ"},
+		"course_class_enrollment": {"điểm"},
+		"student":                 {"sinh viên"},
+	}
+
+	tests := []struct {
+		name           string
+		question       string
+		maxTables      int
+		expectedTables []string
+	}{
+		{
+			name:           "Keywords of the tables",
+			question:       "Điểm các môn học của tôi?",
+			maxTables:      2,
+			expectedTables: []string{"course", "course_class_enrollment"},
+		},
+		{
+			name:      "Linked tables rank above unrelated ones",
+			question:  "Điểm các môn học học kỳ này?",
+			maxTables: 3,
+			// course_class matches itself and is linked to both course and course_class_enrollment
+			expectedTables: []string{"course", "course_class", "course_class_enrollment"},
+		},
+		{
+			name:           "Names of the tables and columns",
+			question:       "How many credits has the course CS101?",
+			maxTables:      1,
+			expectedTables: []string{"course"},
+		},
+		{
+			name:           "No match keeps every table",
+			question:       "Xin chào",
+			maxTables:      2,
+			expectedTables: []string{"faculty", "course", "course_class", "course_class_enrollment", "student"},
+		},
+		{
+			name:           "No limit keeps every table",
+			question:       "Điểm của tôi?",
+			maxTables:      0,
+			expectedTables: []string{"faculty", "course", "course_class", "course_class_enrollment", "student"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected := selectRelevantTables(schema, tt.question, keywords, tt.maxTables)
+			var names []string
+			for _, table := range selected.Tables {
+				names = append(names, table.Name)
+			}
+			assert.Equal(t, tt.expectedTables, names)
+		})
+	}
+}
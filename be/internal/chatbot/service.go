@@ -2,17 +2,24 @@ package chatbot
 
 import (
 	"HNLP/be/internal/chatmanagement"
+	"HNLP/be/internal/config"
 	"HNLP/be/internal/db"
 	"HNLP/be/internal/llm"
 	"HNLP/be/internal/search"
+	"HNLP/be/internal/semester"
+	"HNLP/be/internal/usage"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/invopop/jsonschema"
 	"github.com/sashabaranov/go-openai"
 	"io"
 	"log"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 )
 
 const (
@@ -20,17 +27,32 @@ const (
 Your task is base on given tool, answer user query.
 You should prioritize the function call that is most relevant to the user query.
 In case you don't find any relevant function, you generate a Postgres SQL to use executeQuery function to run SQL query.
+Prefer the domain functions like GetMySchedule, GetTranscript or FindCourseClasses to executeQuery for the questions they answer, their semester argument takes the words of the user like "kỳ này" directly.
 You should not use any other function to retrieve data, try to avoid use LIKE operator in SQL query, but if user query is too vague, you can use LIKE operator to get the data.
 Here is the database schema: %s
 
 Note that we have 3 concept about course, Lớp học phần is course_class, Lịch học is course_class_schedule, Môn học là course.
 When you want to select course_class_schedule of a semester, you should join it with course_class to leverage course_class.semester_id
 User ID is %d (This will be id of student or professor), User role is %s.
-Note that current semester is 2024-2025-1 and semester have format like yyyy-yy-x where x is 1,2. And you should only use it to filter if user request.
+Today is %s and the current semester is %s. Semester have format like yyyy-yyyy-x where x is 1,2 or 3 for the summer semester, it is semester.code and course_class.semester_id.
+When user mentions a semester like "kỳ trước" or "học kỳ 2 năm ngoái", use ResolveSemester function to get its code. And you should only use it to filter if user request.
 When user specify a specific name, you should use it to filter the data.
+The previous messages are the conversation with the user, use them to understand what the user query refers to.
 Here is the user query: %s
 In case there is not data return, you should inform user that there is no data or user does not have permission to access the data.
 `
+	// RepairPromptTemplate asks the LLM to correct the tool calls which failed with the given errors
+	RepairPromptTemplate = `The tool calls %s failed with the errors above.
+Fix the arguments of the call (e.g. correct the SQL syntax, the table or column names, or add the conditions required by the authorization policy) and call the tool again.
+`
+
+	// ToolModel chooses the tool calls and AnswerModel writes the answer from their results, unless other models
+	// are configured for these stages
+	ToolModel   = openai.O3Mini20250131
+	AnswerModel = openai.GPT4oMini20240718
+
+	// DefaultMaxSteps is the number of tool call rounds of the agent loop when it isn't configured
+	DefaultMaxSteps = 5
 )
 
 // IChatService defines the interface for chat services.
@@ -44,15 +66,24 @@ type ChatService struct {
 	searchSrv      search.Service
 	funcRegistry   llm.FuncRegistry
 	chatManagement chatmanagement.Service
+	semesterSrv    semester.Service
+	usageSrv       usage.Service
+	cfg            config.ChatbotConfig
+	// summaries caches the summary of the oldest turns of the conversations, see trimHistory
+	summaries summaryCache
 }
 
 // NewChatService creates a new instance of ChatService.
-func NewChatService(aiProvider llm.AIProvider, db db.HDb, searchSrv search.Service, funcRegistry llm.FuncRegistry) *ChatService {
+func NewChatService(aiProvider llm.AIProvider, db db.HDb, searchSrv search.Service, funcRegistry llm.FuncRegistry, chatManagement chatmanagement.Service, semesterSrv semester.Service, usageSrv usage.Service, cfg config.ChatbotConfig) *ChatService {
 	service := ChatService{
-		aiProvider:   aiProvider,
-		db:           db,
-		searchSrv:    searchSrv,
-		funcRegistry: funcRegistry,
+		aiProvider:     aiProvider,
+		db:             db,
+		searchSrv:      searchSrv,
+		funcRegistry:   funcRegistry,
+		chatManagement: chatManagement,
+		semesterSrv:    semesterSrv,
+		usageSrv:       usageSrv,
+		cfg:            cfg,
 	}
 	return &service
 }
@@ -75,84 +106,146 @@ func (cs *ChatService) StreamChatResponseV2(ctx context.Context, req ChatRequest
 	ctx = context.WithValue(ctx, "userId", req.UserID)
 	ctx = context.WithValue(ctx, "specificId", req.SpecificID)
 	ctx = context.WithValue(ctx, "userRole", req.Role)
+	ctx = context.WithValue(ctx, "userScopes", cs.cfg.ToolScopes[strings.ToLower(req.Role)])
 
-	// Step 2: Prepare LLM messages
-	dbDDL, err := cs.db.LoadDDL()
-	toolPrompt := fmt.Sprintf(ToolPromptTemplate, dbDDL, req.SpecificID, req.Role, req.Messages[len(req.Messages)-1].Content)
-	funcDefs := cs.funcRegistry.GetFuncDefinitions()
-
-	toolResponse, err := cs.getToolCallsByAI(ctx, toolPrompt, funcDefs)
+	answerModel, err := cs.answerModel(ctx, req.Model)
 	if err != nil {
-		log.Printf("Failed to get tool calls: %v", err)
 		return err
 	}
+	// The quota is checked before each call, it is checked first to answer before the stream starts
+	if err := cs.checkQuota(ctx); err != nil {
+		return err
+	}
+
+	// Load the previous turns before saving the user message, a new conversation is created if the request doesn't have one
+	userQuery := req.Messages[len(req.Messages)-1].Content
+	history, conversationId := cs.loadHistory(ctx, req)
+	ctx = context.WithValue(ctx, "conversationId", conversationId)
+	history = cs.trimHistory(ctx, history, cs.historyBudget(cs.modelFor(ctx, StageToolPlanning), answerModel))
+	conversationId = cs.saveMessage(ctx, conversationId, req.UserID, chatmanagement.SenderTypeUser, userQuery, nil)
+	ctx = context.WithValue(ctx, "conversationId", conversationId)
+	if conversationId != 0 {
+		if err := writeSSEResponse(w, StreamResponse{Choices: []Choice{}, ConversationId: conversationId}); err != nil {
+			return err
+		}
+	}
 
-	toolResults := make(map[string]string)
-	for _, toolCall := range toolResponse.ToolCalls {
-		executedResult, err := cs.funcRegistry.Execute(ctx, toolCall)
+	// Step 2: Prepare LLM messages
+	dbDDL := cs.schemaForPrompt(ctx, req.Role, history, userQuery)
+	toolPrompt := fmt.Sprintf(ToolPromptTemplate, dbDDL, req.SpecificID, req.Role, time.Now().Format(semester.DateLayout), cs.currentSemesterForPrompt(ctx), userQuery)
+	funcDefs := cs.funcRegistry.GetFuncDefinitions(ctx)
+
+	messages := append(history, llm.Message{
+		Role:    openai.ChatMessageRoleUser,
+		Content: toolPrompt,
+	})
+
+	// Step 3: Run the agent loop, each step executes the tool calls of the AI and gives their results back to it
+	// until the AI stops calling tools or the step or token budget runs out.
+	// A failed call is given back to the AI to be corrected up to MaxRepairAttempts times
+	repairAttempts := 0
+	var toolCallRecords []ToolCallRecord
+	for step := 0; ; step++ {
+		// The first step must call a tool to ground the answer on the database
+		mode := llm.Auto
+		if step == 0 {
+			mode = llm.Required
+		}
+		toolResponse, err := cs.completeToolCalls(ctx, messages, funcDefs, mode)
 		if err != nil {
-			log.Printf("Failed to execute tool call: %v", err)
+			log.Printf("Failed to get tool calls: %v", err)
+			return err
+		}
+		if len(toolResponse.ToolCalls) == 0 {
+			break
+		}
 
-			resp := StreamResponse{
-				Choices: []Choice{{Delta: Delta{Content: err.Error()}}},
+		if err := writeStepEvent(w, step, "running", toolResponse.ToolCalls, nil); err != nil {
+			return err
+		}
+		results := cs.executeToolCalls(ctx, toolResponse.ToolCalls)
+		if err := writeStepEvent(w, step, "completed", toolResponse.ToolCalls, results); err != nil {
+			return err
+		}
+		messages = append(messages, buildStepMessages(toolResponse, results)...)
+		toolCallRecords = append(toolCallRecords, buildToolCallRecords(step, results)...)
+
+		var failedCalls []string
+		var firstErr error
+		for _, result := range results {
+			if result.err != nil {
+				log.Printf("Failed to execute tool call %s (step %d): %v", result.call.Function.Name, step+1, result.err)
+				failedCalls = append(failedCalls, result.call.Function.Name)
+				if firstErr == nil {
+					firstErr = result.err
+				}
 			}
-
-			if err := writeSSEResponse(w, resp); err != nil {
-				return err
+		}
+		if firstErr != nil {
+			repairAttempts++
+			if repairAttempts > cs.cfg.MaxRepairAttempts || ctx.Err() != nil {
+				resp := StreamResponse{
+					Choices: []Choice{{Delta: Delta{Content: firstErr.Error()}}},
+				}
+
+				if err := writeSSEResponse(w, resp); err != nil {
+					return err
+				}
+				fmt.Fprintf(w, "data: [DONE]\n\n")
+				if conversationId != 0 {
+					cs.saveMessage(ctx, conversationId, req.UserID, chatmanagement.SenderTypeBot, firstErr.Error(), toolCallRecords)
+				}
+				return nil
 			}
-			fmt.Fprintf(w, "data: [DONE]\n\n")
-			return nil
-
 		}
 
-		toolResults[toolCall.ID] = executedResult
-	}
-
-	// Step 4: Recall the AI provider to get the final answer
-	naturalLangRequest := llm.CompletionRequest{
-		Messages: []llm.Message{
-			{
+		if step+1 >= cs.maxSteps() {
+			log.Printf("Agent loop stopped after %d steps", step+1)
+			break
+		}
+		if cs.cfg.MaxTokens > 0 && llm.EstimateTokens(messages) >= cs.cfg.MaxTokens {
+			log.Printf("Agent loop stopped after %d steps, token budget of %d reached", step+1, cs.cfg.MaxTokens)
+			break
+		}
+		if firstErr != nil {
+			messages = append(messages, llm.Message{
 				Role:    openai.ChatMessageRoleUser,
-				Content: toolPrompt,
-			},
-			{
-				Role:       openai.ChatMessageRoleAssistant,
-				Content:    toolResponse.Content,
-				ToolCalls:  toolResponse.ToolCalls,
-				ToolCallId: toolResponse.ToolCallId,
-				Id:         toolResponse.Id,
-			},
-		},
-		Model: openai.GPT4oMini20240718,
+				Content: fmt.Sprintf(RepairPromptTemplate, strings.Join(failedCalls, ", ")),
+			})
+			log.Printf("Repair attempt %d/%d", repairAttempts, cs.cfg.MaxRepairAttempts)
+		}
 	}
 
-	for toolId, result := range toolResults {
-		naturalLangRequest.Messages = append(naturalLangRequest.Messages, llm.Message{
-			Role:       openai.ChatMessageRoleTool,
-			Content:    result,
-			ToolCallId: toolId,
-		})
+	// Step 4: Recall the AI provider to get the final answer from the whole history of tool calls
+	naturalLangRequest := llm.CompletionRequest{
+		Messages: messages,
+		Model:    answerModel.Model,
+		Provider: answerModel.Provider,
 	}
 
 	// Step 5: Stream the response
-	chunks, err := cs.aiProvider.StreamComplete(ctx, naturalLangRequest)
+	chunks, err := cs.streamComplete(ctx, naturalLangRequest)
 	if err != nil {
 		log.Printf("Failed to stream complete results: %v", err)
 		return err
 	}
 
 	// Accumulate the complete bot response
-	//var fullContent strings.Builder
+	var fullContent strings.Builder
 
 	for chunk := range chunks {
 		if chunk.Done {
+			cs.recordUsage(ctx, StageAnswer, naturalLangRequest.Model, chunk.Usage)
 			// Save the complete bot message to the conversation
 			fmt.Fprintf(w, "data: [DONE]\n\n")
+			if conversationId != 0 {
+				cs.saveMessage(ctx, conversationId, req.UserID, chatmanagement.SenderTypeBot, fullContent.String(), toolCallRecords)
+			}
 			return nil
 		}
 
-		//// Accumulate content for saving later
-		//fullContent.WriteString(chunk.Content)
+		// Accumulate content for saving later
+		fullContent.WriteString(chunk.Content)
 
 		// Format SSE response
 		resp := StreamResponse{
@@ -167,17 +260,33 @@ func (cs *ChatService) StreamChatResponseV2(ctx context.Context, req ChatRequest
 	return nil
 }
 
+// ProviderHealth returns the health of the LLM providers, or nil if the provider doesn't track it
+func (cs *ChatService) ProviderHealth() []llm.ProviderHealth {
+	reporter, ok := cs.aiProvider.(llm.HealthReporter)
+	if !ok {
+		return nil
+	}
+	return reporter.Health()
+}
+
 func (cs *ChatService) getToolCallsByAI(ctx context.Context, toolPrompt string, funcDefs []llm.FuncDefinition) (llm.Message, error) {
-	toolRequest := llm.CompletionRequest{
-		Messages: []llm.Message{
-			{
-				Role:    openai.ChatMessageRoleUser,
-				Content: toolPrompt,
-			},
+	return cs.completeToolCalls(ctx, []llm.Message{
+		{
+			Role:    openai.ChatMessageRoleUser,
+			Content: toolPrompt,
 		},
-		Model:               openai.O3Mini20250131,
+	}, funcDefs, llm.Required)
+}
+
+// completeToolCalls asks the AI for the tool calls answering the conversation
+func (cs *ChatService) completeToolCalls(ctx context.Context, messages []llm.Message, funcDefs []llm.FuncDefinition, mode llm.FunctionCallingMode) (llm.Message, error) {
+	model := cs.modelFor(ctx, StageToolPlanning)
+	toolRequest := llm.CompletionRequest{
+		Messages:            messages,
+		Model:               model.Model,
+		Provider:            model.Provider,
 		Tools:               make([]llm.Tool, 0),
-		FunctionCallingMode: llm.Required,
+		FunctionCallingMode: mode,
 	}
 
 	// Convert function definitions to tools
@@ -189,10 +298,67 @@ func (cs *ChatService) getToolCallsByAI(ctx context.Context, toolPrompt string,
 	}
 
 	// Step 3: Get tool call
-	toolResponse, err := cs.aiProvider.Complete(ctx, toolRequest)
+	toolResponse, err := cs.complete(ctx, StageToolPlanning, toolRequest)
 	return toolResponse, err
 }
 
+// toolResult is the outcome of a tool call, content is only set if the call succeeded
+type toolResult struct {
+	call    llm.ToolCall
+	content string
+	err     error
+}
+
+// executeToolCalls executes the independent tool calls of a step concurrently and returns their results in the order of the calls
+func (cs *ChatService) executeToolCalls(ctx context.Context, toolCalls []llm.ToolCall) []toolResult {
+	results := make([]toolResult, len(toolCalls))
+	var wg sync.WaitGroup
+	for i, toolCall := range toolCalls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			content, err := cs.funcRegistry.Execute(ctx, toolCall)
+			results[i] = toolResult{call: toolCall, content: content, err: err}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// saveMessage saves a message of the conversation and returns the id of the conversation, or 0 if it can't be saved.
+// The chat keeps working without history, so the errors are only logged.
+func (cs *ChatService) saveMessage(ctx context.Context, conversationId int, userId int, role chatmanagement.SenderType, content string, toolCalls []ToolCallRecord) int {
+	request := chatmanagement.CreateMessageRequest{
+		ConversationId: &conversationId,
+		Content:        content,
+		Role:           role,
+		UserId:         userId,
+	}
+	if len(toolCalls) > 0 {
+		toolCallsJSON, err := json.Marshal(toolCalls)
+		if err != nil {
+			log.Printf("Failed to marshal tool calls: %v", err)
+		}
+		request.ToolCalls = toolCallsJSON
+	}
+
+	// The message must be saved even if the client disconnected at the end of the stream
+	response, err := cs.chatManagement.CreateMessage(context.WithoutCancel(ctx), request)
+	if err != nil {
+		log.Printf("Failed to save %s message of conversation %d: %v", role, conversationId, err)
+		return 0
+	}
+	return response.ConversationId
+}
+
+// maxSteps returns the number of tool call rounds allowed in the agent loop
+func (cs *ChatService) maxSteps() int {
+	if cs.cfg.MaxSteps <= 0 {
+		return DefaultMaxSteps
+	}
+	return cs.cfg.MaxSteps
+}
+
 // ValidationResult holds the outcome of query validation
 type ValidationResult struct {
 	IsValid bool   `json:"is_valid" jsonschema:"description=Indicates if the query is valid based on user role"`
@@ -212,7 +378,10 @@ These table, info are accessible for all roles: program, semester, course, cours
 		ExpandedStruct: false,
 	}
 
+	model := cs.stageModel(StageValidation, role)
 	validationRequest := llm.CompletionRequest{
+		Model:    model.Model,
+		Provider: model.Provider,
 		Messages: []llm.Message{
 			{
 				Content: prompt,
@@ -226,7 +395,7 @@ These table, info are accessible for all roles: program, semester, course, cours
 		},
 	}
 
-	response, err := cs.aiProvider.Complete(ctx, validationRequest)
+	response, err := cs.complete(ctx, StageValidation, validationRequest)
 	if err != nil {
 		return ValidationResult{}, fmt.Errorf("failed to validate user query: %v", err)
 	}
@@ -241,6 +410,83 @@ These table, info are accessible for all roles: program, semester, course, cours
 
 //------------------Private helper functions------------------
 
+// buildStepMessages builds the assistant message of a step followed by the result of each of its tool calls
+func buildStepMessages(toolResponse llm.Message, results []toolResult) []llm.Message {
+	messages := []llm.Message{
+		{
+			Role:       openai.ChatMessageRoleAssistant,
+			Content:    toolResponse.Content,
+			ToolCalls:  toolResponse.ToolCalls,
+			ToolCallId: toolResponse.ToolCallId,
+			Id:         toolResponse.Id,
+		},
+	}
+	for _, result := range results {
+		content := result.content
+		if result.err != nil {
+			content = formatToolError(result.err)
+		}
+		messages = append(messages, llm.Message{
+			Role:       openai.ChatMessageRoleTool,
+			Content:    content,
+			ToolCallId: result.call.ID,
+		})
+	}
+	return messages
+}
+
+// buildToolCallRecords records the tool calls of a step with their results to save them with the bot message
+func buildToolCallRecords(step int, results []toolResult) []ToolCallRecord {
+	records := make([]ToolCallRecord, 0, len(results))
+	for _, result := range results {
+		record := ToolCallRecord{Step: step, ID: result.call.ID, Result: result.content}
+		if result.call.Function != nil {
+			record.Name = result.call.Function.Name
+			record.Arguments = result.call.Function.Arguments
+		}
+		if result.err != nil {
+			record.Error = result.err.Error()
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// writeStepEvent reports the progress of a step of the agent loop, the errors are only known once the step is completed
+func writeStepEvent(w io.Writer, index int, status string, toolCalls []llm.ToolCall, results []toolResult) error {
+	step := &AgentStep{Index: index, Status: status, ToolCalls: make([]ToolCallStatus, 0, len(toolCalls))}
+	for i, toolCall := range toolCalls {
+		callStatus := ToolCallStatus{ID: toolCall.ID}
+		if toolCall.Function != nil {
+			callStatus.Name = toolCall.Function.Name
+			callStatus.Arguments = toolCall.Function.Arguments
+		}
+		if i < len(results) && results[i].err != nil {
+			callStatus.Error = results[i].err.Error()
+		}
+		step.ToolCalls = append(step.ToolCalls, callStatus)
+	}
+	return writeSSEResponse(w, StreamResponse{Choices: []Choice{}, Step: step})
+}
+
+// formatToolError formats the error of a tool call for the AI.
+// The message of a rejected query is written for the user, so we add the explanation of the authorization failure.
+func formatToolError(err error) string {
+	content := "Error: " + err.Error()
+	var rejectedErr *db.QueryRejectedError
+	if errors.As(err, &rejectedErr) && rejectedErr.Explanation != nil {
+		content += "\n" + rejectedErr.Explanation.String()
+	}
+	// The invalid arguments are listed field by field so the model can correct the call
+	var validationErr *llm.ValidationError
+	if errors.As(err, &validationErr) {
+		if invalidArgs, marshalErr := json.Marshal(validationErr); marshalErr == nil {
+			content += "\n" + string(invalidArgs)
+		}
+	}
+	return content
+}
+
 func convertQueryResultToJSONString(queryResult *db.QueryResult) (string, error) {
 	jsonBytes, err := json.MarshalIndent(queryResult, "", "  ") // Use MarshalIndent for pretty JSON
 	if err != nil {
@@ -268,3 +514,14 @@ func writeSSEResponse(w io.Writer, resp StreamResponse) error {
 
 	return nil
 }
+
+// currentSemesterForPrompt describes the current semester for the prompt, the LLM can still resolve it with the
+// ResolveSemester function if the semesters can't be loaded
+func (cs *ChatService) currentSemesterForPrompt(ctx context.Context) string {
+	current, err := cs.semesterSrv.GetCurrentSemester(ctx)
+	if err != nil {
+		log.Printf("Failed to get the current semester: %v", err)
+		return "unknown"
+	}
+	return current.String()
+}
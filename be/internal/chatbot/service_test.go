@@ -0,0 +1,405 @@
+package chatbot
+
+import (
+	"HNLP/be/internal/chatmanagement"
+	"HNLP/be/internal/config"
+	"HNLP/be/internal/db"
+	"HNLP/be/internal/llm"
+	"HNLP/be/internal/testutil"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newRepairTestService(maxRepairAttempts int, executeQuery func(ctx context.Context, req db.QueryRequest) (*db.QueryResult, error)) (*ChatService, *MockAIProvider) {
+	return newAgentTestService(config.ChatbotConfig{MaxRepairAttempts: maxRepairAttempts}, executeQuery)
+}
+
+func newAgentTestService(cfg config.ChatbotConfig, executeQuery func(ctx context.Context, req db.QueryRequest) (*db.QueryResult, error)) (*ChatService, *MockAIProvider) {
+	mockDb := &MockHDb{}
+	mockDb.On("LoadSchema", mock.Anything, mock.Anything).Return(&db.DatabaseSchema{Tables: []db.TableSchema{{
+		Name:       "student",
+		Columns:    []db.ColumnSchema{{Name: "id", Type: "integer"}, {Name: "name", Type: "text"}},
+		PrimaryKey: []string{"id"},
+	}}}, nil)
+
+	funcRegistry := llm.NewFunctionRegistryImpl()
+	funcRegistry.Register(llm.FuncWrapper("ExecuteQuery", "Run a SQL query", executeQuery))
+
+	chatManagement := &MockChatManagementService{}
+	chatManagement.On("CreateMessage", mock.Anything, mock.Anything).Return(chatmanagement.CreateMessageResponse{ConversationId: 1}, nil)
+
+	semesterSrv := &testutil.MockSemesterService{}
+	semesterSrv.On("GetCurrentSemester", mock.Anything).Return(testCurrentSemester, nil)
+
+	usageSrv := &MockUsageService{}
+	usageSrv.On("CheckQuota", mock.Anything, mock.Anything).Return(nil).Maybe()
+	usageSrv.On("RecordUsage", mock.Anything, mock.Anything).Return(nil).Maybe()
+
+	aiProvider := &MockAIProvider{}
+	return NewChatService(aiProvider, mockDb, &MockSearchService{}, funcRegistry, chatManagement, semesterSrv, usageSrv, cfg), aiProvider
+}
+
+func queryToolCall(id string, query string) llm.Message {
+	return llm.Message{
+		Role: openai.ChatMessageRoleAssistant,
+		ToolCalls: []llm.ToolCall{{
+			ID:       id,
+			Type:     llm.ToolTypeFunction,
+			Function: &llm.FunctionCall{Name: "ExecuteQuery", Arguments: `{"query": "` + query + `"}`},
+		}},
+	}
+}
+
+func streamOf(contents ...string) <-chan llm.StreamChunk {
+	chunks := make(chan llm.StreamChunk, len(contents)+1)
+	for _, content := range contents {
+		chunks <- llm.StreamChunk{Content: content}
+	}
+	chunks <- llm.StreamChunk{Done: true}
+	close(chunks)
+	return chunks
+}
+
+func TestChatService_StreamChatResponseV2_RepairsFailedToolCall(t *testing.T) {
+	var executedQueries []string
+	srv, aiProvider := newRepairTestService(2, func(ctx context.Context, req db.QueryRequest) (*db.QueryResult, error) {
+		executedQueries = append(executedQueries, req.Query)
+		switch req.Query {
+		case "SELEC name FROM student":
+			return nil, errors.New(`error executing query: pq: syntax error at or near "SELEC"`)
+		case "SELECT name FROM student":
+			return nil, &db.QueryRejectedError{
+				Message: "Xin lỗi bạn không có quyền truy cập vào dữ liệu này",
+				Explanation: &db.AuthorizationExplanation{
+					Role:   "student",
+					Reason: "The tables are read without any condition on their authorize columns",
+					Tables: []db.UnauthorizedTable{{Alias: "student", Table: "student", Conditions: []db.AuthorizationCondition{{AuthorizeColumn: "id", ExpectedValues: []int{1}}}}},
+				},
+			}
+		default:
+			return &db.QueryResult{Data: []map[string]interface{}{{"name": "Nguyen Van A"}}}, nil
+		}
+	})
+
+	aiProvider.On("Complete", mock.Anything, mock.MatchedBy(func(req llm.CompletionRequest) bool { return len(req.Messages) == 1 })).
+		Return(queryToolCall("call_1", "SELEC name FROM student"), nil).Once()
+	aiProvider.On("Complete", mock.Anything, mock.MatchedBy(func(req llm.CompletionRequest) bool { return len(req.Messages) == 4 })).
+		Return(queryToolCall("call_2", "SELECT name FROM student"), nil).Once()
+	aiProvider.On("Complete", mock.Anything, mock.MatchedBy(func(req llm.CompletionRequest) bool { return len(req.Messages) == 7 })).
+		Return(queryToolCall("call_3", "SELECT name FROM student WHERE id = 1"), nil).Once()
+	aiProvider.On("Complete", mock.Anything, mock.MatchedBy(func(req llm.CompletionRequest) bool { return len(req.Messages) == 9 })).
+		Return(llm.Message{Role: openai.ChatMessageRoleAssistant}, nil).Once()
+	aiProvider.On("StreamComplete", mock.Anything, mock.Anything).Return(streamOf("Bạn tên là ", "Nguyen Van A"), nil).Once()
+
+	var response bytes.Buffer
+	err := srv.StreamChatResponseV2(context.Background(), ChatRequest{
+		Messages:   []MessageRequest{{Role: "user", Content: "Tên của tôi là gì?"}},
+		SpecificID: 1,
+		Role:       "student",
+	}, &response)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"SELEC name FROM student", "SELECT name FROM student", "SELECT name FROM student WHERE id = 1"}, executedQueries)
+	assert.Contains(t, response.String(), "Nguyen Van A")
+	assert.True(t, strings.HasSuffix(response.String(), "data: [DONE]\n\n"))
+	aiProvider.AssertExpectations(t)
+
+	// The last repair request contains the errors of both failed calls, with the explanation of the authorization failure
+	lastRepair := aiProvider.Calls[2].Arguments.Get(1).(llm.CompletionRequest)
+	assert.Equal(t, openai.ChatMessageRoleTool, lastRepair.Messages[2].Role)
+	assert.Equal(t, "call_1", lastRepair.Messages[2].ToolCallId)
+	assert.Contains(t, lastRepair.Messages[2].Content, `syntax error at or near "SELEC"`)
+	assert.Equal(t, "call_2", lastRepair.Messages[5].ToolCallId)
+	assert.Contains(t, lastRepair.Messages[5].Content, "student.id IN (1)")
+	assert.Equal(t, openai.ChatMessageRoleUser, lastRepair.Messages[6].Role)
+
+	// The final answer sees the whole history of the agent loop
+	answerRequest := aiProvider.Calls[4].Arguments.Get(1).(llm.CompletionRequest)
+	require.Len(t, answerRequest.Messages, 9)
+	assert.Equal(t, "call_3", answerRequest.Messages[8].ToolCallId)
+	assert.Equal(t, llm.Required, aiProvider.Calls[0].Arguments.Get(1).(llm.CompletionRequest).FunctionCallingMode)
+	assert.Equal(t, llm.Auto, aiProvider.Calls[3].Arguments.Get(1).(llm.CompletionRequest).FunctionCallingMode)
+}
+
+func TestChatService_StreamChatResponseV2_RepairsInvalidArguments(t *testing.T) {
+	var executedQueries []string
+	srv, aiProvider := newRepairTestService(1, func(ctx context.Context, req db.QueryRequest) (*db.QueryResult, error) {
+		executedQueries = append(executedQueries, req.Query)
+		return &db.QueryResult{Data: []map[string]interface{}{{"name": "Nguyen Van A"}}}, nil
+	})
+
+	invalidCall := queryToolCall("call_1", "")
+	aiProvider.On("Complete", mock.Anything, mock.MatchedBy(func(req llm.CompletionRequest) bool { return len(req.Messages) == 1 })).
+		Return(invalidCall, nil).Once()
+	aiProvider.On("Complete", mock.Anything, mock.MatchedBy(func(req llm.CompletionRequest) bool { return len(req.Messages) == 4 })).
+		Return(queryToolCall("call_2", "SELECT name FROM student WHERE id = 1"), nil).Once()
+	aiProvider.On("Complete", mock.Anything, mock.Anything).Return(llm.Message{Role: openai.ChatMessageRoleAssistant}, nil).Once()
+	aiProvider.On("StreamComplete", mock.Anything, mock.Anything).Return(streamOf("Nguyen Van A"), nil).Once()
+
+	var response bytes.Buffer
+	err := srv.StreamChatResponseV2(context.Background(), ChatRequest{
+		Messages:   []MessageRequest{{Role: "user", Content: "Tên của tôi là gì?"}},
+		SpecificID: 1,
+		Role:       "student",
+	}, &response)
+	require.NoError(t, err)
+
+	// The invalid call never reaches the function and the model gets the invalid fields
+	assert.Equal(t, []string{"SELECT name FROM student WHERE id = 1"}, executedQueries)
+	repair := aiProvider.Calls[1].Arguments.Get(1).(llm.CompletionRequest)
+	assert.Equal(t, "call_1", repair.Messages[2].ToolCallId)
+	assert.Contains(t, repair.Messages[2].Content, `"invalid_arguments":[{"field":"query","message":"must not be empty"}]`)
+}
+
+func TestChatService_StreamChatResponseV2_StopsAfterMaxRepairAttempts(t *testing.T) {
+	attempts := 0
+	srv, aiProvider := newRepairTestService(1, func(ctx context.Context, req db.QueryRequest) (*db.QueryResult, error) {
+		attempts++
+		return nil, errors.New(`error executing query: pq: column "nam" does not exist`)
+	})
+
+	aiProvider.On("Complete", mock.Anything, mock.Anything).Return(queryToolCall("call_1", "SELECT nam FROM student"), nil)
+
+	var response bytes.Buffer
+	err := srv.StreamChatResponseV2(context.Background(), ChatRequest{
+		Messages:   []MessageRequest{{Role: "user", Content: "Tên của tôi là gì?"}},
+		SpecificID: 1,
+		Role:       "student",
+	}, &response)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, attempts)
+	aiProvider.AssertNumberOfCalls(t, "Complete", 2)
+	aiProvider.AssertNotCalled(t, "StreamComplete", mock.Anything, mock.Anything)
+	assert.Contains(t, response.String(), `column \"nam\" does not exist`)
+	assert.True(t, strings.HasSuffix(response.String(), "data: [DONE]\n\n"))
+}
+
+func queryToolCalls(queries ...string) llm.Message {
+	message := llm.Message{Role: openai.ChatMessageRoleAssistant}
+	for i, query := range queries {
+		message.ToolCalls = append(message.ToolCalls, queryToolCall("call_"+string(rune('a'+i)), query).ToolCalls...)
+	}
+	return message
+}
+
+// stepEvents returns the agent step events written in the SSE response
+func stepEvents(t *testing.T, response string) []AgentStep {
+	var steps []AgentStep
+	for _, line := range strings.Split(response, "\n") {
+		if !strings.HasPrefix(line, "data: {") {
+			continue
+		}
+		var resp StreamResponse
+		require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &resp))
+		if resp.Step != nil {
+			steps = append(steps, *resp.Step)
+		}
+	}
+	return steps
+}
+
+func TestChatService_StreamChatResponseV2_ChainsToolCalls(t *testing.T) {
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	srv, aiProvider := newAgentTestService(config.ChatbotConfig{MaxSteps: 5}, func(ctx context.Context, req db.QueryRequest) (*db.QueryResult, error) {
+		mu.Lock()
+		running++
+		maxRunning = max(maxRunning, running)
+		mu.Unlock()
+		// Let the other calls of the step start before returning
+		time.Sleep(50 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return &db.QueryResult{Data: []map[string]interface{}{{"query": req.Query}}}, nil
+	})
+
+	aiProvider.On("Complete", mock.Anything, mock.MatchedBy(func(req llm.CompletionRequest) bool { return len(req.Messages) == 1 })).
+		Return(queryToolCalls("SELECT 1", "SELECT 2", "SELECT 3"), nil).Once()
+	aiProvider.On("Complete", mock.Anything, mock.MatchedBy(func(req llm.CompletionRequest) bool { return len(req.Messages) == 5 })).
+		Return(queryToolCalls("SELECT 4"), nil).Once()
+	aiProvider.On("Complete", mock.Anything, mock.MatchedBy(func(req llm.CompletionRequest) bool { return len(req.Messages) == 7 })).
+		Return(llm.Message{Role: openai.ChatMessageRoleAssistant}, nil).Once()
+	aiProvider.On("StreamComplete", mock.Anything, mock.Anything).Return(streamOf("Done"), nil).Once()
+
+	var response bytes.Buffer
+	err := srv.StreamChatResponseV2(context.Background(), ChatRequest{
+		Messages:   []MessageRequest{{Role: "user", Content: "Môn nào kỳ này có môn tiên quyết tôi đã trượt?"}},
+		SpecificID: 1,
+		Role:       "student",
+	}, &response)
+	require.NoError(t, err)
+	aiProvider.AssertExpectations(t)
+
+	// The calls of a step run concurrently, their results keep the order of the calls
+	assert.Equal(t, 3, maxRunning)
+	answerRequest := aiProvider.Calls[3].Arguments.Get(1).(llm.CompletionRequest)
+	require.Len(t, answerRequest.Messages, 7)
+	for i, id := range []string{"call_a", "call_b", "call_c"} {
+		assert.Equal(t, id, answerRequest.Messages[2+i].ToolCallId)
+		assert.Contains(t, answerRequest.Messages[2+i].Content, fmt.Sprintf("SELECT %d", i+1))
+	}
+
+	steps := stepEvents(t, response.String())
+	require.Len(t, steps, 4)
+	assert.Equal(t, AgentStep{Index: 0, Status: "running", ToolCalls: []ToolCallStatus{
+		{ID: "call_a", Name: "ExecuteQuery", Arguments: `{"query": "SELECT 1"}`},
+		{ID: "call_b", Name: "ExecuteQuery", Arguments: `{"query": "SELECT 2"}`},
+		{ID: "call_c", Name: "ExecuteQuery", Arguments: `{"query": "SELECT 3"}`},
+	}}, steps[0])
+	assert.Equal(t, "completed", steps[1].Status)
+	assert.Equal(t, 1, steps[3].Index)
+	assert.True(t, strings.HasSuffix(response.String(), "data: [DONE]\n\n"))
+}
+
+func TestChatService_StreamChatResponseV2_StopsAtBudget(t *testing.T) {
+	tests := []struct {
+		name          string
+		cfg           config.ChatbotConfig
+		expectedSteps int
+	}{
+		{
+			name:          "Step budget",
+			cfg:           config.ChatbotConfig{MaxSteps: 2},
+			expectedSteps: 2,
+		},
+		{
+			name:          "Token budget",
+			cfg:           config.ChatbotConfig{MaxSteps: 10, MaxTokens: 1},
+			expectedSteps: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executed := 0
+			srv, aiProvider := newAgentTestService(tt.cfg, func(ctx context.Context, req db.QueryRequest) (*db.QueryResult, error) {
+				executed++
+				return &db.QueryResult{}, nil
+			})
+			// The AI never stops calling tools
+			aiProvider.On("Complete", mock.Anything, mock.Anything).Return(queryToolCall("call_1", "SELECT 1"), nil)
+			aiProvider.On("StreamComplete", mock.Anything, mock.Anything).Return(streamOf("Done"), nil).Once()
+
+			var response bytes.Buffer
+			err := srv.StreamChatResponseV2(context.Background(), ChatRequest{
+				Messages:   []MessageRequest{{Role: "user", Content: "Tên của tôi là gì?"}},
+				SpecificID: 1,
+				Role:       "student",
+			}, &response)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expectedSteps, executed)
+			aiProvider.AssertNumberOfCalls(t, "Complete", tt.expectedSteps)
+			aiProvider.AssertNumberOfCalls(t, "StreamComplete", 1)
+			assert.Contains(t, response.String(), "Done")
+		})
+	}
+}
+
+func TestChatService_StreamChatResponseV2_SavesConversation(t *testing.T) {
+	srv, aiProvider := newAgentTestService(config.ChatbotConfig{}, func(ctx context.Context, req db.QueryRequest) (*db.QueryResult, error) {
+		return &db.QueryResult{Data: []map[string]interface{}{{"name": "Nguyen Van A"}}}, nil
+	})
+	chatManagement := &MockChatManagementService{}
+	srv.chatManagement = chatManagement
+
+	var savedMessages []chatmanagement.CreateMessageRequest
+	chatManagement.On("CreateMessage", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			savedMessages = append(savedMessages, args.Get(1).(chatmanagement.CreateMessageRequest))
+		}).
+		Return(chatmanagement.CreateMessageResponse{ConversationId: 42}, nil)
+
+	aiProvider.On("Complete", mock.Anything, mock.MatchedBy(func(req llm.CompletionRequest) bool { return len(req.Messages) == 1 })).
+		Return(queryToolCall("call_1", "SELECT name FROM student WHERE id = 1"), nil).Once()
+	aiProvider.On("Complete", mock.Anything, mock.Anything).Return(llm.Message{Role: openai.ChatMessageRoleAssistant}, nil).Once()
+	aiProvider.On("StreamComplete", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			// The user message is saved before the generation
+			require.Len(t, savedMessages, 1)
+		}).
+		Return(streamOf("Bạn tên là ", "Nguyen Van A"), nil).Once()
+
+	var response bytes.Buffer
+	err := srv.StreamChatResponseV2(context.Background(), ChatRequest{
+		Messages:   []MessageRequest{{Role: "user", Content: "Tên của tôi là gì?"}},
+		UserID:     7,
+		SpecificID: 1,
+		Role:       "student",
+	}, &response)
+	require.NoError(t, err)
+
+	// The conversation id is sent in the first event
+	assert.True(t, strings.HasPrefix(response.String(), `data: {"choices":[],"conversation_id":42}`))
+
+	require.Len(t, savedMessages, 2)
+	assert.Equal(t, 0, *savedMessages[0].ConversationId)
+	assert.Equal(t, chatmanagement.SenderTypeUser, savedMessages[0].Role)
+	assert.Equal(t, "Tên của tôi là gì?", savedMessages[0].Content)
+	assert.Equal(t, 7, savedMessages[0].UserId)
+	assert.Nil(t, savedMessages[0].ToolCalls)
+
+	assert.Equal(t, 42, *savedMessages[1].ConversationId)
+	assert.Equal(t, chatmanagement.SenderTypeBot, savedMessages[1].Role)
+	assert.Equal(t, "Bạn tên là Nguyen Van A", savedMessages[1].Content)
+	var toolCalls []ToolCallRecord
+	require.NoError(t, json.Unmarshal(savedMessages[1].ToolCalls, &toolCalls))
+	assert.Equal(t, []ToolCallRecord{{
+		Step:      0,
+		ID:        "call_1",
+		Name:      "ExecuteQuery",
+		Arguments: `{"query": "SELECT name FROM student WHERE id = 1"}`,
+		Result:    `{"metadata":{"row_count":0,"columns":null},"data":[{"name":"Nguyen Van A"}]}`,
+	}}, toolCalls)
+}
+
+func TestChatService_StreamChatResponseV2_ToolsOfRole(t *testing.T) {
+	tests := []struct {
+		role     string
+		expected []string
+	}{
+		{role: "student", expected: []string{"ExecuteQuery"}},
+		{role: "professor", expected: []string{"ExecuteQuery", "ExportGrades"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.role, func(t *testing.T) {
+			cfg := config.ChatbotConfig{ToolScopes: map[string][]string{"professor": {"grades:export"}}}
+			srv, aiProvider := newAgentTestService(cfg, func(ctx context.Context, req db.QueryRequest) (*db.QueryResult, error) {
+				return &db.QueryResult{}, nil
+			})
+			srv.funcRegistry.Register(llm.FuncWrapperNoArgs("ExportGrades", "Export the grades of the classes", func(ctx context.Context) (string, error) {
+				return "", nil
+			}, llm.WithRoles("professor"), llm.WithScopes("grades:export")))
+			aiProvider.On("Complete", mock.Anything, mock.Anything).Return(llm.Message{Role: openai.ChatMessageRoleAssistant}, nil).Once()
+			aiProvider.On("StreamComplete", mock.Anything, mock.Anything).Return(streamOf("Xin chào"), nil).Once()
+
+			var response bytes.Buffer
+			err := srv.StreamChatResponseV2(context.Background(), ChatRequest{
+				Messages:   []MessageRequest{{Role: "user", Content: "Xin chào"}},
+				SpecificID: 1,
+				Role:       tt.role,
+			}, &response)
+			require.NoError(t, err)
+
+			var tools []string
+			for _, tool := range aiProvider.Calls[0].Arguments.Get(1).(llm.CompletionRequest).Tools {
+				tools = append(tools, tool.Function.Name)
+			}
+			assert.Equal(t, tt.expected, tools)
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package chatbot
+
+import (
+	"HNLP/be/internal/llm"
+	"HNLP/be/internal/usage"
+	"context"
+	"log"
+)
+
+// complete checks the quota of the user, sends the request of the stage and records its usage
+func (cs *ChatService) complete(ctx context.Context, stage Stage, req llm.CompletionRequest) (llm.Message, error) {
+	if err := cs.checkQuota(ctx); err != nil {
+		return llm.Message{}, err
+	}
+	response, err := cs.aiProvider.Complete(ctx, req)
+	if err != nil {
+		return response, err
+	}
+	cs.recordUsage(ctx, stage, req.Model, response.Usage)
+	return response, nil
+}
+
+// streamComplete checks the quota of the user and starts the stream, the usage comes with the Done chunk
+// and must be recorded by the caller
+func (cs *ChatService) streamComplete(ctx context.Context, req llm.CompletionRequest) (<-chan llm.StreamChunk, error) {
+	if err := cs.checkQuota(ctx); err != nil {
+		return nil, err
+	}
+	return cs.aiProvider.StreamComplete(ctx, req)
+}
+
+// checkQuota returns usage.ErrQuotaExceeded if the user of the context reached the quota of their role.
+// The calls without a user in the context, e.g. in the tests, aren't limited.
+func (cs *ChatService) checkQuota(ctx context.Context) error {
+	userId, ok := ctx.Value("userId").(int)
+	if !ok {
+		return nil
+	}
+	role, _ := ctx.Value("userRole").(string)
+	return cs.usageSrv.CheckQuota(ctx, usage.CheckQuotaRequest{UserId: userId, Role: role})
+}
+
+// recordUsage adds the call of the user of the context to the usage ledger, the chat keeps working if it fails
+func (cs *ChatService) recordUsage(ctx context.Context, stage Stage, model string, callUsage *llm.Usage) {
+	userId, ok := ctx.Value("userId").(int)
+	if !ok || callUsage == nil {
+		return
+	}
+	// The model which answered, which differs from the requested one after a fallback
+	if callUsage.Model != "" {
+		model = callUsage.Model
+	}
+	role, _ := ctx.Value("userRole").(string)
+	conversationId, _ := ctx.Value("conversationId").(int)
+
+	err := cs.usageSrv.RecordUsage(context.WithoutCancel(ctx), usage.RecordUsageRequest{
+		UserId:           userId,
+		Role:             role,
+		ConversationId:   conversationId,
+		Stage:            string(stage),
+		Model:            model,
+		PromptTokens:     callUsage.PromptTokens,
+		CompletionTokens: callUsage.CompletionTokens,
+		TotalTokens:      callUsage.TotalTokens,
+	})
+	if err != nil {
+		log.Printf("Failed to record the usage of %s by user %d: %v", model, userId, err)
+	}
+}
@@ -0,0 +1,76 @@
+package chatbot
+
+import (
+	"HNLP/be/internal/config"
+	"HNLP/be/internal/db"
+	"HNLP/be/internal/llm"
+	"HNLP/be/internal/usage"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestChatService_StreamChatResponseV2_RecordsUsage(t *testing.T) {
+	srv, aiProvider := newAgentTestService(config.ChatbotConfig{}, func(ctx context.Context, req db.QueryRequest) (*db.QueryResult, error) {
+		return &db.QueryResult{}, nil
+	})
+	usageSrv := &MockUsageService{}
+	srv.usageSrv = usageSrv
+	usageSrv.On("CheckQuota", mock.Anything, usage.CheckQuotaRequest{UserId: 7, Role: "student"}).Return(nil)
+	var records []usage.RecordUsageRequest
+	usageSrv.On("RecordUsage", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		records = append(records, args.Get(1).(usage.RecordUsageRequest))
+	}).Return(nil)
+
+	toolResponse := queryToolCall("call_1", "SELECT 1")
+	toolResponse.Usage = &llm.Usage{Model: "o3-mini-2025-01-31", PromptTokens: 100, CompletionTokens: 10, TotalTokens: 110}
+	aiProvider.On("Complete", mock.Anything, mock.MatchedBy(func(req llm.CompletionRequest) bool { return len(req.Messages) == 1 })).
+		Return(toolResponse, nil).Once()
+	// The provider doesn't report the usage of the second step
+	aiProvider.On("Complete", mock.Anything, mock.Anything).Return(llm.Message{Role: openai.ChatMessageRoleAssistant}, nil).Once()
+	chunks := make(chan llm.StreamChunk, 2)
+	chunks <- llm.StreamChunk{Content: "Done"}
+	// The answer model fell back to another model
+	chunks <- llm.StreamChunk{Done: true, Usage: &llm.Usage{Model: "gemini-2.0-flash", PromptTokens: 200, CompletionTokens: 20, TotalTokens: 220}}
+	close(chunks)
+	aiProvider.On("StreamComplete", mock.Anything, mock.Anything).Return((<-chan llm.StreamChunk)(chunks), nil).Once()
+
+	var response bytes.Buffer
+	err := srv.StreamChatResponseV2(context.Background(), ChatRequest{
+		Messages: []MessageRequest{{Role: "user", Content: "Điểm của tôi?"}},
+		UserID:   7,
+		Role:     "student",
+	}, &response)
+	require.NoError(t, err)
+
+	assert.Equal(t, []usage.RecordUsageRequest{
+		{UserId: 7, Role: "student", ConversationId: 1, Stage: "tool_planning", Model: "o3-mini-2025-01-31", PromptTokens: 100, CompletionTokens: 10, TotalTokens: 110},
+		{UserId: 7, Role: "student", ConversationId: 1, Stage: "answer", Model: "gemini-2.0-flash", PromptTokens: 200, CompletionTokens: 20, TotalTokens: 220},
+	}, records)
+	// Before the request and before each of the 3 calls
+	usageSrv.AssertNumberOfCalls(t, "CheckQuota", 4)
+}
+
+func TestChatService_StreamChatResponseV2_QuotaExceeded(t *testing.T) {
+	srv, aiProvider := newAgentTestService(config.ChatbotConfig{}, func(ctx context.Context, req db.QueryRequest) (*db.QueryResult, error) {
+		return &db.QueryResult{}, nil
+	})
+	usageSrv := &MockUsageService{}
+	srv.usageSrv = usageSrv
+	usageSrv.On("CheckQuota", mock.Anything, mock.Anything).Return(fmt.Errorf("%w: daily limit of 1000 tokens reached", usage.ErrQuotaExceeded))
+
+	var response bytes.Buffer
+	err := srv.StreamChatResponseV2(context.Background(), ChatRequest{
+		Messages: []MessageRequest{{Role: "user", Content: "Điểm của tôi?"}},
+		UserID:   7,
+		Role:     "student",
+	}, &response)
+	assert.ErrorIs(t, err, usage.ErrQuotaExceeded)
+	assert.Empty(t, response.String())
+	aiProvider.AssertNotCalled(t, "Complete", mock.Anything, mock.Anything)
+}
@@ -2,6 +2,7 @@ package chatmanagement
 
 import (
 	"context"
+	"encoding/json"
 )
 
 type Service interface {
@@ -54,6 +55,8 @@ type CreateMessageRequest struct {
 	Content        string     `json:"content" form:"content" uri:"content"`
 	Role           SenderType `json:"role" form:"role" uri:"role"`
 	UserId         int        `json:"user_id" omitempty:"true" form:"user_id" uri:"user_id"`
+	// ToolCalls is only set for the bot messages saved by the chatbot
+	ToolCalls json.RawMessage `json:"tool_calls,omitempty"`
 }
 
 type CreateMessageResponse struct {
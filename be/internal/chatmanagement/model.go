@@ -1,6 +1,9 @@
 package chatmanagement
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // SenderType represents who sent a message
 type SenderType string
@@ -27,6 +30,8 @@ type Message struct {
 	ConversationID int        `db:"conversation_id" json:"conversation_id"`
 	SenderType     SenderType `db:"sender_type" json:"role"`
 	Content        string     `db:"content" json:"content"`
-	CreatedAt      time.Time  `db:"created_at" json:"created_at"`
-	DeletedAt      *time.Time `db:"deleted_at" json:"deleted_at,omitempty"`
+	// ToolCalls is the JSON list of the tool calls made by the bot with their results, null for user messages
+	ToolCalls json.RawMessage `db:"tool_calls" json:"tool_calls,omitempty"`
+	CreatedAt time.Time       `db:"created_at" json:"created_at"`
+	DeletedAt *time.Time      `db:"deleted_at" json:"deleted_at,omitempty"`
 }
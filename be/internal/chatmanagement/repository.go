@@ -63,7 +63,7 @@ func (r *RepositoryImpl) DeleteConversation(ctx context.Context, conversation *C
 
 func (r *RepositoryImpl) GetMessagesByConversationID(ctx context.Context, conversationID int) ([]Message, error) {
 	var messages []Message
-	err := r.db.SelectContext(ctx, &messages, "SELECT * FROM message WHERE conversation_id = $1", conversationID)
+	err := r.db.SelectContext(ctx, &messages, "SELECT * FROM message WHERE conversation_id = $1 ORDER BY created_at, id", conversationID)
 	if err != nil {
 		return nil, err
 	}
@@ -71,8 +71,13 @@ func (r *RepositoryImpl) GetMessagesByConversationID(ctx context.Context, conver
 }
 
 func (r *RepositoryImpl) SaveMessage(ctx context.Context, message *Message) (bool, error) {
-	_, err := r.db.ExecContext(ctx, "INSERT INTO message (conversation_id, sender_type, content) VALUES ($1, $2, $3)",
-		message.ConversationID, message.SenderType, message.Content)
+	// lib/pq sends []byte as bytea, so the JSON is sent as a string, or NULL if there are no tool calls
+	var toolCalls interface{}
+	if len(message.ToolCalls) > 0 {
+		toolCalls = string(message.ToolCalls)
+	}
+	_, err := r.db.ExecContext(ctx, "INSERT INTO message (conversation_id, sender_type, content, tool_calls) VALUES ($1, $2, $3, $4)",
+		message.ConversationID, message.SenderType, message.Content, toolCalls)
 	if err != nil {
 		return false, err
 	}
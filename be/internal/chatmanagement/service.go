@@ -91,6 +91,7 @@ func (s *ServiceImpl) CreateMessage(ctx context.Context, req CreateMessageReques
 		ConversationID: conversationId,
 		Content:        req.Content,
 		SenderType:     req.Role,
+		ToolCalls:      req.ToolCalls,
 	}
 
 	_, err = s.repo.SaveMessage(ctx, &message)
@@ -4,18 +4,26 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/spf13/viper"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 )
 
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	CORS     CORSConfig     `mapstructure:"cors"`
-	OpenAI   OpenAIConfig   `mapstructure:"openai"`
-	GeminiAI GeminiAIConfig `mapstructure:"gemini"`
-	JWT      JWTConfig      `mapstructure:"jwt"`
-	SerpApi  SerpApiConfig  `mapstructure:"serpapi"`
+	Server       ServerConfig       `mapstructure:"server"`
+	Database     DatabaseConfig     `mapstructure:"database"`
+	CORS         CORSConfig         `mapstructure:"cors"`
+	OpenAI       OpenAIConfig       `mapstructure:"openai"`
+	GeminiAI     GeminiAIConfig     `mapstructure:"gemini"`
+	LocalLLM     LocalLLMConfig     `mapstructure:"local_llm"`
+	JWT          JWTConfig          `mapstructure:"jwt"`
+	SerpApi      SerpApiConfig      `mapstructure:"serpapi"`
+	Chatbot      ChatbotConfig      `mapstructure:"chatbot"`
+	Usage        UsageConfig        `mapstructure:"usage"`
+	Grade        GradeConfig        `mapstructure:"grade"`
+	Audit        AuditConfig        `mapstructure:"audit"`
+	Schedule     ScheduleConfig     `mapstructure:"schedule"`
+	Registration RegistrationConfig `mapstructure:"registration"`
 }
 
 type ServerConfig struct {
@@ -24,6 +32,13 @@ type ServerConfig struct {
 
 type DatabaseConfig struct {
 	URL string `mapstructure:"url"`
+	// AuthorizationMode is either "reject" (default) or "rewrite"
+	AuthorizationMode string `mapstructure:"authorization_mode"`
+	// AuthorizationPolicyFile is the YAML/JSON authorization policy, the embedded default policy is used if empty.
+	// A relative path is relative to the directory of the config file, DATABASE_AUTHORIZATION_POLICY_FILE overrides it.
+	AuthorizationPolicyFile string `mapstructure:"authorization_policy_file"`
+	// DDLExcludedTables are left out of the schema given to the LLM
+	DDLExcludedTables []string `mapstructure:"ddl_excluded_tables"`
 }
 
 type CORSConfig struct {
@@ -40,6 +55,25 @@ type OpenAIConfig struct {
 
 type GeminiAIConfig struct {
 	APIKey string `mapstructure:"api_key"`
+	// Model is used for the requests which don't ask for a Gemini model, the default Gemini model is used if empty
+	Model string `mapstructure:"model"`
+}
+
+// LocalLLMConfig configures a self-hosted LLM server, e.g. Ollama, vLLM or the llama.cpp server
+type LocalLLMConfig struct {
+	// BaseURL of the server, e.g. http://localhost:11434/v1 for an OpenAI-compatible API or http://localhost:11434 for Ollama
+	BaseURL string `mapstructure:"base_url"`
+	// API is either "openai" (default) for the OpenAI-compatible servers or "ollama" for the native Ollama API
+	API    string `mapstructure:"api"`
+	APIKey string `mapstructure:"api_key"`
+	// Models maps the models requested by the chatbot to the local models, the other models use DefaultModel
+	Models       map[string]string `mapstructure:"models"`
+	DefaultModel string            `mapstructure:"default_model"`
+	// ToolCalling is "auto" (default) to prompt for the tool calls in JSON once the model rejects the tools,
+	// "native" to always send the tools or "prompt" to always prompt for them
+	ToolCalling string `mapstructure:"tool_calling"`
+	// TimeoutSeconds bounds a request, the local models can be slow so 0 means no timeout
+	TimeoutSeconds int `mapstructure:"timeout_seconds"`
 }
 
 type JWTConfig struct {
@@ -51,6 +85,126 @@ type SerpApiConfig struct {
 	APIKey string `mapstructure:"api_key"`
 }
 
+type ChatbotConfig struct {
+	// Providers are the LLM providers of the chatbot in order of preference among "openai", "gemini" and "local",
+	// a request falls back to the next provider when one fails. It is [openai] if empty
+	Providers []string `mapstructure:"providers"`
+	// Router configures the retries, the timeouts and the circuit breakers of the providers
+	Router RouterConfig `mapstructure:"router"`
+	// Models chooses the model of each stage of the chatbot
+	Models ModelCatalogConfig `mapstructure:"models"`
+	// ToolScopes grants scopes to the roles, a tool registered with scopes is only given to the roles having all of them
+	ToolScopes map[string][]string `mapstructure:"tool_scopes"`
+	// MaxRepairAttempts is how many times the LLM can correct a failed tool call, 0 disables the repair
+	MaxRepairAttempts int `mapstructure:"max_repair_attempts"`
+	// MaxSteps is how many rounds of tool calls the agent can make before answering, 0 uses the default
+	MaxSteps int `mapstructure:"max_steps"`
+	// MaxTokens stops the agent loop once the conversation reaches this estimated size, 0 means no budget
+	MaxTokens int `mapstructure:"max_tokens"`
+	// HistoryTokens is the token budget of the conversation history per model, the oldest turns are summarized above it
+	HistoryTokens map[string]int `mapstructure:"history_tokens"`
+	// MaxSchemaTables is how many tables relevant to the question are described in the prompt, 0 describes all the readable tables
+	MaxSchemaTables int `mapstructure:"max_schema_tables"`
+	// TableKeywords are the words of the questions about a table besides its name, e.g. its Vietnamese name
+	TableKeywords map[string][]string `mapstructure:"table_keywords"`
+}
+
+type RouterConfig struct {
+	// MaxRetries is how many times a failed request is retried on the same provider, 0 disables the retries
+	MaxRetries int `mapstructure:"max_retries"`
+	// InitialBackoffMs is the delay before the first retry, it doubles at each retry up to MaxBackoffMs
+	InitialBackoffMs int `mapstructure:"initial_backoff_ms"`
+	MaxBackoffMs     int `mapstructure:"max_backoff_ms"`
+	// TimeoutSeconds bounds an attempt, a streamed answer included, 0 uses the default
+	TimeoutSeconds int `mapstructure:"timeout_seconds"`
+	// FailureThreshold is how many consecutive failures open the circuit of a provider, 0 uses the default
+	FailureThreshold int `mapstructure:"failure_threshold"`
+	// OpenSeconds is how long an open circuit skips its provider before trying it again, 0 uses the default
+	OpenSeconds int `mapstructure:"open_seconds"`
+}
+
+type ModelCatalogConfig struct {
+	// Stages maps the stages of the chatbot (tool_planning, answer, validation, summarization) to their model,
+	// the stages which aren't configured use the default models
+	Stages map[string]ModelConfig `mapstructure:"stages"`
+	// Roles overrides the models of some stages for a role, e.g. a stronger tool planning model for the admins
+	Roles map[string]map[string]ModelConfig `mapstructure:"roles"`
+	// Allowed are the models a chat request can choose to write the answer, a request can't choose its model if empty
+	Allowed []ModelConfig `mapstructure:"allowed"`
+}
+
+type ModelConfig struct {
+	// Provider is the provider tried first for the model, the order of the providers is kept if empty
+	Provider string `mapstructure:"provider"`
+	Model    string `mapstructure:"model"`
+}
+
+// UsageConfig configures the accounting of the LLM calls
+type UsageConfig struct {
+	// Prices are the prices of the models, the calls of the models without a price cost nothing
+	Prices []ModelPriceConfig `mapstructure:"prices"`
+	// Quotas are the limits of the users of each role, the roles without a quota are unlimited
+	Quotas map[string]QuotaConfig `mapstructure:"quotas"`
+}
+
+type ModelPriceConfig struct {
+	// Model is the name of the model, or a prefix of it, e.g. "gpt-4o-mini" for all its versions
+	Model string `mapstructure:"model"`
+	// PromptPerMillion and CompletionPerMillion are the USD prices of a million prompt and completion tokens
+	PromptPerMillion     float64 `mapstructure:"prompt_per_million"`
+	CompletionPerMillion float64 `mapstructure:"completion_per_million"`
+}
+
+// QuotaConfig limits the usage of a user per day and per calendar month, 0 means no limit
+type QuotaConfig struct {
+	DailyTokens   int     `mapstructure:"daily_tokens"`
+	MonthlyTokens int     `mapstructure:"monthly_tokens"`
+	DailyCost     float64 `mapstructure:"daily_cost"`
+	MonthlyCost   float64 `mapstructure:"monthly_cost"`
+}
+
+// GradeConfig is the grading rules of the university, the VNU rules are used if empty
+type GradeConfig struct {
+	// Scale converts the 10-point grades to the letters and the 4-point grades
+	Scale []GradeBandConfig `mapstructure:"scale"`
+	// ExcludedEnrollmentTypes are the enrollment types which don't count in the GPA, e.g. the exempted courses
+	ExcludedEnrollmentTypes []string `mapstructure:"excluded_enrollment_types"`
+}
+
+// GradeBandConfig is a grade of the scale, a 10-point grade gets the band with the highest Min it reaches
+type GradeBandConfig struct {
+	Letter string  `mapstructure:"letter"`
+	Min    float64 `mapstructure:"min"`
+	Points float64 `mapstructure:"points"`
+}
+
+// AuditConfig configures the projection of the graduation of the degree audit
+type AuditConfig struct {
+	// CreditsPerSemester is the pace of the students without history, 18 if 0
+	CreditsPerSemester int `mapstructure:"credits_per_semester"`
+}
+
+// ScheduleConfig converts the lessons of the timetable like "3-4" to clock times
+type ScheduleConfig struct {
+	// Periods are the clock times of the lessons, 12 lessons of 50 minutes every hour from 07:00 if empty
+	Periods []PeriodConfig `mapstructure:"periods"`
+	// TimeZone is the time zone of the periods, Asia/Ho_Chi_Minh if empty
+	TimeZone string `mapstructure:"time_zone"`
+}
+
+// PeriodConfig is the start and the end of a lesson, e.g. "07:00" and "07:50"
+type PeriodConfig struct {
+	Lesson int    `mapstructure:"lesson"`
+	Start  string `mapstructure:"start"`
+	End    string `mapstructure:"end"`
+}
+
+// RegistrationConfig limits the course registration of the students
+type RegistrationConfig struct {
+	// MaxCredits is the maximum of the credits registered and waitlisted by a student in a semester, 24 if zero
+	MaxCredits int `mapstructure:"max_credits"`
+}
+
 func LoadConfig(configPath string, envPath string) (*Config, error) {
 	// Load .env file first
 	if err := godotenv.Load(envPath); err != nil {
@@ -83,5 +237,10 @@ func LoadConfig(configPath string, envPath string) (*Config, error) {
 		return nil, err
 	}
 
+	// The policy file goes with the config file, wherever the service is started from
+	if policyFile := config.Database.AuthorizationPolicyFile; policyFile != "" && !filepath.IsAbs(policyFile) {
+		config.Database.AuthorizationPolicyFile = filepath.Join(filepath.Dir(configPath), policyFile)
+	}
+
 	return &config, nil
 }
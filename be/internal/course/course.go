@@ -1,5 +1,7 @@
 package course
 
+import "github.com/lib/pq"
+
 type Course struct {
 	ID             int    `json:"id" db:"id"`
 	Code           string `json:"code" db:"code"`
@@ -9,5 +11,84 @@ type Course struct {
 	PracticeHours  int    `json:"practice_hours" db:"practice_hours"`
 	TheoryHours    int    `json:"theory_hours" db:"theory_hours"`
 	SelfLearnHours int    `json:"self_learn_hours" db:"self_learn_hours"`
-	Prerequisite   *int   `json:"prerequisite,omitempty" db:"prerequisite"`
+}
+
+// CourseRef is a course referenced by another one, e.g. its prerequisite
+type CourseRef struct {
+	Code string `json:"code" db:"code"`
+	Name string `json:"name" db:"name"`
+	// Group is the requirement group of a prerequisite, one course of each group is required
+	Group int `json:"group,omitempty" db:"group_no"`
+}
+
+// CourseInfo describes a course with its credits, its hours and its prerequisites
+type CourseInfo struct {
+	Code           string      `json:"code"`
+	Name           string      `json:"name"`
+	EnglishName    string      `json:"english_name"`
+	Credits        int         `json:"credits"`
+	TheoryHours    int         `json:"theory_hours"`
+	PracticeHours  int         `json:"practice_hours"`
+	SelfLearnHours int         `json:"self_learn_hours"`
+	Prerequisites  []CourseRef `json:"prerequisites"`
+}
+
+// StudentRef identifies a student in the responses
+type StudentRef struct {
+	ID   int    `json:"id" db:"id"`
+	Code string `json:"code" db:"code"`
+	Name string `json:"name" db:"name"`
+}
+
+// TranscriptEntry is a course class taken by a student with its grades, the grades are null until they are published
+type TranscriptEntry struct {
+	ClassID        int      `json:"-" db:"course_class_id"`
+	Semester       string   `json:"semester" db:"semester_id"`
+	ClassCode      string   `json:"class_code" db:"class_code"`
+	CourseCode     string   `json:"course_code" db:"course_code"`
+	CourseName     string   `json:"course_name" db:"course_name"`
+	Credits        int      `json:"credits" db:"credits"`
+	EnrollmentType *string  `json:"enrollment_type,omitempty" db:"enrollment_type"`
+	MidtermGrade   *float64 `json:"midterm_grade" db:"midterm_grade"`
+	FinalGrade     *float64 `json:"final_grade" db:"final_grade"`
+	Grade          *string  `json:"grade" db:"grade"`
+	GPA            *float64 `json:"gpa" db:"gpa"`
+}
+
+// ProfessorAccess is what a professor can see of a student, like the course_class_enrollment policy of the professors
+type ProfessorAccess struct {
+	// Advisor is true if the professor advises the administrative class of the student, they see all the classes
+	Advisor bool
+	// ClassIDs are the classes of the student taught by the professor
+	ClassIDs []int
+}
+
+// TranscriptSemester groups the courses of a semester of the transcript
+type TranscriptSemester struct {
+	Semester string            `json:"semester"`
+	Credits  int               `json:"credits"`
+	Courses  []TranscriptEntry `json:"courses"`
+}
+
+// Program is a training program, its code is the admission code
+type Program struct {
+	ID               int     `json:"-" db:"id"`
+	Code             string  `json:"code" db:"code"`
+	Name             string  `json:"name" db:"name"`
+	DegreeType       string  `json:"degree_type" db:"degree_type"`
+	TrainingDuration float64 `json:"training_duration" db:"training_duration"`
+	Abbreviation     *string `json:"abbreviation,omitempty" db:"abbreviation"`
+	// RequiredCredits are the credits to graduate, the credits of the whole curriculum if nil
+	RequiredCredits *int `json:"required_credits,omitempty" db:"required_credits"`
+}
+
+// CurriculumCourse is a course of the curriculum of a program
+type CurriculumCourse struct {
+	Code        string `json:"code" db:"code"`
+	Name        string `json:"name" db:"name"`
+	EnglishName string `json:"english_name" db:"english_name"`
+	Credits     int    `json:"credits" db:"credits"`
+	Mandatory   bool   `json:"mandatory" db:"mandatory"`
+	// Prerequisites are the codes of the prerequisite courses ordered by requirement group
+	Prerequisites pq.StringArray `json:"prerequisites,omitempty" db:"prerequisite_codes"`
 }
@@ -21,6 +21,9 @@ type CourseClass struct {
 
 type Service interface {
 	GetCourse(ctx context.Context, req GetCourseRequest) (*GetCourseResponse, error)
+	GetCourseInfo(ctx context.Context, req GetCourseInfoRequest) (CourseInfo, error)
+	GetTranscript(ctx context.Context, req GetTranscriptRequest) (GetTranscriptResponse, error)
+	GetProgramCurriculum(ctx context.Context, req GetProgramCurriculumRequest) (GetProgramCurriculumResponse, error)
 }
 
 type Repository interface {
@@ -31,6 +34,17 @@ type Repository interface {
 	GetAllCoursesOfStudentByName(ctx context.Context, studentName string) ([]CourseClass, error)
 	GetStudentName(ctx context.Context, id int) (string, error)
 	GetStudentByName(ctx context.Context, name string) (int, error)
+	// GetPrerequisites returns the courses to pass before taking the course ordered by requirement group
+	GetPrerequisites(ctx context.Context, courseId int) ([]CourseRef, error)
+	GetStudent(ctx context.Context, id int) (StudentRef, error)
+	// GetTranscript returns the course classes taken by the student ordered by semester and course code
+	GetTranscript(ctx context.Context, studentId int) ([]TranscriptEntry, error)
+	// GetProfessorAccess returns whether the professor advises the student and the classes of the student they teach
+	GetProfessorAccess(ctx context.Context, professorId int, studentId int) (ProfessorAccess, error)
+	GetProgramByCode(ctx context.Context, code string) (Program, error)
+	// GetProgramOfStudent returns the program of the administrative class of the student
+	GetProgramOfStudent(ctx context.Context, studentId int) (Program, error)
+	GetCurriculum(ctx context.Context, programId int) ([]CurriculumCourse, error)
 }
 
 type GetCourseResponse struct {
@@ -38,3 +52,29 @@ type GetCourseResponse struct {
 	Name        string `json:"name"`
 	EnglishName string `json:"english_name"`
 }
+
+type GetCourseInfoRequest struct {
+	Code *string `json:"code,omitempty" jsonschema:"description=Code of the course,example=INT3306"`
+	Name *string `json:"name,omitempty" jsonschema:"description=Vietnamese or English name of the course when the code isn't known"`
+}
+
+type GetTranscriptRequest struct {
+	StudentId *int `json:"student_id,omitempty" jsonschema:"description=Id of the student, the current student by default,minimum=1"`
+}
+
+type GetTranscriptResponse struct {
+	Student   StudentRef           `json:"student"`
+	Semesters []TranscriptSemester `json:"semesters"`
+	// Credits is the sum of the credits of the course classes taken
+	Credits int `json:"credits"`
+}
+
+type GetProgramCurriculumRequest struct {
+	ProgramCode *string `json:"program_code,omitempty" jsonschema:"description=Admission code of the program, the program of the current student by default"`
+}
+
+type GetProgramCurriculumResponse struct {
+	Program Program            `json:"program"`
+	Courses []CurriculumCourse `json:"courses"`
+	Credits int                `json:"credits"`
+}
@@ -13,15 +13,18 @@ func NewRepositoryImpl(db db.HDb) *RepositoryImpl {
 	return &RepositoryImpl{db: db}
 }
 
+// courseColumns leaves out the deprecated course.prerequisite, the requirements are in course_requirement
+const courseColumns = "id, code, name, english_name, credits, practice_hours, theory_hours, self_learn_hours"
+
 func (r *RepositoryImpl) GetByCode(ctx context.Context, code string) (Course, error) {
 	var course Course
-	err := r.db.GetContext(ctx, &course, "SELECT * FROM course WHERE code = $1", code)
+	err := r.db.GetContext(ctx, &course, "SELECT "+courseColumns+" FROM course WHERE code = $1", code)
 	return course, err
 }
 
 func (r *RepositoryImpl) GetByName(ctx context.Context, name string) (Course, error) {
 	var course Course
-	err := r.db.GetContext(ctx, &course, "SELECT * FROM course WHERE name = $1", name)
+	err := r.db.GetContext(ctx, &course, "SELECT "+courseColumns+" FROM course WHERE name = $1", name)
 	return course, err
 }
 
@@ -69,6 +72,100 @@ func (r *RepositoryImpl) GetStudentByName(ctx context.Context, name string) (int
 
 func (r *RepositoryImpl) GetByEnglishName(ctx context.Context, englishName string) (Course, error) {
 	var course Course
-	err := r.db.GetContext(ctx, &course, "SELECT * FROM course WHERE english_name = $1", englishName)
+	err := r.db.GetContext(ctx, &course, "SELECT "+courseColumns+" FROM course WHERE english_name = $1", englishName)
 	return course, err
 }
+
+func (r *RepositoryImpl) GetPrerequisites(ctx context.Context, courseId int) ([]CourseRef, error) {
+	var prerequisites []CourseRef
+	err := r.db.SelectContext(ctx, &prerequisites, `SELECT p.code, COALESCE(p.name, '') AS name, cr.group_no
+FROM course_requirement cr
+         JOIN course p ON p.id = cr.required_course_id
+WHERE cr.course_id = $1
+  AND cr.type = 'prerequisite'
+ORDER BY cr.group_no, p.code`, courseId)
+	return prerequisites, err
+}
+
+func (r *RepositoryImpl) GetStudent(ctx context.Context, id int) (StudentRef, error) {
+	var student StudentRef
+	err := r.db.GetContext(ctx, &student, "SELECT id, code, COALESCE(name, '') AS name FROM student WHERE id = $1", id)
+	return student, err
+}
+
+func (r *RepositoryImpl) GetTranscript(ctx context.Context, studentId int) ([]TranscriptEntry, error) {
+	var entries []TranscriptEntry
+	err := r.db.SelectContext(ctx, &entries, `SELECT cc.id                    AS course_class_id,
+       cc.semester_id,
+       cc.code                  AS class_code,
+       c.code                   AS course_code,
+       COALESCE(c.name, '')     AS course_name,
+       COALESCE(c.credits, 0)   AS credits,
+       cce.enrollment_type,
+       cce.midterm_grade,
+       cce.final_grade,
+       cce.grade,
+       cce.gpa
+FROM course_class_enrollment cce
+         JOIN course_class cc ON cc.id = cce.course_class_id
+         JOIN course c ON c.id = cc.course_id
+WHERE cce.student_id = $1
+ORDER BY cc.semester_id, c.code`, studentId)
+	return entries, err
+}
+
+func (r *RepositoryImpl) GetProfessorAccess(ctx context.Context, professorId int, studentId int) (ProfessorAccess, error) {
+	var access ProfessorAccess
+	err := r.db.GetContext(ctx, &access.Advisor, `SELECT EXISTS (SELECT 1
+               FROM student s
+                        JOIN administrative_class ac ON ac.id = s.administrative_class_id
+               WHERE s.id = $2
+                 AND ac.advisor_id = $1)`, professorId, studentId)
+	if err != nil {
+		return ProfessorAccess{}, err
+	}
+	err = r.db.SelectContext(ctx, &access.ClassIDs, `SELECT DISTINCT cce.course_class_id
+FROM course_class_enrollment cce
+         JOIN course_class_schedule ccs ON ccs.course_class_id = cce.course_class_id
+         JOIN course_schedule_instructor csi ON csi.course_class_schedule_id = ccs.id
+WHERE cce.student_id = $2
+  AND csi.professor_id = $1
+ORDER BY cce.course_class_id`, professorId, studentId)
+	return access, err
+}
+
+func (r *RepositoryImpl) GetProgramByCode(ctx context.Context, code string) (Program, error) {
+	var program Program
+	err := r.db.GetContext(ctx, &program, "SELECT * FROM program WHERE code = $1", code)
+	return program, err
+}
+
+func (r *RepositoryImpl) GetProgramOfStudent(ctx context.Context, studentId int) (Program, error) {
+	var program Program
+	err := r.db.GetContext(ctx, &program, `SELECT p.*
+FROM student s
+         JOIN administrative_class ac ON ac.id = s.administrative_class_id
+         JOIN program p ON p.id = ac.program_id
+WHERE s.id = $1`, studentId)
+	return program, err
+}
+
+func (r *RepositoryImpl) GetCurriculum(ctx context.Context, programId int) ([]CurriculumCourse, error) {
+	var courses []CurriculumCourse
+	err := r.db.SelectContext(ctx, &courses, `SELECT c.code,
+       COALESCE(c.name, '')         AS name,
+       COALESCE(c.english_name, '') AS english_name,
+       COALESCE(c.credits, 0)       AS credits,
+       cp.mandatory,
+       ARRAY(SELECT p.code
+             FROM course_requirement cr
+                      JOIN course p ON p.id = cr.required_course_id
+             WHERE cr.course_id = c.id
+               AND cr.type = 'prerequisite'
+             ORDER BY cr.group_no, p.code) AS prerequisite_codes
+FROM course_program cp
+         JOIN course c ON c.id = cp.course_id
+WHERE cp.program_id = $1
+ORDER BY c.code`, programId)
+	return courses, err
+}
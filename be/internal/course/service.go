@@ -3,7 +3,9 @@ package course
 import (
 	"HNLP/be/internal/db"
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
 )
 
 type ServiceImpl struct {
@@ -19,107 +21,189 @@ func NewServiceImpl(repo Repository, db *db.SQLHDb) *ServiceImpl {
 }
 
 func (s *ServiceImpl) GetCourse(ctx context.Context, req GetCourseRequest) (*GetCourseResponse, error) {
-	var course Course
-	var err error
+	course, err := s.findCourse(ctx, req.Code, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &GetCourseResponse{
+		Code:        course.Code,
+		Name:        course.Name,
+		EnglishName: course.EnglishName,
+	}, nil
+}
 
-	// Try ID first if provided
-	if req.Code != nil {
-		course, err = s.repo.GetByCode(ctx, *req.Code)
-		if err == nil {
-			return &GetCourseResponse{
-				Code:        course.Code,
-				Name:        course.Name,
-				EnglishName: course.EnglishName,
-			}, nil
-		}
+// GetCourseInfo returns the credits, the hours and the prerequisites of a course found by its code or its name
+func (s *ServiceImpl) GetCourseInfo(ctx context.Context, req GetCourseInfoRequest) (CourseInfo, error) {
+	course, err := s.findCourse(ctx, req.Code, req.Name)
+	if err != nil {
+		return CourseInfo{}, err
 	}
+	prerequisites, err := s.repo.GetPrerequisites(ctx, course.ID)
+	if err != nil {
+		return CourseInfo{}, err
+	}
+	if prerequisites == nil {
+		prerequisites = []CourseRef{}
+	}
+	return CourseInfo{
+		Code:           course.Code,
+		Name:           course.Name,
+		EnglishName:    course.EnglishName,
+		Credits:        course.Credits,
+		TheoryHours:    course.TheoryHours,
+		PracticeHours:  course.PracticeHours,
+		SelfLearnHours: course.SelfLearnHours,
+		Prerequisites:  prerequisites,
+	}, nil
+}
 
-	// Try name if provided (either as fallback from ID or direct request)
-	if req.Name != nil {
-		// Try regular name
-		course, err = s.repo.GetByName(ctx, *req.Name)
-		if err == nil {
-			return &GetCourseResponse{
-				Code:        course.Code,
-				Name:        course.Name,
-				EnglishName: course.EnglishName,
-			}, nil
-		}
+// GetTranscript returns the course classes taken by a student with their grades grouped by semester.
+// The students can only get their own transcript and the professors the one of the students they advise,
+// or only the classes they teach to the other students.
+func (s *ServiceImpl) GetTranscript(ctx context.Context, req GetTranscriptRequest) (GetTranscriptResponse, error) {
+	scope, err := s.StudentScope(ctx, req.StudentId)
+	if err != nil {
+		return GetTranscriptResponse{}, err
+	}
+	studentId := scope.StudentID
+	student, err := s.repo.GetStudent(ctx, studentId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return GetTranscriptResponse{}, fmt.Errorf("student %d not found", studentId)
+	}
+	if err != nil {
+		return GetTranscriptResponse{}, err
+	}
+	entries, err := s.repo.GetTranscript(ctx, studentId)
+	if err != nil {
+		return GetTranscriptResponse{}, err
+	}
 
-		// Try English name
-		course, err = s.repo.GetByEnglishName(ctx, *req.Name)
-		if err == nil {
-			return &GetCourseResponse{
-				Code:        course.Code,
-				Name:        course.Name,
-				EnglishName: course.EnglishName,
-			}, nil
+	response := GetTranscriptResponse{Student: student, Semesters: []TranscriptSemester{}}
+	for _, entry := range entries {
+		if !scope.Includes(entry.ClassID) {
+			continue
+		}
+		// The entries are ordered by semester
+		last := len(response.Semesters) - 1
+		if last < 0 || response.Semesters[last].Semester != entry.Semester {
+			response.Semesters = append(response.Semesters, TranscriptSemester{Semester: entry.Semester})
+			last++
 		}
+		response.Semesters[last].Courses = append(response.Semesters[last].Courses, entry)
+		response.Semesters[last].Credits += entry.Credits
+		response.Credits += entry.Credits
 	}
-
-	// If we reach here, no course was found
-	return nil, errors.New("course not found")
+	return response, nil
 }
 
-type GetGpaOfStudentRequest struct {
-	StudentId   *int    `json:"student_id"`
-	StudentName *string `json:"student_name"`
+// GetProgramCurriculum returns the courses of a program, the program of the current student by default
+func (s *ServiceImpl) GetProgramCurriculum(ctx context.Context, req GetProgramCurriculumRequest) (GetProgramCurriculumResponse, error) {
+	var program Program
+	var err error
+	caller := db.CallerFrom(ctx)
+	if req.ProgramCode != nil && *req.ProgramCode != "" {
+		program, err = s.repo.GetProgramByCode(ctx, *req.ProgramCode)
+		if errors.Is(err, sql.ErrNoRows) {
+			return GetProgramCurriculumResponse{}, fmt.Errorf("program %s not found", *req.ProgramCode)
+		}
+	} else if caller.Role == "student" {
+		program, err = s.repo.GetProgramOfStudent(ctx, caller.SpecificID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return GetProgramCurriculumResponse{}, errors.New("the student isn't in a program")
+		}
+	} else {
+		return GetProgramCurriculumResponse{}, errors.New("program_code is required")
+	}
+	if err != nil {
+		return GetProgramCurriculumResponse{}, err
+	}
+
+	courses, err := s.repo.GetCurriculum(ctx, program.ID)
+	if err != nil {
+		return GetProgramCurriculumResponse{}, err
+	}
+	response := GetProgramCurriculumResponse{Program: program, Courses: courses}
+	if response.Courses == nil {
+		response.Courses = []CurriculumCourse{}
+	}
+	for _, course := range courses {
+		response.Credits += course.Credits
+	}
+	return response, nil
 }
 
-type GetGpaOfStudentResponse struct {
-	GPA float64 `json:"gpa"`
+// AccessibleStudent returns the student asked by the caller, the caller themselves for a student by default,
+// or db.ErrForbidden if the caller can't access the whole record of the student, e.g. for the degree audit.
+// A professor must advise the student.
+func (s *ServiceImpl) AccessibleStudent(ctx context.Context, studentId *int) (int, error) {
+	scope, err := s.StudentScope(ctx, studentId)
+	if err != nil {
+		return 0, err
+	}
+	if !scope.Full() {
+		return 0, fmt.Errorf("%w: only the advisor of the student can access their whole record", db.ErrForbidden)
+	}
+	return scope.StudentID, nil
 }
 
-func (s *ServiceImpl) GetCurrentGpaOfStudent(ctx context.Context, req GetGpaOfStudentRequest) (GetGpaOfStudentResponse, error) {
-	// Get all courses of the student
-	role := ctx.Value("userRole").(string)
-	specificId := ctx.Value("specificId").(int)
-	if role == "student" {
-		if req.StudentId != nil && (*req.StudentId != specificId || *req.StudentId == 0) {
-			studentName, _ := s.repo.GetStudentName(ctx, specificId)
-			if req.StudentName != nil && *req.StudentName != studentName {
-				return GetGpaOfStudentResponse{}, errors.New("you are not allowed to get GPA of this student")
-			}
+// StudentScope returns the student asked by the caller with the course classes the caller can see, or db.ErrForbidden
+// if the caller can't access the data of the student. Like the policy of the course_class_enrollment table,
+// a professor sees all the classes of the students they advise and only the classes they teach to the other students.
+func (s *ServiceImpl) StudentScope(ctx context.Context, studentId *int) (db.StudentScope, error) {
+	caller := db.CallerFrom(ctx)
+	switch caller.Role {
+	case "student":
+		if studentId != nil && *studentId != caller.SpecificID {
+			return db.StudentScope{}, db.ErrForbidden
+		}
+		return db.StudentScope{StudentID: caller.SpecificID}, nil
+	case "professor":
+		if studentId == nil {
+			return db.StudentScope{}, db.ErrStudentRequired
+		}
+		access, err := s.repo.GetProfessorAccess(ctx, caller.SpecificID, *studentId)
+		if err != nil {
+			return db.StudentScope{}, err
 		}
-	} else if role == "professor" {
-		professorInfo, _ := s.db.FetchProfessorInfo(ctx, specificId)
-		var studentId int
-		if req.StudentId != nil && *req.StudentId != 0 {
-			studentId = *req.StudentId
-		} else {
-			studentId, _ = s.repo.GetStudentByName(ctx, *req.StudentName)
+		if access.Advisor {
+			return db.StudentScope{StudentID: *studentId}, nil
 		}
-		if !db.ContainsInt(professorInfo.TaughtStudentIDs, studentId) && !db.ContainsInt(professorInfo.AdvisedStudentIDs, studentId) {
-			return GetGpaOfStudentResponse{}, errors.New("Bạn không có quyền truy cập dữ liệu của sinh viên này")
+		if len(access.ClassIDs) == 0 {
+			return db.StudentScope{}, db.ErrForbidden
 		}
+		return db.StudentScope{StudentID: *studentId, ClassIDs: access.ClassIDs}, nil
+	case "admin":
+		if studentId == nil {
+			return db.StudentScope{}, db.ErrStudentRequired
+		}
+		return db.StudentScope{StudentID: *studentId}, nil
 	}
+	return db.StudentScope{}, db.ErrForbidden
+}
 
-	var courseClasses []CourseClass
-	var err error
-	if req.StudentId != nil && *req.StudentId != 0 {
-		courseClasses, err = s.repo.GetAllCoursesOfStudentByID(ctx, *req.StudentId)
-	} else if req.StudentName != nil {
-		courseClasses, err = s.repo.GetAllCoursesOfStudentByName(ctx, *req.StudentName)
-	} else {
-		return GetGpaOfStudentResponse{}, errors.New("student id or name is required")
-	}
+// ------------------Private helper function------------------
 
-	if err != nil {
-		return GetGpaOfStudentResponse{}, err
-	}
-	gpa := 0.0
-	count := 0
-	for _, courseClass := range courseClasses {
-		if courseClass.GPA != nil {
-			gpa += *courseClass.GPA
-			count++
+// findCourse finds a course by its code, then by its Vietnamese or English name
+func (s *ServiceImpl) findCourse(ctx context.Context, code *string, name *string) (Course, error) {
+	if code != nil {
+		course, err := s.repo.GetByCode(ctx, *code)
+		if err == nil {
+			return course, nil
 		}
 	}
-	if count == 0 {
-		return GetGpaOfStudentResponse{}, errors.New("không tìm thấy dữ liệu điểm hoặc không có quyền truy cập dữ liệu của sinh viên này")
+
+	// Try name if provided (either as fallback from the code or direct request)
+	if name != nil {
+		course, err := s.repo.GetByName(ctx, *name)
+		if err == nil {
+			return course, nil
+		}
+		course, err = s.repo.GetByEnglishName(ctx, *name)
+		if err == nil {
+			return course, nil
+		}
 	}
 
-	return GetGpaOfStudentResponse{
-		GPA: gpa / float64(count),
-	}, nil
+	// If we reach here, no course was found
+	return Course{}, errors.New("course not found")
 }
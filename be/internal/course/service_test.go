@@ -0,0 +1,234 @@
+package course
+
+import (
+	"HNLP/be/internal/db"
+	"context"
+	"database/sql"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// MockRepository implements the Repository interface for testing
+type MockRepository struct {
+	mock.Mock
+}
+
+func (m *MockRepository) GetByCode(ctx context.Context, code string) (Course, error) {
+	args := m.Called(ctx, code)
+	return args.Get(0).(Course), args.Error(1)
+}
+
+func (m *MockRepository) GetByName(ctx context.Context, name string) (Course, error) {
+	args := m.Called(ctx, name)
+	return args.Get(0).(Course), args.Error(1)
+}
+
+func (m *MockRepository) GetByEnglishName(ctx context.Context, name string) (Course, error) {
+	args := m.Called(ctx, name)
+	return args.Get(0).(Course), args.Error(1)
+}
+
+func (m *MockRepository) GetAllCoursesOfStudentByID(ctx context.Context, id int) ([]CourseClass, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).([]CourseClass), args.Error(1)
+}
+
+func (m *MockRepository) GetAllCoursesOfStudentByName(ctx context.Context, studentName string) ([]CourseClass, error) {
+	args := m.Called(ctx, studentName)
+	return args.Get(0).([]CourseClass), args.Error(1)
+}
+
+func (m *MockRepository) GetStudentName(ctx context.Context, id int) (string, error) {
+	args := m.Called(ctx, id)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockRepository) GetStudentByName(ctx context.Context, name string) (int, error) {
+	args := m.Called(ctx, name)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockRepository) GetPrerequisites(ctx context.Context, courseId int) ([]CourseRef, error) {
+	args := m.Called(ctx, courseId)
+	return args.Get(0).([]CourseRef), args.Error(1)
+}
+
+func (m *MockRepository) GetStudent(ctx context.Context, id int) (StudentRef, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(StudentRef), args.Error(1)
+}
+
+func (m *MockRepository) GetTranscript(ctx context.Context, studentId int) ([]TranscriptEntry, error) {
+	args := m.Called(ctx, studentId)
+	return args.Get(0).([]TranscriptEntry), args.Error(1)
+}
+
+func (m *MockRepository) GetProfessorAccess(ctx context.Context, professorId int, studentId int) (ProfessorAccess, error) {
+	args := m.Called(ctx, professorId, studentId)
+	return args.Get(0).(ProfessorAccess), args.Error(1)
+}
+
+func (m *MockRepository) GetProgramByCode(ctx context.Context, code string) (Program, error) {
+	args := m.Called(ctx, code)
+	return args.Get(0).(Program), args.Error(1)
+}
+
+func (m *MockRepository) GetProgramOfStudent(ctx context.Context, studentId int) (Program, error) {
+	args := m.Called(ctx, studentId)
+	return args.Get(0).(Program), args.Error(1)
+}
+
+func (m *MockRepository) GetCurriculum(ctx context.Context, programId int) ([]CurriculumCourse, error) {
+	args := m.Called(ctx, programId)
+	return args.Get(0).([]CurriculumCourse), args.Error(1)
+}
+
+func callerContext(role string, specificId int) context.Context {
+	ctx := context.WithValue(context.Background(), "userRole", role)
+	return context.WithValue(ctx, "specificId", specificId)
+}
+
+func TestServiceImpl_GetCourseInfo(t *testing.T) {
+	repo := &MockRepository{}
+	repo.On("GetByCode", mock.Anything, "Trí tuệ nhân tạo").Return(Course{}, sql.ErrNoRows)
+	repo.On("GetByName", mock.Anything, "Trí tuệ nhân tạo").Return(Course{}, sql.ErrNoRows)
+	repo.On("GetByEnglishName", mock.Anything, "Trí tuệ nhân tạo").Return(Course{}, sql.ErrNoRows)
+	repo.On("GetByName", mock.Anything, "Artificial Intelligence").Return(Course{}, sql.ErrNoRows)
+	repo.On("GetByEnglishName", mock.Anything, "Artificial Intelligence").
+		Return(Course{ID: 7, Code: "INT3401", Name: "Trí tuệ nhân tạo", EnglishName: "Artificial Intelligence", Credits: 3, TheoryHours: 30, PracticeHours: 15}, nil)
+	repo.On("GetPrerequisites", mock.Anything, 7).Return([]CourseRef{{Code: "INT2210", Name: "Cấu trúc dữ liệu và giải thuật", Group: 1}}, nil)
+	service := NewServiceImpl(repo, nil)
+
+	name := "Artificial Intelligence"
+	info, err := service.GetCourseInfo(context.Background(), GetCourseInfoRequest{Name: &name})
+	require.NoError(t, err)
+	assert.Equal(t, CourseInfo{
+		Code: "INT3401", Name: "Trí tuệ nhân tạo", EnglishName: "Artificial Intelligence", Credits: 3, TheoryHours: 30, PracticeHours: 15,
+		Prerequisites: []CourseRef{{Code: "INT2210", Name: "Cấu trúc dữ liệu và giải thuật", Group: 1}},
+	}, info)
+
+	unknown := "Trí tuệ nhân tạo"
+	_, err = service.GetCourseInfo(context.Background(), GetCourseInfoRequest{Code: &unknown, Name: &unknown})
+	assert.EqualError(t, err, "course not found")
+}
+
+func TestServiceImpl_GetTranscript(t *testing.T) {
+	grade := func(value float64) *float64 { return &value }
+	entries := []TranscriptEntry{
+		{ClassID: 11, Semester: "2023-2024-1", ClassCode: "INT2210 1", CourseCode: "INT2210", Credits: 4, FinalGrade: grade(8.5)},
+		{ClassID: 12, Semester: "2023-2024-1", ClassCode: "MAT1093 2", CourseCode: "MAT1093", Credits: 4, FinalGrade: grade(7)},
+		{ClassID: 13, Semester: "2023-2024-2", ClassCode: "INT3401 1", CourseCode: "INT3401", Credits: 3},
+	}
+	allSemesters := []TranscriptSemester{
+		{Semester: "2023-2024-1", Credits: 8, Courses: entries[:2]},
+		{Semester: "2023-2024-2", Credits: 3, Courses: entries[2:]},
+	}
+
+	tests := []struct {
+		name       string
+		role       string
+		specificId int
+		studentId  *int
+		access     ProfessorAccess
+		expectedId int
+		semesters  []TranscriptSemester
+		credits    int
+		wantErr    error
+		errMessage string
+	}{
+		{name: "Own transcript of a student", role: "student", specificId: 5, expectedId: 5, semesters: allSemesters, credits: 11},
+		{name: "Student asking for themselves", role: "student", specificId: 5, studentId: intPtr(5), expectedId: 5, semesters: allSemesters, credits: 11},
+		{name: "Student asking for another student", role: "student", specificId: 5, studentId: intPtr(6), wantErr: db.ErrForbidden},
+		{name: "Professor advising the student", role: "professor", specificId: 2, studentId: intPtr(5), access: ProfessorAccess{Advisor: true}, expectedId: 5, semesters: allSemesters, credits: 11},
+		{
+			name: "Professor teaching a class of the student", role: "professor", specificId: 2, studentId: intPtr(5), access: ProfessorAccess{ClassIDs: []int{13}}, expectedId: 5,
+			semesters: []TranscriptSemester{{Semester: "2023-2024-2", Credits: 3, Courses: entries[2:]}}, credits: 3,
+		},
+		{name: "Professor not related to the student", role: "professor", specificId: 2, studentId: intPtr(5), wantErr: db.ErrForbidden},
+		{name: "Professor without student", role: "professor", specificId: 2, errMessage: "student_id is required"},
+		{name: "Admin", role: "admin", specificId: 1, studentId: intPtr(5), expectedId: 5, semesters: allSemesters, credits: 11},
+		{name: "Unknown role", role: "guest", specificId: 1, wantErr: db.ErrForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &MockRepository{}
+			repo.On("GetProfessorAccess", mock.Anything, tt.specificId, mock.Anything).Return(tt.access, nil)
+			repo.On("GetStudent", mock.Anything, tt.expectedId).Return(StudentRef{ID: tt.expectedId, Code: "21020005", Name: "Nguyễn Văn An"}, nil)
+			repo.On("GetTranscript", mock.Anything, tt.expectedId).Return(entries, nil)
+
+			response, err := NewServiceImpl(repo, nil).GetTranscript(callerContext(tt.role, tt.specificId), GetTranscriptRequest{StudentId: tt.studentId})
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				repo.AssertNotCalled(t, "GetTranscript", mock.Anything, mock.Anything)
+				return
+			}
+			if tt.errMessage != "" {
+				assert.EqualError(t, err, tt.errMessage)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedId, response.Student.ID)
+			assert.Equal(t, tt.credits, response.Credits)
+			assert.Equal(t, tt.semesters, response.Semesters)
+		})
+	}
+}
+
+func TestServiceImpl_AccessibleStudent(t *testing.T) {
+	repo := &MockRepository{}
+	repo.On("GetProfessorAccess", mock.Anything, 2, 5).Return(ProfessorAccess{Advisor: true}, nil)
+	repo.On("GetProfessorAccess", mock.Anything, 3, 5).Return(ProfessorAccess{ClassIDs: []int{13}}, nil)
+	service := NewServiceImpl(repo, nil)
+
+	studentId, err := service.AccessibleStudent(callerContext("professor", 2), intPtr(5))
+	require.NoError(t, err)
+	assert.Equal(t, 5, studentId)
+
+	// The whole record of the student, e.g. the degree audit, is only for the advisor
+	_, err = service.AccessibleStudent(callerContext("professor", 3), intPtr(5))
+	assert.ErrorIs(t, err, db.ErrForbidden)
+
+	studentId, err = service.AccessibleStudent(callerContext("student", 5), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 5, studentId)
+}
+
+func TestServiceImpl_GetProgramCurriculum(t *testing.T) {
+	program := Program{ID: 3, Code: "CN1", Name: "Công nghệ thông tin", DegreeType: "Cử nhân", TrainingDuration: 4}
+	courses := []CurriculumCourse{{Code: "INT2210", Credits: 4}, {Code: "INT3401", Credits: 3, Prerequisites: pq.StringArray{"INT2210"}}}
+
+	t.Run("Program of the student", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("GetProgramOfStudent", mock.Anything, 5).Return(program, nil)
+		repo.On("GetCurriculum", mock.Anything, 3).Return(courses, nil)
+
+		response, err := NewServiceImpl(repo, nil).GetProgramCurriculum(callerContext("student", 5), GetProgramCurriculumRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, GetProgramCurriculumResponse{Program: program, Courses: courses, Credits: 7}, response)
+	})
+
+	t.Run("Unknown program", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("GetProgramByCode", mock.Anything, "XX9").Return(Program{}, sql.ErrNoRows)
+
+		_, err := NewServiceImpl(repo, nil).GetProgramCurriculum(callerContext("professor", 2), GetProgramCurriculumRequest{ProgramCode: strPtr("XX9")})
+		assert.EqualError(t, err, "program XX9 not found")
+	})
+
+	t.Run("Professor without program", func(t *testing.T) {
+		_, err := NewServiceImpl(&MockRepository{}, nil).GetProgramCurriculum(callerContext("professor", 2), GetProgramCurriculumRequest{})
+		assert.EqualError(t, err, "program_code is required")
+	})
+}
+
+func intPtr(value int) *int {
+	return &value
+}
+
+func strPtr(value string) *string {
+	return &value
+}
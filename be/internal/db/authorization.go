@@ -12,18 +12,55 @@ import (
 
 type AuthorizationService interface {
 	AuthorizeNode(node *pgquery.Node, tables *om.OrderedMap[string, *TableInfoV2], neg bool, userInfo UserContext) (*AuthorizationResult, error)
+	RewriteNode(node *pgquery.Node, userInfo UserContext) error
+	// CheckColumnAccess checks the selected columns of the statement against the column rules.
+	// It returns the masks to apply on the query result, keyed by output column name.
+	CheckColumnAccess(node *pgquery.Node, userInfo UserContext) (map[string]ColumnAction, error)
+	// FilterSchema returns the part of the schema the role can read, without the tables it can't read and the denied columns
+	FilterSchema(schema *DatabaseSchema, role string) *DatabaseSchema
 }
 
 // AuthorizationServiceImpl handles SQL query authorization
 type AuthorizationServiceImpl struct {
 	schemaService SchemaService
+	policy        *AuthorizationPolicy
+	// cteNames is the set of CTE names visible in the statement being authorized, see withCTEScope
+	cteNames map[string]bool
 }
 
-// NewAuthorizationServiceImpl creates a new authorization service
+// NewAuthorizationServiceImpl creates a new authorization service with the default policy
 func NewAuthorizationServiceImpl(service SchemaService) *AuthorizationServiceImpl {
+	return NewAuthorizationServiceImplWithPolicy(service, DefaultAuthorizationPolicy())
+}
+
+// NewAuthorizationServiceImplWithPolicy creates a new authorization service with the given policy.
+// The policy should be validated against the schema before.
+func NewAuthorizationServiceImplWithPolicy(service SchemaService, policy *AuthorizationPolicy) *AuthorizationServiceImpl {
 	return &AuthorizationServiceImpl{
 		schemaService: service,
+		policy:        policy,
+	}
+}
+
+// getPolicy returns the policy of the service, falling back to the default policy when none is set
+func (s *AuthorizationServiceImpl) getPolicy() *AuthorizationPolicy {
+	if s.policy == nil {
+		return defaultPolicy()
 	}
+	return s.policy
+}
+
+func (s *AuthorizationServiceImpl) FilterSchema(schema *DatabaseSchema, role string) *DatabaseSchema {
+	policy := s.getPolicy()
+	return schema.Filter(
+		func(table string) bool {
+			return policy.CanReadTable(table, role)
+		},
+		func(table string, column string) bool {
+			rule := policy.GetColumnRule(table, role, column)
+			return rule == nil || rule.Action != ColumnActionDeny
+		},
+	)
 }
 
 type AuthorizationResult struct {
@@ -33,6 +70,18 @@ type AuthorizationResult struct {
 	Tables *om.OrderedMap[string, *TableInfoV2]
 
 	TargetList []*pgquery.Node
+
+	// Explanation tells why a SELECT statement isn't authorized, it is nil if the statement is authorized
+	Explanation *AuthorizationExplanation
+
+	// denials are the unauthorized SELECT statements found while authorizing, the explanation is built from them
+	denials []denial
+}
+
+// denial is an unauthorized SELECT statement without set operation, with the tables which stayed unauthorized
+type denial struct {
+	stmt   *pgquery.SelectStmt
+	tables *om.OrderedMap[string, *TableInfoV2]
 }
 
 type AuthorizationContext struct {
@@ -42,8 +91,8 @@ type AuthorizationContext struct {
 }
 
 type AuthorizationCondition struct {
-	AuthorizeColumn string
-	ExpectedValues  []int // Changed to plural for clarity
+	AuthorizeColumn string `json:"authorize_column"`
+	ExpectedValues  []int  `json:"expected_values"` // Changed to plural for clarity
 }
 
 type UserContext interface {
@@ -65,7 +114,21 @@ type UserContext interface {
 // - bool: true if the node is authorized, false otherwise
 // - []TableInfo: the list of remaining unauthorized tables
 // - error: an error if any occurred during the authorization process
+//
+// The explanation of an unauthorized SELECT statement is built once here, from the denials of its nested statements.
 func (s *AuthorizationServiceImpl) AuthorizeNode(node *pgquery.Node, tables *om.OrderedMap[string, *TableInfoV2], neg bool, userInfo UserContext) (*AuthorizationResult, error) {
+	result, err := s.authorizeNode(node, tables, neg, userInfo)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := node.GetNode().(*pgquery.Node_SelectStmt); ok && !result.Authorized {
+		result.Explanation = s.explainDenials(result.denials, userInfo)
+	}
+	return result, nil
+}
+
+// authorizeNode is AuthorizeNode without the explanation, the nested nodes are authorized with it
+func (s *AuthorizationServiceImpl) authorizeNode(node *pgquery.Node, tables *om.OrderedMap[string, *TableInfoV2], neg bool, userInfo UserContext) (*AuthorizationResult, error) {
 	if node.GetNode() == nil {
 		return nil, errors.New("node is nil")
 	}
@@ -92,6 +155,8 @@ func (s *AuthorizationServiceImpl) AuthorizeNode(node *pgquery.Node, tables *om.
 		return s.authorizeRangeSubselect(node.GetRangeSubselect(), tables, neg, userInfo)
 	case *pgquery.Node_WithClause:
 		return s.authorizeWithClause(node.GetWithClause(), tables, neg, userInfo)
+	case *pgquery.Node_AConst:
+		return s.authorizeAConst(node.GetAConst(), tables, neg)
 	case *pgquery.Node_Query:
 	case *pgquery.Node_ColumnRef:
 	case *pgquery.Node_AIndirection:
@@ -111,6 +176,27 @@ func (s *AuthorizationServiceImpl) AuthorizeNode(node *pgquery.Node, tables *om.
 }
 
 func (s *AuthorizationServiceImpl) authorizeSelectStmt(stmt *pgquery.SelectStmt, tables *om.OrderedMap[string, *TableInfoV2], neg bool, userInfo UserContext) (*AuthorizationResult, error) {
+	if stmt.GetIntoClause() != nil || stmt.GetWithClause() == nil {
+		return s.authorizeSelectBody(stmt, tables, neg, userInfo)
+	}
+
+	// The CTE bodies are authorized on their own, the conditions of the statement can't authorize their tables.
+	// The rest of the statement is authorized in the scope of the CTE names.
+	scoped, ctesResult, err := s.withCTEScope(stmt.GetWithClause(), userInfo)
+	if err != nil {
+		return nil, err
+	}
+	result, err := scoped.authorizeSelectBody(stmt, tables, neg, userInfo)
+	if err != nil {
+		return nil, err
+	}
+	result.Authorized = result.Authorized && ctesResult.Authorized
+	result.denials = append(result.denials, ctesResult.denials...)
+	return result, nil
+}
+
+// authorizeSelectBody authorizes the statement without its WITH clause
+func (s *AuthorizationServiceImpl) authorizeSelectBody(stmt *pgquery.SelectStmt, tables *om.OrderedMap[string, *TableInfoV2], neg bool, userInfo UserContext) (*AuthorizationResult, error) {
 	result := &AuthorizationResult{
 		Authorized: true,
 		Tables:     om.NewOrderedMap[string, *TableInfoV2](),
@@ -120,17 +206,6 @@ func (s *AuthorizationServiceImpl) authorizeSelectStmt(stmt *pgquery.SelectStmt,
 		return result, nil
 	}
 
-	if stmt.GetWithClause() != nil {
-		for _, cte := range stmt.GetWithClause().GetCtes() {
-			cteResult, err := s.AuthorizeNode(cte, tables, neg, userInfo)
-			if err != nil {
-				return nil, err
-			}
-			result.Tables = s.MergeMaps(cteResult.Tables, result.Tables)
-			result.Authorized = result.Authorized && cteResult.Authorized
-		}
-	}
-
 	if stmt.GetOp() == pgquery.SetOperation_SETOP_UNION {
 		// Similar to the OR condition, the remaining unauthorized tables will be union
 		// of all unauthorized tables for left and right select
@@ -143,6 +218,7 @@ func (s *AuthorizationServiceImpl) authorizeSelectStmt(stmt *pgquery.SelectStmt,
 			return nil, err
 		}
 		result.Authorized = lResult.Authorized && rResult.Authorized
+		result.denials = append(lResult.denials, rResult.denials...)
 		// This is a little trick, we only merge the right to left. But because the scope of lResult and rResult is only here
 		// So do this to have a little bit better performance and convenience in code
 		s.UpdateUnauthorizedTablesByUnion(result.Tables, []*om.OrderedMap[string, *TableInfoV2]{s.MergeMaps(lResult.Tables, rResult.Tables)})
@@ -164,6 +240,9 @@ func (s *AuthorizationServiceImpl) authorizeSelectStmt(stmt *pgquery.SelectStmt,
 			return nil, err
 		}
 		result.Authorized = lResult.Authorized || rResult.Authorized
+		if !result.Authorized {
+			result.denials = append(lResult.denials, rResult.denials...)
+		}
 		// Update result tables like above
 		s.UpdateUnauthorizedTablesByIntersection(result.Tables, []*om.OrderedMap[string, *TableInfoV2]{s.MergeMaps(lResult.Tables, rResult.Tables)})
 		if lResult.TargetList != nil && rResult.TargetList != nil {
@@ -181,7 +260,7 @@ func (s *AuthorizationServiceImpl) authorizeSelectStmt(stmt *pgquery.SelectStmt,
 	}
 
 	for _, fromItem := range stmt.GetFromClause() {
-		fromResult, err := s.AuthorizeNode(fromItem, tables, neg, userInfo)
+		fromResult, err := s.authorizeNode(fromItem, tables, neg, userInfo)
 		if err != nil {
 			return nil, err
 		}
@@ -192,7 +271,7 @@ func (s *AuthorizationServiceImpl) authorizeSelectStmt(stmt *pgquery.SelectStmt,
 	// We are certainly that the where clause and having clause don't discover needed new tables.
 	// If they discovered new tables, it should be handled inside its own node
 	if !result.Authorized && stmt.GetWhereClause() != nil {
-		whereResult, err := s.AuthorizeNode(stmt.WhereClause, result.Tables, neg, userInfo)
+		whereResult, err := s.authorizeNode(stmt.WhereClause, result.Tables, neg, userInfo)
 		if err != nil {
 			return nil, err
 		}
@@ -203,7 +282,7 @@ func (s *AuthorizationServiceImpl) authorizeSelectStmt(stmt *pgquery.SelectStmt,
 
 	// The HAVING clause is applied after the WHERE clause
 	if !result.Authorized && stmt.GetHavingClause() != nil {
-		havingResult, err := s.AuthorizeNode(stmt.HavingClause, result.Tables, neg, userInfo)
+		havingResult, err := s.authorizeNode(stmt.HavingClause, result.Tables, neg, userInfo)
 		if err != nil {
 			return nil, err
 		}
@@ -217,6 +296,9 @@ func (s *AuthorizationServiceImpl) authorizeSelectStmt(stmt *pgquery.SelectStmt,
 		result.TargetList = stmt.GetTargetList()
 	}
 
+	if !result.Authorized {
+		result.denials = []denial{{stmt: stmt, tables: result.Tables}}
+	}
 	return result, nil
 }
 
@@ -224,14 +306,14 @@ func (s *AuthorizationServiceImpl) authorizeSelectStmt(stmt *pgquery.SelectStmt,
 func (s *AuthorizationServiceImpl) authorizeFromExpr(node *pgquery.FromExpr, tables *om.OrderedMap[string, *TableInfoV2], neg bool, userInfo UserContext) (*AuthorizationResult, error) {
 	var combinedTables *om.OrderedMap[string, *TableInfoV2]
 	for _, table := range node.GetFromlist() {
-		tableResult, err := s.AuthorizeNode(table, tables, neg, userInfo)
+		tableResult, err := s.authorizeNode(table, tables, neg, userInfo)
 		if err != nil {
 			return nil, err
 		}
 		combinedTables = s.MergeMaps(combinedTables, tableResult.Tables)
 	}
 
-	return s.AuthorizeNode(node.GetQuals(), combinedTables, neg, userInfo)
+	return s.authorizeNode(node.GetQuals(), combinedTables, neg, userInfo)
 }
 
 func (s *AuthorizationServiceImpl) authorizeCommonTableExpr(expr *pgquery.Node_CommonTableExpr, tables []TableInfo, userInfo UserContext) (*AuthorizationResult, error) {
@@ -250,12 +332,12 @@ func (s *AuthorizationServiceImpl) authorizeJoinExpr(joinExpr *pgquery.JoinExpr,
 		return nil, fmt.Errorf("right side of join is nil")
 	}
 
-	lResult, err := s.AuthorizeNode(joinExpr.GetLarg(), tables, neg, userInfo)
+	lResult, err := s.authorizeNode(joinExpr.GetLarg(), tables, neg, userInfo)
 	if err != nil {
 		return nil, err
 	}
 
-	rResult, err := s.AuthorizeNode(joinExpr.GetRarg(), tables, neg, userInfo)
+	rResult, err := s.authorizeNode(joinExpr.GetRarg(), tables, neg, userInfo)
 	if err != nil {
 		return nil, err
 	}
@@ -318,7 +400,7 @@ func (s *AuthorizationServiceImpl) authorizeJoinExpr(joinExpr *pgquery.JoinExpr,
 		return nil, fmt.Errorf("unsupported join type: %v", joinExpr.GetJointype())
 	}
 
-	qualResult, err := s.AuthorizeNode(joinExpr.GetQuals(), curTables, neg, userInfo)
+	qualResult, err := s.authorizeNode(joinExpr.GetQuals(), curTables, neg, userInfo)
 	if err != nil {
 		return nil, err
 	}
@@ -334,7 +416,7 @@ func (s *AuthorizationServiceImpl) authorizeJoinExpr(joinExpr *pgquery.JoinExpr,
 // authorizeSubLink authorizes a SubLink node in the SQL query.
 func (s *AuthorizationServiceImpl) authorizeSubLink(link *pgquery.SubLink, tables *om.OrderedMap[string, *TableInfoV2], neg bool, userInfo UserContext) (*AuthorizationResult, error) {
 	// This node only parse fully after analysis phase, so we only can to authorize subquery here
-	return s.AuthorizeNode(link.GetSubselect(), tables, neg, userInfo)
+	return s.authorizeNode(link.GetSubselect(), tables, neg, userInfo)
 }
 
 func (s *AuthorizationServiceImpl) authorizeRangeSubselect(node *pgquery.RangeSubselect, tables *om.OrderedMap[string, *TableInfoV2], neg bool, userInfo UserContext) (*AuthorizationResult, error) {
@@ -343,7 +425,7 @@ func (s *AuthorizationServiceImpl) authorizeRangeSubselect(node *pgquery.RangeSu
 		return nil, fmt.Errorf("lateral is not supported")
 	}
 
-	authResult, err := s.AuthorizeNode(node.GetSubquery(), tables, false, userInfo)
+	authResult, err := s.authorizeNode(node.GetSubquery(), tables, false, userInfo)
 	if err != nil {
 		return nil, err
 	}
@@ -364,11 +446,30 @@ func (s *AuthorizationServiceImpl) authorizeRangeVar(node *pgquery.RangeVar, tab
 		return nil, fmt.Errorf("range var is nil")
 	}
 
+	if node.GetSchemaname() == "" && s.cteNames[node.GetRelname()] {
+		// A CTE only reads what its body is authorized to read, and the body is authorized with the WITH clause
+		cte := &TableInfoV2{
+			Name:               node.GetRelname(),
+			Columns:            om.NewOrderedMap[string, *ColumnInfo](),
+			Alias:              node.GetRelname(),
+			Authorized:         true,
+			UnAuthorizedTables: om.NewOrderedMap[string, *TableInfoV2](),
+		}
+		if node.GetAlias() != nil {
+			cte.Alias = node.GetAlias().GetAliasname()
+		}
+		return &AuthorizationResult{
+			Authorized: true,
+			Tables:     s.MergeMaps(tables, om.NewOrderedMapWithElements(&om.Element[string, *TableInfoV2]{Key: cte.Alias, Value: cte})),
+		}, nil
+	}
+
+	authorized := s.getPolicy().IsPublicTable(node.GetRelname()) || s.getPolicy().IsBypassRole(userInfo.GetRole())
 	table := &TableInfoV2{
 		Name:               node.GetRelname(),
 		Columns:            om.NewOrderedMap[string, *ColumnInfo](), // Need to check with select statement to decide should we add columns here or when we have target list
 		Alias:              node.GetRelname(),
-		Authorized:         isPublicTable(node.GetRelname()) || userInfo.GetRole() == "admin",
+		Authorized:         authorized,
 		UnAuthorizedTables: om.NewOrderedMap[string, *TableInfoV2](),
 		IsDatabase:         true,
 	}
@@ -379,6 +480,7 @@ func (s *AuthorizationServiceImpl) authorizeRangeVar(node *pgquery.RangeVar, tab
 		table.Columns.Set(colName, &ColumnInfo{
 			Name:        colName,
 			SourceTable: table,
+			Rule:        s.getPolicy().GetColumnRule(table.Name, userInfo.GetRole(), colName),
 		})
 	}
 
@@ -389,7 +491,7 @@ func (s *AuthorizationServiceImpl) authorizeRangeVar(node *pgquery.RangeVar, tab
 	tables = s.MergeMaps(tables, om.NewOrderedMapWithElements(&om.Element[string, *TableInfoV2]{Key: table.Alias, Value: table}))
 
 	return &AuthorizationResult{
-		Authorized: isPublicTable(table.Name) || userInfo.GetRole() == "admin",
+		Authorized: authorized,
 		Tables:     tables,
 	}, nil
 }
@@ -403,7 +505,7 @@ func (s *AuthorizationServiceImpl) authorizeWithClause(clause *pgquery.WithClaus
 		Tables:     om.NewOrderedMap[string, *TableInfoV2](),
 	}
 	for _, cte := range clause.GetCtes() {
-		cteResult, err := s.AuthorizeNode(cte, tables, neg, userInfo)
+		cteResult, err := s.authorizeNode(cte, tables, neg, userInfo)
 		if err != nil {
 			return nil, err
 		}
@@ -413,6 +515,59 @@ func (s *AuthorizationServiceImpl) authorizeWithClause(clause *pgquery.WithClaus
 	return result, nil
 }
 
+// withCTEScope authorizes the CTE bodies of a WITH clause and returns the service whose scope also sees the CTE names,
+// with the result of the bodies. A CTE body only sees the CTEs before it, or all of them in a recursive WITH clause.
+func (s *AuthorizationServiceImpl) withCTEScope(clause *pgquery.WithClause, userInfo UserContext) (*AuthorizationServiceImpl, *AuthorizationResult, error) {
+	scoped := &AuthorizationServiceImpl{
+		schemaService: s.schemaService,
+		policy:        s.policy,
+		cteNames:      make(map[string]bool, len(s.cteNames)+len(clause.GetCtes())),
+	}
+	for name := range s.cteNames {
+		scoped.cteNames[name] = true
+	}
+	if clause.GetRecursive() {
+		for _, cte := range clause.GetCtes() {
+			scoped.cteNames[cte.GetCommonTableExpr().GetCtename()] = true
+		}
+	}
+
+	result := &AuthorizationResult{Authorized: true}
+	for _, cte := range clause.GetCtes() {
+		body := cte.GetCommonTableExpr().GetCtequery()
+		if body == nil {
+			return nil, nil, errors.New("CTE query is nil")
+		}
+		cteResult, err := scoped.authorizeNode(body, nil, false, userInfo)
+		if err != nil {
+			return nil, nil, err
+		}
+		result.Authorized = result.Authorized && cteResult.Authorized
+		result.denials = append(result.denials, cteResult.denials...)
+		scoped.cteNames[cte.GetCommonTableExpr().GetCtename()] = true
+	}
+	return scoped, result, nil
+}
+
+// authorizeAConst authorizes a constant condition. A condition which is always false selects no row, so it
+// authorizes every table, e.g. the FALSE filter of the rewriter for the tables the user has no policy for.
+func (s *AuthorizationServiceImpl) authorizeAConst(aConst *pgquery.A_Const, tables *om.OrderedMap[string, *TableInfoV2], neg bool) (*AuthorizationResult, error) {
+	resultTables := CloneUnAuthorizedTables(tables)
+	if resultTables == nil {
+		resultTables = om.NewOrderedMap[string, *TableInfoV2]()
+	}
+	boolVal, ok := aConst.GetVal().(*pgquery.A_Const_Boolval)
+	// NOT TRUE is always false too
+	if !ok || aConst.GetIsnull() || boolVal.Boolval.GetBoolval() != neg {
+		return &AuthorizationResult{Authorized: resultTables.Len() == 0, Tables: resultTables}, nil
+	}
+	for _, table := range resultTables.AllFromFront() {
+		table.Authorized = true
+		table.UnAuthorizedTables = om.NewOrderedMap[string, *TableInfoV2]()
+	}
+	return &AuthorizationResult{Authorized: true, Tables: resultTables}, nil
+}
+
 // authorizeBoolExpr authorizes a BoolExpr node in the SQL query (mostly used in WHERE and ON clause).
 func (s *AuthorizationServiceImpl) authorizeBoolExpr(boolExpr *pgquery.BoolExpr, tables *om.OrderedMap[string, *TableInfoV2], neg bool, userInfo UserContext) (*AuthorizationResult, error) {
 	if boolExpr == nil {
@@ -433,7 +588,7 @@ func (s *AuthorizationServiceImpl) authorizeBoolExpr(boolExpr *pgquery.BoolExpr,
 		// of all unauthorized tables for each subexpression
 		var authResultTables []*om.OrderedMap[string, *TableInfoV2]
 		for _, arg := range boolExpr.Args {
-			authResult, err := s.AuthorizeNode(arg, result.Tables, neg, userInfo)
+			authResult, err := s.authorizeNode(arg, result.Tables, neg, userInfo)
 			if err != nil {
 				return nil, err
 			}
@@ -445,7 +600,7 @@ func (s *AuthorizationServiceImpl) authorizeBoolExpr(boolExpr *pgquery.BoolExpr,
 		// If intersection of unauthorized tables of all subexpressions is empty, then the whole expression is authorized
 		var authResultTables []*om.OrderedMap[string, *TableInfoV2]
 		for _, arg := range boolExpr.Args {
-			authResult, err := s.AuthorizeNode(arg, result.Tables, neg, userInfo)
+			authResult, err := s.authorizeNode(arg, result.Tables, neg, userInfo)
 			if err != nil {
 				return nil, err
 			}
@@ -459,7 +614,7 @@ func (s *AuthorizationServiceImpl) authorizeBoolExpr(boolExpr *pgquery.BoolExpr,
 		if len(boolExpr.Args) != 1 {
 			return nil, fmt.Errorf("NOT expression must have exactly one argument")
 		}
-		authResult, err := s.AuthorizeNode(boolExpr.Args[0], result.Tables, !neg, userInfo)
+		authResult, err := s.authorizeNode(boolExpr.Args[0], result.Tables, !neg, userInfo)
 		if err != nil {
 			return nil, err
 		}
@@ -574,7 +729,7 @@ func (s *AuthorizationServiceImpl) authorizeAExpr(expr *pgquery.A_Expr, tables *
 						continue
 					}
 
-					authResult, _ := s.AuthorizeNode(expr.GetRexpr(), om.NewOrderedMapWithElements(tableElement), neg, userInfo)
+					authResult, _ := s.authorizeNode(expr.GetRexpr(), om.NewOrderedMapWithElements(tableElement), neg, userInfo)
 					if authResult.Authorized {
 						tableElement.Value.Authorized = true
 					}
@@ -583,7 +738,7 @@ func (s *AuthorizationServiceImpl) authorizeAExpr(expr *pgquery.A_Expr, tables *
 					if resolvedCol == nil {
 						continue
 					}
-					authResult, _ := s.AuthorizeNode(expr.GetRexpr(), nil, neg, userInfo)
+					authResult, _ := s.authorizeNode(expr.GetRexpr(), nil, neg, userInfo)
 					for _, table := range authResult.Tables.AllFromFront() {
 						if !table.IsDatabase {
 							// Don't support yet, to support in the future we need to have an extra field in TableInfoV2 to quick access all discovered tables
@@ -605,8 +760,8 @@ func (s *AuthorizationServiceImpl) authorizeAExpr(expr *pgquery.A_Expr, tables *
 		}
 	case pgquery.A_Expr_Kind_AEXPR_IN:
 		// Case: a IN (b, c, d)
-		// We only allow authorizeColumn IN (id) or id IN (column)
-		if expr.GetLexpr().GetColumnRef() == nil || expr.GetRexpr().GetList() == nil || len(expr.GetRexpr().GetList().GetItems()) != 1 {
+		// We only allow authorizeColumn IN (id, ...) where every id is allowed
+		if expr.GetLexpr().GetColumnRef() == nil || expr.GetRexpr().GetList() == nil || len(expr.GetRexpr().GetList().GetItems()) == 0 {
 			break
 		}
 		columnRef := expr.GetLexpr().GetColumnRef()
@@ -618,13 +773,13 @@ func (s *AuthorizationServiceImpl) authorizeAExpr(expr *pgquery.A_Expr, tables *
 					// If the table is authorized, we don't need to check it
 					continue
 				}
-				if s.isAuthorizedExpression(columnRef, itemList[0].GetAConst(), table, table, userInfo) {
+				if s.isAuthorizedList(columnRef, itemList, table, table, userInfo) {
 					table.Authorized = true
 				}
 			} else {
 				var tablesToRemove []string
 				for unAuthAlias, unauthorizedTable := range table.UnAuthorizedTables.AllFromFront() {
-					if s.isAuthorizedExpression(columnRef, itemList[0].GetAConst(), table, unauthorizedTable, userInfo) {
+					if s.isAuthorizedList(columnRef, itemList, table, unauthorizedTable, userInfo) {
 						// Just too much careful, we also set the table to authorized
 						authorizedTable, _ := table.UnAuthorizedTables.Get(unAuthAlias)
 						authorizedTable.Authorized = true
@@ -988,136 +1143,53 @@ func (s *AuthorizationServiceImpl) isAuthorizedExpression(columnRef *pgquery.Col
 	return true
 }
 
-// getAuthorizationColumn returns the column name used for authorization filtering
-// for a given table and role. Returns an empty string for public tables, admin role,
-// or when no specific authorization column applies.
-func (s *AuthorizationServiceImpl) getAuthorizationColumn(name string, userInfo UserContext) AuthorizationContext {
-	// Admin role has unrestricted access to all tables
-	if userInfo.GetRole() == "admin" {
-		return AuthorizationContext{
-			Bypass: true,
+// isAuthorizedList checks that every item of an IN list is an allowed value of the authorize column
+func (s *AuthorizationServiceImpl) isAuthorizedList(columnRef *pgquery.ColumnRef, items []*pgquery.Node, targetTable *TableInfoV2, realUnAuthTable *TableInfoV2, userInfo UserContext) bool {
+	for _, item := range items {
+		if item.GetAConst() == nil || !s.isAuthorizedExpression(columnRef, item.GetAConst(), targetTable, realUnAuthTable, userInfo) {
+			return false
 		}
 	}
+	return true
+}
 
-	// Public tables accessible to all roles
-	switch name {
-	case "program", "semester", "course", "course_program", "course_class",
-		"course_class_schedule", "course_schedule_instructor", "faculty":
+// getAuthorizationColumn returns the columns used for authorization filtering and their allowed values
+// for a given table and role, as declared in the authorization policy.
+// It bypasses the check for public tables and bypass roles (admin), and returns an empty context
+// when the role has no access to the table.
+func (s *AuthorizationServiceImpl) getAuthorizationColumn(name string, userInfo UserContext) AuthorizationContext {
+	policy := s.getPolicy()
+	if policy.IsBypassRole(userInfo.GetRole()) || policy.IsPublicTable(name) {
 		return AuthorizationContext{
 			Bypass: true,
 		}
 	}
 
-	// Role-specific authorization columns
-	switch userInfo.GetRole() {
-
-	case "student":
-		studentInfo, ok := userInfo.(*StudentInfo)
-		if !ok {
-			return AuthorizationContext{}
-		}
-		switch name {
-		case "professor":
-			result := AuthorizationContext{
-				AuthorizeColumns: []string{"id"},
-				Conditions:       om.NewOrderedMap[string, []int](),
-			}
-			// Create a combined slice of instructor and advisor IDs
-			combinedIDs := make([]int, 0)
-			combinedIDs = append(combinedIDs, studentInfo.CourseInstructorIDs...)
-			combinedIDs = append(combinedIDs, studentInfo.AdvisorProfessorID)
-			result.Conditions.Set("id", combinedIDs)
-			return result
-
-		case "student":
-			result := AuthorizationContext{
-				AuthorizeColumns: []string{"id"},
-				Conditions:       om.NewOrderedMap[string, []int](),
-			}
-			result.Conditions.Set("id", []int{studentInfo.ID})
-			return result
-		case "administrative_class":
-			result := AuthorizationContext{
-				AuthorizeColumns: []string{"id"},
-				Conditions:       om.NewOrderedMap[string, []int](),
-			}
-			result.Conditions.Set("id", []int{studentInfo.AdministrativeClassID})
-
-			return result
-		case "course_class_enrollment":
-			result := AuthorizationContext{
-				AuthorizeColumns: []string{"student_id"},
-				Conditions:       om.NewOrderedMap[string, []int](),
-			}
-			result.Conditions.Set("student_id", []int{studentInfo.ID})
-
-			return result
-		case "student_course_class_schedule":
-			result := AuthorizationContext{
-				AuthorizeColumns: []string{"student_id"},
-				Conditions:       om.NewOrderedMap[string, []int](),
-			}
-			result.Conditions.Set("student_id", []int{studentInfo.ID})
-			return result
-		case "student_scholarship":
-			result := AuthorizationContext{
-				AuthorizeColumns: []string{"student_id"},
-				Conditions:       om.NewOrderedMap[string, []int](),
-			}
-			result.Conditions.Set("student_id", []int{studentInfo.ID})
-			return result
-		}
-	case "professor":
-		professorInfo, ok := userInfo.(*ProfessorInfo)
-		if !ok {
-			return AuthorizationContext{}
-		}
-		switch name {
-		case "professor":
-			result := AuthorizationContext{
-				AuthorizeColumns: []string{"id"}, // Filter by professor_id
-				Conditions:       om.NewOrderedMap[string, []int](),
-			}
-			result.Conditions.Set("id", []int{professorInfo.ID})
-			return result
-		case "administrative_class":
-			result := AuthorizationContext{
-				AuthorizeColumns: []string{"id", "advisor_id"},
-				Conditions:       om.NewOrderedMap[string, []int](),
-			}
-			result.Conditions.Set("advisor_id", []int{professorInfo.UserInfo.ID})
-			result.Conditions.Set("id", professorInfo.AdvisedClassIDs)
-			return result
-		case "course_class_enrollment":
-			result := AuthorizationContext{
-				AuthorizeColumns: []string{"course_class_id", "student_id"},
-				Conditions:       om.NewOrderedMap[string, []int](),
-			}
+	tablePolicy := policy.GetTablePolicy(name, userInfo.GetRole())
+	if tablePolicy == nil {
+		// Default: No access for unspecified tables/roles
+		return AuthorizationContext{}
+	}
 
-			result.Conditions.Set("course_class_id", professorInfo.TaughtCourseClassIDs)
-			result.Conditions.Set("student_id", professorInfo.AdvisedStudentIDs)
-			return result
-		case "student_course_class_schedule":
-			result := AuthorizationContext{
-				AuthorizeColumns: []string{"course_class_id", "student_id"},
-				Conditions:       om.NewOrderedMap[string, []int](),
-			}
-			result.Conditions.Set("course_class_id", professorInfo.TaughtCourseClassIDs)
-			result.Conditions.Set("student_id", professorInfo.AdvisedStudentIDs)
-
-			return result
-		case "student":
-			result := AuthorizationContext{
-				AuthorizeColumns: []string{"id"},
-				Conditions:       om.NewOrderedMap[string, []int](),
+	result := AuthorizationContext{
+		AuthorizeColumns: make([]string, 0, len(tablePolicy.Columns)),
+		Conditions:       om.NewOrderedMap[string, []int](),
+	}
+	for _, column := range tablePolicy.Columns {
+		allowedValues := make([]int, 0)
+		for _, source := range column.Sources {
+			values, ok := resolveFactSource(source, userInfo)
+			if !ok {
+				// The user context doesn't carry the facts of its role, so we can't authorize anything
+				log.Printf("Warning: can't resolve fact source %s for user %d", source, userInfo.GetID())
+				return AuthorizationContext{}
 			}
-			result.Conditions.Set("id", professorInfo.TaughtStudentIDs)
-			return result
+			allowedValues = append(allowedValues, values...)
 		}
+		result.AuthorizeColumns = append(result.AuthorizeColumns, column.Column)
+		result.Conditions.Set(column.Column, allowedValues)
 	}
-
-	// Default: No access for unspecified tables/roles
-	return AuthorizationContext{}
+	return result
 }
 
 func (s *AuthorizationServiceImpl) CheckPermission(ctx context.Context, id int, role string, table string) {
@@ -23,6 +23,8 @@ func (m *MockSchemaService) GetColumns(tableName string) []string {
 		return []string{"id", "name", "program_id", "advisor_id"}
 	case "course_class_enrollment":
 		return []string{"id", "student_id", "course_class_id", "grade"}
+	case "student_course_class_schedule":
+		return []string{"id", "course_class_enrollment_id", "course_class_schedule_id"}
 	default:
 		return []string{}
 	}
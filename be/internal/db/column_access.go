@@ -0,0 +1,407 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	om "github.com/elliotchance/orderedmap/v3"
+	pgquery "github.com/pganalyze/pg_query_go/v6"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"strings"
+)
+
+// ColumnAccessError is returned when the query selects a column denied by a column rule
+type ColumnAccessError struct {
+	Table  string
+	Column string
+}
+
+func (e *ColumnAccessError) Error() string {
+	return fmt.Sprintf("access to column %s of table %s is denied", e.Column, e.Table)
+}
+
+// outputColumn is a column of the result of a SELECT statement with the rule protecting it
+type outputColumn struct {
+	Name string
+	Rule *ColumnRule
+}
+
+// CheckColumnAccess resolves the output columns of the statement to the columns of the database tables
+// and checks them against the column rules of the user.
+// It returns a ColumnAccessError if a denied column is selected, otherwise the masks to apply on the query result
+// keyed by output column name.
+//
+// Only the selected columns are checked, a protected column can still be used in the WHERE, JOIN or ORDER BY clauses.
+// A column computed from a protected column (e.g. upper(email)) is protected too, but it can't be partially redacted,
+// so mask_partial becomes mask_null for it. A whole-row reference (e.g. SELECT s, row_to_json(s) or to_json(s.*))
+// reads every column of the table, so it is protected by the most restrictive rule of the table.
+func (s *AuthorizationServiceImpl) CheckColumnAccess(node *pgquery.Node, userInfo UserContext) (map[string]ColumnAction, error) {
+	stmt := node.GetSelectStmt()
+	if stmt == nil {
+		return nil, errors.New("only SELECT statements are supported")
+	}
+
+	outputs := s.resolveSelectColumns(stmt, map[string]*TableInfoV2{}, userInfo)
+
+	masks := make(map[string]ColumnAction)
+	for _, output := range outputs {
+		if output.Rule == nil {
+			continue
+		}
+		if output.Rule.Action == ColumnActionDeny {
+			return nil, &ColumnAccessError{Table: output.Rule.Table, Column: output.Rule.Column}
+		}
+		// Different columns can have the same output name, then the more restrictive mask wins
+		if restrictiveness[output.Rule.Action] > restrictiveness[masks[output.Name]] {
+			masks[output.Name] = output.Rule.Action
+		}
+	}
+	return masks, nil
+}
+
+// resolveSelectColumns returns the output columns of the statement.
+// ctes is a map of the CTE names visible in the current scope to their virtual tables.
+func (s *AuthorizationServiceImpl) resolveSelectColumns(stmt *pgquery.SelectStmt, ctes map[string]*TableInfoV2, userInfo UserContext) []outputColumn {
+	if stmt == nil {
+		return nil
+	}
+
+	scope := make(map[string]*TableInfoV2, len(ctes))
+	for name, table := range ctes {
+		scope[name] = table
+	}
+	if withClause := stmt.GetWithClause(); withClause != nil {
+		if withClause.GetRecursive() {
+			// The columns of a recursive CTE are resolved from its non-recursive part, so we only need to reserve the names here
+			for _, cte := range withClause.GetCtes() {
+				name := cte.GetCommonTableExpr().GetCtename()
+				scope[name] = s.newVirtualTable(name, nil, nil)
+			}
+		}
+		for _, cte := range withClause.GetCtes() {
+			expr := cte.GetCommonTableExpr()
+			outputs := s.resolveSelectColumns(expr.GetCtequery().GetSelectStmt(), scope, userInfo)
+			scope[expr.GetCtename()] = s.newVirtualTable(expr.GetCtename(), outputs, expr.GetAliascolnames())
+		}
+	}
+
+	if stmt.GetOp() != pgquery.SetOperation_SETOP_NONE {
+		// The names of the output columns come from the left side, and each column is protected by the rules of both sides
+		outputs := s.resolveSelectColumns(stmt.GetLarg(), scope, userInfo)
+		rOutputs := s.resolveSelectColumns(stmt.GetRarg(), scope, userInfo)
+		for i := range outputs {
+			if i < len(rOutputs) {
+				outputs[i].Rule = moreRestrictiveRule(outputs[i].Rule, rOutputs[i].Rule)
+			}
+		}
+		return outputs
+	}
+
+	tables := om.NewOrderedMap[string, *TableInfoV2]()
+	for _, fromItem := range stmt.GetFromClause() {
+		s.collectFromTables(fromItem, scope, tables, userInfo)
+	}
+
+	var outputs []outputColumn
+	for _, target := range stmt.GetTargetList() {
+		outputs = append(outputs, s.resolveTargetColumns(target.GetResTarget(), tables, scope, userInfo)...)
+	}
+	return outputs
+}
+
+// collectFromTables adds the tables of the FROM item to tables, keyed by alias
+func (s *AuthorizationServiceImpl) collectFromTables(node *pgquery.Node, ctes map[string]*TableInfoV2, tables *om.OrderedMap[string, *TableInfoV2], userInfo UserContext) {
+	switch n := node.GetNode().(type) {
+	case *pgquery.Node_RangeVar:
+		rangeVar := n.RangeVar
+		alias := rangeVar.GetRelname()
+		if rangeVar.GetAlias() != nil {
+			alias = rangeVar.GetAlias().GetAliasname()
+		}
+
+		var table *TableInfoV2
+		if cte, ok := ctes[rangeVar.GetRelname()]; ok && rangeVar.GetSchemaname() == "" {
+			table = cte
+		} else {
+			// authorizeRangeVar populates the columns of the database table with their rules
+			result, err := s.authorizeRangeVar(rangeVar, nil, userInfo)
+			if err != nil {
+				return
+			}
+			table, _ = result.Tables.Get(alias)
+		}
+		if table == nil {
+			return
+		}
+		if rangeVar.GetAlias() != nil && len(rangeVar.GetAlias().GetColnames()) > 0 {
+			table = s.newVirtualTable(alias, s.tableOutputColumns(table), rangeVar.GetAlias().GetColnames())
+		}
+		tables.Set(alias, table)
+
+	case *pgquery.Node_RangeSubselect:
+		if n.RangeSubselect.GetAlias() == nil {
+			return
+		}
+		alias := n.RangeSubselect.GetAlias()
+		outputs := s.resolveSelectColumns(n.RangeSubselect.GetSubquery().GetSelectStmt(), ctes, userInfo)
+		tables.Set(alias.GetAliasname(), s.newVirtualTable(alias.GetAliasname(), outputs, alias.GetColnames()))
+
+	case *pgquery.Node_JoinExpr:
+		if n.JoinExpr.GetAlias() == nil {
+			s.collectFromTables(n.JoinExpr.GetLarg(), ctes, tables, userInfo)
+			s.collectFromTables(n.JoinExpr.GetRarg(), ctes, tables, userInfo)
+			return
+		}
+		// The tables inside an aliased join are hidden behind the alias
+		joinTables := om.NewOrderedMap[string, *TableInfoV2]()
+		s.collectFromTables(n.JoinExpr.GetLarg(), ctes, joinTables, userInfo)
+		s.collectFromTables(n.JoinExpr.GetRarg(), ctes, joinTables, userInfo)
+		var outputs []outputColumn
+		for _, table := range joinTables.AllFromFront() {
+			outputs = append(outputs, s.tableOutputColumns(table)...)
+		}
+		alias := n.JoinExpr.GetAlias()
+		tables.Set(alias.GetAliasname(), s.newVirtualTable(alias.GetAliasname(), outputs, alias.GetColnames()))
+	}
+}
+
+// resolveTargetColumns returns the output columns of a target of the target list, a star target can give many columns
+func (s *AuthorizationServiceImpl) resolveTargetColumns(target *pgquery.ResTarget, tables *om.OrderedMap[string, *TableInfoV2], ctes map[string]*TableInfoV2, userInfo UserContext) []outputColumn {
+	if target == nil || target.GetVal() == nil {
+		return nil
+	}
+
+	if columnRef := target.GetVal().GetColumnRef(); columnRef != nil {
+		fields := columnRef.GetFields()
+		if len(fields) == 0 {
+			return nil
+		}
+		if fields[len(fields)-1].GetAStar() != nil {
+			if len(fields) == 1 {
+				// Case : SELECT * FROM ...
+				var outputs []outputColumn
+				for _, table := range tables.AllFromFront() {
+					outputs = append(outputs, s.tableOutputColumns(table)...)
+				}
+				return outputs
+			}
+			// Case : SELECT table.* FROM ...
+			table, ok := tables.Get(s.getStringValueFromNode(fields[len(fields)-2]))
+			if !ok {
+				return nil
+			}
+			return s.tableOutputColumns(table)
+		}
+
+		// Case : SELECT (table.)col (AS alias) FROM ...
+		// or SELECT table (AS alias) FROM ..., the whole row as a single value
+		name := s.getStringValueFromNode(fields[len(fields)-1])
+		if target.GetName() != "" {
+			name = target.GetName()
+		}
+		return []outputColumn{{Name: name, Rule: s.resolveColumnRef(columnRef, tables, userInfo)}}
+	}
+
+	// Case : SELECT expression (AS alias) FROM ...
+	name := target.GetName()
+	if name == "" {
+		name = "?column?"
+		if funcCall := target.GetVal().GetFuncCall(); funcCall != nil && len(funcCall.GetFuncname()) > 0 {
+			name = s.getStringValueFromNode(funcCall.GetFuncname()[len(funcCall.GetFuncname())-1])
+		}
+	}
+	rule := s.resolveExpressionRule(target.GetVal().ProtoReflect(), tables, ctes, userInfo)
+	if rule != nil && rule.Action == ColumnActionMaskPartial {
+		rule = &ColumnRule{Column: rule.Column, Action: ColumnActionMaskNull, Table: rule.Table}
+	}
+	return []outputColumn{{Name: name, Rule: rule}}
+}
+
+// resolveColumnRef returns the rule protecting the referenced column.
+// If the column can't be resolved, we use the most restrictive rule of a column with the same name to be safe.
+func (s *AuthorizationServiceImpl) resolveColumnRef(columnRef *pgquery.ColumnRef, tables *om.OrderedMap[string, *TableInfoV2], userInfo UserContext) *ColumnRule {
+	fields := columnRef.GetFields()
+	colName := s.getStringValueFromNode(fields[len(fields)-1])
+
+	if len(fields) >= 2 {
+		if table, ok := tables.Get(s.getStringValueFromNode(fields[len(fields)-2])); ok && table.Columns.Has(colName) {
+			return table.getColumnRule(colName)
+		}
+	} else {
+		for _, table := range tables.AllFromFront() {
+			if table.Columns.Has(colName) {
+				return table.getColumnRule(colName)
+			}
+		}
+		// Like PostgreSQL, a name which isn't a column is the whole row of the table with this alias
+		if table, ok := tables.Get(colName); ok {
+			return s.wholeRowRule(table, userInfo)
+		}
+	}
+
+	return s.getPolicy().getColumnRuleByName(userInfo.GetRole(), colName)
+}
+
+// resolveStarRule returns the rule protecting a star inside an expression, e.g. to_json(s.*).
+// If the table can't be resolved, all the tables are considered to be safe.
+func (s *AuthorizationServiceImpl) resolveStarRule(columnRef *pgquery.ColumnRef, tables *om.OrderedMap[string, *TableInfoV2], userInfo UserContext) *ColumnRule {
+	fields := columnRef.GetFields()
+	if len(fields) >= 2 {
+		if table, ok := tables.Get(s.getStringValueFromNode(fields[len(fields)-2])); ok {
+			return s.wholeRowRule(table, userInfo)
+		}
+	}
+	var result *ColumnRule
+	for _, table := range tables.AllFromFront() {
+		result = moreRestrictiveRule(result, s.wholeRowRule(table, userInfo))
+	}
+	return result
+}
+
+// wholeRowRule returns the most restrictive rule of the columns of the table, which protects its whole row.
+// A row can't be partially redacted, so mask_partial becomes mask_null.
+func (s *AuthorizationServiceImpl) wholeRowRule(table *TableInfoV2, userInfo UserContext) *ColumnRule {
+	var result *ColumnRule
+	if table.IsDatabase {
+		// The rules of the policy also cover the columns the schema doesn't know
+		result = s.getPolicy().getTableRule(table.Name, userInfo.GetRole())
+	}
+	if table.Columns != nil {
+		for colName := range table.Columns.Keys() {
+			result = moreRestrictiveRule(result, table.getColumnRule(colName))
+		}
+	}
+	if result != nil && result.Action == ColumnActionMaskPartial {
+		result = &ColumnRule{Column: result.Column, Action: ColumnActionMaskNull, Table: result.Table}
+	}
+	return result
+}
+
+// resolveExpressionRule returns the most restrictive rule of the columns referenced by the expression, including its sublinks
+func (s *AuthorizationServiceImpl) resolveExpressionRule(msg protoreflect.Message, tables *om.OrderedMap[string, *TableInfoV2], ctes map[string]*TableInfoV2, userInfo UserContext) *ColumnRule {
+	switch m := msg.Interface().(type) {
+	case *pgquery.ColumnRef:
+		if len(m.GetFields()) == 0 {
+			return nil
+		}
+		if m.GetFields()[len(m.GetFields())-1].GetAStar() != nil {
+			return s.resolveStarRule(m, tables, userInfo)
+		}
+		return s.resolveColumnRef(m, tables, userInfo)
+	case *pgquery.SubLink:
+		var result *ColumnRule
+		for _, output := range s.resolveSelectColumns(m.GetSubselect().GetSelectStmt(), ctes, userInfo) {
+			result = moreRestrictiveRule(result, output.Rule)
+		}
+		if m.GetTestexpr() != nil {
+			result = moreRestrictiveRule(result, s.resolveExpressionRule(m.GetTestexpr().ProtoReflect(), tables, ctes, userInfo))
+		}
+		return result
+	}
+
+	var result *ColumnRule
+	msg.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.Message() == nil || fd.IsMap() {
+			return true
+		}
+		if fd.IsList() {
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				result = moreRestrictiveRule(result, s.resolveExpressionRule(list.Get(i).Message(), tables, ctes, userInfo))
+			}
+			return true
+		}
+		result = moreRestrictiveRule(result, s.resolveExpressionRule(v.Message(), tables, ctes, userInfo))
+		return true
+	})
+	return result
+}
+
+// tableOutputColumns returns all columns of the table with their rules, like SELECT table.* does
+func (s *AuthorizationServiceImpl) tableOutputColumns(table *TableInfoV2) []outputColumn {
+	if table.Columns == nil {
+		return nil
+	}
+	outputs := make([]outputColumn, 0, table.Columns.Len())
+	for colAlias := range table.Columns.Keys() {
+		outputs = append(outputs, outputColumn{Name: colAlias, Rule: table.getColumnRule(colAlias)})
+	}
+	return outputs
+}
+
+// newVirtualTable creates the table of a subquery, a CTE or an aliased join from its output columns.
+// The columns are renamed by colNames in order, like the column aliases of (SELECT ...) AS alias(colNames).
+func (s *AuthorizationServiceImpl) newVirtualTable(name string, outputs []outputColumn, colNames []*pgquery.Node) *TableInfoV2 {
+	table := &TableInfoV2{
+		Name:               name,
+		Alias:              name,
+		Columns:            om.NewOrderedMap[string, *ColumnInfo](),
+		UnAuthorizedTables: om.NewOrderedMap[string, *TableInfoV2](),
+	}
+	for i, output := range outputs {
+		colName := output.Name
+		if i < len(colNames) && s.getStringValueFromNode(colNames[i]) != "" {
+			colName = s.getStringValueFromNode(colNames[i])
+		}
+		table.Columns.Set(colName, &ColumnInfo{
+			Name: colName,
+			Rule: moreRestrictiveRule(table.getColumnRule(colName), output.Rule),
+		})
+	}
+	return table
+}
+
+// MaskQueryResult applies the masks returned by CheckColumnAccess on the query result in place
+func MaskQueryResult(result *QueryResult, masks map[string]ColumnAction) {
+	if result == nil || len(masks) == 0 {
+		return
+	}
+	for _, row := range result.Data {
+		for column, action := range masks {
+			value, ok := row[column]
+			if !ok || value == nil {
+				continue
+			}
+			switch action {
+			case ColumnActionMaskPartial:
+				row[column] = redactValue(value)
+			default:
+				row[column] = nil
+			}
+		}
+	}
+}
+
+// MaskValue applies the column rule of the role on a value read outside of ExecuteQuery, e.g. by a tool querying the
+// database directly, like MaskQueryResult does on the query results. A denied or mask_null column gives nil.
+func (p *AuthorizationPolicy) MaskValue(table string, role string, column string, value *string) *string {
+	rule := p.GetColumnRule(table, role, column)
+	if rule == nil || value == nil {
+		return value
+	}
+	if rule.Action == ColumnActionMaskPartial {
+		if redacted, ok := redactValue(*value).(string); ok {
+			return &redacted
+		}
+	}
+	return nil
+}
+
+// redactValue partially hides a value: an email keeps the first character of its local part and its domain,
+// other strings keep their last 4 characters. Values which aren't strings are hidden completely.
+func redactValue(value interface{}) interface{} {
+	str, ok := value.(string)
+	if !ok {
+		return nil
+	}
+
+	if local, domain, found := strings.Cut(str, "@"); found && local != "" {
+		localRunes := []rune(local)
+		return string(localRunes[0]) + "***@" + domain
+	}
+
+	runes := []rune(str)
+	if len(runes) <= 4 {
+		return strings.Repeat("*", len(runes))
+	}
+	return strings.Repeat("*", len(runes)-4) + string(runes[len(runes)-4:])
+}
@@ -0,0 +1,213 @@
+package db
+
+import (
+	pgquery "github.com/pganalyze/pg_query_go/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// region TestCheckColumnAccess
+func TestCheckColumnAccess(t *testing.T) {
+	policy, err := ParseAuthorizationPolicy([]byte(`
+public_tables: [course]
+bypass_roles: [admin]
+column_rules:
+  - table: student
+    role: professor
+    columns:
+      - column: birthday
+        action: deny
+      - column: email
+        action: mask_partial
+      - column: gender
+        action: mask_null
+  - table: professor
+    role: student
+    columns:
+      - column: email
+        action: mask_partial`), "yaml")
+	require.NoError(t, err)
+	authService := NewAuthorizationServiceImplWithPolicy(&MockSchemaService{}, policy)
+
+	student := &StudentInfo{UserInfo: UserInfo{ID: 1, Role: "student"}}
+	professor := &ProfessorInfo{UserInfo: UserInfo{ID: 2, Role: "professor"}}
+
+	tests := []struct {
+		name          string
+		query         string
+		userInfo      UserContext
+		expectedMasks map[string]ColumnAction
+		expectedError string
+	}{
+		{
+			name:          "Column without rule",
+			query:         "SELECT name, code FROM student",
+			userInfo:      professor,
+			expectedMasks: map[string]ColumnAction{},
+		},
+		{
+			name:          "Denied column is rejected",
+			query:         "SELECT name, birthday FROM student",
+			userInfo:      professor,
+			expectedError: "access to column birthday of table student is denied",
+		},
+		{
+			name:          "Denied column in star is rejected",
+			query:         "SELECT s.* FROM student s",
+			userInfo:      professor,
+			expectedError: "access to column birthday of table student is denied",
+		},
+		{
+			name:          "Masked column keeps its alias",
+			query:         "SELECT s.email AS contact, p.email FROM student s JOIN professor p ON p.id = 2",
+			userInfo:      professor,
+			expectedMasks: map[string]ColumnAction{"contact": ColumnActionMaskPartial},
+		},
+		{
+			name:          "Lineage through subquery and column aliases",
+			query:         "SELECT x.mail FROM (SELECT id, email FROM student) x(student_id, mail)",
+			userInfo:      professor,
+			expectedMasks: map[string]ColumnAction{"mail": ColumnActionMaskPartial},
+		},
+		{
+			name:          "Lineage through CTE",
+			query:         "WITH s AS (SELECT name, gender FROM student) SELECT * FROM s",
+			userInfo:      professor,
+			expectedMasks: map[string]ColumnAction{"gender": ColumnActionMaskNull},
+		},
+		{
+			name:          "Denied column through CTE is rejected",
+			query:         "WITH s AS (SELECT * FROM student) SELECT name, birthday FROM s",
+			userInfo:      professor,
+			expectedError: "access to column birthday of table student is denied",
+		},
+		{
+			name:          "Expression of a masked column is nulled",
+			query:         "SELECT upper(email), lower(name) AS lower_name FROM student",
+			userInfo:      professor,
+			expectedMasks: map[string]ColumnAction{"upper": ColumnActionMaskNull},
+		},
+		{
+			name:          "Expression of a denied column is rejected",
+			query:         "SELECT extract(year FROM birthday) AS birth_year FROM student",
+			userInfo:      professor,
+			expectedError: "access to column birthday of table student is denied",
+		},
+		{
+			name:          "Denied column in scalar subquery is rejected",
+			query:         "SELECT name, (SELECT birthday FROM student s2 WHERE s2.id = 1) AS b FROM course",
+			userInfo:      professor,
+			expectedError: "access to column birthday of table student is denied",
+		},
+		{
+			name:          "Union takes the rules of both sides",
+			query:         "SELECT name, code FROM course UNION SELECT name, email FROM student",
+			userInfo:      professor,
+			expectedMasks: map[string]ColumnAction{"code": ColumnActionMaskPartial},
+		},
+		{
+			name:          "Denied column in WHERE clause is allowed",
+			query:         "SELECT name FROM student WHERE birthday > '2000-01-01'",
+			userInfo:      professor,
+			expectedMasks: map[string]ColumnAction{},
+		},
+		{
+			name:          "Whole row in a function is rejected",
+			query:         "SELECT row_to_json(s) FROM student s",
+			userInfo:      professor,
+			expectedError: "access to column birthday of table student is denied",
+		},
+		{
+			name:          "Star of a table in a function is rejected",
+			query:         "SELECT to_json(s.*) AS info FROM student s",
+			userInfo:      professor,
+			expectedError: "access to column birthday of table student is denied",
+		},
+		{
+			name:          "Whole row as a column is rejected",
+			query:         "SELECT s FROM student s",
+			userInfo:      professor,
+			expectedError: "access to column birthday of table student is denied",
+		},
+		{
+			name:          "Whole row of a masked table is nulled",
+			query:         "SELECT p, row_to_json(professor) AS info, to_json(p.*) FROM professor p, professor",
+			userInfo:      student,
+			expectedMasks: map[string]ColumnAction{"p": ColumnActionMaskNull, "info": ColumnActionMaskNull, "to_json": ColumnActionMaskNull},
+		},
+		{
+			name:          "Whole row of a CTE takes the rules of its columns",
+			query:         "WITH x AS (SELECT name, gender FROM student) SELECT to_json(x) FROM x",
+			userInfo:      professor,
+			expectedMasks: map[string]ColumnAction{"to_json": ColumnActionMaskNull},
+		},
+		{
+			name:          "Column with the name of a table is a column",
+			query:         "SELECT name FROM student name",
+			userInfo:      professor,
+			expectedMasks: map[string]ColumnAction{},
+		},
+		{
+			name:          "Rules are per role",
+			query:         "SELECT s.birthday, p.email FROM student s, professor p",
+			userInfo:      student,
+			expectedMasks: map[string]ColumnAction{"email": ColumnActionMaskPartial},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := pgquery.Parse(tt.query)
+			require.NoError(t, err)
+
+			masks, err := authService.CheckColumnAccess(tree.Stmts[0].GetStmt(), tt.userInfo)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedMasks, masks)
+		})
+	}
+}
+
+// endregion
+
+// region TestMaskQueryResult
+func TestMaskQueryResult(t *testing.T) {
+	result := &QueryResult{Data: []map[string]interface{}{
+		{"name": "Nguyen Van A", "email": "nguyenvana@vnu.edu.vn", "phone": "0912345678", "birthday": "2003-05-01T00:00:00Z", "code": 21020001},
+		{"name": "Tran Thi B", "email": nil, "phone": "123", "birthday": nil, "code": 21020002},
+	}}
+
+	MaskQueryResult(result, map[string]ColumnAction{
+		"email":    ColumnActionMaskPartial,
+		"phone":    ColumnActionMaskPartial,
+		"birthday": ColumnActionMaskNull,
+		"code":     ColumnActionMaskPartial,
+	})
+
+	assert.Equal(t, []map[string]interface{}{
+		{"name": "Nguyen Van A", "email": "n***@vnu.edu.vn", "phone": "******5678", "birthday": nil, "code": nil},
+		{"name": "Tran Thi B", "email": nil, "phone": "***", "birthday": nil, "code": nil},
+	}, result.Data)
+}
+
+// endregion
+
+// region TestAuthorizationPolicy_MaskValue
+func TestAuthorizationPolicy_MaskValue(t *testing.T) {
+	policy := DefaultAuthorizationPolicy()
+	email := "nguyenvana@vnu.edu.vn"
+	birthday := "2003-05-01"
+
+	assert.Equal(t, "n***@vnu.edu.vn", *policy.MaskValue("student", "professor", "email", &email))
+	assert.Nil(t, policy.MaskValue("student", "professor", "birthday", &birthday))
+	assert.Nil(t, policy.MaskValue("student", "professor", "email", nil))
+	// The columns without rule and the roles without rules are left as is
+	assert.Equal(t, &birthday, policy.MaskValue("student", "student", "birthday", &birthday))
+	assert.Equal(t, &email, policy.MaskValue("student", "admin", "email", &email))
+}
+
+// endregion
@@ -3,8 +3,10 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	pgquery "github.com/pganalyze/pg_query_go/v6"
+	"log"
 	"regexp"
 	"strings"
 	"time"
@@ -12,35 +14,57 @@ import (
 	"github.com/jmoiron/sqlx"
 )
 
-var ddlLoaders = make(map[string]DDLLoader)
+// ddlLoaders creates the DDL loader of a database by driver name
+var ddlLoaders = make(map[string]func(db *sqlx.DB) DDLLoader)
 
 // HDb defines the database operations interface
 type HDb interface {
 	LoadDDL() (string, error)
+	// LoadSchema returns the schema of the tables the role can read
+	LoadSchema(ctx context.Context, role string) (*DatabaseSchema, error)
 	ExecuteQuery(ctx context.Context, query QueryRequest) (*QueryResult, error)
 	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
 	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
 	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
 	//QueryRowContext(ctx context.Context, s string, id int, title string)
 	QueryRowx(query string, args ...interface{}) *sqlx.Row
+	// BeginTxx starts a transaction, the writes of the services which must be atomic run in it
+	BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error)
 }
 
+// AuthorizationMode decides what ExecuteQuery does with a query which isn't authorized as it is
+type AuthorizationMode string
+
+const (
+	// AuthorizationModeReject rejects the query if it doesn't already filter the restricted tables
+	AuthorizationModeReject AuthorizationMode = "reject"
+	// AuthorizationModeRewrite injects the needed filters into the query and runs the rewritten query
+	AuthorizationModeRewrite AuthorizationMode = "rewrite"
+)
+
 // SQLHDb implements the HDb interface
 type SQLHDb struct {
 	*sqlx.DB
 	DDLLoader
-	authSer AuthorizationService
+	authSer  AuthorizationService
+	authMode AuthorizationMode
 }
 
 // NewHDb creates a new HDb instance
-func NewHDb(driverName, dataSourceUrl string, authSer AuthorizationService) (*SQLHDb, error) {
+func NewHDb(driverName, dataSourceUrl string, authSer AuthorizationService, authMode AuthorizationMode) (*SQLHDb, error) {
 	db, err := sqlx.Connect(driverName, dataSourceUrl)
 	if err != nil {
 		return nil, err
 	}
-	ddlLoader := ddlLoaders[driverName]
+	var ddlLoader DDLLoader
+	if newDDLLoader, ok := ddlLoaders[driverName]; ok {
+		ddlLoader = newDDLLoader(db)
+	}
+	if authMode == "" {
+		authMode = AuthorizationModeReject
+	}
 
-	return &SQLHDb{db, ddlLoader, authSer}, nil
+	return &SQLHDb{db, ddlLoader, authSer, authMode}, nil
 }
 
 // LoadDDL loads the database schema
@@ -48,20 +72,29 @@ func (db *SQLHDb) LoadDDL() (string, error) {
 	return db.DDLLoader.LoadDDL(db.DB)
 }
 
+// LoadSchema loads the database schema filtered by the authorization policy for the role
+func (db *SQLHDb) LoadSchema(ctx context.Context, role string) (*DatabaseSchema, error) {
+	schema, err := db.DDLLoader.LoadSchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.authSer.FilterSchema(schema, role), nil
+}
+
 // ExecuteQuery executes a SQL query and returns the results
 func (db *SQLHDb) ExecuteQuery(ctx context.Context, req QueryRequest) (*QueryResult, error) {
 	req.Query = CleanSQL(req.Query)
 
-	// Validate the query
-	isValid, errMsg, err := db.validateQuery(ctx, req.Query)
+	// Validate the query, in rewrite mode we will get back the safe version of the query
+	safeQuery, masks, rejected, err := db.validateQuery(ctx, req.Query)
 	if err != nil {
 		return nil, fmt.Errorf("error validating query: %v", err)
 	}
-	if !isValid {
-		return nil, fmt.Errorf("%s", errMsg)
+	if rejected != nil {
+		return nil, rejected
 	}
 
-	rows, err := db.QueryxContext(ctx, req.Query)
+	rows, err := db.QueryxContext(ctx, safeQuery)
 	if err != nil {
 		return nil, fmt.Errorf("error executing query: %v", err)
 	}
@@ -117,6 +150,7 @@ func (db *SQLHDb) ExecuteQuery(ctx context.Context, req QueryRequest) (*QueryRes
 
 	result.Data = allRows
 	result.Metadata.RowCount = len(allRows)
+	MaskQueryResult(result, masks)
 
 	return result, nil
 }
@@ -136,80 +170,136 @@ func CleanSQL(sql string) string {
 	return sql
 }
 
-func (db *SQLHDb) validateQuery(ctx context.Context, query string) (bool, string, error) {
+// QueryRejectedError is returned by ExecuteQuery when the query is rejected before being executed.
+// The message is shown to the user, while the explanation (only set for authorization failures)
+// can be given to the LLM to repair the query.
+type QueryRejectedError struct {
+	Message     string
+	Explanation *AuthorizationExplanation
+}
+
+func (e *QueryRejectedError) Error() string {
+	return e.Message
+}
+
+// validateQuery authorizes the query for the current user.
+// It returns the query which is safe to execute with the masks to apply on its result,
+// or the rejection with the message for the user.
+// In rewrite mode, an unauthorized query is rewritten to only read the authorized rows instead of being rejected.
+func (db *SQLHDb) validateQuery(ctx context.Context, query string) (string, map[string]ColumnAction, *QueryRejectedError, error) {
 	// Use pg_query_go to parse the SQL query
 	tree, err := pgquery.Parse(query)
 	if err != nil {
-		return false, "Failed to parse SQL query", err
+		return "", nil, &QueryRejectedError{Message: "Failed to parse SQL query"}, err
 	}
 
 	// Only allow SELECT statements for security
 	if len(tree.Stmts) == 0 {
-		return false, "Empty query", nil
+		return "", nil, &QueryRejectedError{Message: "Empty query"}, nil
+	}
+	if len(tree.Stmts) > 1 {
+		return "", nil, &QueryRejectedError{Message: "Only one query is allowed"}, nil
 	}
 
 	stmt := tree.Stmts[0]
 	selectStmt := stmt.Stmt.GetSelectStmt()
 	if selectStmt == nil {
-		return false, "Only SELECT queries are allowed", nil
+		return "", nil, &QueryRejectedError{Message: "Only SELECT queries are allowed"}, nil
+	}
+
+	userInfo, errMsg, err := db.fetchUserContext(ctx)
+	if userInfo == nil {
+		return "", nil, &QueryRejectedError{Message: errMsg}, err
+	}
+
+	// Now use userInfo for authorization
+	authResult, err := db.authSer.AuthorizeNode(stmt.GetStmt(), nil, false, userInfo)
+	if err != nil {
+		return "", nil, &QueryRejectedError{Message: "Xin lỗi bạn không có quyền truy cập vào dữ liệu này"}, err
+	}
+
+	// The column rules apply whether the rows are authorized or not
+	masks, err := db.authSer.CheckColumnAccess(stmt.GetStmt(), userInfo)
+	var columnErr *ColumnAccessError
+	if errors.As(err, &columnErr) {
+		explanation := &AuthorizationExplanation{
+			Role:     userInfo.GetRole(),
+			Reason:   fmt.Sprintf("Column %s of table %s can't be selected", columnErr.Column, columnErr.Table),
+			NodeType: "SELECT",
+			Node:     columnErr.Column,
+			Location: -1,
+		}
+		log.Printf("Rejected query %q for %s %d: %s", query, userInfo.GetRole(), userInfo.GetID(), explanation)
+		return "", nil, &QueryRejectedError{
+			Message:     fmt.Sprintf("Xin lỗi bạn không có quyền truy cập vào cột %s của bảng %s", columnErr.Column, columnErr.Table),
+			Explanation: explanation,
+		}, nil
+	}
+	if err != nil {
+		return "", nil, &QueryRejectedError{Message: "Xin lỗi bạn không có quyền truy cập vào dữ liệu này"}, err
+	}
+
+	if authResult.Authorized {
+		return query, masks, nil, nil
+	}
+	if db.authMode != AuthorizationModeRewrite {
+		log.Printf("Rejected query %q for %s %d: %s", query, userInfo.GetRole(), userInfo.GetID(), authResult.Explanation)
+		return "", nil, &QueryRejectedError{
+			Message:     "Xin lỗi bạn không có quyền truy cập vào dữ liệu này",
+			Explanation: authResult.Explanation,
+		}, nil
 	}
 
-	role := ctx.Value("userRole").(string)
-	specificId := ctx.Value("specificId").(int)
+	rewrittenQuery, err := rewriteQuery(db.authSer, tree, userInfo)
+	if errors.Is(err, ErrRewriteUnauthorized) {
+		log.Printf("Rejected query %q for %s %d: %v", query, userInfo.GetRole(), userInfo.GetID(), err)
+		return "", nil, &QueryRejectedError{
+			Message:     "Xin lỗi bạn không có quyền truy cập vào dữ liệu này",
+			Explanation: authResult.Explanation,
+		}, nil
+	}
+	if err != nil {
+		return "", nil, &QueryRejectedError{Message: "Failed to rewrite SQL query"}, err
+	}
+	log.Printf("Rewrote unauthorized query %q to %q", query, rewrittenQuery)
+
+	return rewrittenQuery, masks, nil, nil
+}
+
+// fetchUserContext loads the authorization facts of the current user from the context values.
+// It returns nil with the message for the user if the user can't be identified.
+func (db *SQLHDb) fetchUserContext(ctx context.Context) (UserContext, string, error) {
+	role, _ := ctx.Value("userRole").(string)
+	specificId, _ := ctx.Value("specificId").(int)
 	if role == "" {
-		return false, "Role not found", nil
+		return nil, "Role not found", nil
 	}
 	if specificId == 0 {
-		return false, "User ID not found", nil
+		return nil, "User ID not found", nil
 	}
-	var userInfo UserContext
 
 	switch role {
 	case "student":
-		userInfo, err = db.FetchStudentInfo(ctx, specificId)
+		userInfo, err := db.FetchStudentInfo(ctx, specificId)
 		if err != nil {
-			return false, "Failed to fetch student info", err
+			return nil, "Failed to fetch student info", err
 		}
+		return userInfo, "", nil
 	case "professor":
-		userInfo, err = db.FetchProfessorInfo(ctx, specificId)
+		userInfo, err := db.FetchProfessorInfo(ctx, specificId)
 		if err != nil {
-			return false, "Failed to fetch professor info", err
+			return nil, "Failed to fetch professor info", err
 		}
+		return userInfo, "", nil
 	case "admin":
-		userInfo, err = db.FetchAdminInfo(ctx, specificId)
+		userInfo, err := db.FetchAdminInfo(ctx, specificId)
 		if err != nil {
-			return false, "Failed to fetch admin info", err
+			return nil, "Failed to fetch admin info", err
 		}
+		return userInfo, "", nil
 	default:
-		return false, fmt.Sprintf("Unknown role: %s", role), nil
-	}
-
-	// Now use userInfo for authorization
-	authResult, err := db.authSer.AuthorizeNode(stmt.GetStmt(), nil, false, userInfo)
-	if err != nil {
-		return false, "Xin lỗi bạn không có quyền truy cập vào dữ liệu này", err
-	}
-
-	return authResult.Authorized, "Xin lỗi bạn không có quyền truy cập vào dữ liệu này", nil
-}
-
-// Helper functions
-func isPublicTable(tableName string) bool {
-	publicTables := []string{
-		"faculty",
-		"program",
-		"course",
-		"course_program",
-		"course_class",
-		"course_class_schedule",
-	}
-
-	for _, table := range publicTables {
-		if table == tableName {
-			return true
-		}
+		return nil, fmt.Sprintf("Unknown role: %s", role), nil
 	}
-	return false
 }
 
 type TableInfo struct {
@@ -1,29 +1,53 @@
 package db
 
 import (
+	"context"
 	"github.com/jmoiron/sqlx"
-	"os"
+	"slices"
 )
 
+// PgDDLLoader describes the database to the LLM with the schema introspected by the schema service
 type PgDDLLoader struct {
+	schemaService *SchemaServiceImpl
+	// excludedTables are the internal tables which the LLM doesn't need to know, e.g. the accounts and the conversations
+	excludedTables []string
 }
 
 func init() {
-	ddlLoaders["postgres"] = &PgDDLLoader{} // Pg driver isn't have constant for driver name. So we also hardcode here
+	// Pg driver isn't have constant for driver name. So we also hardcode here
+	ddlLoaders["postgres"] = func(db *sqlx.DB) DDLLoader {
+		return NewPgDDLLoader(NewSchemaServiceImpl(db), nil)
+	}
+}
+
+func NewPgDDLLoader(schemaService *SchemaServiceImpl, excludedTables []string) *PgDDLLoader {
+	return &PgDDLLoader{
+		schemaService:  schemaService,
+		excludedTables: excludedTables,
+	}
+}
+
+// LoadSchema returns the cached schema of the schema service without the excluded tables
+func (d *PgDDLLoader) LoadSchema(ctx context.Context) (*DatabaseSchema, error) {
+	schema, err := d.schemaService.GetSchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return schema.Filter(
+		func(table string) bool {
+			return !slices.Contains(d.excludedTables, table)
+		},
+		func(table string, column string) bool {
+			return true
+		},
+	), nil
 }
 
+// LoadDDL renders the cached schema of the schema service, which is bound to the database it introspects
 func (d *PgDDLLoader) LoadDDL(db *sqlx.DB) (string, error) {
-	// At this time, we will load the DDL from the init file
-	// TODO: Load from the running database instead
-	content, err := os.ReadFile("/home/huy/Code/Personal/KLTN/be/db/init/1-schema.sql")
+	schema, err := d.LoadSchema(context.Background())
 	if err != nil {
 		return "", err
 	}
-	return string(content), nil
-	//cmd := exec.Command("pg_dump", "--schema-only", os.Getenv("DATABASE_URL"))
-	//out, err := cmd.Output()
-	//if err != nil {
-	//	return "", err
-	//}
-	//return string(out), nil
+	return schema.Render(), nil
 }
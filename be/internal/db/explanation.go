@@ -0,0 +1,203 @@
+package db
+
+import (
+	"fmt"
+	pgquery "github.com/pganalyze/pg_query_go/v6"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"strings"
+)
+
+// AuthorizationExplanation tells why a query isn't authorized.
+// It is detailed enough for the LLM to repair the query and for the admins to debug the policy.
+type AuthorizationExplanation struct {
+	Role string `json:"role"`
+	// Reason is a short description of the failure
+	Reason string `json:"reason"`
+	// Tables are the tables which are still unauthorized after the WHERE, JOIN and HAVING clauses
+	Tables []UnauthorizedTable `json:"tables,omitempty"`
+	// NodeType and Node give the type and the SQL of the AST node which caused the failure
+	NodeType string `json:"node_type,omitempty"`
+	Node     string `json:"node,omitempty"`
+	// Location is the position of the node in the query, or -1 if unknown
+	Location int32 `json:"location"`
+}
+
+// UnauthorizedTable is a table which stayed in UnAuthorizedTables with the conditions which would have authorized it
+type UnauthorizedTable struct {
+	Alias string `json:"alias"`
+	Table string `json:"table"`
+	// Conditions are the authorize columns with their allowed values, filtering by any of them authorizes the table.
+	// It is empty if the role can't read the table at all.
+	Conditions []AuthorizationCondition `json:"conditions,omitempty"`
+}
+
+// String formats the explanation for the LLM and the logs
+func (e *AuthorizationExplanation) String() string {
+	if e == nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString(e.Reason)
+	if e.Node != "" {
+		sb.WriteString(fmt.Sprintf(" (%s: %s)", e.NodeType, e.Node))
+	}
+	for _, table := range e.Tables {
+		if len(table.Conditions) == 0 {
+			sb.WriteString(fmt.Sprintf("\n- Role %s can't read table %s (alias %s)", e.Role, table.Table, table.Alias))
+			continue
+		}
+		conditions := make([]string, 0, len(table.Conditions))
+		for _, condition := range table.Conditions {
+			values := make([]string, 0, len(condition.ExpectedValues))
+			for _, value := range condition.ExpectedValues {
+				values = append(values, fmt.Sprintf("%d", value))
+			}
+			conditions = append(conditions, fmt.Sprintf("%s.%s IN (%s)", table.Alias, condition.AuthorizeColumn, strings.Join(values, ", ")))
+		}
+		sb.WriteString(fmt.Sprintf("\n- Table %s (alias %s) must be filtered by one of: %s", table.Table, table.Alias, strings.Join(conditions, ", ")))
+	}
+	return sb.String()
+}
+
+// explainDenials builds the explanation of an unauthorized statement from the denials collected while authorizing it.
+// The first denial is explained, e.g. the first unauthorized side of a set operation.
+func (s *AuthorizationServiceImpl) explainDenials(denials []denial, userInfo UserContext) *AuthorizationExplanation {
+	if len(denials) == 0 {
+		return &AuthorizationExplanation{
+			Role:     userInfo.GetRole(),
+			Reason:   "The statement can't be authorized",
+			Location: -1,
+		}
+	}
+	return s.explainDenial(denials[0], userInfo)
+}
+
+// explainDenial explains an unauthorized SELECT statement from the tables which stayed unauthorized
+func (s *AuthorizationServiceImpl) explainDenial(d denial, userInfo UserContext) *AuthorizationExplanation {
+	stmt := d.stmt
+	explanation := &AuthorizationExplanation{
+		Role:     userInfo.GetRole(),
+		Location: -1,
+	}
+
+	// The alias of the first unauthorized table in the FROM clause, it can be a subquery containing the unauthorized table
+	var fromAlias string
+	if d.tables != nil {
+		for alias, table := range d.tables.AllFromFront() {
+			if table.IsDatabase {
+				if !table.Authorized {
+					explanation.Tables = append(explanation.Tables, s.explainTable(alias, table, userInfo))
+				}
+			} else if table.UnAuthorizedTables != nil {
+				for unAuthAlias, unAuthTable := range table.UnAuthorizedTables.AllFromFront() {
+					explanation.Tables = append(explanation.Tables, s.explainTable(unAuthAlias, unAuthTable, userInfo))
+				}
+			}
+			if fromAlias == "" && len(explanation.Tables) > 0 {
+				fromAlias = alias
+			}
+		}
+	}
+
+	var culprit *pgquery.Node
+	switch {
+	case len(explanation.Tables) == 0:
+		explanation.Reason = "The statement can't be authorized"
+	case stmt.GetWhereClause() != nil:
+		culprit = stmt.GetWhereClause()
+		explanation.NodeType = "WHERE"
+		explanation.Reason = "The WHERE clause doesn't restrict the tables to the rows the user can read"
+	case stmt.GetHavingClause() != nil:
+		culprit = stmt.GetHavingClause()
+		explanation.NodeType = "HAVING"
+		explanation.Reason = "The HAVING clause doesn't restrict the tables to the rows the user can read"
+	default:
+		culprit = findFromItem(stmt.GetFromClause(), fromAlias)
+		explanation.NodeType = "FROM"
+		explanation.Reason = "The tables are read without any condition on their authorize columns"
+	}
+	if culprit != nil {
+		explanation.Node = deparseNode(culprit)
+		explanation.Location = nodeLocation(culprit)
+	}
+
+	return explanation
+}
+
+func (s *AuthorizationServiceImpl) explainTable(alias string, table *TableInfoV2, userInfo UserContext) UnauthorizedTable {
+	result := UnauthorizedTable{Alias: alias, Table: table.Name}
+	authContext := s.getAuthorizationColumn(table.Name, userInfo)
+	for _, column := range authContext.AuthorizeColumns {
+		values, _ := authContext.Conditions.Get(column)
+		result.Conditions = append(result.Conditions, AuthorizationCondition{
+			AuthorizeColumn: column,
+			ExpectedValues:  uniqueInts(values),
+		})
+	}
+	return result
+}
+
+// findFromItem returns the item of the FROM clause with the given alias, looking inside the joins
+func findFromItem(items []*pgquery.Node, alias string) *pgquery.Node {
+	for _, item := range items {
+		switch n := item.GetNode().(type) {
+		case *pgquery.Node_RangeVar:
+			if n.RangeVar.GetAlias().GetAliasname() == alias || (n.RangeVar.GetAlias() == nil && n.RangeVar.GetRelname() == alias) {
+				return item
+			}
+		case *pgquery.Node_RangeSubselect:
+			if n.RangeSubselect.GetAlias().GetAliasname() == alias {
+				return item
+			}
+		case *pgquery.Node_JoinExpr:
+			if n.JoinExpr.GetAlias().GetAliasname() == alias {
+				return item
+			}
+			if found := findFromItem([]*pgquery.Node{n.JoinExpr.GetLarg(), n.JoinExpr.GetRarg()}, alias); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// deparseNode returns the SQL of a FROM item or an expression, or an empty string if it can't be deparsed
+func deparseNode(node *pgquery.Node) string {
+	stmt := &pgquery.SelectStmt{
+		LimitOption: pgquery.LimitOption_LIMIT_OPTION_DEFAULT,
+		Op:          pgquery.SetOperation_SETOP_NONE,
+	}
+	prefix := "SELECT "
+	switch node.GetNode().(type) {
+	case *pgquery.Node_RangeVar, *pgquery.Node_RangeSubselect, *pgquery.Node_JoinExpr:
+		stmt.TargetList = []*pgquery.Node{pgquery.MakeResTargetNodeWithVal(pgquery.MakeColumnRefNode([]*pgquery.Node{pgquery.MakeAStarNode()}, 0), 0)}
+		stmt.FromClause = []*pgquery.Node{node}
+		prefix = "SELECT * FROM "
+	default:
+		stmt.TargetList = []*pgquery.Node{pgquery.MakeResTargetNodeWithVal(node, 0)}
+	}
+
+	sql, err := pgquery.Deparse(&pgquery.ParseResult{Stmts: []*pgquery.RawStmt{
+		{Stmt: &pgquery.Node{Node: &pgquery.Node_SelectStmt{SelectStmt: stmt}}},
+	}})
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(sql, prefix)
+}
+
+// nodeLocation returns the location of the node in the query, or -1 if the node doesn't have one
+func nodeLocation(node *pgquery.Node) int32 {
+	location := int32(-1)
+	node.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.Message() == nil {
+			return true
+		}
+		if field := fd.Message().Fields().ByName("location"); field != nil {
+			location = int32(v.Message().Get(field).Int())
+		}
+		return false
+	})
+	return location
+}
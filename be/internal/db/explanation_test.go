@@ -0,0 +1,144 @@
+package db
+
+import (
+	pgquery "github.com/pganalyze/pg_query_go/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// region TestAuthorizationExplanation
+func TestAuthorizationExplanation(t *testing.T) {
+	authService := NewAuthorizationServiceImpl(&MockSchemaService{})
+	student := &StudentInfo{UserInfo: UserInfo{ID: 1, Role: "student"}, AdministrativeClassID: 10}
+
+	tests := []struct {
+		name     string
+		query    string
+		expected *AuthorizationExplanation
+	}{
+		{
+			name:     "Authorized query has no explanation",
+			query:    "SELECT * FROM student WHERE id = 1",
+			expected: nil,
+		},
+		{
+			name:  "Table read without filter",
+			query: "SELECT name FROM course c, student s",
+			expected: &AuthorizationExplanation{
+				Role:     "student",
+				Reason:   "The tables are read without any condition on their authorize columns",
+				Tables:   []UnauthorizedTable{{Alias: "s", Table: "student", Conditions: []AuthorizationCondition{{AuthorizeColumn: "id", ExpectedValues: []int{1}}}}},
+				NodeType: "FROM",
+				Node:     "student s",
+				Location: 27,
+			},
+		},
+		{
+			name:  "WHERE clause with wrong value",
+			query: "SELECT * FROM student WHERE id = 2",
+			expected: &AuthorizationExplanation{
+				Role:     "student",
+				Reason:   "The WHERE clause doesn't restrict the tables to the rows the user can read",
+				Tables:   []UnauthorizedTable{{Alias: "student", Table: "student", Conditions: []AuthorizationCondition{{AuthorizeColumn: "id", ExpectedValues: []int{1}}}}},
+				NodeType: "WHERE",
+				Node:     "id = 2",
+				Location: 31,
+			},
+		},
+		{
+			name:  "Table without policy",
+			query: "SELECT * FROM user_account",
+			expected: &AuthorizationExplanation{
+				Role:     "student",
+				Reason:   "The tables are read without any condition on their authorize columns",
+				Tables:   []UnauthorizedTable{{Alias: "user_account", Table: "user_account"}},
+				NodeType: "FROM",
+				Node:     "user_account",
+				Location: 14,
+			},
+		},
+		{
+			name:  "Unauthorized side of a union",
+			query: "SELECT id FROM student WHERE id = 1 UNION SELECT id FROM administrative_class",
+			expected: &AuthorizationExplanation{
+				Role:     "student",
+				Reason:   "The tables are read without any condition on their authorize columns",
+				Tables:   []UnauthorizedTable{{Alias: "administrative_class", Table: "administrative_class", Conditions: []AuthorizationCondition{{AuthorizeColumn: "id", ExpectedValues: []int{10}}}}},
+				NodeType: "FROM",
+				Node:     "administrative_class",
+				Location: 57,
+			},
+		},
+		{
+			name:  "Unauthorized subquery in the FROM clause is explained by the outer statement",
+			query: "SELECT * FROM (SELECT student.id FROM student) s",
+			expected: &AuthorizationExplanation{
+				Role:     "student",
+				Reason:   "The tables are read without any condition on their authorize columns",
+				Tables:   []UnauthorizedTable{{Alias: "student", Table: "student", Conditions: []AuthorizationCondition{{AuthorizeColumn: "id", ExpectedValues: []int{1}}}}},
+				NodeType: "FROM",
+				Node:     "(SELECT student.id FROM student) s",
+				Location: -1,
+			},
+		},
+		{
+			name:  "Unauthorized subquery in the WHERE clause is explained by the outer statement",
+			query: "SELECT * FROM student WHERE id IN (SELECT student_id FROM course_class_enrollment)",
+			expected: &AuthorizationExplanation{
+				Role:   "student",
+				Reason: "The WHERE clause doesn't restrict the tables to the rows the user can read",
+				Tables: []UnauthorizedTable{
+					{Alias: "student", Table: "student", Conditions: []AuthorizationCondition{{AuthorizeColumn: "id", ExpectedValues: []int{1}}}},
+					{Alias: "course_class_enrollment", Table: "course_class_enrollment", Conditions: []AuthorizationCondition{{AuthorizeColumn: "student_id", ExpectedValues: []int{1}}}},
+				},
+				NodeType: "WHERE",
+				Node:     "id IN (SELECT student_id FROM course_class_enrollment)",
+				Location: 31,
+			},
+		},
+		{
+			name:  "Unauthorized CTE body",
+			query: "WITH c AS (SELECT id FROM administrative_class) SELECT * FROM c",
+			expected: &AuthorizationExplanation{
+				Role:     "student",
+				Reason:   "The tables are read without any condition on their authorize columns",
+				Tables:   []UnauthorizedTable{{Alias: "administrative_class", Table: "administrative_class", Conditions: []AuthorizationCondition{{AuthorizeColumn: "id", ExpectedValues: []int{10}}}}},
+				NodeType: "FROM",
+				Node:     "administrative_class",
+				Location: 26,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := pgquery.Parse(tt.query)
+			require.NoError(t, err)
+
+			result, err := authService.AuthorizeNode(tree.Stmts[0].GetStmt(), nil, false, student)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected == nil, result.Authorized)
+			assert.Equal(t, tt.expected, result.Explanation)
+		})
+	}
+}
+
+func TestAuthorizationExplanation_String(t *testing.T) {
+	explanation := &AuthorizationExplanation{
+		Role:     "student",
+		Reason:   "The WHERE clause doesn't restrict the tables to the rows the user can read",
+		NodeType: "WHERE",
+		Node:     "s.id = 2",
+		Tables: []UnauthorizedTable{
+			{Alias: "s", Table: "student", Conditions: []AuthorizationCondition{{AuthorizeColumn: "id", ExpectedValues: []int{1}}}},
+			{Alias: "u", Table: "user_account"},
+		},
+	}
+
+	assert.Equal(t, "The WHERE clause doesn't restrict the tables to the rows the user can read (WHERE: s.id = 2)\n"+
+		"- Table student (alias s) must be filtered by one of: s.id IN (1)\n"+
+		"- Role student can't read table user_account (alias u)", explanation.String())
+}
+
+// endregion
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -16,9 +17,10 @@ type QueryResult struct {
 }
 
 type QueryRequest struct {
-	Query string `json:"query"`
+	Query string `json:"query" jsonschema:"description=A single PostgreSQL SELECT query,minLength=1"`
 }
 
 type DDLLoader interface {
 	LoadDDL(db *sqlx.DB) (string, error)
+	LoadSchema(ctx context.Context) (*DatabaseSchema, error)
 }
@@ -0,0 +1,384 @@
+package db
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//go:embed default_authorization_policy.yaml
+var defaultAuthorizationPolicy []byte
+
+// defaultPolicy is the compiled default policy, shared by the services created without a policy
+var defaultPolicy = sync.OnceValue(DefaultAuthorizationPolicy)
+
+// factSourceTypes maps the name of a UserInfo type to its reflect type and the role it belongs to.
+// A fact source like StudentInfo.CourseInstructorIDs can only be used in policies of the corresponding role.
+var factSourceTypes = map[string]struct {
+	Type reflect.Type
+	Role string
+}{
+	"StudentInfo":   {reflect.TypeOf(StudentInfo{}), "student"},
+	"ProfessorInfo": {reflect.TypeOf(ProfessorInfo{}), "professor"},
+	"AdminInfo":     {reflect.TypeOf(AdminInfo{}), "admin"},
+}
+
+// AuthorizationPolicy is the declarative authorization policy of the database, usually loaded from a YAML/JSON file.
+type AuthorizationPolicy struct {
+	// PublicTables can be read by every role
+	PublicTables []string `yaml:"public_tables" json:"public_tables"`
+	// BypassRoles can read every table
+	BypassRoles []string `yaml:"bypass_roles" json:"bypass_roles"`
+	// Policies restrict the rows of a table a role can read
+	Policies []TablePolicy `yaml:"policies" json:"policies"`
+	// ColumnRules restrict the columns of a table a role can read, whether the table is public or not
+	ColumnRules []TableColumnRules `yaml:"column_rules" json:"column_rules"`
+
+	publicTables map[string]bool
+	bypassRoles  map[string]bool
+	// tablePolicies is a map of table name to a map of role to policy
+	tablePolicies map[string]map[string]*TablePolicy
+	// columnRules is a map of table name to a map of role to a map of column name to rule
+	columnRules map[string]map[string]map[string]*ColumnRule
+}
+
+// TablePolicy gives the authorize columns of a table for a role
+type TablePolicy struct {
+	Table   string         `yaml:"table" json:"table"`
+	Role    string         `yaml:"role" json:"role"`
+	Columns []ColumnPolicy `yaml:"columns" json:"columns"`
+}
+
+// ColumnPolicy is an authorize column with the named fact sources giving its allowed values.
+// A row is authorized if the value of any authorize column is in its allowed values.
+type ColumnPolicy struct {
+	Column  string   `yaml:"column" json:"column"`
+	Sources []string `yaml:"sources" json:"sources"`
+}
+
+// ColumnAction is what happens to a column protected by a column rule
+type ColumnAction string
+
+const (
+	// ColumnActionDeny rejects the query if the column is selected
+	ColumnActionDeny ColumnAction = "deny"
+	// ColumnActionMaskNull replaces the values of the column with NULL in the query result
+	ColumnActionMaskNull ColumnAction = "mask_null"
+	// ColumnActionMaskPartial redacts the values of the column in the query result, only keeping a few characters
+	ColumnActionMaskPartial ColumnAction = "mask_partial"
+)
+
+// restrictiveness orders the column actions, the more restrictive action wins when a column is protected twice
+var restrictiveness = map[ColumnAction]int{
+	ColumnActionMaskPartial: 1,
+	ColumnActionMaskNull:    2,
+	ColumnActionDeny:        3,
+}
+
+// TableColumnRules gives the column rules of a table for a role
+type TableColumnRules struct {
+	Table   string       `yaml:"table" json:"table"`
+	Role    string       `yaml:"role" json:"role"`
+	Columns []ColumnRule `yaml:"columns" json:"columns"`
+}
+
+// ColumnRule protects a column of a table.
+type ColumnRule struct {
+	Column string       `yaml:"column" json:"column"`
+	Action ColumnAction `yaml:"action" json:"action"`
+	// Table is filled when the policy is compiled, so the rule can be reported without its TableColumnRules
+	Table string `yaml:"-" json:"-"`
+}
+
+// DefaultAuthorizationPolicy returns the policy embedded in the binary
+func DefaultAuthorizationPolicy() *AuthorizationPolicy {
+	policy, err := ParseAuthorizationPolicy(defaultAuthorizationPolicy, "yaml")
+	if err != nil {
+		// The embedded policy is checked by the tests, so this should never happen
+		panic(fmt.Sprintf("invalid default authorization policy: %v", err))
+	}
+	return policy
+}
+
+// LoadAuthorizationPolicy loads the policy from a YAML or JSON file, the format is decided by the file extension
+func LoadAuthorizationPolicy(path string) (*AuthorizationPolicy, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	format := "yaml"
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		format = "json"
+	}
+	return ParseAuthorizationPolicy(content, format)
+}
+
+// ParseAuthorizationPolicy parses and compiles the policy. It checks everything that doesn't need the database,
+// use Validate to check the policy against the live schema.
+func ParseAuthorizationPolicy(content []byte, format string) (*AuthorizationPolicy, error) {
+	var policy AuthorizationPolicy
+	var err error
+	if format == "json" {
+		err = json.Unmarshal(content, &policy)
+	} else {
+		err = yaml.Unmarshal(content, &policy)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse authorization policy: %v", err)
+	}
+
+	if err := policy.compile(); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (p *AuthorizationPolicy) compile() error {
+	var errs []error
+
+	p.publicTables = make(map[string]bool)
+	for _, table := range p.PublicTables {
+		p.publicTables[table] = true
+	}
+	p.bypassRoles = make(map[string]bool)
+	for _, role := range p.BypassRoles {
+		p.bypassRoles[role] = true
+	}
+
+	p.tablePolicies = make(map[string]map[string]*TablePolicy)
+	for i := range p.Policies {
+		tablePolicy := &p.Policies[i]
+		if tablePolicy.Table == "" || tablePolicy.Role == "" {
+			errs = append(errs, fmt.Errorf("policy #%d: table and role are required", i))
+			continue
+		}
+		if p.publicTables[tablePolicy.Table] {
+			errs = append(errs, fmt.Errorf("policy %s/%s: table is already public", tablePolicy.Table, tablePolicy.Role))
+		}
+		if _, ok := p.tablePolicies[tablePolicy.Table][tablePolicy.Role]; ok {
+			errs = append(errs, fmt.Errorf("policy %s/%s: duplicated policy", tablePolicy.Table, tablePolicy.Role))
+			continue
+		}
+		if len(tablePolicy.Columns) == 0 {
+			errs = append(errs, fmt.Errorf("policy %s/%s: at least one authorize column is required", tablePolicy.Table, tablePolicy.Role))
+		}
+		for _, column := range tablePolicy.Columns {
+			if column.Column == "" {
+				errs = append(errs, fmt.Errorf("policy %s/%s: column name is required", tablePolicy.Table, tablePolicy.Role))
+			}
+			if len(column.Sources) == 0 {
+				errs = append(errs, fmt.Errorf("policy %s/%s: column %s has no fact source", tablePolicy.Table, tablePolicy.Role, column.Column))
+			}
+			for _, source := range column.Sources {
+				if err := checkFactSource(source, tablePolicy.Role); err != nil {
+					errs = append(errs, fmt.Errorf("policy %s/%s: column %s: %v", tablePolicy.Table, tablePolicy.Role, column.Column, err))
+				}
+			}
+		}
+
+		if p.tablePolicies[tablePolicy.Table] == nil {
+			p.tablePolicies[tablePolicy.Table] = make(map[string]*TablePolicy)
+		}
+		p.tablePolicies[tablePolicy.Table][tablePolicy.Role] = tablePolicy
+	}
+
+	p.columnRules = make(map[string]map[string]map[string]*ColumnRule)
+	for i := range p.ColumnRules {
+		tableRules := &p.ColumnRules[i]
+		if tableRules.Table == "" || tableRules.Role == "" {
+			errs = append(errs, fmt.Errorf("column rules #%d: table and role are required", i))
+			continue
+		}
+		if _, ok := p.columnRules[tableRules.Table][tableRules.Role]; ok {
+			errs = append(errs, fmt.Errorf("column rules %s/%s: duplicated column rules", tableRules.Table, tableRules.Role))
+			continue
+		}
+		rules := make(map[string]*ColumnRule)
+		for j := range tableRules.Columns {
+			rule := &tableRules.Columns[j]
+			rule.Table = tableRules.Table
+			if rule.Column == "" {
+				errs = append(errs, fmt.Errorf("column rules %s/%s: column name is required", tableRules.Table, tableRules.Role))
+				continue
+			}
+			if _, ok := restrictiveness[rule.Action]; !ok {
+				errs = append(errs, fmt.Errorf("column rules %s/%s: column %s has unknown action %q", tableRules.Table, tableRules.Role, rule.Column, rule.Action))
+				continue
+			}
+			if _, ok := rules[rule.Column]; ok {
+				errs = append(errs, fmt.Errorf("column rules %s/%s: duplicated rule for column %s", tableRules.Table, tableRules.Role, rule.Column))
+				continue
+			}
+			rules[rule.Column] = rule
+		}
+
+		if p.columnRules[tableRules.Table] == nil {
+			p.columnRules[tableRules.Table] = make(map[string]map[string]*ColumnRule)
+		}
+		p.columnRules[tableRules.Table][tableRules.Role] = rules
+	}
+
+	return errors.Join(errs...)
+}
+
+// Validate checks the policy against the live schema: every restricted table and authorize column must exist.
+// Public tables which don't exist are only logged because they are harmless.
+func (p *AuthorizationPolicy) Validate(schemaService SchemaService) error {
+	var errs []error
+	for _, table := range p.PublicTables {
+		if len(schemaService.GetColumns(table)) == 0 {
+			log.Printf("Warning: public table %s of the authorization policy doesn't exist", table)
+		}
+	}
+
+	for _, tablePolicy := range p.Policies {
+		columns := schemaService.GetColumns(tablePolicy.Table)
+		if len(columns) == 0 {
+			errs = append(errs, fmt.Errorf("policy %s/%s: table %s doesn't exist", tablePolicy.Table, tablePolicy.Role, tablePolicy.Table))
+			continue
+		}
+		for _, column := range tablePolicy.Columns {
+			if !ContainsString(columns, column.Column) {
+				errs = append(errs, fmt.Errorf("policy %s/%s: column %s doesn't exist", tablePolicy.Table, tablePolicy.Role, column.Column))
+			}
+		}
+	}
+
+	for _, tableRules := range p.ColumnRules {
+		columns := schemaService.GetColumns(tableRules.Table)
+		if len(columns) == 0 {
+			errs = append(errs, fmt.Errorf("column rules %s/%s: table %s doesn't exist", tableRules.Table, tableRules.Role, tableRules.Table))
+			continue
+		}
+		for _, rule := range tableRules.Columns {
+			if !ContainsString(columns, rule.Column) {
+				errs = append(errs, fmt.Errorf("column rules %s/%s: column %s doesn't exist", tableRules.Table, tableRules.Role, rule.Column))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// IsPublicTable reports whether the table can be read by every role
+func (p *AuthorizationPolicy) IsPublicTable(table string) bool {
+	return p.publicTables[table]
+}
+
+// IsBypassRole reports whether the role can read every table
+func (p *AuthorizationPolicy) IsBypassRole(role string) bool {
+	return p.bypassRoles[role]
+}
+
+// CanReadTable reports whether the role can read some rows of the table
+func (p *AuthorizationPolicy) CanReadTable(table string, role string) bool {
+	return p.IsPublicTable(table) || p.IsBypassRole(role) || p.GetTablePolicy(table, role) != nil
+}
+
+// GetTablePolicy returns the policy of the table for the role, or nil if the role has no access to the table
+func (p *AuthorizationPolicy) GetTablePolicy(table string, role string) *TablePolicy {
+	return p.tablePolicies[table][role]
+}
+
+// GetColumnRule returns the rule protecting the column of the table for the role, or nil if the column isn't protected
+func (p *AuthorizationPolicy) GetColumnRule(table string, role string, column string) *ColumnRule {
+	return p.columnRules[table][role][column]
+}
+
+// getColumnRuleByName returns the most restrictive rule protecting a column with the given name in any table for the role.
+// It is used when the table of a column can't be resolved, e.g. the column comes from a function in the FROM clause.
+func (p *AuthorizationPolicy) getColumnRuleByName(role string, column string) *ColumnRule {
+	var result *ColumnRule
+	for _, roleRules := range p.columnRules {
+		result = moreRestrictiveRule(result, roleRules[role][column])
+	}
+	return result
+}
+
+// getTableRule returns the most restrictive rule protecting a column of the table for the role
+func (p *AuthorizationPolicy) getTableRule(table string, role string) *ColumnRule {
+	rules := p.columnRules[table][role]
+	columns := make([]string, 0, len(rules))
+	for column := range rules {
+		columns = append(columns, column)
+	}
+	// Sorted so that the same rule is reported among the equally restrictive ones
+	sort.Strings(columns)
+	var result *ColumnRule
+	for _, column := range columns {
+		result = moreRestrictiveRule(result, rules[column])
+	}
+	return result
+}
+
+// moreRestrictiveRule returns the more restrictive of the two rules, any of them can be nil
+func moreRestrictiveRule(a *ColumnRule, b *ColumnRule) *ColumnRule {
+	if a == nil {
+		return b
+	}
+	if b == nil || restrictiveness[a.Action] >= restrictiveness[b.Action] {
+		return a
+	}
+	return b
+}
+
+// checkFactSource checks that the fact source exists and belongs to the role
+func checkFactSource(source string, role string) error {
+	typeName, fieldName, ok := strings.Cut(source, ".")
+	if !ok {
+		return fmt.Errorf("invalid fact source %q, expected <Type>.<Field>", source)
+	}
+	sourceType, ok := factSourceTypes[typeName]
+	if !ok {
+		return fmt.Errorf("unknown fact source type %s", typeName)
+	}
+	if sourceType.Role != role {
+		return fmt.Errorf("fact source %s can't be used for role %s", source, role)
+	}
+	field, ok := sourceType.Type.FieldByName(fieldName)
+	if !ok {
+		return fmt.Errorf("unknown fact source %s", source)
+	}
+	if field.Type.Kind() != reflect.Int && !(field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Int) {
+		return fmt.Errorf("fact source %s must be an int or a list of int", source)
+	}
+	return nil
+}
+
+// resolveFactSource returns the values of the fact source for the user.
+// The fact source is already checked when the policy is compiled, so we only need to check the user type here.
+func resolveFactSource(source string, userInfo UserContext) ([]int, bool) {
+	typeName, fieldName, _ := strings.Cut(source, ".")
+	value := reflect.ValueOf(userInfo)
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil, false
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct || value.Type().Name() != typeName {
+		return nil, false
+	}
+
+	field := value.FieldByName(fieldName)
+	switch field.Kind() {
+	case reflect.Int:
+		return []int{int(field.Int())}, true
+	case reflect.Slice:
+		values := make([]int, field.Len())
+		for i := 0; i < field.Len(); i++ {
+			values[i] = int(field.Index(i).Int())
+		}
+		return values, true
+	default:
+		return nil, false
+	}
+}
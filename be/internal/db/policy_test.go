@@ -0,0 +1,220 @@
+package db
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// region TestAuthorizationPolicy
+func TestDefaultAuthorizationPolicy(t *testing.T) {
+	policy := DefaultAuthorizationPolicy()
+
+	assert.True(t, policy.IsPublicTable("course"))
+	assert.True(t, policy.IsPublicTable("semester"))
+	assert.True(t, policy.IsPublicTable("course_schedule_instructor"))
+	assert.True(t, policy.IsPublicTable("course_requirement"))
+	assert.False(t, policy.IsPublicTable("student"))
+	assert.True(t, policy.IsBypassRole("admin"))
+	assert.NotNil(t, policy.GetTablePolicy("course_class_enrollment", "student"))
+	assert.Nil(t, policy.GetTablePolicy("user_account", "student"))
+}
+
+func TestLoadAuthorizationPolicy(t *testing.T) {
+	// The embedded file is the only copy of the policy, a deployment loads its own copy of it
+	policy, err := LoadAuthorizationPolicy("default_authorization_policy.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultAuthorizationPolicy().PublicTables, policy.PublicTables)
+	assert.True(t, policy.IsPublicTable("course_requirement"))
+
+	_, err = LoadAuthorizationPolicy("missing_policy.yaml")
+	assert.Error(t, err)
+}
+
+func TestParseAuthorizationPolicy(t *testing.T) {
+	tests := []struct {
+		name          string
+		content       string
+		format        string
+		expectedError string
+	}{
+		{
+			name: "Valid YAML policy",
+			content: `
+public_tables: [course]
+policies:
+  - table: student_scholarship
+    role: student
+    columns:
+      - column: student_id
+        sources: [StudentInfo.ID]`,
+			format: "yaml",
+		},
+		{
+			name:    "Valid JSON policy",
+			content: `{"public_tables": ["course"], "policies": [{"table": "student", "role": "professor", "columns": [{"column": "id", "sources": ["ProfessorInfo.TaughtStudentIDs"]}]}]}`,
+			format:  "json",
+		},
+		{
+			name: "Unknown fact source field",
+			content: `
+policies:
+  - table: student
+    role: student
+    columns:
+      - column: id
+        sources: [StudentInfo.Unknown]`,
+			format:        "yaml",
+			expectedError: "policy student/student: column id: unknown fact source StudentInfo.Unknown",
+		},
+		{
+			name: "Fact source of another role",
+			content: `
+policies:
+  - table: student
+    role: student
+    columns:
+      - column: id
+        sources: [ProfessorInfo.ID]`,
+			format:        "yaml",
+			expectedError: "policy student/student: column id: fact source ProfessorInfo.ID can't be used for role student",
+		},
+		{
+			name: "Fact source with unsupported type",
+			content: `
+policies:
+  - table: student
+    role: student
+    columns:
+      - column: id
+        sources: [StudentInfo.Role]`,
+			format:        "yaml",
+			expectedError: "policy student/student: column id: fact source StudentInfo.Role must be an int or a list of int",
+		},
+		{
+			name: "Duplicated policy",
+			content: `
+policies:
+  - table: student
+    role: student
+    columns:
+      - column: id
+        sources: [StudentInfo.ID]
+  - table: student
+    role: student
+    columns:
+      - column: id
+        sources: [StudentInfo.ID]`,
+			format:        "yaml",
+			expectedError: "policy student/student: duplicated policy",
+		},
+		{
+			name: "Restricted table is also public",
+			content: `
+public_tables: [student]
+policies:
+  - table: student
+    role: student
+    columns:
+      - column: id
+        sources: [StudentInfo.ID]`,
+			format:        "yaml",
+			expectedError: "policy student/student: table is already public",
+		},
+		{
+			name: "Unknown column action",
+			content: `
+column_rules:
+  - table: student
+    role: professor
+    columns:
+      - column: email
+        action: hide`,
+			format:        "yaml",
+			expectedError: `column rules student/professor: column email has unknown action "hide"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := ParseAuthorizationPolicy([]byte(tt.content), tt.format)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotNil(t, policy)
+		})
+	}
+}
+
+func TestAuthorizationPolicy_Validate(t *testing.T) {
+	schemaService := &MockSchemaService{}
+
+	valid, err := ParseAuthorizationPolicy([]byte(`
+public_tables: [course, semester]
+policies:
+  - table: course_class_enrollment
+    role: student
+    columns:
+      - column: student_id
+        sources: [StudentInfo.ID]`), "yaml")
+	require.NoError(t, err)
+	// semester doesn't exist in the mock schema, but it is only a public table
+	assert.NoError(t, valid.Validate(schemaService))
+
+	invalid, err := ParseAuthorizationPolicy([]byte(`
+policies:
+  - table: student_scholarship
+    role: student
+    columns:
+      - column: student_id
+        sources: [StudentInfo.ID]
+  - table: student
+    role: student
+    columns:
+      - column: student_id
+        sources: [StudentInfo.ID]`), "yaml")
+	require.NoError(t, err)
+	assert.EqualError(t, invalid.Validate(schemaService),
+		"policy student_scholarship/student: table student_scholarship doesn't exist\npolicy student/student: column student_id doesn't exist")
+}
+
+func TestGetAuthorizationColumn_FromPolicy(t *testing.T) {
+	policy, err := ParseAuthorizationPolicy([]byte(`
+public_tables: [course]
+bypass_roles: [admin]
+policies:
+  - table: professor
+    role: student
+    columns:
+      - column: id
+        sources: [StudentInfo.CourseInstructorIDs, StudentInfo.AdvisorProfessorID]
+  - table: student_scholarship
+    role: student
+    columns:
+      - column: student_id
+        sources: [StudentInfo.ID]`), "yaml")
+	require.NoError(t, err)
+	authService := NewAuthorizationServiceImplWithPolicy(&MockSchemaService{}, policy)
+
+	student := &StudentInfo{UserInfo: UserInfo{ID: 1, Role: "student"}, CourseInstructorIDs: []int{3, 4}, AdvisorProfessorID: 5}
+
+	authContext := authService.getAuthorizationColumn("professor", student)
+	assert.Equal(t, []string{"id"}, authContext.AuthorizeColumns)
+	ids, _ := authContext.Conditions.Get("id")
+	assert.Equal(t, []int{3, 4, 5}, ids)
+
+	authContext = authService.getAuthorizationColumn("student_scholarship", student)
+	studentIds, _ := authContext.Conditions.Get("student_id")
+	assert.Equal(t, []int{1}, studentIds)
+
+	assert.True(t, authService.getAuthorizationColumn("course", student).Bypass)
+	assert.True(t, authService.getAuthorizationColumn("student", &AdminInfo{UserInfo: UserInfo{ID: 1, Role: "admin"}}).Bypass)
+	assert.Empty(t, authService.getAuthorizationColumn("student", student).AuthorizeColumns)
+
+	// The user context doesn't match the role, so nothing is authorized
+	assert.Empty(t, authService.getAuthorizationColumn("professor", &UserInfo{ID: 1, Role: "student"}).AuthorizeColumns)
+}
+
+// endregion
@@ -0,0 +1,222 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	pgquery "github.com/pganalyze/pg_query_go/v6"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// ErrRewriteUnauthorized is returned when the rewritten query still isn't authorized
+var ErrRewriteUnauthorized = errors.New("the rewritten query isn't authorized")
+
+// rewriteQuery rewrites the statement of the parsed query and returns the rewritten SQL.
+// The rewritten SQL is parsed and authorized again from scratch, so a node the rewriter produced or missed can't
+// skip the authorization: it fails closed with ErrRewriteUnauthorized if the second pass isn't authorized.
+func rewriteQuery(authSer AuthorizationService, tree *pgquery.ParseResult, userInfo UserContext) (string, error) {
+	if err := authSer.RewriteNode(tree.Stmts[0].GetStmt(), userInfo); err != nil {
+		return "", err
+	}
+	rewrittenQuery, err := pgquery.Deparse(tree)
+	if err != nil {
+		return "", err
+	}
+
+	rewrittenTree, err := pgquery.Parse(rewrittenQuery)
+	if err != nil {
+		return "", err
+	}
+	if len(rewrittenTree.Stmts) != 1 || rewrittenTree.Stmts[0].GetStmt().GetSelectStmt() == nil {
+		return "", fmt.Errorf("%w: it isn't a single SELECT statement", ErrRewriteUnauthorized)
+	}
+	authResult, err := authSer.AuthorizeNode(rewrittenTree.Stmts[0].GetStmt(), nil, false, userInfo)
+	if err != nil {
+		return "", err
+	}
+	if !authResult.Authorized {
+		return "", fmt.Errorf("%w: %s", ErrRewriteUnauthorized, authResult.Explanation)
+	}
+	return rewrittenQuery, nil
+}
+
+// RewriteNode rewrites the given statement in place so that it only reads the rows the user is allowed to see.
+// Every RangeVar that the authorization policy restricts for the user is replaced by a filtered subselect, e.g.
+//
+//	SELECT * FROM course_class_enrollment cce
+//
+// becomes
+//
+//	SELECT * FROM (SELECT * FROM course_class_enrollment WHERE student_id IN (1)) cce
+//
+// The alias (and column aliases) of the original table are kept, so the rest of the query doesn't need to change.
+// References to CTEs are not rewritten because their bodies are rewritten instead.
+func (s *AuthorizationServiceImpl) RewriteNode(node *pgquery.Node, userInfo UserContext) error {
+	if node.GetNode() == nil {
+		return errors.New("node is nil")
+	}
+	s.rewriteNode(node, map[string]bool{}, userInfo)
+	return nil
+}
+
+// rewriteNode walks the node and replaces the restricted RangeVar nodes.
+// cteNames is the set of CTE names which are visible in the current scope.
+func (s *AuthorizationServiceImpl) rewriteNode(node *pgquery.Node, cteNames map[string]bool, userInfo UserContext) {
+	if node == nil || node.GetNode() == nil {
+		return
+	}
+
+	switch n := node.GetNode().(type) {
+	case *pgquery.Node_RangeVar:
+		if restricted := s.restrictRangeVar(n.RangeVar, cteNames, userInfo); restricted != nil {
+			node.Node = restricted
+		}
+		return
+	case *pgquery.Node_SelectStmt:
+		s.rewriteSelectStmt(n.SelectStmt, cteNames, userInfo)
+		return
+	}
+
+	s.rewriteChildren(node.ProtoReflect(), "", cteNames, userInfo)
+}
+
+// rewriteSelectStmt handles the scope of the WITH clause before walking the rest of the statement.
+func (s *AuthorizationServiceImpl) rewriteSelectStmt(stmt *pgquery.SelectStmt, cteNames map[string]bool, userInfo UserContext) {
+	if stmt == nil {
+		return
+	}
+
+	scope := make(map[string]bool, len(cteNames))
+	for name := range cteNames {
+		scope[name] = true
+	}
+
+	if withClause := stmt.GetWithClause(); withClause != nil {
+		// A recursive CTE can reference itself (and the CTEs after it), so all names are visible from the beginning
+		if withClause.GetRecursive() {
+			for _, cte := range withClause.GetCtes() {
+				scope[cte.GetCommonTableExpr().GetCtename()] = true
+			}
+		}
+		for _, cte := range withClause.GetCtes() {
+			s.rewriteNode(cte.GetCommonTableExpr().GetCtequery(), scope, userInfo)
+			scope[cte.GetCommonTableExpr().GetCtename()] = true
+		}
+	}
+
+	// The WITH clause is already handled above
+	s.rewriteChildren(stmt.ProtoReflect(), "with_clause", scope, userInfo)
+}
+
+// rewriteChildren walks all the message fields of msg (except the skipped one) to find nested nodes.
+// We use protobuf reflection here because sublinks can be nested in almost any expression node.
+func (s *AuthorizationServiceImpl) rewriteChildren(msg protoreflect.Message, skip protoreflect.Name, cteNames map[string]bool, userInfo UserContext) {
+	msg.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.Name() == skip || fd.Message() == nil || fd.IsMap() {
+			return true
+		}
+		if fd.IsList() {
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				s.rewriteMessage(list.Get(i).Message(), cteNames, userInfo)
+			}
+			return true
+		}
+		s.rewriteMessage(v.Message(), cteNames, userInfo)
+		return true
+	})
+}
+
+func (s *AuthorizationServiceImpl) rewriteMessage(msg protoreflect.Message, cteNames map[string]bool, userInfo UserContext) {
+	switch m := msg.Interface().(type) {
+	case *pgquery.Node:
+		s.rewriteNode(m, cteNames, userInfo)
+	case *pgquery.SelectStmt:
+		s.rewriteSelectStmt(m, cteNames, userInfo)
+	default:
+		s.rewriteChildren(msg, "", cteNames, userInfo)
+	}
+}
+
+// restrictRangeVar returns the filtered subselect which replaces the range var,
+// or nil if the range var doesn't need to be restricted.
+func (s *AuthorizationServiceImpl) restrictRangeVar(rangeVar *pgquery.RangeVar, cteNames map[string]bool, userInfo UserContext) *pgquery.Node_RangeSubselect {
+	if rangeVar.GetSchemaname() == "" && cteNames[rangeVar.GetRelname()] {
+		return nil
+	}
+
+	authContext := s.getAuthorizationColumn(rangeVar.GetRelname(), userInfo)
+	if authContext.Bypass {
+		return nil
+	}
+
+	alias := rangeVar.GetAlias()
+	if alias == nil {
+		alias = &pgquery.Alias{Aliasname: rangeVar.GetRelname()}
+	}
+
+	innerRangeVar := &pgquery.RangeVar{
+		Catalogname:    rangeVar.GetCatalogname(),
+		Schemaname:     rangeVar.GetSchemaname(),
+		Relname:        rangeVar.GetRelname(),
+		Inh:            rangeVar.GetInh(),
+		Relpersistence: rangeVar.GetRelpersistence(),
+		Location:       rangeVar.GetLocation(),
+	}
+
+	subquery := &pgquery.SelectStmt{
+		TargetList: []*pgquery.Node{
+			pgquery.MakeResTargetNodeWithVal(pgquery.MakeColumnRefNode([]*pgquery.Node{pgquery.MakeAStarNode()}, 0), 0),
+		},
+		FromClause:  []*pgquery.Node{{Node: &pgquery.Node_RangeVar{RangeVar: innerRangeVar}}},
+		WhereClause: s.buildAuthorizationPredicate(authContext),
+		LimitOption: pgquery.LimitOption_LIMIT_OPTION_DEFAULT,
+		Op:          pgquery.SetOperation_SETOP_NONE,
+	}
+
+	return &pgquery.Node_RangeSubselect{
+		RangeSubselect: &pgquery.RangeSubselect{
+			Subquery: &pgquery.Node{Node: &pgquery.Node_SelectStmt{SelectStmt: subquery}},
+			Alias:    alias,
+		},
+	}
+}
+
+// buildAuthorizationPredicate builds the WHERE clause which only keeps the authorized rows.
+// Each authorize column gives an IN (...) predicate and the rows are authorized if any of them matches.
+// If there is no authorize column with allowed values, the predicate is FALSE.
+func (s *AuthorizationServiceImpl) buildAuthorizationPredicate(authContext AuthorizationContext) *pgquery.Node {
+	var predicates []*pgquery.Node
+	for _, column := range authContext.AuthorizeColumns {
+		if authContext.Conditions == nil {
+			break
+		}
+		values, _ := authContext.Conditions.Get(column)
+		values = uniqueInts(values)
+		if len(values) == 0 {
+			continue
+		}
+
+		items := make([]*pgquery.Node, 0, len(values))
+		for _, value := range values {
+			items = append(items, pgquery.MakeAConstIntNode(int64(value), 0))
+		}
+		predicates = append(predicates, pgquery.MakeAExprNode(
+			pgquery.A_Expr_Kind_AEXPR_IN,
+			[]*pgquery.Node{pgquery.MakeStrNode("=")},
+			pgquery.MakeColumnRefNode([]*pgquery.Node{pgquery.MakeStrNode(column)}, 0),
+			pgquery.MakeListNode(items),
+			0,
+		))
+	}
+
+	switch len(predicates) {
+	case 0:
+		return &pgquery.Node{Node: &pgquery.Node_AConst{AConst: &pgquery.A_Const{
+			Val: &pgquery.A_Const_Boolval{Boolval: &pgquery.Boolean{Boolval: false}},
+		}}}
+	case 1:
+		return predicates[0]
+	default:
+		return pgquery.MakeBoolExprNode(pgquery.BoolExprType_OR_EXPR, predicates, 0)
+	}
+}
@@ -0,0 +1,210 @@
+package db
+
+import (
+	pgquery "github.com/pganalyze/pg_query_go/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// region TestRewriteNode
+func TestRewriteNode(t *testing.T) {
+	schemaService := &MockSchemaService{}
+	authService := NewAuthorizationServiceImpl(schemaService)
+
+	student := &StudentInfo{UserInfo: UserInfo{ID: 1, Role: "student"}, AdministrativeClassID: 10}
+	professor := &ProfessorInfo{
+		UserInfo:             UserInfo{ID: 2, Role: "professor"},
+		TaughtCourseClassIDs: []int{5, 6, 5},
+		AdvisedStudentIDs:    []int{7},
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		userInfo UserContext
+		expected string
+	}{
+		{
+			name:     "Student reading own grades without filter",
+			query:    "SELECT grade FROM course_class_enrollment",
+			userInfo: student,
+			expected: "SELECT grade FROM (SELECT * FROM course_class_enrollment WHERE student_id IN (1)) course_class_enrollment",
+		},
+		{
+			name:     "Alias and public table are kept",
+			query:    "SELECT c.name, cce.grade FROM course_class_enrollment cce JOIN course_class cc ON cc.id = cce.course_class_id JOIN course c ON c.id = cc.course_id",
+			userInfo: student,
+			expected: "SELECT c.name, cce.grade FROM (SELECT * FROM course_class_enrollment WHERE student_id IN (1)) cce JOIN course_class cc ON cc.id = cce.course_class_id JOIN course c ON c.id = cc.course_id",
+		},
+		{
+			name:     "Professor with multiple authorize columns",
+			query:    "SELECT * FROM course_class_enrollment",
+			userInfo: professor,
+			expected: "SELECT * FROM (SELECT * FROM course_class_enrollment WHERE course_class_id IN (5, 6) OR student_id IN (7)) course_class_enrollment",
+		},
+		{
+			name:  "Professor reading the schedules they teach and the ones of their advisees",
+			query: "SELECT * FROM student_course_class_schedule",
+			userInfo: &ProfessorInfo{
+				UserInfo:             UserInfo{ID: 2, Role: "professor"},
+				TaughtScheduleIDs:    []int{3},
+				AdvisedEnrollmentIDs: []int{8, 9},
+			},
+			expected: "SELECT * FROM (SELECT * FROM student_course_class_schedule WHERE course_class_schedule_id IN (3) OR course_class_enrollment_id IN (8, 9)) student_course_class_schedule",
+		},
+		{
+			name:     "Table without policy is filtered out completely",
+			query:    "SELECT * FROM user_account",
+			userInfo: student,
+			expected: "SELECT * FROM (SELECT * FROM user_account WHERE false) user_account",
+		},
+		{
+			name:     "Subquery in WHERE clause",
+			query:    "SELECT name FROM course WHERE id IN (SELECT course_class_id FROM course_class_enrollment)",
+			userInfo: student,
+			expected: "SELECT name FROM course WHERE id IN (SELECT course_class_id FROM (SELECT * FROM course_class_enrollment WHERE student_id IN (1)) course_class_enrollment)",
+		},
+		{
+			name:     "CTE reference is not rewritten but its body is",
+			query:    "WITH student AS (SELECT * FROM student) SELECT name FROM student",
+			userInfo: student,
+			expected: "WITH student AS (SELECT * FROM (SELECT * FROM student WHERE id IN (1)) student) SELECT name FROM student",
+		},
+		{
+			name:     "Union of restricted tables",
+			query:    "SELECT id FROM student UNION SELECT id FROM administrative_class",
+			userInfo: student,
+			expected: "SELECT id FROM (SELECT * FROM student WHERE id IN (1)) student UNION SELECT id FROM (SELECT * FROM administrative_class WHERE id IN (10)) administrative_class",
+		},
+		{
+			name:     "Admin query is not rewritten",
+			query:    "SELECT * FROM student",
+			userInfo: &AdminInfo{UserInfo: UserInfo{ID: 3, Role: "admin"}},
+			expected: "SELECT * FROM student",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := pgquery.Parse(tt.query)
+			require.NoError(t, err)
+
+			err = authService.RewriteNode(tree.Stmts[0].GetStmt(), tt.userInfo)
+			require.NoError(t, err)
+
+			rewritten, err := pgquery.Deparse(tree)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, rewritten)
+
+			// The rewritten query must still be a valid query, authorized as it is
+			rewrittenTree, err := pgquery.Parse(rewritten)
+			require.NoError(t, err)
+			authResult, err := authService.AuthorizeNode(rewrittenTree.Stmts[0].GetStmt(), nil, false, tt.userInfo)
+			require.NoError(t, err)
+			assert.True(t, authResult.Authorized, authResult.Explanation.String())
+		})
+	}
+}
+
+// skippingRewriter is a rewriter which misses every node
+type skippingRewriter struct {
+	*AuthorizationServiceImpl
+}
+
+func (r skippingRewriter) RewriteNode(node *pgquery.Node, userInfo UserContext) error {
+	return nil
+}
+
+// region TestRewriteQuery
+func TestRewriteQuery(t *testing.T) {
+	authService := NewAuthorizationServiceImpl(&MockSchemaService{})
+	student := &StudentInfo{UserInfo: UserInfo{ID: 1, Role: "student"}}
+
+	tests := []struct {
+		name     string
+		authSer  AuthorizationService
+		query    string
+		expected string
+		wantErr  error
+	}{
+		{
+			name:     "Rewritten query is authorized again",
+			authSer:  authService,
+			query:    "SELECT grade FROM course_class_enrollment",
+			expected: "SELECT grade FROM (SELECT * FROM course_class_enrollment WHERE student_id IN (1)) course_class_enrollment",
+		},
+		{
+			name:     "Rewritten CTE",
+			authSer:  authService,
+			query:    "WITH s AS (SELECT * FROM student) SELECT s.name FROM s",
+			expected: "WITH s AS (SELECT * FROM (SELECT * FROM student WHERE id IN (1)) student) SELECT s.name FROM s",
+		},
+		{
+			name:    "Node missed by the rewriter",
+			authSer: skippingRewriter{authService},
+			query:   "SELECT grade FROM course_class_enrollment",
+			wantErr: ErrRewriteUnauthorized,
+		},
+		{
+			name:    "Table shadowed by a CTE is still checked",
+			authSer: skippingRewriter{authService},
+			query:   "WITH course AS (SELECT * FROM student) SELECT * FROM course",
+			wantErr: ErrRewriteUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := pgquery.Parse(tt.query)
+			require.NoError(t, err)
+
+			rewritten, err := rewriteQuery(tt.authSer, tree, student)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, rewritten)
+		})
+	}
+}
+
+// endregion
+
+// region TestAuthorizeRewrittenForms
+func TestAuthorizeRewrittenForms(t *testing.T) {
+	authService := NewAuthorizationServiceImpl(&MockSchemaService{})
+	professor := &ProfessorInfo{UserInfo: UserInfo{ID: 2, Role: "professor"}, TaughtCourseClassIDs: []int{5, 6}}
+
+	tests := []struct {
+		name       string
+		query      string
+		authorized bool
+	}{
+		{name: "IN list of allowed values", query: "SELECT * FROM course_class_enrollment WHERE course_class_id IN (5, 6)", authorized: true},
+		{name: "IN list with a value not allowed", query: "SELECT * FROM course_class_enrollment WHERE course_class_id IN (5, 7)", authorized: false},
+		{name: "Always false condition", query: "SELECT * FROM user_account WHERE false", authorized: true},
+		{name: "Always true condition", query: "SELECT * FROM user_account WHERE true", authorized: false},
+		{name: "Negated true condition", query: "SELECT * FROM user_account WHERE NOT true", authorized: true},
+		{name: "CTE with an authorized body", query: "WITH e AS (SELECT * FROM course_class_enrollment WHERE course_class_id = 5) SELECT * FROM e", authorized: true},
+		{name: "CTE with an unauthorized body", query: "WITH e AS (SELECT * FROM course_class_enrollment) SELECT * FROM e WHERE e.course_class_id = 5", authorized: false},
+		{name: "CTE shadowing a restricted table", query: "WITH student AS (SELECT * FROM student) SELECT * FROM student WHERE id = 1", authorized: false},
+		{name: "CTE referenced in a subquery", query: "WITH e AS (SELECT * FROM course_class_enrollment WHERE course_class_id IN (6)) SELECT * FROM course WHERE id IN (SELECT course_class_id FROM e)", authorized: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := pgquery.Parse(tt.query)
+			require.NoError(t, err)
+
+			authResult, err := authService.AuthorizeNode(tree.Stmts[0].GetStmt(), nil, false, professor)
+			require.NoError(t, err)
+			assert.Equal(t, tt.authorized, authResult.Authorized)
+		})
+	}
+}
+
+// endregion
+
+// endregion
@@ -1,10 +1,19 @@
 package db
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"strings"
 	"sync"
+	"time"
 )
 
+// DefaultSchemaTTL is how long the introspected schema is cached before being loaded again
+const DefaultSchemaTTL = 10 * time.Minute
+
 type SchemaService interface {
 	// GetColumns returns the list of column names for a given table.
 	GetColumns(tableName string) []string
@@ -14,12 +23,19 @@ type SchemaServiceImpl struct {
 	db          *sqlx.DB
 	columnCache map[string][]string
 	cacheMutex  sync.RWMutex
+
+	// schema is the cached result of the introspection, it is loaded again once it is older than schemaTTL
+	schema         *DatabaseSchema
+	schemaLoadedAt time.Time
+	schemaTTL      time.Duration
+	schemaMutex    sync.Mutex
 }
 
 func NewSchemaServiceImpl(db *sqlx.DB) *SchemaServiceImpl {
 	service := &SchemaServiceImpl{
 		db:          db,
 		columnCache: make(map[string][]string),
+		schemaTTL:   DefaultSchemaTTL,
 	}
 	return service
 }
@@ -62,3 +78,256 @@ func (s *SchemaServiceImpl) queryColumnsFromDB(tableName string) []string {
 	}
 	return columns
 }
+
+// DatabaseSchema is the structure of the tables of the database, as introspected from the running database
+type DatabaseSchema struct {
+	Tables []TableSchema
+}
+
+type TableSchema struct {
+	Name        string
+	Comment     string
+	Columns     []ColumnSchema
+	PrimaryKey  []string
+	ForeignKeys []ForeignKey
+}
+
+type ColumnSchema struct {
+	Name     string
+	Type     string
+	Nullable bool
+	Comment  string
+}
+
+type ForeignKey struct {
+	Columns           []string
+	ReferencedTable   string
+	ReferencedColumns []string
+}
+
+// schemaColumnRow is a row of the columns introspection query
+type schemaColumnRow struct {
+	TableName    string `db:"table_name"`
+	TableComment string `db:"table_comment"`
+	ColumnName   string `db:"column_name"`
+	DataType     string `db:"data_type"`
+	Nullable     bool   `db:"nullable"`
+	Comment      string `db:"column_comment"`
+}
+
+// schemaConstraintRow is a row of the primary and foreign keys introspection query
+type schemaConstraintRow struct {
+	TableName         string         `db:"table_name"`
+	Type              string         `db:"constraint_type"`
+	Columns           pq.StringArray `db:"columns"`
+	ReferencedTable   string         `db:"referenced_table"`
+	ReferencedColumns pq.StringArray `db:"referenced_columns"`
+}
+
+// GetSchema returns the schema of the public tables, it is cached for the TTL of the service
+func (s *SchemaServiceImpl) GetSchema(ctx context.Context) (*DatabaseSchema, error) {
+	s.schemaMutex.Lock()
+	defer s.schemaMutex.Unlock()
+
+	if s.schema != nil && time.Since(s.schemaLoadedAt) < s.schemaTTL {
+		return s.schema, nil
+	}
+	if s.db == nil {
+		return nil, errors.New("schema service has no database to introspect")
+	}
+
+	schema, err := s.querySchemaFromDB(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to introspect the database schema: %w", err)
+	}
+	s.schema = schema
+	s.schemaLoadedAt = time.Now()
+	return schema, nil
+}
+
+// Invalidate clears the cached schema and columns, e.g. after a migration
+func (s *SchemaServiceImpl) Invalidate() {
+	s.schemaMutex.Lock()
+	s.schema = nil
+	s.schemaMutex.Unlock()
+
+	s.cacheMutex.Lock()
+	s.columnCache = make(map[string][]string)
+	s.cacheMutex.Unlock()
+}
+
+func (s *SchemaServiceImpl) querySchemaFromDB(ctx context.Context) (*DatabaseSchema, error) {
+	var columns []schemaColumnRow
+	err := s.db.SelectContext(ctx, &columns,
+		`SELECT c.table_name,
+			COALESCE(obj_description(a.attrelid, 'pg_class'), '') AS table_comment,
+			c.column_name,
+			format_type(a.atttypid, a.atttypmod) AS data_type,
+			c.is_nullable = 'YES' AS nullable,
+			COALESCE(col_description(a.attrelid, a.attnum), '') AS column_comment
+		FROM information_schema.columns c
+		JOIN information_schema.tables t ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+		JOIN pg_catalog.pg_attribute a ON a.attrelid = format('%I.%I', c.table_schema, c.table_name)::regclass
+			AND a.attname = c.column_name
+		WHERE c.table_schema = 'public' AND t.table_type = 'BASE TABLE'
+		ORDER BY c.table_name, c.ordinal_position`)
+	if err != nil {
+		return nil, err
+	}
+
+	var constraints []schemaConstraintRow
+	err = s.db.SelectContext(ctx, &constraints,
+		`SELECT cls.relname AS table_name,
+			con.contype AS constraint_type,
+			ARRAY(SELECT a.attname FROM unnest(con.conkey) WITH ORDINALITY k(attnum, ord)
+				JOIN pg_catalog.pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum
+				ORDER BY k.ord) AS columns,
+			COALESCE(ref.relname, '') AS referenced_table,
+			ARRAY(SELECT a.attname FROM unnest(con.confkey) WITH ORDINALITY k(attnum, ord)
+				JOIN pg_catalog.pg_attribute a ON a.attrelid = con.confrelid AND a.attnum = k.attnum
+				ORDER BY k.ord) AS referenced_columns
+		FROM pg_catalog.pg_constraint con
+		JOIN pg_catalog.pg_class cls ON cls.oid = con.conrelid
+		JOIN pg_catalog.pg_namespace n ON n.oid = cls.relnamespace
+		LEFT JOIN pg_catalog.pg_class ref ON ref.oid = con.confrelid
+		WHERE n.nspname = 'public' AND con.contype IN ('p', 'f')
+		ORDER BY cls.relname, con.conname`)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildDatabaseSchema(columns, constraints), nil
+}
+
+// buildDatabaseSchema groups the rows of the introspection queries by table, in the order of the columns rows
+func buildDatabaseSchema(columns []schemaColumnRow, constraints []schemaConstraintRow) *DatabaseSchema {
+	schema := &DatabaseSchema{}
+	tableIndex := make(map[string]int)
+	for _, column := range columns {
+		index, exists := tableIndex[column.TableName]
+		if !exists {
+			index = len(schema.Tables)
+			tableIndex[column.TableName] = index
+			schema.Tables = append(schema.Tables, TableSchema{Name: column.TableName, Comment: column.TableComment})
+		}
+		schema.Tables[index].Columns = append(schema.Tables[index].Columns, ColumnSchema{
+			Name:     column.ColumnName,
+			Type:     column.DataType,
+			Nullable: column.Nullable,
+			Comment:  column.Comment,
+		})
+	}
+
+	for _, constraint := range constraints {
+		index, exists := tableIndex[constraint.TableName]
+		if !exists {
+			continue
+		}
+		table := &schema.Tables[index]
+		switch constraint.Type {
+		case "p":
+			table.PrimaryKey = constraint.Columns
+		case "f":
+			table.ForeignKeys = append(table.ForeignKeys, ForeignKey{
+				Columns:           constraint.Columns,
+				ReferencedTable:   constraint.ReferencedTable,
+				ReferencedColumns: constraint.ReferencedColumns,
+			})
+		}
+	}
+	return schema
+}
+
+// Filter returns a copy of the schema with only the kept tables and columns.
+// The keys on removed columns and the foreign keys referencing removed tables or columns are removed as well.
+func (s *DatabaseSchema) Filter(keepTable func(table string) bool, keepColumn func(table string, column string) bool) *DatabaseSchema {
+	kept := make(map[string]map[string]bool)
+	result := &DatabaseSchema{}
+	for _, table := range s.Tables {
+		if !keepTable(table.Name) {
+			continue
+		}
+		kept[table.Name] = make(map[string]bool)
+		filtered := TableSchema{Name: table.Name, Comment: table.Comment}
+		for _, column := range table.Columns {
+			if keepColumn(table.Name, column.Name) {
+				kept[table.Name][column.Name] = true
+				filtered.Columns = append(filtered.Columns, column)
+			}
+		}
+		filtered.PrimaryKey, filtered.ForeignKeys = table.PrimaryKey, table.ForeignKeys
+		result.Tables = append(result.Tables, filtered)
+	}
+
+	allKept := func(table string, columns []string) bool {
+		for _, column := range columns {
+			if !kept[table][column] {
+				return false
+			}
+		}
+		return true
+	}
+	for i := range result.Tables {
+		table := &result.Tables[i]
+		if !allKept(table.Name, table.PrimaryKey) {
+			table.PrimaryKey = nil
+		}
+		var foreignKeys []ForeignKey
+		for _, fk := range table.ForeignKeys {
+			if allKept(table.Name, fk.Columns) && allKept(fk.ReferencedTable, fk.ReferencedColumns) {
+				foreignKeys = append(foreignKeys, fk)
+			}
+		}
+		table.ForeignKeys = foreignKeys
+	}
+	return result
+}
+
+// Render formats the schema for the LLM, one line per column with its type, keys and comment:
+//
+//	student -- table comment
+//	  id integer PK
+//	  administrative_class_id integer -> administrative_class(id)
+//	  email character varying(100) -- Email address
+func (s *DatabaseSchema) Render() string {
+	var sb strings.Builder
+	for _, table := range s.Tables {
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(table.Name)
+		if table.Comment != "" {
+			sb.WriteString(" -- " + table.Comment)
+		}
+		sb.WriteString("\n")
+
+		for _, column := range table.Columns {
+			sb.WriteString("  " + column.Name + " " + column.Type)
+			if len(table.PrimaryKey) == 1 && table.PrimaryKey[0] == column.Name {
+				sb.WriteString(" PK")
+			} else if !column.Nullable {
+				sb.WriteString(" NOT NULL")
+			}
+			for _, fk := range table.ForeignKeys {
+				if len(fk.Columns) == 1 && fk.Columns[0] == column.Name {
+					sb.WriteString(fmt.Sprintf(" -> %s(%s)", fk.ReferencedTable, fk.ReferencedColumns[0]))
+				}
+			}
+			if column.Comment != "" {
+				sb.WriteString(" -- " + column.Comment)
+			}
+			sb.WriteString("\n")
+		}
+
+		// The composite keys don't fit on a column line
+		if len(table.PrimaryKey) > 1 {
+			sb.WriteString(fmt.Sprintf("  PK (%s)\n", strings.Join(table.PrimaryKey, ", ")))
+		}
+		for _, fk := range table.ForeignKeys {
+			if len(fk.Columns) > 1 {
+				sb.WriteString(fmt.Sprintf("  (%s) -> %s(%s)\n", strings.Join(fk.Columns, ", "), fk.ReferencedTable, strings.Join(fk.ReferencedColumns, ", ")))
+			}
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// region TestDatabaseSchema
+func TestDatabaseSchema_Render(t *testing.T) {
+	schema := buildDatabaseSchema(
+		[]schemaColumnRow{
+			{TableName: "course", ColumnName: "id", DataType: "integer"},
+			{TableName: "course", ColumnName: "code", DataType: "character varying(10)", Comment: "Course code, e.g., 'CS101'"},
+			{TableName: "course", ColumnName: "prerequisite", DataType: "integer", Nullable: true},
+			{TableName: "course_program", ColumnName: "course_id", DataType: "integer"},
+			{TableName: "course_program", ColumnName: "program_id", DataType: "integer"},
+			{TableName: "student", TableComment: "Students of the university", ColumnName: "id", DataType: "integer"},
+			{TableName: "student", ColumnName: "user_id", DataType: "integer", Nullable: true},
+			{TableName: "user_account", ColumnName: "id", DataType: "integer"},
+		},
+		[]schemaConstraintRow{
+			{TableName: "course", Type: "p", Columns: []string{"id"}},
+			{TableName: "course_program", Type: "p", Columns: []string{"course_id", "program_id"}},
+			{TableName: "course_program", Type: "f", Columns: []string{"course_id"}, ReferencedTable: "course", ReferencedColumns: []string{"id"}},
+			{TableName: "student", Type: "p", Columns: []string{"id"}},
+			{TableName: "student", Type: "f", Columns: []string{"user_id"}, ReferencedTable: "user_account", ReferencedColumns: []string{"id"}},
+			// Constraint of a table which isn't introspected
+			{TableName: "pg_temp", Type: "p", Columns: []string{"id"}},
+		},
+	)
+
+	require.Len(t, schema.Tables, 4)
+	assert.Equal(t, []string{"course_id", "program_id"}, schema.Tables[1].PrimaryKey)
+
+	// The foreign key referencing the removed table is removed as well
+	schema = schema.Filter(
+		func(table string) bool { return table != "user_account" },
+		func(table string, column string) bool { return true },
+	)
+
+	assert.Equal(t, `course
+  id integer PK
+  code character varying(10) NOT NULL -- Course code, e.g., 'CS101'
+  prerequisite integer
+
+course_program
+  course_id integer NOT NULL -> course(id)
+  program_id integer NOT NULL
+  PK (course_id, program_id)
+
+student -- Students of the university
+  id integer PK
+  user_id integer
+`, schema.Render())
+}
+
+func TestAuthorizationServiceImpl_FilterSchema(t *testing.T) {
+	policy, err := ParseAuthorizationPolicy([]byte(`
+public_tables: [course]
+bypass_roles: [admin]
+policies:
+  - table: student
+    role: student
+    columns:
+      - column: id
+        sources: [StudentInfo.ID]
+column_rules:
+  - table: student
+    role: student
+    columns:
+      - column: birthday
+        action: deny
+      - column: email
+        action: mask_partial`), "yaml")
+	require.NoError(t, err)
+	authService := NewAuthorizationServiceImplWithPolicy(&MockSchemaService{}, policy)
+
+	schema := &DatabaseSchema{Tables: []TableSchema{
+		{Name: "course", Columns: []ColumnSchema{{Name: "id"}}, PrimaryKey: []string{"id"}},
+		{Name: "student", Columns: []ColumnSchema{{Name: "id"}, {Name: "birthday"}, {Name: "email"}, {Name: "user_id"}}, PrimaryKey: []string{"id"},
+			ForeignKeys: []ForeignKey{{Columns: []string{"user_id"}, ReferencedTable: "user_account", ReferencedColumns: []string{"id"}}}},
+		{Name: "user_account", Columns: []ColumnSchema{{Name: "id"}, {Name: "password"}}, PrimaryKey: []string{"id"}},
+	}}
+
+	// The student can't read user_account, nor the denied birthday, but the masked email is kept
+	studentSchema := authService.FilterSchema(schema, "student")
+	require.Len(t, studentSchema.Tables, 2)
+	assert.Equal(t, []ColumnSchema{{Name: "id"}, {Name: "email"}, {Name: "user_id"}}, studentSchema.Tables[1].Columns)
+	assert.Empty(t, studentSchema.Tables[1].ForeignKeys)
+
+	// The professor has no policy on student
+	assert.Len(t, authService.FilterSchema(schema, "professor").Tables, 1)
+	assert.Equal(t, schema, authService.FilterSchema(schema, "admin"))
+}
+
+func TestSchemaServiceImpl_GetSchema_Cache(t *testing.T) {
+	cached := &DatabaseSchema{Tables: []TableSchema{{Name: "course"}}}
+	service := NewSchemaServiceImpl(nil)
+	service.schema = cached
+	service.schemaLoadedAt = time.Now()
+
+	schema, err := service.GetSchema(context.Background())
+	require.NoError(t, err)
+	assert.Same(t, cached, schema)
+
+	// The expired schema is loaded again, which fails without database
+	service.schemaLoadedAt = time.Now().Add(-DefaultSchemaTTL)
+	_, err = service.GetSchema(context.Background())
+	assert.Error(t, err)
+
+	service.schemaLoadedAt = time.Now()
+	service.Invalidate()
+	_, err = service.GetSchema(context.Background())
+	assert.Error(t, err)
+}
+
+// endregion
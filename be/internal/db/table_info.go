@@ -167,9 +167,30 @@ func (t *TableInfoV2) getRealColumnInfoFromAlias(colAlias string) *ColumnInfo {
 	return resolvedCol
 }
 
+// getColumnRule returns the column rule of a column alias by following its lineage to the database table.
+// It returns nil if the column isn't protected or can't be resolved.
+func (t *TableInfoV2) getColumnRule(colAlias string) *ColumnRule {
+	curTable := t
+	for curTable != nil && curTable.Columns != nil {
+		col, ok := curTable.Columns.Get(colAlias)
+		if !ok {
+			return nil
+		}
+		if col.Rule != nil || curTable.IsDatabase {
+			return col.Rule
+		}
+		colAlias = col.Name
+		curTable = col.SourceTable
+	}
+	return nil
+}
+
 type ColumnInfo struct {
 	Name        string
 	SourceTable *TableInfoV2
+	// Rule is the column rule protecting the column for the current user.
+	// It is set on the columns of database tables, and on the columns computed from protected columns (e.g. upper(email)).
+	Rule *ColumnRule
 }
 
 // Clone Create a copy of the ColumnInfo instance.
@@ -181,6 +202,7 @@ func (c *ColumnInfo) Clone(sourceTable *TableInfoV2) *ColumnInfo {
 
 	clone := &ColumnInfo{
 		Name: c.Name,
+		Rule: c.Rule,
 	}
 
 	if sourceTable != nil {
@@ -2,15 +2,61 @@ package db
 
 import (
 	"context"
+	"errors"
 	"log"
 	"sync"
 )
 
+// ErrForbidden is returned by the domain services when the user can't access the requested data
+var ErrForbidden = errors.New("you are not allowed to access this data")
+
+// ErrStudentRequired is returned when a professor or an admin asks for the data of a student without its id
+var ErrStudentRequired = errors.New("student_id is required")
+
 type UserInfo struct {
 	ID   int
 	Role string
 }
 
+// Caller is the user of a request: the role and the id in the table of the role, i.e. the student or the professor id
+type Caller struct {
+	Role       string
+	SpecificID int
+}
+
+// CallerFrom reads the caller from the "userRole" and "specificId" values of the context
+func CallerFrom(ctx context.Context) Caller {
+	role, _ := ctx.Value("userRole").(string)
+	specificId, _ := ctx.Value("specificId").(int)
+	return Caller{Role: role, SpecificID: specificId}
+}
+
+// StudentScope is the student whose data the caller asked for, with the course classes of the student the caller can see
+type StudentScope struct {
+	StudentID int
+	// ClassIDs are the course classes the caller can see, nil if the caller can see all of them.
+	// E.g. a professor who teaches the student without advising them only sees the classes they teach.
+	ClassIDs []int
+}
+
+// Full reports whether the caller can see every course class of the student
+func (s StudentScope) Full() bool {
+	return s.ClassIDs == nil
+}
+
+// Includes reports whether the caller can see the course class of the student
+func (s StudentScope) Includes(classId int) bool {
+	if s.Full() {
+		return true
+	}
+	for _, id := range s.ClassIDs {
+		if id == classId {
+			return true
+		}
+	}
+	return false
+}
+
 type StudentInfo struct {
 	UserInfo
 	AdministrativeClassID  int
@@ -26,6 +72,8 @@ type ProfessorInfo struct {
 	TaughtCourseClassIDs []int
 	TaughtScheduleIDs    []int
 	AdvisedStudentIDs    []int
+	// AdvisedEnrollmentIDs are the course class enrollments of the advised students
+	AdvisedEnrollmentIDs []int
 	TaughtStudentIDs     []int
 }
 
@@ -92,7 +140,7 @@ func (db *SQLHDb) FetchProfessorInfo(ctx context.Context, specificUserID int) (*
 	info.UserInfo.Role = "professor"
 
 	var wg sync.WaitGroup
-	wg.Add(5)
+	wg.Add(6)
 	go func() {
 		defer wg.Done()
 		err := db.SelectContext(ctx, &info.TaughtStudentIDs, `select distinct cce.id
@@ -155,6 +203,20 @@ where csi.professor_id = $1`, specificUserID)
 			return
 		}
 	}()
+
+	go func() {
+		defer wg.Done()
+		err := db.SelectContext(ctx, &info.AdvisedEnrollmentIDs,
+			`select cce.id
+			from course_class_enrollment cce
+			inner join student s on cce.student_id = s.id
+			inner join administrative_class ac on s.administrative_class_id = ac.id
+			where ac.advisor_id = $1`, specificUserID)
+		if err != nil {
+			log.Println("Error fetching advised enrollment IDs:", err)
+			return
+		}
+	}()
 	wg.Wait()
 	return &info, nil
 }
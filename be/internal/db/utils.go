@@ -33,3 +33,16 @@ func ContainsString(slice []string, val string) bool {
 	}
 	return false
 }
+
+// uniqueInts returns the values of the slice without duplicates, keeping the original order
+func uniqueInts(slice []int) []int {
+	seen := make(map[int]bool, len(slice))
+	result := make([]int, 0, len(slice))
+	for _, item := range slice {
+		if !seen[item] {
+			seen[item] = true
+			result = append(result, item)
+		}
+	}
+	return result
+}
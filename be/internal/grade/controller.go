@@ -0,0 +1,49 @@
+package grade
+
+import (
+	"HNLP/be/internal/auth"
+	"HNLP/be/internal/db"
+	"HNLP/be/internal/middleware"
+	"errors"
+	"github.com/gin-gonic/gin"
+)
+
+type Controller struct {
+	service Service
+}
+
+func NewController(service Service) *Controller {
+	return &Controller{service: service}
+}
+
+// GetGpa returns the GPA of a student, e.g. /api/v1/grades/gpa?student_id=1&semester=2024-2025-1
+func (c *Controller) GetGpa(ctx *gin.Context) {
+	var request GetGpaRequest
+	if err := ctx.ShouldBindQuery(&request); err != nil {
+		ctx.JSON(400, gin.H{"error": "invalid request"})
+		return
+	}
+
+	// The services read the caller from the context like for the chatbot tools
+	reqCtx := middleware.RequestContext(ctx)
+
+	response, err := c.service.GetGpa(reqCtx, request)
+	if errors.Is(err, db.ErrForbidden) {
+		ctx.JSON(403, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, db.ErrStudentRequired) || errors.Is(err, ErrInvalidSemester) {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(500, gin.H{"error": "failed to get GPA"})
+		return
+	}
+
+	ctx.JSON(200, response)
+}
+
+func (c *Controller) RegisterRoutes(router *gin.Engine, jwtService *auth.ServiceImpl) {
+	router.GET("/api/v1/grades/gpa", middleware.Authenticate(jwtService), c.GetGpa)
+}
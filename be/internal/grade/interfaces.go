@@ -0,0 +1,80 @@
+package grade
+
+import (
+	"HNLP/be/internal/db"
+	"context"
+	"errors"
+)
+
+// ErrInvalidSemester is returned when the semester asked can't be resolved
+var ErrInvalidSemester = errors.New("invalid semester")
+
+type Service interface {
+	GetGpa(ctx context.Context, req GetGpaRequest) (GetGpaResponse, error)
+	ConvertGrade(ctx context.Context, req ConvertGradeRequest) (ConvertGradeResponse, error)
+}
+
+type Repository interface {
+	// GetAttempts returns the course classes taken by the student ordered by semester
+	GetAttempts(ctx context.Context, studentId int) ([]Attempt, error)
+}
+
+// StudentAccess checks that the caller can access the data of a student, course.ServiceImpl implements it
+type StudentAccess interface {
+	// StudentScope returns the student asked by the caller, the caller themselves for a student by default,
+	// with the course classes of the student the caller can see
+	StudentScope(ctx context.Context, studentId *int) (db.StudentScope, error)
+}
+
+type GetGpaRequest struct {
+	StudentId *int   `json:"student_id,omitempty" form:"student_id" jsonschema:"description=Id of the student, the current student by default,minimum=1"`
+	Semester  string `json:"semester,omitempty" form:"semester" jsonschema:"description=The semester or the academic year mentioned by the user, e.g. 'kỳ trước', 'năm học 2023-2024' or a code like '2024-2025-1'. Every semester is returned if empty"`
+}
+
+type GetGpaResponse struct {
+	StudentID int `json:"student_id"`
+	// Semesters are the semesters asked which have grades
+	Semesters []SemesterGpa `json:"semesters"`
+	// Cumulative is the GPA of all the semesters up to the last semester asked, with the best attempt of the retaken courses
+	Cumulative Gpa `json:"cumulative"`
+}
+
+// Gpa is a GPA on the 4-point scale weighted by the credits of the courses
+type Gpa struct {
+	Gpa float64 `json:"gpa"`
+	// Credits are the credits counted in the GPA and PassedCredits the ones of the passed courses
+	Credits       int `json:"credits"`
+	PassedCredits int `json:"passed_credits"`
+}
+
+type SemesterGpa struct {
+	Semester string `json:"semester"`
+	Gpa
+	Courses []CourseGrade `json:"courses"`
+}
+
+// CourseGrade is a graded attempt of a course converted to the scale
+type CourseGrade struct {
+	CourseCode string   `json:"course_code"`
+	CourseName string   `json:"course_name"`
+	ClassCode  string   `json:"class_code"`
+	Credits    int      `json:"credits"`
+	FinalGrade *float64 `json:"final_grade,omitempty"`
+	Letter     string   `json:"letter"`
+	Points     float64  `json:"points"`
+	// Superseded is true if a better attempt of the course replaces it in the cumulative GPA
+	Superseded bool `json:"superseded,omitempty"`
+}
+
+type ConvertGradeRequest struct {
+	// One of the grades is given
+	FinalGrade *float64 `json:"final_grade,omitempty" jsonschema:"description=Grade on the 10-point scale,minimum=0,maximum=10"`
+	Letter     *string  `json:"letter,omitempty" jsonschema:"description=Letter grade, e.g. B+"`
+	Points     *float64 `json:"points,omitempty" jsonschema:"description=Grade on the 4-point scale,minimum=0,maximum=4"`
+}
+
+type ConvertGradeResponse struct {
+	Band
+	// Scale is the whole grading scale of the university
+	Scale []Band `json:"scale"`
+}
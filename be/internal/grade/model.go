@@ -0,0 +1,140 @@
+package grade
+
+import (
+	"HNLP/be/internal/config"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Band is a grade of the university scale: its letter, the lowest 10-point grade of the band and its 4-point grade
+type Band struct {
+	Letter string  `json:"letter"`
+	Min    float64 `json:"min"`
+	Points float64 `json:"points"`
+}
+
+// Passed tells if the grade passes the course, only the bands worth 0 points fail it
+func (b Band) Passed() bool {
+	return b.Points > 0
+}
+
+// DefaultScale is the grading scale of VNU
+var DefaultScale = []config.GradeBandConfig{
+	{Letter: "A+", Min: 9.0, Points: 4.0},
+	{Letter: "A", Min: 8.5, Points: 3.7},
+	{Letter: "B+", Min: 8.0, Points: 3.5},
+	{Letter: "B", Min: 7.0, Points: 3.0},
+	{Letter: "C+", Min: 6.5, Points: 2.5},
+	{Letter: "C", Min: 5.5, Points: 2.0},
+	{Letter: "D+", Min: 5.0, Points: 1.5},
+	{Letter: "D", Min: 4.0, Points: 1.0},
+	{Letter: "F", Min: 0, Points: 0},
+}
+
+// Scale converts the grades between the 10-point, letter and 4-point scales
+type Scale struct {
+	// bands are sorted by Min descending
+	bands []Band
+}
+
+// NewScale builds the scale of the bands, the DefaultScale if there is none
+func NewScale(bands []config.GradeBandConfig) Scale {
+	if len(bands) == 0 {
+		bands = DefaultScale
+	}
+	scale := Scale{bands: make([]Band, 0, len(bands))}
+	for _, band := range bands {
+		scale.bands = append(scale.bands, Band{Letter: strings.TrimSpace(band.Letter), Min: band.Min, Points: band.Points})
+	}
+	sort.SliceStable(scale.bands, func(i, j int) bool {
+		return scale.bands[i].Min > scale.bands[j].Min
+	})
+	return scale
+}
+
+// Bands returns the bands from the highest to the lowest
+func (s Scale) Bands() []Band {
+	return append([]Band(nil), s.bands...)
+}
+
+// FromTen returns the band of a 10-point grade rounded to one decimal, the lowest band if it is below all of them
+func (s Scale) FromTen(grade float64) Band {
+	grade = math.Round(grade*10) / 10
+	for _, band := range s.bands {
+		if grade >= band.Min {
+			return band
+		}
+	}
+	return s.bands[len(s.bands)-1]
+}
+
+// FromLetter returns the band of a letter grade, false if the letter isn't in the scale
+func (s Scale) FromLetter(letter string) (Band, bool) {
+	letter = strings.TrimSpace(letter)
+	for _, band := range s.bands {
+		if strings.EqualFold(band.Letter, letter) {
+			return band, true
+		}
+	}
+	return Band{}, false
+}
+
+// FromPoints returns the highest band worth at most the 4-point grade
+func (s Scale) FromPoints(points float64) Band {
+	for _, band := range s.bands {
+		if points >= band.Points {
+			return band
+		}
+	}
+	return s.bands[len(s.bands)-1]
+}
+
+// Convert returns the band of the grades of an attempt: from its 10-point grade, else its letter, else its 4-point grade.
+// It returns false if the attempt isn't graded yet.
+func (s Scale) Convert(finalGrade *float64, letter *string, points *float64) (Band, bool) {
+	if finalGrade != nil {
+		return s.FromTen(*finalGrade), true
+	}
+	if letter != nil {
+		if band, ok := s.FromLetter(*letter); ok {
+			return band, true
+		}
+	}
+	if points != nil {
+		return s.FromPoints(*points), true
+	}
+	return Band{}, false
+}
+
+// CourseStatuses returns the courses passed by an attempt and the courses taken from the current semester without grade yet
+func (s Scale) CourseStatuses(attempts []Attempt, current string) (passed map[string]bool, inProgress map[string]bool) {
+	passed = make(map[string]bool)
+	inProgress = make(map[string]bool)
+	for _, attempt := range attempts {
+		band, graded := s.Convert(attempt.FinalGrade, attempt.Grade, attempt.GPA)
+		if graded && band.Passed() {
+			passed[attempt.CourseCode] = true
+		} else if !graded && attempt.Semester >= current {
+			inProgress[attempt.CourseCode] = true
+		}
+	}
+	for code := range passed {
+		delete(inProgress, code)
+	}
+	return passed, inProgress
+}
+
+// Attempt is a course class taken by a student with its grades
+type Attempt struct {
+	ClassID        int      `db:"course_class_id"`
+	Semester       string   `db:"semester_id"`
+	ClassCode      string   `db:"class_code"`
+	CourseCode     string   `db:"course_code"`
+	CourseName     string   `db:"course_name"`
+	Credits        int      `db:"credits"`
+	EnrollmentType *string  `db:"enrollment_type"`
+	FinalGrade     *float64 `db:"final_grade"`
+	Grade          *string  `db:"grade"`
+	GPA            *float64 `db:"gpa"`
+}
@@ -0,0 +1,34 @@
+package grade
+
+import (
+	"HNLP/be/internal/db"
+	"context"
+)
+
+type RepositoryImpl struct {
+	db db.HDb
+}
+
+func NewRepositoryImpl(db db.HDb) *RepositoryImpl {
+	return &RepositoryImpl{db: db}
+}
+
+func (r *RepositoryImpl) GetAttempts(ctx context.Context, studentId int) ([]Attempt, error) {
+	var attempts []Attempt
+	err := r.db.SelectContext(ctx, &attempts, `SELECT cc.id                  AS course_class_id,
+       cc.semester_id,
+       cc.code                AS class_code,
+       c.code                 AS course_code,
+       COALESCE(c.name, '')   AS course_name,
+       COALESCE(c.credits, 0) AS credits,
+       cce.enrollment_type,
+       cce.final_grade,
+       cce.grade,
+       cce.gpa
+FROM course_class_enrollment cce
+         JOIN course_class cc ON cc.id = cce.course_class_id
+         JOIN course c ON c.id = cc.course_id
+WHERE cce.student_id = $1
+ORDER BY cc.semester_id, c.code`, studentId)
+	return attempts, err
+}
@@ -0,0 +1,192 @@
+package grade
+
+import (
+	"HNLP/be/internal/config"
+	"HNLP/be/internal/semester"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+type ServiceImpl struct {
+	repo        Repository
+	students    StudentAccess
+	semesterSrv semester.Service
+	scale       Scale
+	// excludedTypes are the lowercase enrollment types left out of the GPA
+	excludedTypes map[string]bool
+}
+
+func NewServiceImpl(repo Repository, students StudentAccess, semesterSrv semester.Service, cfg config.GradeConfig) *ServiceImpl {
+	excludedTypes := make(map[string]bool, len(cfg.ExcludedEnrollmentTypes))
+	for _, enrollmentType := range cfg.ExcludedEnrollmentTypes {
+		excludedTypes[strings.ToLower(strings.TrimSpace(enrollmentType))] = true
+	}
+	return &ServiceImpl{
+		repo:          repo,
+		students:      students,
+		semesterSrv:   semesterSrv,
+		scale:         NewScale(cfg.Scale),
+		excludedTypes: excludedTypes,
+	}
+}
+
+// GetGpa returns the credit-weighted GPA of a student in the semesters asked and the cumulative GPA at the end of the last one.
+// The semester GPA counts every attempt of the semester while the cumulative GPA only counts the best attempt of each course.
+// A professor who doesn't advise the student only gets the GPA of the classes they teach to the student.
+func (s *ServiceImpl) GetGpa(ctx context.Context, req GetGpaRequest) (GetGpaResponse, error) {
+	scope, err := s.students.StudentScope(ctx, req.StudentId)
+	if err != nil {
+		return GetGpaResponse{}, err
+	}
+	studentId := scope.StudentID
+	var semesters []string
+	if strings.TrimSpace(req.Semester) != "" {
+		resolved, err := s.semesterSrv.ResolveSemester(ctx, semester.ResolveSemesterRequest{Expression: req.Semester})
+		if err != nil {
+			return GetGpaResponse{}, fmt.Errorf("%w: %v", ErrInvalidSemester, err)
+		}
+		for _, sem := range resolved.Semesters {
+			semesters = append(semesters, sem.Code)
+		}
+	}
+	attempts, err := s.repo.GetAttempts(ctx, studentId)
+	if err != nil {
+		return GetGpaResponse{}, err
+	}
+	if !scope.Full() {
+		visible := make([]Attempt, 0, len(attempts))
+		for _, attempt := range attempts {
+			if scope.Includes(attempt.ClassID) {
+				visible = append(visible, attempt)
+			}
+		}
+		attempts = visible
+	}
+
+	graded := s.gradedAttempts(attempts)
+	if len(semesters) == 0 {
+		for _, attempt := range graded {
+			if len(semesters) == 0 || semesters[len(semesters)-1] != attempt.Semester {
+				semesters = append(semesters, attempt.Semester)
+			}
+		}
+	}
+	response := GetGpaResponse{StudentID: studentId, Semesters: []SemesterGpa{}}
+	if len(semesters) == 0 {
+		return response, nil
+	}
+
+	// The semester codes sort chronologically
+	last := semesters[0]
+	for _, code := range semesters {
+		if code > last {
+			last = code
+		}
+	}
+	best := make(map[string]int)
+	for i, attempt := range graded {
+		if attempt.Semester > last {
+			break
+		}
+		// The latest attempt wins a tie
+		if j, ok := best[attempt.CourseCode]; !ok || attempt.Points >= graded[j].Points {
+			best[attempt.CourseCode] = i
+		}
+	}
+	var cumulative []CourseGrade
+	for i := range graded {
+		if graded[i].Semester > last {
+			break
+		}
+		if best[graded[i].CourseCode] == i {
+			cumulative = append(cumulative, graded[i].CourseGrade)
+		} else {
+			graded[i].Superseded = true
+		}
+	}
+	response.Cumulative = weightedGpa(cumulative)
+
+	for _, code := range semesters {
+		semesterGpa := SemesterGpa{Semester: code}
+		for _, attempt := range graded {
+			if attempt.Semester == code {
+				semesterGpa.Courses = append(semesterGpa.Courses, attempt.CourseGrade)
+			}
+		}
+		if len(semesterGpa.Courses) == 0 {
+			continue
+		}
+		semesterGpa.Gpa = weightedGpa(semesterGpa.Courses)
+		response.Semesters = append(response.Semesters, semesterGpa)
+	}
+	return response, nil
+}
+
+// ConvertGrade converts a grade given on the 10-point, letter or 4-point scale to the other scales
+func (s *ServiceImpl) ConvertGrade(ctx context.Context, req ConvertGradeRequest) (ConvertGradeResponse, error) {
+	if req.FinalGrade == nil && req.Points == nil && (req.Letter == nil || strings.TrimSpace(*req.Letter) == "") {
+		return ConvertGradeResponse{}, errors.New("final_grade, letter or points is required")
+	}
+	if req.FinalGrade == nil && req.Letter != nil {
+		if _, ok := s.scale.FromLetter(*req.Letter); !ok {
+			return ConvertGradeResponse{}, fmt.Errorf("unknown letter grade %q", *req.Letter)
+		}
+	}
+	band, _ := s.scale.Convert(req.FinalGrade, req.Letter, req.Points)
+	return ConvertGradeResponse{Band: band, Scale: s.scale.Bands()}, nil
+}
+
+// ------------------Private helper function------------------
+
+// gradedAttempt is an attempt counted in the GPA with the semester it was taken in
+type gradedAttempt struct {
+	Semester string
+	CourseGrade
+}
+
+// gradedAttempts converts the attempts to the scale, leaving out the excluded enrollment types and the attempts without grade
+func (s *ServiceImpl) gradedAttempts(attempts []Attempt) []gradedAttempt {
+	var graded []gradedAttempt
+	for _, attempt := range attempts {
+		if attempt.EnrollmentType != nil && s.excludedTypes[strings.ToLower(strings.TrimSpace(*attempt.EnrollmentType))] {
+			continue
+		}
+		band, ok := s.scale.Convert(attempt.FinalGrade, attempt.Grade, attempt.GPA)
+		if !ok {
+			continue
+		}
+		graded = append(graded, gradedAttempt{
+			Semester: attempt.Semester,
+			CourseGrade: CourseGrade{
+				CourseCode: attempt.CourseCode,
+				CourseName: attempt.CourseName,
+				ClassCode:  attempt.ClassCode,
+				Credits:    attempt.Credits,
+				FinalGrade: attempt.FinalGrade,
+				Letter:     band.Letter,
+				Points:     band.Points,
+			},
+		})
+	}
+	return graded
+}
+
+// weightedGpa averages the 4-point grades weighted by the credits, rounded to two decimals
+func weightedGpa(courses []CourseGrade) Gpa {
+	var gpa Gpa
+	var total float64
+	for _, course := range courses {
+		gpa.Credits += course.Credits
+		total += course.Points * float64(course.Credits)
+		if course.Points > 0 {
+			gpa.PassedCredits += course.Credits
+		}
+	}
+	if gpa.Credits > 0 {
+		gpa.Gpa = math.Round(total/float64(gpa.Credits)*100) / 100
+	}
+	return gpa
+}
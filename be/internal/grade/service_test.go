@@ -0,0 +1,200 @@
+package grade_test
+
+import (
+	"HNLP/be/internal/config"
+	"HNLP/be/internal/db"
+	"HNLP/be/internal/grade"
+	"HNLP/be/internal/semester"
+	"HNLP/be/internal/testutil"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+var testGradeCfg = config.GradeConfig{ExcludedEnrollmentTypes: []string{"Miễn học"}}
+
+// testAttempts has a failed course retaken, a course retaken with a worse grade, an exempted course and an ungraded class
+var testAttempts = []grade.Attempt{
+	{ClassID: 1, Semester: "2023-2024-1", ClassCode: "INT1008 1", CourseCode: "INT1008", Credits: 3, FinalGrade: floatPtr(6.0)},
+	{ClassID: 2, Semester: "2023-2024-1", ClassCode: "MAT1093 2", CourseCode: "MAT1093", Credits: 4, FinalGrade: floatPtr(3.0)},
+	{ClassID: 3, Semester: "2023-2024-1", ClassCode: "PES1015 1", CourseCode: "PES1015", Credits: 1, EnrollmentType: strPtr("Miễn học"), FinalGrade: floatPtr(9.0)},
+	{ClassID: 4, Semester: "2023-2024-2", ClassCode: "INT2210 1", CourseCode: "INT2210", Credits: 3, Grade: strPtr("A")},
+	{ClassID: 5, Semester: "2023-2024-2", ClassCode: "MAT1093 1", CourseCode: "MAT1093", Credits: 4, FinalGrade: floatPtr(8.0), Grade: strPtr("B+")},
+	{ClassID: 6, Semester: "2023-2024-2", ClassCode: "INT2211 1", CourseCode: "INT2211", Credits: 4},
+	{ClassID: 7, Semester: "2024-2025-1", ClassCode: "INT1008 3", CourseCode: "INT1008", Credits: 3, FinalGrade: floatPtr(5.0)},
+}
+
+func TestScale_Convert(t *testing.T) {
+	vnu := grade.NewScale(nil)
+	// A pass/fail scale given out of order
+	custom := grade.NewScale([]config.GradeBandConfig{{Letter: "F", Min: 0, Points: 0}, {Letter: "P", Min: 5, Points: 4}})
+
+	tests := []struct {
+		name       string
+		scale      grade.Scale
+		finalGrade *float64
+		letter     *string
+		points     *float64
+		expected   grade.Band
+		graded     bool
+	}{
+		{name: "10-point grade", scale: vnu, finalGrade: floatPtr(8.7), expected: grade.Band{Letter: "A", Min: 8.5, Points: 3.7}, graded: true},
+		{name: "10-point grade rounded to one decimal", scale: vnu, finalGrade: floatPtr(8.45), expected: grade.Band{Letter: "A", Min: 8.5, Points: 3.7}, graded: true},
+		{name: "Failed", scale: vnu, finalGrade: floatPtr(3.9), expected: grade.Band{Letter: "F", Min: 0, Points: 0}, graded: true},
+		{name: "10-point grade first", scale: vnu, finalGrade: floatPtr(7.2), letter: strPtr("A+"), expected: grade.Band{Letter: "B", Min: 7, Points: 3}, graded: true},
+		{name: "Letter", scale: vnu, letter: strPtr(" b+"), expected: grade.Band{Letter: "B+", Min: 8, Points: 3.5}, graded: true},
+		{name: "Unknown letter falls back to the 4-point grade", scale: vnu, letter: strPtr("I"), points: floatPtr(3.2), expected: grade.Band{Letter: "B", Min: 7, Points: 3}, graded: true},
+		{name: "Not graded", scale: vnu, letter: strPtr("I")},
+		{name: "Custom scale", scale: custom, finalGrade: floatPtr(6), expected: grade.Band{Letter: "P", Min: 5, Points: 4}, graded: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			band, graded := tt.scale.Convert(tt.finalGrade, tt.letter, tt.points)
+			assert.Equal(t, tt.graded, graded)
+			assert.Equal(t, tt.expected, band)
+		})
+	}
+}
+
+func TestServiceImpl_GetGpa(t *testing.T) {
+	semester1 := grade.SemesterGpa{
+		Semester: "2023-2024-1",
+		Gpa:      grade.Gpa{Gpa: 0.86, Credits: 7, PassedCredits: 3},
+		Courses: []grade.CourseGrade{
+			{CourseCode: "INT1008", ClassCode: "INT1008 1", Credits: 3, FinalGrade: floatPtr(6.0), Letter: "C", Points: 2},
+			{CourseCode: "MAT1093", ClassCode: "MAT1093 2", Credits: 4, FinalGrade: floatPtr(3.0), Letter: "F", Points: 0, Superseded: true},
+		},
+	}
+	semester2 := grade.SemesterGpa{
+		Semester: "2023-2024-2",
+		Gpa:      grade.Gpa{Gpa: 3.59, Credits: 7, PassedCredits: 7},
+		Courses: []grade.CourseGrade{
+			{CourseCode: "INT2210", ClassCode: "INT2210 1", Credits: 3, Letter: "A", Points: 3.7},
+			{CourseCode: "MAT1093", ClassCode: "MAT1093 1", Credits: 4, FinalGrade: floatPtr(8.0), Letter: "B+", Points: 3.5},
+		},
+	}
+	semester3 := grade.SemesterGpa{
+		Semester: "2024-2025-1",
+		Gpa:      grade.Gpa{Gpa: 1.5, Credits: 3, PassedCredits: 3},
+		Courses: []grade.CourseGrade{
+			{CourseCode: "INT1008", ClassCode: "INT1008 3", Credits: 3, FinalGrade: floatPtr(5.0), Letter: "D+", Points: 1.5, Superseded: true},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		req      grade.GetGpaRequest
+		scope    db.StudentScope
+		resolved []semester.Semester
+		expected grade.GetGpaResponse
+	}{
+		{
+			name: "Every semester",
+			req:  grade.GetGpaRequest{},
+			expected: grade.GetGpaResponse{
+				StudentID:  5,
+				Semesters:  []grade.SemesterGpa{semester1, semester2, semester3},
+				Cumulative: grade.Gpa{Gpa: 3.11, Credits: 10, PassedCredits: 10},
+			},
+		},
+		{
+			name:     "Cumulative up to the semester",
+			req:      grade.GetGpaRequest{Semester: "kỳ 2 năm học 2023-2024"},
+			resolved: []semester.Semester{{Code: "2023-2024-2"}},
+			expected: grade.GetGpaResponse{
+				StudentID:  5,
+				Semesters:  []grade.SemesterGpa{semester2},
+				Cumulative: grade.Gpa{Gpa: 3.11, Credits: 10, PassedCredits: 10},
+			},
+		},
+		{
+			name:     "Semester without grades",
+			req:      grade.GetGpaRequest{Semester: "2022-2023-2"},
+			resolved: []semester.Semester{{Code: "2022-2023-2"}},
+			expected: grade.GetGpaResponse{StudentID: 5, Semesters: []grade.SemesterGpa{}},
+		},
+		{
+			name:  "Classes taught by a professor who doesn't advise the student",
+			req:   grade.GetGpaRequest{StudentId: intPtr(5)},
+			scope: db.StudentScope{StudentID: 5, ClassIDs: []int{4}},
+			expected: grade.GetGpaResponse{
+				StudentID: 5,
+				Semesters: []grade.SemesterGpa{{
+					Semester: "2023-2024-2",
+					Gpa:      grade.Gpa{Gpa: 3.7, Credits: 3, PassedCredits: 3},
+					Courses:  []grade.CourseGrade{{CourseCode: "INT2210", ClassCode: "INT2210 1", Credits: 3, Letter: "A", Points: 3.7}},
+				}},
+				Cumulative: grade.Gpa{Gpa: 3.7, Credits: 3, PassedCredits: 3},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &testutil.MockGradeRepository{}
+			repo.On("GetAttempts", mock.Anything, 5).Return(testAttempts, nil)
+			students := &testutil.MockStudentAccess{}
+			scope := tt.scope
+			if scope.StudentID == 0 {
+				scope = db.StudentScope{StudentID: 5}
+			}
+			students.On("StudentScope", mock.Anything, tt.req.StudentId).Return(scope, nil)
+			semesterSrv := &testutil.MockSemesterService{}
+			semesterSrv.On("ResolveSemester", mock.Anything, semester.ResolveSemesterRequest{Expression: tt.req.Semester}).
+				Return(semester.ResolveSemesterResponse{Semesters: tt.resolved}, nil).Maybe()
+
+			response, err := grade.NewServiceImpl(repo, students, semesterSrv, testGradeCfg).GetGpa(context.Background(), tt.req)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, response)
+		})
+	}
+
+	t.Run("Forbidden", func(t *testing.T) {
+		students := &testutil.MockStudentAccess{}
+		students.On("StudentScope", mock.Anything, intPtr(9)).Return(db.StudentScope{}, db.ErrForbidden)
+
+		_, err := grade.NewServiceImpl(&testutil.MockGradeRepository{}, students, &testutil.MockSemesterService{}, testGradeCfg).GetGpa(context.Background(), grade.GetGpaRequest{StudentId: intPtr(9)})
+		assert.ErrorIs(t, err, db.ErrForbidden)
+	})
+
+	t.Run("Invalid semester", func(t *testing.T) {
+		students := &testutil.MockStudentAccess{}
+		students.On("StudentScope", mock.Anything, (*int)(nil)).Return(db.StudentScope{StudentID: 5}, nil)
+		semesterSrv := &testutil.MockSemesterService{}
+		semesterSrv.On("ResolveSemester", mock.Anything, mock.Anything).Return(semester.ResolveSemesterResponse{}, errors.New("semester 2030-2031-1 not found"))
+
+		_, err := grade.NewServiceImpl(&testutil.MockGradeRepository{}, students, semesterSrv, testGradeCfg).GetGpa(context.Background(), grade.GetGpaRequest{Semester: "2030-2031-1"})
+		assert.ErrorIs(t, err, grade.ErrInvalidSemester)
+	})
+}
+
+func TestServiceImpl_ConvertGrade(t *testing.T) {
+	service := grade.NewServiceImpl(&testutil.MockGradeRepository{}, &testutil.MockStudentAccess{}, &testutil.MockSemesterService{}, testGradeCfg)
+
+	response, err := service.ConvertGrade(context.Background(), grade.ConvertGradeRequest{FinalGrade: floatPtr(6.5)})
+	require.NoError(t, err)
+	assert.Equal(t, grade.Band{Letter: "C+", Min: 6.5, Points: 2.5}, response.Band)
+	assert.Len(t, response.Scale, len(grade.DefaultScale))
+
+	_, err = service.ConvertGrade(context.Background(), grade.ConvertGradeRequest{Letter: strPtr("E")})
+	assert.EqualError(t, err, `unknown letter grade "E"`)
+
+	_, err = service.ConvertGrade(context.Background(), grade.ConvertGradeRequest{})
+	assert.Error(t, err)
+}
+
+func floatPtr(value float64) *float64 {
+	return &value
+}
+
+func strPtr(value string) *string {
+	return &value
+}
+
+func intPtr(value int) *int {
+	return &value
+}
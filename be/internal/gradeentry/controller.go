@@ -0,0 +1,107 @@
+package gradeentry
+
+import (
+	"HNLP/be/internal/auth"
+	"HNLP/be/internal/db"
+	"HNLP/be/internal/middleware"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"io"
+	"strconv"
+)
+
+type Controller struct {
+	service Service
+}
+
+func NewController(service Service) *Controller {
+	return &Controller{service: service}
+}
+
+// UploadGrades enters the grades of a class from a multipart form with the "file" sheet, the "reason" of the change,
+// the optional "semester" and "dry_run", e.g. POST /api/v1/classes/INT3306%201/grades
+func (c *Controller) UploadGrades(ctx *gin.Context) {
+	header, err := ctx.FormFile("file")
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": "the grade file is missing"})
+		return
+	}
+	if header.Size > MaxFileSize {
+		ctx.JSON(413, gin.H{"error": "the grade file is too large"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": "failed to read the grade file"})
+		return
+	}
+	defer file.Close()
+	content, err := io.ReadAll(io.LimitReader(file, MaxFileSize))
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": "failed to read the grade file"})
+		return
+	}
+	dryRun := false
+	if value := ctx.PostForm("dry_run"); value != "" {
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			ctx.JSON(400, gin.H{"error": "invalid dry_run"})
+			return
+		}
+	}
+
+	response, err := c.service.UploadGrades(middleware.RequestContext(ctx), UploadGradesRequest{
+		ClassCode: ctx.Param("class_code"),
+		Semester:  ctx.PostForm("semester"),
+		FileName:  header.Filename,
+		Content:   content,
+		Reason:    ctx.PostForm("reason"),
+		DryRun:    dryRun,
+	})
+	if err != nil {
+		c.writeError(ctx, err)
+		return
+	}
+	// The report of the invalid rows is returned with the error status, nothing was saved
+	if response.Invalid > 0 {
+		ctx.JSON(422, response)
+		return
+	}
+	ctx.JSON(200, response)
+}
+
+// GetGradeHistory returns the grade changes of a class, e.g. /api/v1/classes/INT3306%201/grades/history?semester=2024-2025-2
+func (c *Controller) GetGradeHistory(ctx *gin.Context) {
+	var request GetGradeHistoryRequest
+	if err := ctx.ShouldBindQuery(&request); err != nil {
+		ctx.JSON(400, gin.H{"error": "invalid request"})
+		return
+	}
+	request.ClassCode = ctx.Param("class_code")
+
+	response, err := c.service.GetGradeHistory(middleware.RequestContext(ctx), request)
+	if err != nil {
+		c.writeError(ctx, err)
+		return
+	}
+	ctx.JSON(200, response)
+}
+
+func (c *Controller) RegisterRoutes(router *gin.Engine, jwtService *auth.ServiceImpl) {
+	router.POST("/api/v1/classes/:class_code/grades", middleware.Authenticate(jwtService), middleware.HasAnyRole("professor"), c.UploadGrades)
+	router.GET("/api/v1/classes/:class_code/grades/history", middleware.Authenticate(jwtService), middleware.HasAnyRole("professor"), c.GetGradeHistory)
+}
+
+// ------------------Private helper function------------------
+
+func (c *Controller) writeError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, db.ErrForbidden), errors.Is(err, ErrGradesLocked):
+		ctx.JSON(403, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrClassNotFound):
+		ctx.JSON(404, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrReasonRequired), errors.Is(err, ErrInvalidFile):
+		ctx.JSON(400, gin.H{"error": err.Error()})
+	default:
+		ctx.JSON(500, gin.H{"error": "failed to process the grades"})
+	}
+}
@@ -0,0 +1,78 @@
+package gradeentry
+
+import (
+	"HNLP/be/internal/db"
+	"context"
+	"errors"
+)
+
+var (
+	ErrClassNotFound = errors.New("course class not found")
+	// ErrGradesLocked is returned to the professors after the grade deadline of the semester
+	ErrGradesLocked   = errors.New("the grades are locked")
+	ErrReasonRequired = errors.New("the reason of the change is required")
+	// ErrInvalidFile is returned when the uploaded file can't be read as a grade sheet
+	ErrInvalidFile = errors.New("invalid grade file")
+)
+
+// Professors loads the classes taught by a professor
+type Professors interface {
+	FetchProfessorInfo(ctx context.Context, specificUserID int) (*db.ProfessorInfo, error)
+}
+
+type Repository interface {
+	// GetClass returns the class with the code in the semester
+	GetClass(ctx context.Context, code string, semester string) (Class, error)
+	// GetHistory returns the grade changes of the class, the latest first
+	GetHistory(ctx context.Context, classId int) ([]Change, error)
+	// Transaction runs fn in a transaction, committed if fn returns no error and rolled back otherwise
+	Transaction(ctx context.Context, fn func(tx Tx) error) error
+}
+
+// Tx is the grade data read and written in a transaction
+type Tx interface {
+	// GetEnrollments returns the enrollments of the class and locks them until the end of the transaction
+	GetEnrollments(ctx context.Context, classId int) ([]Enrollment, error)
+	UpdateGrades(ctx context.Context, enrollment Enrollment) error
+	InsertChange(ctx context.Context, change Change) error
+}
+
+type UploadGradesRequest struct {
+	ClassCode string
+	Semester  string
+	// FileName is the name of the uploaded file, its extension tells if it is a CSV or an XLSX file
+	FileName string
+	Content  []byte
+	Reason   string
+	// DryRun validates the file without saving the grades
+	DryRun bool
+}
+
+type UploadGradesResponse struct {
+	ClassCode string `json:"class_code"`
+	Semester  string `json:"semester"`
+	DryRun    bool   `json:"dry_run"`
+	// Saved is false if a row is invalid, the grades are only saved if every row is valid
+	Saved     bool        `json:"saved"`
+	Updated   int         `json:"updated"`
+	Unchanged int         `json:"unchanged"`
+	Invalid   int         `json:"invalid"`
+	Rows      []RowReport `json:"rows"`
+}
+
+type GetGradeHistoryRequest struct {
+	ClassCode string
+	Semester  string `form:"semester"`
+}
+
+type GetGradeHistoryResponse struct {
+	ClassCode string   `json:"class_code"`
+	Semester  string   `json:"semester"`
+	Changes   []Change `json:"changes"`
+}
+
+type Service interface {
+	// UploadGrades enters the grades of a class from a CSV or XLSX sheet and reports the validation of each row
+	UploadGrades(ctx context.Context, req UploadGradesRequest) (UploadGradesResponse, error)
+	GetGradeHistory(ctx context.Context, req GetGradeHistoryRequest) (GetGradeHistoryResponse, error)
+}
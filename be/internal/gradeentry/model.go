@@ -0,0 +1,226 @@
+package gradeentry
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxFileSize is the maximum size of an uploaded grade file
+	MaxFileSize = 5 << 20
+	// maxPartSize is the maximum size of a decompressed part of an XLSX workbook
+	maxPartSize = 32 << 20
+)
+
+// Row status of the validation report
+const (
+	RowUpdated   = "updated"
+	RowUnchanged = "unchanged"
+	RowInvalid   = "invalid"
+)
+
+// headerAliases are the accepted headers of the columns of a grade sheet, compared in lowercase
+var headerAliases = map[string][]string{
+	"student_code":  {"student_code", "mã sinh viên", "mã sv", "mssv"},
+	"midterm_grade": {"midterm_grade", "midterm", "điểm giữa kỳ", "giữa kỳ"},
+	"final_grade":   {"final_grade", "final", "điểm cuối kỳ", "cuối kỳ", "điểm học phần"},
+}
+
+type Class struct {
+	ID       int    `db:"id"`
+	Code     string `db:"code"`
+	Semester string `db:"semester_id"`
+}
+
+// Enrollment is the grades of a student in a class, Grade and GPA are derived from FinalGrade
+type Enrollment struct {
+	ID           int      `db:"id"`
+	StudentCode  string   `db:"student_code"`
+	MidtermGrade *float64 `db:"midterm_grade"`
+	FinalGrade   *float64 `db:"final_grade"`
+	Grade        *string  `db:"grade"`
+	GPA          *float64 `db:"gpa"`
+}
+
+// Change is a row of the grade history
+type Change struct {
+	ID              int       `json:"id" db:"id"`
+	EnrollmentID    int       `json:"-" db:"course_class_enrollment_id"`
+	StudentCode     string    `json:"student_code" db:"student_code"`
+	ChangedBy       int       `json:"-" db:"changed_by"`
+	ChangedByName   string    `json:"changed_by" db:"changed_by_name"`
+	ChangedByRole   string    `json:"changed_by_role" db:"changed_by_role"`
+	OldMidtermGrade *float64  `json:"old_midterm_grade" db:"old_midterm_grade"`
+	NewMidtermGrade *float64  `json:"new_midterm_grade" db:"new_midterm_grade"`
+	OldFinalGrade   *float64  `json:"old_final_grade" db:"old_final_grade"`
+	NewFinalGrade   *float64  `json:"new_final_grade" db:"new_final_grade"`
+	OldGrade        *string   `json:"old_grade" db:"old_grade"`
+	NewGrade        *string   `json:"new_grade" db:"new_grade"`
+	OldGPA          *float64  `json:"old_gpa" db:"old_gpa"`
+	NewGPA          *float64  `json:"new_gpa" db:"new_gpa"`
+	Reason          string    `json:"reason" db:"reason"`
+	ChangedAt       time.Time `json:"changed_at" db:"changed_at"`
+}
+
+// RowReport is the validation of a row of the grade sheet with the grades it would save
+type RowReport struct {
+	Line         int      `json:"line"`
+	StudentCode  string   `json:"student_code"`
+	MidtermGrade *float64 `json:"midterm_grade"`
+	FinalGrade   *float64 `json:"final_grade"`
+	Grade        *string  `json:"grade"`
+	GPA          *float64 `json:"gpa"`
+	Status       string   `json:"status"`
+	Errors       []string `json:"errors,omitempty"`
+}
+
+// record is a row of the uploaded sheet with its line number
+type record struct {
+	Line  int
+	Cells []string
+}
+
+// sheetRow is a row of the grade sheet, a nil score is left unchanged
+type sheetRow struct {
+	Line        int
+	StudentCode string
+	Midterm     *float64
+	Final       *float64
+	Errors      []string
+}
+
+// readRecords reads the rows of a CSV or an XLSX file by the extension of its name
+func readRecords(fileName string, content []byte) ([]record, error) {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".csv":
+		return readCSV(content)
+	case ".xlsx":
+		return readXLSX(content)
+	default:
+		return nil, fmt.Errorf("%w: %q isn't a .csv or .xlsx file", ErrInvalidFile, fileName)
+	}
+}
+
+func readCSV(content []byte) ([]record, error) {
+	// Excel writes the CSV files in UTF-8 with a BOM
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	var records []record
+	for {
+		cells, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+		}
+		line, _ := reader.FieldPos(0)
+		records = append(records, record{Line: line, Cells: cells})
+	}
+}
+
+// parseSheet maps the columns of the header, the first non-empty row, and parses the scores of the other rows
+func parseSheet(records []record) ([]sheetRow, error) {
+	header := -1
+	for i, rec := range records {
+		if !isBlank(rec.Cells) {
+			header = i
+			break
+		}
+	}
+	if header < 0 {
+		return nil, fmt.Errorf("%w: the file is empty", ErrInvalidFile)
+	}
+	columns := make(map[string]int)
+	for index, cell := range records[header].Cells {
+		name := strings.ToLower(strings.TrimSpace(cell))
+		for column, aliases := range headerAliases {
+			if containsString(aliases, name) {
+				columns[column] = index
+			}
+		}
+	}
+	if _, ok := columns["student_code"]; !ok {
+		return nil, fmt.Errorf("%w: the header has no student_code column", ErrInvalidFile)
+	}
+	_, hasMidterm := columns["midterm_grade"]
+	_, hasFinal := columns["final_grade"]
+	if !hasMidterm && !hasFinal {
+		return nil, fmt.Errorf("%w: the header has no midterm_grade nor final_grade column", ErrInvalidFile)
+	}
+
+	var rows []sheetRow
+	for _, rec := range records[header+1:] {
+		if isBlank(rec.Cells) {
+			continue
+		}
+		row := sheetRow{Line: rec.Line, StudentCode: strings.TrimSpace(cellOf(rec, columns, "student_code"))}
+		if row.StudentCode == "" {
+			row.Errors = append(row.Errors, "the student code is missing")
+		}
+		var err error
+		if row.Midterm, err = parseScore(cellOf(rec, columns, "midterm_grade")); err != nil {
+			row.Errors = append(row.Errors, "midterm_grade: "+err.Error())
+		}
+		if row.Final, err = parseScore(cellOf(rec, columns, "final_grade")); err != nil {
+			row.Errors = append(row.Errors, "final_grade: "+err.Error())
+		}
+		if row.Midterm == nil && row.Final == nil && len(row.Errors) == 0 {
+			row.Errors = append(row.Errors, "the row has no score")
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseScore parses a score of the 10-point scale rounded to one decimal, "7,5" is read as 7.5. An empty cell is nil.
+func parseScore(text string) (*float64, error) {
+	text = strings.TrimSpace(strings.Replace(text, ",", ".", 1))
+	if text == "" {
+		return nil, nil
+	}
+	score, err := strconv.ParseFloat(text, 64)
+	if err != nil || math.IsNaN(score) {
+		return nil, fmt.Errorf("%q isn't a number", text)
+	}
+	score = math.Round(score*10) / 10
+	if score < 0 || score > 10 {
+		return nil, fmt.Errorf("%v isn't between 0 and 10", score)
+	}
+	return &score, nil
+}
+
+func cellOf(rec record, columns map[string]int, column string) string {
+	index, ok := columns[column]
+	if !ok || index >= len(rec.Cells) {
+		return ""
+	}
+	return rec.Cells[index]
+}
+
+func isBlank(cells []string) bool {
+	for _, cell := range cells {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package gradeentry
+
+import (
+	"archive/zip"
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// buildXLSX builds a minimal workbook whose first sheet is the given worksheet XML, with the shared strings
+func buildXLSX(t *testing.T, sharedStrings string, sheet string) []byte {
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	parts := map[string]string{
+		"xl/workbook.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Điểm" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/sharedStrings" Target="sharedStrings.xml"/>
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`,
+		"xl/sharedStrings.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` + sharedStrings + `</sst>`,
+		"xl/worksheets/sheet1.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` + sheet + `</sheetData></worksheet>`,
+	}
+	for name, content := range parts {
+		part, err := writer.Create(name)
+		require.NoError(t, err)
+		_, err = part.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+	return buffer.Bytes()
+}
+
+func TestReadRecords(t *testing.T) {
+	workbook := buildXLSX(t,
+		`<si><t>Mã sinh viên</t></si><si><r><t>Điểm </t></r><r><t>cuối kỳ</t></r></si><si><t>21020001</t></si>`,
+		`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="s"><v>1</v></c></row>
+<row r="3"><c r="A3" t="s"><v>2</v></c><c r="B3" t="inlineStr"><is><t>ghi chú</t></is></c><c r="C3"><v>8.5</v></c></row>`)
+
+	tests := []struct {
+		name      string
+		fileName  string
+		content   []byte
+		expected  []record
+		errSubstr string
+	}{
+		{
+			name:     "CSV with a BOM and a quoted cell",
+			fileName: "diem.CSV",
+			content:  []byte("\xef\xbb\xbfstudent_code,final_grade\n21020001,\"7,5\"\n\n21020002,8\n"),
+			expected: []record{
+				{Line: 1, Cells: []string{"student_code", "final_grade"}},
+				{Line: 2, Cells: []string{"21020001", "7,5"}},
+				{Line: 4, Cells: []string{"21020002", "8"}},
+			},
+		},
+		{
+			name:     "XLSX with shared, rich and inline strings",
+			fileName: "diem.xlsx",
+			content:  workbook,
+			expected: []record{
+				{Line: 1, Cells: []string{"Mã sinh viên", "", "Điểm cuối kỳ"}},
+				{Line: 3, Cells: []string{"21020001", "ghi chú", "8.5"}},
+			},
+		},
+		{
+			name:      "Unsupported extension",
+			fileName:  "diem.pdf",
+			content:   []byte("%PDF"),
+			errSubstr: `"diem.pdf" isn't a .csv or .xlsx file`,
+		},
+		{
+			name:      "Not a workbook",
+			fileName:  "diem.xlsx",
+			content:   []byte("student_code,final_grade"),
+			errSubstr: "not an XLSX workbook",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := readRecords(tt.fileName, tt.content)
+			if tt.errSubstr != "" {
+				assert.ErrorIs(t, err, ErrInvalidFile)
+				assert.ErrorContains(t, err, tt.errSubstr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, records)
+		})
+	}
+}
+
+func TestParseSheet(t *testing.T) {
+	tests := []struct {
+		name      string
+		records   []record
+		expected  []sheetRow
+		errSubstr string
+	}{
+		{
+			name: "Vietnamese headers, comma decimals and empty scores",
+			records: []record{
+				{Line: 1, Cells: []string{"STT", " Mã SV ", "Điểm giữa kỳ", "Điểm cuối kỳ"}},
+				{Line: 2, Cells: []string{"1", "21020001", "6,25", "8"}},
+				{Line: 3, Cells: []string{"2", "21020002", "", "9.0"}},
+				{Line: 4, Cells: []string{"", "", "", ""}},
+			},
+			expected: []sheetRow{
+				{Line: 2, StudentCode: "21020001", Midterm: floatPtr(6.3), Final: floatPtr(8)},
+				{Line: 3, StudentCode: "21020002", Final: floatPtr(9)},
+			},
+		},
+		{
+			name: "Invalid rows",
+			records: []record{
+				{Line: 1, Cells: []string{"student_code", "midterm_grade", "final_grade"}},
+				{Line: 2, Cells: []string{"", "11", "abc"}},
+				{Line: 3, Cells: []string{"21020003"}},
+			},
+			expected: []sheetRow{
+				{Line: 2, Errors: []string{"the student code is missing", "midterm_grade: 11 isn't between 0 and 10", `final_grade: "abc" isn't a number`}},
+				{Line: 3, StudentCode: "21020003", Errors: []string{"the row has no score"}},
+			},
+		},
+		{
+			name:      "Student code column missing",
+			records:   []record{{Line: 1, Cells: []string{"name", "final_grade"}}},
+			errSubstr: "no student_code column",
+		},
+		{
+			name:      "Score columns missing",
+			records:   []record{{Line: 1, Cells: []string{"mssv", "name"}}},
+			errSubstr: "no midterm_grade nor final_grade column",
+		},
+		{
+			name:      "Empty file",
+			records:   []record{{Line: 1, Cells: []string{" "}}},
+			errSubstr: "the file is empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := parseSheet(tt.records)
+			if tt.errSubstr != "" {
+				assert.ErrorIs(t, err, ErrInvalidFile)
+				assert.ErrorContains(t, err, tt.errSubstr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, rows)
+		})
+	}
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+func strPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,105 @@
+package gradeentry
+
+import (
+	"HNLP/be/internal/db"
+	"context"
+	"github.com/jmoiron/sqlx"
+)
+
+type RepositoryImpl struct {
+	db db.HDb
+}
+
+func NewRepositoryImpl(db db.HDb) *RepositoryImpl {
+	return &RepositoryImpl{db: db}
+}
+
+func (r *RepositoryImpl) GetClass(ctx context.Context, code string, semester string) (Class, error) {
+	var class Class
+	err := r.db.GetContext(ctx, &class, `SELECT cc.id, cc.code, cc.semester_id
+FROM course_class cc
+WHERE UPPER(cc.code) = UPPER($1)
+  AND cc.semester_id = $2`, code, semester)
+	return class, err
+}
+
+func (r *RepositoryImpl) GetHistory(ctx context.Context, classId int) ([]Change, error) {
+	var changes []Change
+	err := r.db.SelectContext(ctx, &changes, `SELECT gh.id,
+       gh.course_class_enrollment_id,
+       s.code      AS student_code,
+       gh.changed_by,
+       ua.username AS changed_by_name,
+       gh.changed_by_role,
+       gh.old_midterm_grade,
+       gh.new_midterm_grade,
+       gh.old_final_grade,
+       gh.new_final_grade,
+       gh.old_grade,
+       gh.new_grade,
+       gh.old_gpa,
+       gh.new_gpa,
+       gh.reason,
+       gh.changed_at
+FROM grade_history gh
+         JOIN course_class_enrollment cce ON cce.id = gh.course_class_enrollment_id
+         JOIN student s ON s.id = cce.student_id
+         JOIN user_account ua ON ua.id = gh.changed_by
+WHERE cce.course_class_id = $1
+ORDER BY gh.changed_at DESC, gh.id DESC`, classId)
+	return changes, err
+}
+
+func (r *RepositoryImpl) Transaction(ctx context.Context, fn func(tx Tx) error) error {
+	sqlTx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(&txImpl{tx: sqlTx}); err != nil {
+		_ = sqlTx.Rollback()
+		return err
+	}
+	return sqlTx.Commit()
+}
+
+// txImpl implements Tx on a database transaction
+type txImpl struct {
+	tx *sqlx.Tx
+}
+
+func (t *txImpl) GetEnrollments(ctx context.Context, classId int) ([]Enrollment, error) {
+	var enrollments []Enrollment
+	err := t.tx.SelectContext(ctx, &enrollments, `SELECT cce.id,
+       s.code AS student_code,
+       cce.midterm_grade,
+       cce.final_grade,
+       cce.grade,
+       cce.gpa
+FROM course_class_enrollment cce
+         JOIN student s ON s.id = cce.student_id
+WHERE cce.course_class_id = $1
+ORDER BY cce.id
+FOR UPDATE OF cce`, classId)
+	return enrollments, err
+}
+
+func (t *txImpl) UpdateGrades(ctx context.Context, enrollment Enrollment) error {
+	_, err := t.tx.ExecContext(ctx, `UPDATE course_class_enrollment
+SET midterm_grade = $2,
+    final_grade   = $3,
+    grade         = $4,
+    gpa           = $5
+WHERE id = $1`, enrollment.ID, enrollment.MidtermGrade, enrollment.FinalGrade, enrollment.Grade, enrollment.GPA)
+	return err
+}
+
+func (t *txImpl) InsertChange(ctx context.Context, change Change) error {
+	_, err := t.tx.ExecContext(ctx, `INSERT INTO grade_history (course_class_enrollment_id, changed_by, changed_by_role,
+                           old_midterm_grade, new_midterm_grade, old_final_grade, new_final_grade,
+                           old_grade, new_grade, old_gpa, new_gpa, reason)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		change.EnrollmentID, change.ChangedBy, change.ChangedByRole,
+		change.OldMidtermGrade, change.NewMidtermGrade, change.OldFinalGrade, change.NewFinalGrade,
+		change.OldGrade, change.NewGrade, change.OldGPA, change.NewGPA, change.Reason)
+	return err
+}
@@ -0,0 +1,251 @@
+package gradeentry
+
+import (
+	"HNLP/be/internal/db"
+	"HNLP/be/internal/grade"
+	"HNLP/be/internal/semester"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type ServiceImpl struct {
+	repo        Repository
+	professors  Professors
+	semesterSrv semester.Service
+	scale       grade.Scale
+	// now returns the current time, it is replaced in the tests
+	now func() time.Time
+}
+
+func NewServiceImpl(repo Repository, professors Professors, semesterSrv semester.Service, scale grade.Scale) *ServiceImpl {
+	return &ServiceImpl{
+		repo:        repo,
+		professors:  professors,
+		semesterSrv: semesterSrv,
+		scale:       scale,
+		now:         time.Now,
+	}
+}
+
+// UploadGrades validates every row of the sheet against the enrollments of the class and saves the grades only if all
+// the rows are valid. An empty score keeps the grade of the student, the letter grade and the gpa are derived from the
+// final grade. Every changed enrollment is appended to the grade history with the caller and the reason.
+func (s *ServiceImpl) UploadGrades(ctx context.Context, req UploadGradesRequest) (UploadGradesResponse, error) {
+	caller, class, sem, err := s.authorizedClass(ctx, req.ClassCode, req.Semester)
+	if err != nil {
+		return UploadGradesResponse{}, err
+	}
+	// The admins can still correct the grades after the deadline
+	if caller.Role != "admin" && sem.GradesLocked(s.now()) {
+		return UploadGradesResponse{}, fmt.Errorf("%w: the grade deadline of the semester %s was %s", ErrGradesLocked, sem.Code,
+			sem.GradeDeadline.Format(semester.DateLayout))
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" && !req.DryRun {
+		return UploadGradesResponse{}, ErrReasonRequired
+	}
+	records, err := readRecords(req.FileName, req.Content)
+	if err != nil {
+		return UploadGradesResponse{}, err
+	}
+	rows, err := parseSheet(records)
+	if err != nil {
+		return UploadGradesResponse{}, err
+	}
+	userId, _ := ctx.Value("userId").(int)
+
+	response := UploadGradesResponse{ClassCode: class.Code, Semester: sem.Code, DryRun: req.DryRun, Rows: []RowReport{}}
+	err = s.repo.Transaction(ctx, func(tx Tx) error {
+		enrollments, err := tx.GetEnrollments(ctx, class.ID)
+		if err != nil {
+			return err
+		}
+		var changes []Change
+		response.Rows, changes = s.validate(rows, enrollments)
+		for _, row := range response.Rows {
+			switch row.Status {
+			case RowUpdated:
+				response.Updated++
+			case RowUnchanged:
+				response.Unchanged++
+			case RowInvalid:
+				response.Invalid++
+			}
+		}
+		if req.DryRun || response.Invalid > 0 {
+			return nil
+		}
+		for _, change := range changes {
+			change.ChangedBy = userId
+			change.ChangedByRole = caller.Role
+			change.Reason = reason
+			if err := tx.UpdateGrades(ctx, Enrollment{
+				ID:           change.EnrollmentID,
+				MidtermGrade: change.NewMidtermGrade,
+				FinalGrade:   change.NewFinalGrade,
+				Grade:        change.NewGrade,
+				GPA:          change.NewGPA,
+			}); err != nil {
+				return err
+			}
+			if err := tx.InsertChange(ctx, change); err != nil {
+				return err
+			}
+		}
+		response.Saved = true
+		return nil
+	})
+	if err != nil {
+		return UploadGradesResponse{}, err
+	}
+	return response, nil
+}
+
+func (s *ServiceImpl) GetGradeHistory(ctx context.Context, req GetGradeHistoryRequest) (GetGradeHistoryResponse, error) {
+	_, class, sem, err := s.authorizedClass(ctx, req.ClassCode, req.Semester)
+	if err != nil {
+		return GetGradeHistoryResponse{}, err
+	}
+	changes, err := s.repo.GetHistory(ctx, class.ID)
+	if err != nil {
+		return GetGradeHistoryResponse{}, err
+	}
+	if changes == nil {
+		changes = []Change{}
+	}
+	return GetGradeHistoryResponse{ClassCode: class.Code, Semester: sem.Code, Changes: changes}, nil
+}
+
+// ------------------Private helper function------------------
+
+// authorizedClass finds the class and checks that the caller is an admin or a professor teaching it
+func (s *ServiceImpl) authorizedClass(ctx context.Context, code string, expression string) (db.Caller, Class, semester.Semester, error) {
+	caller := db.CallerFrom(ctx)
+	if caller.Role != "professor" && caller.Role != "admin" {
+		return db.Caller{}, Class{}, semester.Semester{}, db.ErrForbidden
+	}
+	sem, err := s.resolveSemester(ctx, expression)
+	if err != nil {
+		return db.Caller{}, Class{}, semester.Semester{}, err
+	}
+	class, err := s.repo.GetClass(ctx, strings.TrimSpace(code), sem.Code)
+	if errors.Is(err, sql.ErrNoRows) {
+		return db.Caller{}, Class{}, semester.Semester{}, fmt.Errorf("%w: %s in the semester %s", ErrClassNotFound, code, sem.Code)
+	}
+	if err != nil {
+		return db.Caller{}, Class{}, semester.Semester{}, err
+	}
+	if caller.Role == "professor" {
+		info, err := s.professors.FetchProfessorInfo(ctx, caller.SpecificID)
+		if err != nil {
+			return db.Caller{}, Class{}, semester.Semester{}, err
+		}
+		if !containsInt(info.TaughtCourseClassIDs, class.ID) {
+			return db.Caller{}, Class{}, semester.Semester{}, db.ErrForbidden
+		}
+	}
+	return caller, class, sem, nil
+}
+
+// resolveSemester resolves the semester expression of the user, the current semester if it is empty
+func (s *ServiceImpl) resolveSemester(ctx context.Context, expression string) (semester.Semester, error) {
+	if strings.TrimSpace(expression) == "" {
+		return s.semesterSrv.GetCurrentSemester(ctx)
+	}
+	resolved, err := s.semesterSrv.ResolveSemester(ctx, semester.ResolveSemesterRequest{Expression: expression})
+	if err != nil {
+		return semester.Semester{}, err
+	}
+	if len(resolved.Semesters) != 1 {
+		return semester.Semester{}, fmt.Errorf("%q is %d semesters, a single semester is expected", expression, len(resolved.Semesters))
+	}
+	return resolved.Semesters[0], nil
+}
+
+// validate reports every row of the sheet and returns the changes of the enrollments of the valid rows
+func (s *ServiceImpl) validate(rows []sheetRow, enrollments []Enrollment) ([]RowReport, []Change) {
+	byCode := make(map[string]Enrollment, len(enrollments))
+	for _, enrollment := range enrollments {
+		byCode[strings.ToUpper(enrollment.StudentCode)] = enrollment
+	}
+	firstLine := make(map[string]int)
+
+	reports := make([]RowReport, 0, len(rows))
+	var changes []Change
+	for _, row := range rows {
+		report := RowReport{Line: row.Line, StudentCode: row.StudentCode, Errors: row.Errors}
+		key := strings.ToUpper(row.StudentCode)
+		enrollment, enrolled := byCode[key]
+		if row.StudentCode != "" {
+			if line, duplicated := firstLine[key]; duplicated {
+				report.Errors = append(report.Errors, fmt.Sprintf("the student is already on the line %d", line))
+			} else {
+				firstLine[key] = row.Line
+			}
+			if !enrolled {
+				report.Errors = append(report.Errors, "the student isn't enrolled in the class")
+			}
+		}
+		if len(report.Errors) > 0 {
+			report.Status = RowInvalid
+			reports = append(reports, report)
+			continue
+		}
+
+		change := Change{
+			EnrollmentID:    enrollment.ID,
+			StudentCode:     enrollment.StudentCode,
+			OldMidtermGrade: enrollment.MidtermGrade,
+			NewMidtermGrade: enrollment.MidtermGrade,
+			OldFinalGrade:   enrollment.FinalGrade,
+			NewFinalGrade:   enrollment.FinalGrade,
+			OldGrade:        enrollment.Grade,
+			NewGrade:        enrollment.Grade,
+			OldGPA:          enrollment.GPA,
+			NewGPA:          enrollment.GPA,
+		}
+		if row.Midterm != nil {
+			change.NewMidtermGrade = row.Midterm
+		}
+		if row.Final != nil {
+			band := s.scale.FromTen(*row.Final)
+			change.NewFinalGrade = row.Final
+			change.NewGrade = &band.Letter
+			change.NewGPA = &band.Points
+		}
+		report.StudentCode = enrollment.StudentCode
+		report.MidtermGrade = change.NewMidtermGrade
+		report.FinalGrade = change.NewFinalGrade
+		report.Grade = change.NewGrade
+		report.GPA = change.NewGPA
+		report.Status = RowUnchanged
+		if !equalFloat(change.OldMidtermGrade, change.NewMidtermGrade) || !equalFloat(change.OldFinalGrade, change.NewFinalGrade) ||
+			!equalString(change.OldGrade, change.NewGrade) || !equalFloat(change.OldGPA, change.NewGPA) {
+			report.Status = RowUpdated
+			changes = append(changes, change)
+		}
+		reports = append(reports, report)
+	}
+	return reports, changes
+}
+
+func equalFloat(a, b *float64) bool {
+	return a == nil && b == nil || a != nil && b != nil && *a == *b
+}
+
+func equalString(a, b *string) bool {
+	return a == nil && b == nil || a != nil && b != nil && *a == *b
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
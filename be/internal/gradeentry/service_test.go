@@ -0,0 +1,292 @@
+package gradeentry
+
+import (
+	"HNLP/be/internal/db"
+	"HNLP/be/internal/grade"
+	"HNLP/be/internal/semester"
+	"HNLP/be/internal/testutil"
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// MockRepository implements the Repository interface for testing, its transactions run on tx
+type MockRepository struct {
+	mock.Mock
+	tx *MockTx
+}
+
+func (m *MockRepository) GetClass(ctx context.Context, code string, semester string) (Class, error) {
+	args := m.Called(ctx, code, semester)
+	return args.Get(0).(Class), args.Error(1)
+}
+
+func (m *MockRepository) GetHistory(ctx context.Context, classId int) ([]Change, error) {
+	args := m.Called(ctx, classId)
+	return args.Get(0).([]Change), args.Error(1)
+}
+
+func (m *MockRepository) Transaction(ctx context.Context, fn func(tx Tx) error) error {
+	m.Called(ctx)
+	return fn(m.tx)
+}
+
+// MockTx implements the Tx interface for testing
+type MockTx struct {
+	mock.Mock
+}
+
+func (m *MockTx) GetEnrollments(ctx context.Context, classId int) ([]Enrollment, error) {
+	args := m.Called(ctx, classId)
+	return args.Get(0).([]Enrollment), args.Error(1)
+}
+
+func (m *MockTx) UpdateGrades(ctx context.Context, enrollment Enrollment) error {
+	return m.Called(ctx, enrollment).Error(0)
+}
+
+func (m *MockTx) InsertChange(ctx context.Context, change Change) error {
+	return m.Called(ctx, change).Error(0)
+}
+
+// staticProfessors implements the Professors interface, every professor teaches the given classes
+type staticProfessors struct {
+	classIds []int
+}
+
+func (p staticProfessors) FetchProfessorInfo(ctx context.Context, specificUserID int) (*db.ProfessorInfo, error) {
+	return &db.ProfessorInfo{UserInfo: db.UserInfo{ID: specificUserID, Role: "professor"}, TaughtCourseClassIDs: p.classIds}, nil
+}
+
+var (
+	gradeDeadline = time.Date(2025, time.July, 15, 0, 0, 0, 0, time.UTC)
+	testSemester  = semester.Semester{
+		Code:          "2024-2025-2",
+		StartDate:     time.Date(2025, time.February, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:       time.Date(2025, time.June, 30, 0, 0, 0, 0, time.UTC),
+		GradeDeadline: &gradeDeadline,
+	}
+	testClass = Class{ID: 1, Code: "INT2210 1", Semester: "2024-2025-2"}
+	// 21020001 has a midterm grade only and 21020002 has all the grades
+	testEnrollments = []Enrollment{
+		{ID: 100, StudentCode: "21020001", MidtermGrade: floatPtr(6)},
+		{ID: 101, StudentCode: "21020002", MidtermGrade: floatPtr(7), FinalGrade: floatPtr(8), Grade: strPtr("B+"), GPA: floatPtr(3.5)},
+	}
+)
+
+func newTestService(repo *MockRepository, now time.Time) *ServiceImpl {
+	semesterSrv := &testutil.MockSemesterService{}
+	semesterSrv.On("GetCurrentSemester", mock.Anything).Return(testSemester, nil)
+	service := NewServiceImpl(repo, staticProfessors{classIds: []int{1}}, semesterSrv, grade.NewScale(nil))
+	service.now = func() time.Time { return now }
+	return service
+}
+
+func newTestRepository() *MockRepository {
+	repo := &MockRepository{tx: &MockTx{}}
+	repo.On("GetClass", mock.Anything, "INT2210 1", "2024-2025-2").Return(testClass, nil)
+	repo.On("GetClass", mock.Anything, "INT3401 1", "2024-2025-2").Return(Class{ID: 2, Code: "INT3401 1", Semester: "2024-2025-2"}, nil)
+	repo.On("GetClass", mock.Anything, "INT9999 1", "2024-2025-2").Return(Class{}, sql.ErrNoRows)
+	repo.On("Transaction", mock.Anything).Return()
+	repo.tx.On("GetEnrollments", mock.Anything, 1).Return(testEnrollments, nil)
+	return repo
+}
+
+func callerContext(role string, specificId int, userId int) context.Context {
+	ctx := context.WithValue(context.Background(), "userRole", role)
+	ctx = context.WithValue(ctx, "userId", userId)
+	return context.WithValue(ctx, "specificId", specificId)
+}
+
+func TestServiceImpl_UploadGrades(t *testing.T) {
+	beforeDeadline := time.Date(2025, time.July, 15, 23, 0, 0, 0, time.UTC)
+	afterDeadline := time.Date(2025, time.July, 16, 8, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		role      string
+		now       time.Time
+		request   UploadGradesRequest
+		expected  UploadGradesResponse
+		changes   []Change
+		wantErr   error
+		errSubstr string
+	}{
+		{
+			name: "Grades saved with the derived letter grade and gpa",
+			role: "professor",
+			now:  beforeDeadline,
+			request: UploadGradesRequest{ClassCode: "INT2210 1", FileName: "diem.csv", Reason: " Nhập điểm cuối kỳ ",
+				Content: []byte("student_code,final_grade\n21020001,9.2\n21020002,8\n")},
+			expected: UploadGradesResponse{ClassCode: "INT2210 1", Semester: "2024-2025-2", Saved: true, Updated: 1, Unchanged: 1, Rows: []RowReport{
+				{Line: 2, StudentCode: "21020001", MidtermGrade: floatPtr(6), FinalGrade: floatPtr(9.2), Grade: strPtr("A+"), GPA: floatPtr(4), Status: RowUpdated},
+				{Line: 3, StudentCode: "21020002", MidtermGrade: floatPtr(7), FinalGrade: floatPtr(8), Grade: strPtr("B+"), GPA: floatPtr(3.5), Status: RowUnchanged},
+			}},
+			changes: []Change{{
+				EnrollmentID: 100, StudentCode: "21020001", ChangedBy: 42, ChangedByRole: "professor", Reason: "Nhập điểm cuối kỳ",
+				OldMidtermGrade: floatPtr(6), NewMidtermGrade: floatPtr(6), NewFinalGrade: floatPtr(9.2), NewGrade: strPtr("A+"), NewGPA: floatPtr(4),
+			}},
+		},
+		{
+			// Nothing is saved when a row is invalid
+			name: "Invalid rows reported",
+			role: "professor",
+			now:  beforeDeadline,
+			request: UploadGradesRequest{ClassCode: "INT2210 1", FileName: "diem.csv", Reason: "Nhập điểm",
+				Content: []byte("student_code,final_grade\n21020001,9\n21029999,5\n21020001,4\n")},
+			expected: UploadGradesResponse{ClassCode: "INT2210 1", Semester: "2024-2025-2", Updated: 1, Invalid: 2, Rows: []RowReport{
+				{Line: 2, StudentCode: "21020001", MidtermGrade: floatPtr(6), FinalGrade: floatPtr(9), Grade: strPtr("A+"), GPA: floatPtr(4), Status: RowUpdated},
+				{Line: 3, StudentCode: "21029999", Status: RowInvalid, Errors: []string{"the student isn't enrolled in the class"}},
+				{Line: 4, StudentCode: "21020001", Status: RowInvalid, Errors: []string{"the student is already on the line 2"}},
+			}},
+		},
+		{
+			name: "Dry run without reason",
+			role: "professor",
+			now:  beforeDeadline,
+			request: UploadGradesRequest{ClassCode: "INT2210 1", FileName: "diem.csv", DryRun: true,
+				Content: []byte("mssv,giữa kỳ\n21020002,7.5\n")},
+			expected: UploadGradesResponse{ClassCode: "INT2210 1", Semester: "2024-2025-2", DryRun: true, Updated: 1, Rows: []RowReport{
+				{Line: 2, StudentCode: "21020002", MidtermGrade: floatPtr(7.5), FinalGrade: floatPtr(8), Grade: strPtr("B+"), GPA: floatPtr(3.5), Status: RowUpdated},
+			}},
+		},
+		{
+			name:    "Admin corrects the grades after the deadline",
+			role:    "admin",
+			now:     afterDeadline,
+			request: UploadGradesRequest{ClassCode: "INT2210 1", FileName: "diem.csv", Reason: "Phúc khảo", Content: []byte("student_code,final_grade\n21020002,4.5\n")},
+			expected: UploadGradesResponse{ClassCode: "INT2210 1", Semester: "2024-2025-2", Saved: true, Updated: 1, Rows: []RowReport{
+				{Line: 2, StudentCode: "21020002", MidtermGrade: floatPtr(7), FinalGrade: floatPtr(4.5), Grade: strPtr("D"), GPA: floatPtr(1), Status: RowUpdated},
+			}},
+			changes: []Change{{
+				EnrollmentID: 101, StudentCode: "21020002", ChangedBy: 42, ChangedByRole: "admin", Reason: "Phúc khảo",
+				OldMidtermGrade: floatPtr(7), NewMidtermGrade: floatPtr(7), OldFinalGrade: floatPtr(8), NewFinalGrade: floatPtr(4.5),
+				OldGrade: strPtr("B+"), NewGrade: strPtr("D"), OldGPA: floatPtr(3.5), NewGPA: floatPtr(1),
+			}},
+		},
+		{
+			name:      "Professor after the deadline",
+			role:      "professor",
+			now:       afterDeadline,
+			request:   UploadGradesRequest{ClassCode: "INT2210 1", FileName: "diem.csv", Reason: "Nhập điểm", Content: []byte("student_code,final_grade\n21020001,9\n")},
+			wantErr:   ErrGradesLocked,
+			errSubstr: "the grade deadline of the semester 2024-2025-2 was 2025-07-15",
+		},
+		{
+			name:    "Class of another professor",
+			role:    "professor",
+			now:     beforeDeadline,
+			request: UploadGradesRequest{ClassCode: "INT3401 1", FileName: "diem.csv", Reason: "Nhập điểm", Content: []byte("student_code,final_grade\n")},
+			wantErr: db.ErrForbidden,
+		},
+		{
+			name:    "Student",
+			role:    "student",
+			now:     beforeDeadline,
+			request: UploadGradesRequest{ClassCode: "INT2210 1", FileName: "diem.csv", Reason: "Nhập điểm", Content: []byte("student_code,final_grade\n")},
+			wantErr: db.ErrForbidden,
+		},
+		{
+			name:    "Class not found",
+			role:    "admin",
+			now:     beforeDeadline,
+			request: UploadGradesRequest{ClassCode: "INT9999 1", FileName: "diem.csv", Reason: "Nhập điểm", Content: []byte("student_code,final_grade\n")},
+			wantErr: ErrClassNotFound,
+		},
+		{
+			name:    "Reason missing",
+			role:    "professor",
+			now:     beforeDeadline,
+			request: UploadGradesRequest{ClassCode: "INT2210 1", FileName: "diem.csv", Reason: " ", Content: []byte("student_code,final_grade\n")},
+			wantErr: ErrReasonRequired,
+		},
+		{
+			name:      "Invalid file",
+			role:      "professor",
+			now:       beforeDeadline,
+			request:   UploadGradesRequest{ClassCode: "INT2210 1", FileName: "diem.csv", Reason: "Nhập điểm", Content: []byte("student_code,name\n")},
+			wantErr:   ErrInvalidFile,
+			errSubstr: "no midterm_grade nor final_grade column",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newTestRepository()
+			for _, change := range tt.changes {
+				repo.tx.On("UpdateGrades", mock.Anything, Enrollment{
+					ID: change.EnrollmentID, MidtermGrade: change.NewMidtermGrade, FinalGrade: change.NewFinalGrade, Grade: change.NewGrade, GPA: change.NewGPA,
+				}).Return(nil).Once()
+				repo.tx.On("InsertChange", mock.Anything, change).Return(nil).Once()
+			}
+			service := newTestService(repo, tt.now)
+
+			response, err := service.UploadGrades(callerContext(tt.role, 7, 42), tt.request)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				if tt.errSubstr != "" {
+					assert.ErrorContains(t, err, tt.errSubstr)
+				}
+				repo.AssertNotCalled(t, "Transaction", mock.Anything)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, response)
+			repo.tx.AssertExpectations(t)
+			repo.tx.AssertNumberOfCalls(t, "UpdateGrades", len(tt.changes))
+			repo.tx.AssertNumberOfCalls(t, "InsertChange", len(tt.changes))
+		})
+	}
+}
+
+func TestServiceImpl_GetGradeHistory(t *testing.T) {
+	changes := []Change{{ID: 1, EnrollmentID: 100, StudentCode: "21020001", ChangedByName: "nguyenvana", ChangedByRole: "professor", Reason: "Nhập điểm"}}
+
+	tests := []struct {
+		name     string
+		role     string
+		request  GetGradeHistoryRequest
+		expected GetGradeHistoryResponse
+		wantErr  error
+	}{
+		{
+			name:     "Professor of the class",
+			role:     "professor",
+			request:  GetGradeHistoryRequest{ClassCode: "INT2210 1"},
+			expected: GetGradeHistoryResponse{ClassCode: "INT2210 1", Semester: "2024-2025-2", Changes: changes},
+		},
+		{
+			name:     "Admin",
+			role:     "admin",
+			request:  GetGradeHistoryRequest{ClassCode: "INT3401 1"},
+			expected: GetGradeHistoryResponse{ClassCode: "INT3401 1", Semester: "2024-2025-2", Changes: []Change{}},
+		},
+		{
+			name:    "Class of another professor",
+			role:    "professor",
+			request: GetGradeHistoryRequest{ClassCode: "INT3401 1"},
+			wantErr: db.ErrForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newTestRepository()
+			repo.On("GetHistory", mock.Anything, 1).Return(changes, nil)
+			repo.On("GetHistory", mock.Anything, 2).Return([]Change(nil), nil)
+			service := newTestService(repo, time.Date(2025, time.August, 1, 0, 0, 0, 0, time.UTC))
+
+			response, err := service.GetGradeHistory(callerContext(tt.role, 7, 42), tt.request)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, response)
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package gradeentry
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// The parts of a workbook read by readXLSX, the rest of the SpreadsheetML is ignored
+
+type xlsxText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		RelationshipID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Items []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		Number int `xml:"r,attr"`
+		Cells  []struct {
+			Ref    string   `xml:"r,attr"`
+			Type   string   `xml:"t,attr"`
+			Value  string   `xml:"v"`
+			Inline xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSX returns the rows of the first sheet of a workbook as text with their line numbers
+func readXLSX(data []byte) ([]record, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: not an XLSX workbook", ErrInvalidFile)
+	}
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	var shared xlsxSharedStrings
+	if file, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decodePart(file, &shared); err != nil {
+			return nil, err
+		}
+	}
+	sheetPath, err := firstSheetPath(files)
+	if err != nil {
+		return nil, err
+	}
+	var sheet xlsxWorksheet
+	if err := decodePart(files[sheetPath], &sheet); err != nil {
+		return nil, err
+	}
+
+	records := make([]record, 0, len(sheet.Rows))
+	for i, row := range sheet.Rows {
+		line := row.Number
+		if line == 0 {
+			line = i + 1
+		}
+		var cells []string
+		for j, cell := range row.Cells {
+			column := columnIndex(cell.Ref)
+			if column < 0 {
+				column = j
+			}
+			for len(cells) <= column {
+				cells = append(cells, "")
+			}
+			switch cell.Type {
+			case "s":
+				var index int
+				if _, err := fmt.Sscan(cell.Value, &index); err != nil || index < 0 || index >= len(shared.Items) {
+					return nil, fmt.Errorf("%w: invalid shared string of the cell %s", ErrInvalidFile, cell.Ref)
+				}
+				cells[column] = shared.Items[index].String()
+			case "inlineStr":
+				cells[column] = cell.Inline.String()
+			default:
+				cells[column] = cell.Value
+			}
+		}
+		records = append(records, record{Line: line, Cells: cells})
+	}
+	return records, nil
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var text strings.Builder
+	for _, run := range t.Runs {
+		text.WriteString(run.Text)
+	}
+	return text.String()
+}
+
+// ------------------Private helper function------------------
+
+// firstSheetPath finds the part of the first sheet of the workbook through its relationships
+func firstSheetPath(files map[string]*zip.File) (string, error) {
+	var workbook xlsxWorkbook
+	var relationships xlsxRelationships
+	workbookFile, ok := files["xl/workbook.xml"]
+	relationshipsFile, hasRelationships := files["xl/_rels/workbook.xml.rels"]
+	if !ok || !hasRelationships {
+		return "", fmt.Errorf("%w: the workbook has no sheet", ErrInvalidFile)
+	}
+	if err := decodePart(workbookFile, &workbook); err != nil {
+		return "", err
+	}
+	if err := decodePart(relationshipsFile, &relationships); err != nil {
+		return "", err
+	}
+	if len(workbook.Sheets) == 0 {
+		return "", fmt.Errorf("%w: the workbook has no sheet", ErrInvalidFile)
+	}
+	for _, relationship := range relationships.Items {
+		if relationship.ID != workbook.Sheets[0].RelationshipID {
+			continue
+		}
+		sheetPath := strings.TrimPrefix(relationship.Target, "/")
+		if !strings.HasPrefix(relationship.Target, "/") {
+			sheetPath = path.Join("xl", relationship.Target)
+		}
+		if _, exists := files[sheetPath]; exists {
+			return sheetPath, nil
+		}
+	}
+	return "", fmt.Errorf("%w: the first sheet of the workbook is missing", ErrInvalidFile)
+}
+
+func decodePart(file *zip.File, dest interface{}) error {
+	reader, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+	defer reader.Close()
+	if err := xml.NewDecoder(io.LimitReader(reader, maxPartSize)).Decode(dest); err != nil {
+		return fmt.Errorf("%w: invalid part %s of the workbook", ErrInvalidFile, file.Name)
+	}
+	return nil
+}
+
+// columnIndex returns the index of the column of a cell reference, e.g. 0 for "A3" and 27 for "AB3"
+func columnIndex(ref string) int {
+	index := 0
+	for _, char := range strings.ToUpper(ref) {
+		if char < 'A' || char > 'Z' {
+			break
+		}
+		index = index*26 + int(char-'A') + 1
+	}
+	return index - 1
+}
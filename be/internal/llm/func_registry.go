@@ -3,9 +3,21 @@ package llm
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/invopop/jsonschema"
+	"reflect"
+	"slices"
+	"strings"
 	"sync"
+	"time"
+)
+
+var (
+	// ErrFuncTimeout is returned when a function runs longer than its timeout
+	ErrFuncTimeout = errors.New("tool timed out")
+	// ErrToolNotAllowed is returned when the role or the scopes of the caller don't allow the tool
+	ErrToolNotAllowed = errors.New("tool not allowed")
 )
 
 // FuncDefinition represents a function definition for a tool
@@ -13,7 +25,29 @@ type FuncDefinition struct {
 	Name        string             `json:"name"`
 	Description string             `json:"description,omitempty"`
 	Parameters  *jsonschema.Schema `json:"parameters"`
-	Handler     FuncHandler
+	// Timeout bounds the execution of the handler, no limit if zero
+	Timeout time.Duration `json:"-"`
+	// Roles are the roles allowed to use the tool, every role if empty
+	Roles []string `json:"-"`
+	// Scopes are the scopes the caller needs all of to use the tool, see WithScopes
+	Scopes  []string `json:"-"`
+	Handler FuncHandler
+}
+
+// AllowedFor returns true if a caller with the role and the scopes can use the tool, the admins can use every tool
+func (fd FuncDefinition) AllowedFor(role string, scopes []string) bool {
+	if role == "admin" {
+		return true
+	}
+	if len(fd.Roles) > 0 && !slices.ContainsFunc(fd.Roles, func(allowed string) bool { return strings.EqualFold(allowed, role) }) {
+		return false
+	}
+	for _, scope := range fd.Scopes {
+		if !slices.Contains(scopes, scope) {
+			return false
+		}
+	}
+	return true
 }
 
 type FuncHandler func(ctx context.Context, args map[string]interface{}) (interface{}, error)
@@ -21,41 +55,124 @@ type FuncHandler func(ctx context.Context, args map[string]interface{}) (interfa
 type FuncRegistry interface {
 	Register(fn FuncDefinition)
 	Execute(ctx context.Context, toolCall ToolCall) (string, error)
-	GetFuncDefinitions() []FuncDefinition
+	// GetFuncDefinitions returns the tools allowed to the caller of the context
+	GetFuncDefinitions(ctx context.Context) []FuncDefinition
 }
 
-// FuncWrapper convert a typed function into a FuncDefinition to be used in the tool registry
-// Currently,it only supports functions with a single argument with type struct (DTO)
-func FuncWrapper[T any, R any](name string, description string, fn func(ctx context.Context, args T) (R, error)) FuncDefinition {
-	// Create a schema reflector for parameter type T
-	reflector := jsonschema.Reflector{
-		ExpandedStruct: true,
-		DoNotReference: true,
+// FuncOption configures a function wrapped by one of the FuncWrapper functions
+type FuncOption func(*funcOptions)
+
+type funcOptions struct {
+	timeout         time.Duration
+	roles           []string
+	scopes          []string
+	argNames        []string
+	argDescriptions []string
+}
+
+// WithTimeout cancels the function and returns ErrFuncTimeout to the model once the timeout is over
+func WithTimeout(timeout time.Duration) FuncOption {
+	return func(o *funcOptions) {
+		o.timeout = timeout
 	}
+}
 
-	// Infer JSON schema from the type T
-	schema := reflector.Reflect(new(T))
+// WithRoles restricts the tool to the roles, it is neither shown to nor executed for the other roles
+func WithRoles(roles ...string) FuncOption {
+	return func(o *funcOptions) {
+		o.roles = roles
+	}
+}
 
-	// Create the handler function that adapts the typed function
-	handler := func(ctx context.Context, innerArgs map[string]interface{}) (interface{}, error) {
-		argsJSON, err := json.Marshal(innerArgs)
-		if err != nil {
-			return nil, fmt.Errorf("failed to marshal args: %v", err)
+// WithScopes restricts the tool to the callers having all the scopes, e.g. "grades:export".
+// The scopes of the caller are the []string "userScopes" value of the context.
+func WithScopes(scopes ...string) FuncOption {
+	return func(o *funcOptions) {
+		o.scopes = scopes
+	}
+}
+
+// WithArgNames names the arguments which aren't a struct, "value" by default for a single argument
+func WithArgNames(names ...string) FuncOption {
+	return func(o *funcOptions) {
+		o.argNames = names
+	}
+}
+
+// WithArgDescriptions describes the arguments which aren't a struct in the order of the function,
+// the fields of a struct are described by their jsonschema tag instead
+func WithArgDescriptions(descriptions ...string) FuncOption {
+	return func(o *funcOptions) {
+		o.argDescriptions = descriptions
+	}
+}
+
+// FuncWrapper convert a typed function into a FuncDefinition to be used in the tool registry.
+// A struct (DTO) argument is the object of the parameters, its fields can be described with jsonschema tags like
+// `jsonschema:"description=Code of the course,example=INT3306,pattern=^[A-Z]{3}[0-9]{4}$"`.
+// Any other argument, e.g. a string or a list, is the single parameter named by WithArgNames.
+func FuncWrapper[T any, R any](name string, description string, fn func(ctx context.Context, args T) (R, error), opts ...FuncOption) FuncDefinition {
+	options := newFuncOptions(opts)
+	if isObjectArg[T]() {
+		// Infer JSON schema from the type T
+		reflector := jsonschema.Reflector{
+			ExpandedStruct: true,
+			DoNotReference: true,
 		}
-		var typedArgs T
-		if err := json.Unmarshal(argsJSON, &typedArgs); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal args: %v", err)
+		schema := reflector.Reflect(new(T))
+
+		// Create the handler function that adapts the typed function
+		handler := func(ctx context.Context, innerArgs map[string]interface{}) (interface{}, error) {
+			var typedArgs T
+			if err := convertArg(innerArgs, &typedArgs); err != nil {
+				return nil, err
+			}
+			return fn(ctx, typedArgs)
 		}
-		return fn(ctx, typedArgs)
+		return options.definition(name, description, schema, handler)
 	}
 
-	// Return the complete FuncDefinition
-	return FuncDefinition{
-		Name:        name,
-		Description: description,
-		Parameters:  schema,
-		Handler:     handler,
+	argName := options.argName(0, "value")
+	schema := objectSchema(argSchema[T](argName, options.argDescription(0)))
+	handler := func(ctx context.Context, innerArgs map[string]interface{}) (interface{}, error) {
+		var typedArg T
+		if err := convertArg(innerArgs[argName], &typedArg); err != nil {
+			return nil, err
+		}
+		return fn(ctx, typedArg)
+	}
+	return options.definition(name, description, schema, handler)
+}
+
+// FuncWrapperNoArgs convert a function without argument into a FuncDefinition, e.g. to get the current semester
+func FuncWrapperNoArgs[R any](name string, description string, fn func(ctx context.Context) (R, error), opts ...FuncOption) FuncDefinition {
+	options := newFuncOptions(opts)
+	handler := func(ctx context.Context, _ map[string]interface{}) (interface{}, error) {
+		return fn(ctx)
+	}
+	return options.definition(name, description, objectSchema(), handler)
+}
+
+// FuncWrapper2 convert a function with two arguments into a FuncDefinition, the arguments are the parameters
+// named by argNames. Both of them are required unless they are pointers.
+func FuncWrapper2[A any, B any, R any](name string, description string, argNames [2]string, fn func(ctx context.Context, a A, b B) (R, error), opts ...FuncOption) FuncDefinition {
+	options := newFuncOptions(opts)
+	schema := objectSchema(
+		argSchema[A](argNames[0], options.argDescription(0)),
+		argSchema[B](argNames[1], options.argDescription(1)),
+	)
+	handler := func(ctx context.Context, innerArgs map[string]interface{}) (interface{}, error) {
+		var a A
+		if err := convertArg(innerArgs[argNames[0]], &a); err != nil {
+			return nil, err
+		}
+		var b B
+		if err := convertArg(innerArgs[argNames[1]], &b); err != nil {
+			return nil, err
+		}
+		return fn(ctx, a, b)
 	}
+	return options.definition(name, description, schema, handler)
 }
 
 // FuncRegistryImpl manages tool handlers
@@ -77,6 +194,9 @@ func (r *FuncRegistryImpl) Register(fn FuncDefinition) {
 	r.mu.Unlock()
 }
 
+// Execute validates the arguments of the tool call against the parameters of the function before calling it,
+// invalid arguments are returned as a *ValidationError so the model can correct them.
+// A tool outside the role or the scopes of the caller of the context is refused with ErrToolNotAllowed.
 func (r *FuncRegistryImpl) Execute(ctx context.Context, toolCall ToolCall) (string, error) {
 	// All the tools need to be registered when the app starts up
 	// So we don't need to lock here
@@ -84,11 +204,24 @@ func (r *FuncRegistryImpl) Execute(ctx context.Context, toolCall ToolCall) (stri
 	if !exists {
 		return "", fmt.Errorf("unknown tool: %s", toolCall.Function.Name)
 	}
+	if role, scopes := callerOf(ctx); !fd.AllowedFor(role, scopes) {
+		return "", fmt.Errorf("%w: %s is not available to the role %q", ErrToolNotAllowed, fd.Name, role)
+	}
 	var args map[string]interface{}
-	if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &args); err != nil {
-		return "", fmt.Errorf("failed to parse arguments: %v", err)
+	// The models may send no argument at all to a function without parameters
+	if arguments := strings.TrimSpace(toolCall.Function.Arguments); arguments != "" {
+		if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+			return "", fmt.Errorf("failed to parse arguments: %v", err)
+		}
 	}
-	result, err := fd.Handler(ctx, args)
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	if fieldErrors := ValidateArgs(fd.Parameters, args); len(fieldErrors) > 0 {
+		return "", &ValidationError{Function: fd.Name, Errors: fieldErrors}
+	}
+
+	result, err := callHandler(ctx, fd, args)
 	if err != nil {
 		return "", err
 	}
@@ -99,10 +232,161 @@ func (r *FuncRegistryImpl) Execute(ctx context.Context, toolCall ToolCall) (stri
 	return string(resultJSON), nil
 }
 
-func (r *FuncRegistryImpl) GetFuncDefinitions() []FuncDefinition {
+// GetFuncDefinitions returns the tools allowed to the role and the scopes of the caller of the context sorted by name,
+// so the model never sees the tools it can't use
+func (r *FuncRegistryImpl) GetFuncDefinitions(ctx context.Context) []FuncDefinition {
+	role, scopes := callerOf(ctx)
 	funcDefs := make([]FuncDefinition, 0, len(r.tools))
 	for _, fd := range r.tools {
-		funcDefs = append(funcDefs, fd)
+		if fd.AllowedFor(role, scopes) {
+			funcDefs = append(funcDefs, fd)
+		}
 	}
+	slices.SortFunc(funcDefs, func(a, b FuncDefinition) int { return strings.Compare(a.Name, b.Name) })
 	return funcDefs
 }
+
+// ------------------Private helper function------------------
+
+// callerOf returns the role and the scopes of the caller of the context
+func callerOf(ctx context.Context) (string, []string) {
+	role, _ := ctx.Value("userRole").(string)
+	scopes, _ := ctx.Value("userScopes").([]string)
+	return role, scopes
+}
+
+// callHandler runs the handler within the timeout of the function. The handler gets a canceled context
+// after the timeout, but a handler ignoring it is left running in the background.
+func callHandler(ctx context.Context, fd FuncDefinition, args map[string]interface{}) (interface{}, error) {
+	if fd.Timeout <= 0 {
+		return fd.Handler(ctx, args)
+	}
+	ctx, cancel := context.WithTimeout(ctx, fd.Timeout)
+	defer cancel()
+
+	type outcome struct {
+		result interface{}
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := fd.Handler(ctx, args)
+		done <- outcome{result: result, err: err}
+	}()
+
+	var out outcome
+	select {
+	case out = <-done:
+	case <-ctx.Done():
+		out.err = ctx.Err()
+	}
+	// The handler may also return the error of the context itself
+	if out.err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("%w: %s took more than %s", ErrFuncTimeout, fd.Name, fd.Timeout)
+	}
+	return out.result, out.err
+}
+
+func newFuncOptions(opts []FuncOption) funcOptions {
+	var options funcOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+func (o funcOptions) definition(name string, description string, schema *jsonschema.Schema, handler FuncHandler) FuncDefinition {
+	return FuncDefinition{
+		Name:        name,
+		Description: description,
+		Parameters:  schema,
+		Timeout:     o.timeout,
+		Roles:       o.roles,
+		Scopes:      o.scopes,
+		Handler:     handler,
+	}
+}
+
+func (o funcOptions) argName(index int, defaultName string) string {
+	if index < len(o.argNames) && o.argNames[index] != "" {
+		return o.argNames[index]
+	}
+	return defaultName
+}
+
+func (o funcOptions) argDescription(index int) string {
+	if index < len(o.argDescriptions) {
+		return o.argDescriptions[index]
+	}
+	return ""
+}
+
+// namedSchema is a property of the object of the parameters
+type namedSchema struct {
+	name     string
+	schema   *jsonschema.Schema
+	required bool
+}
+
+// objectSchema builds the object of the parameters of a function whose arguments aren't a struct
+func objectSchema(properties ...namedSchema) *jsonschema.Schema {
+	schema := &jsonschema.Schema{
+		Type:                 "object",
+		Properties:           jsonschema.NewProperties(),
+		AdditionalProperties: jsonschema.FalseSchema,
+	}
+	for _, property := range properties {
+		schema.Properties.Set(property.name, property.schema)
+		if property.required {
+			schema.Required = append(schema.Required, property.name)
+		}
+	}
+	return schema
+}
+
+// argSchema infers the schema of an argument which isn't the object of the parameters, a pointer is optional
+func argSchema[T any](name string, description string) namedSchema {
+	reflector := jsonschema.Reflector{
+		DoNotReference: true,
+		Anonymous:      true,
+	}
+	schema := reflector.Reflect(new(T))
+	// The schema is nested in the parameters
+	schema.Version = ""
+	if description != "" {
+		schema.Description = description
+	}
+	return namedSchema{
+		name:     name,
+		schema:   schema,
+		required: reflect.TypeFor[T]().Kind() != reflect.Pointer,
+	}
+}
+
+// isObjectArg returns true if T is the object of the parameters itself rather than a single parameter
+func isObjectArg[T any]() bool {
+	t := reflect.TypeFor[T]()
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == reflect.TypeFor[time.Time]() {
+		return false
+	}
+	// The reflector can only expand named structs
+	return t.Kind() == reflect.Struct && t.Name() != ""
+}
+
+// convertArg converts the decoded JSON value into the typed argument
+func convertArg(value interface{}, target interface{}) error {
+	if value == nil {
+		return nil
+	}
+	argsJSON, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal args: %v", err)
+	}
+	if err := json.Unmarshal(argsJSON, target); err != nil {
+		return fmt.Errorf("failed to unmarshal args: %v", err)
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -115,9 +116,12 @@ func TestFuncRegistry_Execute_TypeConversionError(t *testing.T) {
 		},
 	}
 
+	// The arguments are validated before calling the function
 	_, err := registry.Execute(context.Background(), toolCall)
-	require.Error(t, err)
-	assert.Contains(t, err.Error(), "failed to unmarshal args")
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, "getUser", validationErr.Function)
+	assert.Equal(t, []FieldError{{Field: "id", Message: "must be an integer, got string"}}, validationErr.Errors)
 }
 
 func TestFuncRegistry_Execute_ComplexNestedStructure(t *testing.T) {
@@ -375,3 +379,168 @@ func TestFuncWrapper_WithMethodReceiver(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "User: John Doe, 30, true, customer,premium, Boston", result)
 }
+
+func TestFuncWrapper_PrimitiveArgument(t *testing.T) {
+	funcDef := FuncWrapper("countWords", "Count the words of a text", func(ctx context.Context, text string) (int, error) {
+		return len(strings.Fields(text)), nil
+	}, WithArgNames("text"), WithArgDescriptions("The text to count"))
+
+	property, ok := funcDef.Parameters.Properties.Get("text")
+	require.True(t, ok)
+	assert.Equal(t, "string", property.Type)
+	assert.Equal(t, "The text to count", property.Description)
+	assert.Empty(t, property.Version)
+	assert.Equal(t, []string{"text"}, funcDef.Parameters.Required)
+
+	registry := NewFunctionRegistryImpl()
+	registry.Register(funcDef)
+	result, err := registry.Execute(context.Background(), ToolCall{Function: &FunctionCall{Name: "countWords", Arguments: `{"text": "học kỳ 2 năm ngoái"}`}})
+	require.NoError(t, err)
+	assert.Equal(t, "5", result)
+
+	_, err = registry.Execute(context.Background(), ToolCall{Function: &FunctionCall{Name: "countWords", Arguments: `{"value": "a b"}`}})
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, []FieldError{
+		{Field: "text", Message: "is required"},
+		{Field: "value", Message: "is not a known argument"},
+	}, validationErr.Errors)
+}
+
+func TestFuncWrapper_NoArgs(t *testing.T) {
+	funcDef := FuncWrapperNoArgs("getCurrentSemester", "Get the current semester", func(ctx context.Context) (string, error) {
+		return "2024-2025-2", nil
+	})
+	assert.Equal(t, "object", funcDef.Parameters.Type)
+	assert.Equal(t, 0, funcDef.Parameters.Properties.Len())
+
+	registry := NewFunctionRegistryImpl()
+	registry.Register(funcDef)
+	// The models send either an empty object or nothing
+	for _, arguments := range []string{"{}", ""} {
+		result, err := registry.Execute(context.Background(), ToolCall{Function: &FunctionCall{Name: "getCurrentSemester", Arguments: arguments}})
+		require.NoError(t, err)
+		assert.Equal(t, `"2024-2025-2"`, result)
+	}
+}
+
+func TestFuncWrapper2(t *testing.T) {
+	funcDef := FuncWrapper2("getScore", "Get the score of a student in a course", [2]string{"student_id", "course_code"},
+		func(ctx context.Context, studentId int, courseCode *string) (string, error) {
+			if courseCode == nil {
+				return fmt.Sprintf("%d: all", studentId), nil
+			}
+			return fmt.Sprintf("%d: %s", studentId, *courseCode), nil
+		})
+	// The pointer argument is optional
+	assert.Equal(t, []string{"student_id"}, funcDef.Parameters.Required)
+
+	registry := NewFunctionRegistryImpl()
+	registry.Register(funcDef)
+	tests := []struct {
+		name      string
+		arguments string
+		expected  string
+	}{
+		{name: "Both arguments", arguments: `{"student_id": 21020001, "course_code": "INT3306"}`, expected: `"21020001: INT3306"`},
+		{name: "Optional argument missing", arguments: `{"student_id": 21020001}`, expected: `"21020001: all"`},
+		{name: "Optional argument null", arguments: `{"student_id": 21020001, "course_code": null}`, expected: `"21020001: all"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := registry.Execute(context.Background(), ToolCall{Function: &FunctionCall{Name: "getScore", Arguments: tt.arguments}})
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestFuncRegistry_Execute_Timeout(t *testing.T) {
+	registry := NewFunctionRegistryImpl()
+	registry.Register(FuncWrapperNoArgs("slow", "", func(ctx context.Context) (string, error) {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(time.Second):
+			return "done", nil
+		}
+	}, WithTimeout(20*time.Millisecond)))
+	registry.Register(FuncWrapperNoArgs("fast", "", func(ctx context.Context) (string, error) {
+		return "done", nil
+	}, WithTimeout(time.Second)))
+
+	_, err := registry.Execute(context.Background(), ToolCall{Function: &FunctionCall{Name: "slow", Arguments: "{}"}})
+	assert.ErrorIs(t, err, ErrFuncTimeout)
+	assert.Contains(t, err.Error(), "slow took more than 20ms")
+
+	result, err := registry.Execute(context.Background(), ToolCall{Function: &FunctionCall{Name: "fast", Arguments: "{}"}})
+	require.NoError(t, err)
+	assert.Equal(t, `"done"`, result)
+}
+
+func TestFuncWrapper_JsonSchemaTags(t *testing.T) {
+	type SearchCourseRequest struct {
+		Code  string `json:"code" jsonschema:"description=Code of the course,example=INT3306,pattern=^[A-Z]{3}[0-9]{4}$"`
+		Limit int    `json:"limit,omitempty" jsonschema:"minimum=1,maximum=50"`
+	}
+	funcDef := FuncWrapper("searchCourse", "", func(ctx context.Context, req SearchCourseRequest) (string, error) {
+		return req.Code, nil
+	})
+
+	code, ok := funcDef.Parameters.Properties.Get("code")
+	require.True(t, ok)
+	assert.Equal(t, "Code of the course", code.Description)
+	assert.Equal(t, []interface{}{"INT3306"}, code.Examples)
+	assert.Equal(t, []string{"code"}, funcDef.Parameters.Required)
+
+	registry := NewFunctionRegistryImpl()
+	registry.Register(funcDef)
+	_, err := registry.Execute(context.Background(), ToolCall{Function: &FunctionCall{Name: "searchCourse", Arguments: `{"code": "int3306", "limit": 100}`}})
+	require.Error(t, err)
+	assert.Equal(t, "invalid arguments for searchCourse: code: must match the pattern ^[A-Z]{3}[0-9]{4}$; limit: must be at most 50", err.Error())
+}
+
+func TestFuncRegistry_RoleAndScopeFiltering(t *testing.T) {
+	echo := func(ctx context.Context) (string, error) { return "ok", nil }
+	registry := NewFunctionRegistryImpl()
+	registry.Register(FuncWrapperNoArgs("ExecuteQuery", "", echo))
+	registry.Register(FuncWrapperNoArgs("GetCurrentGpaOfStudent", "", echo, WithRoles("student", "professor")))
+	registry.Register(FuncWrapperNoArgs("ExportGrades", "", echo, WithRoles("professor"), WithScopes("grades:export")))
+
+	tests := []struct {
+		name     string
+		role     string
+		scopes   []string
+		expected []string
+	}{
+		{name: "Student", role: "student", expected: []string{"ExecuteQuery", "GetCurrentGpaOfStudent"}},
+		{name: "Professor without the scope", role: "professor", expected: []string{"ExecuteQuery", "GetCurrentGpaOfStudent"}},
+		{name: "Professor with the scope", role: "professor", scopes: []string{"grades:export"}, expected: []string{"ExecuteQuery", "ExportGrades", "GetCurrentGpaOfStudent"}},
+		{name: "Student with the scope", role: "student", scopes: []string{"grades:export"}, expected: []string{"ExecuteQuery", "GetCurrentGpaOfStudent"}},
+		{name: "Admin", role: "admin", expected: []string{"ExecuteQuery", "ExportGrades", "GetCurrentGpaOfStudent"}},
+		{name: "No caller", expected: []string{"ExecuteQuery"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), "userRole", tt.role)
+			ctx = context.WithValue(ctx, "userScopes", tt.scopes)
+
+			var names []string
+			for _, fd := range registry.GetFuncDefinitions(ctx) {
+				names = append(names, fd.Name)
+			}
+			assert.Equal(t, tt.expected, names)
+
+			// Execute agrees with the definitions given to the model
+			for _, name := range []string{"ExecuteQuery", "GetCurrentGpaOfStudent", "ExportGrades"} {
+				_, err := registry.Execute(ctx, ToolCall{Function: &FunctionCall{Name: name, Arguments: "{}"}})
+				if slices.Contains(tt.expected, name) {
+					assert.NoError(t, err, name)
+				} else {
+					assert.ErrorIs(t, err, ErrToolNotAllowed, name)
+				}
+			}
+		})
+	}
+}
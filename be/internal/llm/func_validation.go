@@ -0,0 +1,333 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/invopop/jsonschema"
+	"math"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// ValidationError is returned by FuncRegistry.Execute when the arguments of a tool call don't match the
+// parameters of the function, it is sent back to the model to correct the call
+type ValidationError struct {
+	Function string       `json:"function"`
+	Errors   []FieldError `json:"invalid_arguments"`
+}
+
+// FieldError is an invalid argument, Field is the path of the argument like "items[0].quantity"
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, fieldError := range e.Errors {
+		if fieldError.Field == "" {
+			messages = append(messages, fieldError.Message)
+		} else {
+			messages = append(messages, fieldError.Field+": "+fieldError.Message)
+		}
+	}
+	return fmt.Sprintf("invalid arguments for %s: %s", e.Function, strings.Join(messages, "; "))
+}
+
+// ValidateArgs checks the decoded JSON arguments against the schema of the parameters: the types, the required
+// and unknown fields, the enums, the ranges, the lengths, the patterns and the formats. A null value of an optional
+// field is accepted since the models often send them.
+func ValidateArgs(schema *jsonschema.Schema, args map[string]interface{}) []FieldError {
+	return validateValue(schema, args, "", nil)
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// patterns caches the compiled patterns of the schemas
+var patterns sync.Map
+
+// ------------------Private helper function------------------
+
+func validateValue(schema *jsonschema.Schema, value interface{}, path string, errs []FieldError) []FieldError {
+	if schema == nil || schema == jsonschema.TrueSchema {
+		return errs
+	}
+	if schema == jsonschema.FalseSchema {
+		return append(errs, FieldError{Field: path, Message: "is not allowed"})
+	}
+	if alternatives := slices.Concat(schema.AnyOf, schema.OneOf); len(alternatives) > 0 && !matchesAny(alternatives, value, path) {
+		errs = append(errs, FieldError{Field: path, Message: "does not match any of the allowed schemas"})
+	}
+	if schema.Type != "" && !matchesType(schema.Type, value) {
+		return append(errs, FieldError{Field: path, Message: fmt.Sprintf("must be %s, got %s", withArticle(schema.Type), jsonType(value))})
+	}
+	if len(schema.Enum) > 0 && !inEnum(schema.Enum, value) {
+		errs = append(errs, FieldError{Field: path, Message: "must be one of " + joinValues(schema.Enum)})
+	}
+	if schema.Const != nil && !sameValue(schema.Const, value) {
+		errs = append(errs, FieldError{Field: path, Message: fmt.Sprintf("must be %v", schema.Const)})
+	}
+
+	switch v := value.(type) {
+	case string:
+		errs = validateString(schema, v, path, errs)
+	case float64:
+		errs = validateNumber(schema, v, path, errs)
+	case []interface{}:
+		if schema.MinItems != nil && uint64(len(v)) < *schema.MinItems {
+			errs = append(errs, FieldError{Field: path, Message: fmt.Sprintf("must have at least %d items", *schema.MinItems)})
+		}
+		if schema.MaxItems != nil && uint64(len(v)) > *schema.MaxItems {
+			errs = append(errs, FieldError{Field: path, Message: fmt.Sprintf("must have at most %d items", *schema.MaxItems)})
+		}
+		for i, item := range v {
+			errs = validateValue(schema.Items, item, fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	case map[string]interface{}:
+		errs = validateObject(schema, v, path, errs)
+	}
+	return errs
+}
+
+func validateObject(schema *jsonschema.Schema, object map[string]interface{}, path string, errs []FieldError) []FieldError {
+	for _, name := range schema.Required {
+		if value, ok := object[name]; !ok || value == nil {
+			errs = append(errs, FieldError{Field: joinPath(path, name), Message: "is required"})
+		}
+	}
+
+	known := make(map[string]bool)
+	if schema.Properties != nil {
+		for pair := schema.Properties.Oldest(); pair != nil; pair = pair.Next() {
+			known[pair.Key] = true
+			// A null required field is already reported
+			value, ok := object[pair.Key]
+			if !ok || value == nil {
+				continue
+			}
+			errs = validateValue(pair.Value, value, joinPath(path, pair.Key), errs)
+		}
+	}
+
+	if schema.AdditionalProperties == nil || schema.AdditionalProperties == jsonschema.TrueSchema {
+		return errs
+	}
+	unknown := make([]string, 0)
+	for name := range object {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	// The map iteration order is random
+	slices.Sort(unknown)
+	for _, name := range unknown {
+		if schema.AdditionalProperties == jsonschema.FalseSchema {
+			errs = append(errs, FieldError{Field: joinPath(path, name), Message: "is not a known argument"})
+			continue
+		}
+		errs = validateValue(schema.AdditionalProperties, object[name], joinPath(path, name), errs)
+	}
+	return errs
+}
+
+func validateString(schema *jsonschema.Schema, value string, path string, errs []FieldError) []FieldError {
+	length := uint64(utf8.RuneCountInString(value))
+	if schema.MinLength != nil && length < *schema.MinLength {
+		if length == 0 {
+			errs = append(errs, FieldError{Field: path, Message: "must not be empty"})
+		} else {
+			errs = append(errs, FieldError{Field: path, Message: fmt.Sprintf("must have at least %d characters", *schema.MinLength)})
+		}
+	}
+	if schema.MaxLength != nil && length > *schema.MaxLength {
+		errs = append(errs, FieldError{Field: path, Message: fmt.Sprintf("must have at most %d characters", *schema.MaxLength)})
+	}
+	if schema.Pattern != "" {
+		if pattern := compilePattern(schema.Pattern); pattern != nil && !pattern.MatchString(value) {
+			errs = append(errs, FieldError{Field: path, Message: fmt.Sprintf("must match the pattern %s", schema.Pattern)})
+		}
+	}
+	if schema.Format != "" && !matchesFormat(schema.Format, value) {
+		errs = append(errs, FieldError{Field: path, Message: "must be a valid " + formatName(schema.Format)})
+	}
+	return errs
+}
+
+func validateNumber(schema *jsonschema.Schema, value float64, path string, errs []FieldError) []FieldError {
+	if limit, ok := numberOf(schema.Minimum); ok && value < limit {
+		errs = append(errs, FieldError{Field: path, Message: fmt.Sprintf("must be at least %s", schema.Minimum)})
+	}
+	if limit, ok := numberOf(schema.Maximum); ok && value > limit {
+		errs = append(errs, FieldError{Field: path, Message: fmt.Sprintf("must be at most %s", schema.Maximum)})
+	}
+	if limit, ok := numberOf(schema.ExclusiveMinimum); ok && value <= limit {
+		errs = append(errs, FieldError{Field: path, Message: fmt.Sprintf("must be greater than %s", schema.ExclusiveMinimum)})
+	}
+	if limit, ok := numberOf(schema.ExclusiveMaximum); ok && value >= limit {
+		errs = append(errs, FieldError{Field: path, Message: fmt.Sprintf("must be less than %s", schema.ExclusiveMaximum)})
+	}
+	if step, ok := numberOf(schema.MultipleOf); ok && step != 0 {
+		if quotient := value / step; math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			errs = append(errs, FieldError{Field: path, Message: fmt.Sprintf("must be a multiple of %s", schema.MultipleOf)})
+		}
+	}
+	return errs
+}
+
+func matchesAny(schemas []*jsonschema.Schema, value interface{}, path string) bool {
+	for _, schema := range schemas {
+		if len(validateValue(schema, value, path, nil)) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesType(schemaType string, value interface{}) bool {
+	switch schemaType {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == math.Trunc(number)
+	case "null":
+		return value == nil
+	}
+	return true
+}
+
+// jsonType names the type of the decoded JSON value for the error messages
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func matchesFormat(format string, value string) bool {
+	var err error
+	switch format {
+	case "date-time":
+		_, err = time.Parse(time.RFC3339, value)
+	case "date":
+		_, err = time.Parse(time.DateOnly, value)
+	case "time":
+		_, err = time.Parse(time.TimeOnly, value)
+	case "email":
+		_, err = mail.ParseAddress(value)
+	case "uri":
+		var parsed *url.URL
+		parsed, err = url.ParseRequestURI(value)
+		if err == nil && parsed.Scheme == "" {
+			return false
+		}
+	case "uuid":
+		return uuidPattern.MatchString(value)
+	}
+	// The unknown formats aren't checked
+	return err == nil
+}
+
+func formatName(format string) string {
+	switch format {
+	case "date-time":
+		return "date-time like 2025-03-14T15:30:00+07:00"
+	case "date":
+		return "date like 2025-03-14"
+	case "time":
+		return "time like 15:30:00"
+	}
+	return format
+}
+
+func compilePattern(pattern string) *regexp.Regexp {
+	if cached, ok := patterns.Load(pattern); ok {
+		return cached.(*regexp.Regexp)
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		// An invalid pattern of the schema isn't the fault of the model
+		return nil
+	}
+	patterns.Store(pattern, compiled)
+	return compiled
+}
+
+func numberOf(number json.Number) (float64, bool) {
+	if number == "" {
+		return 0, false
+	}
+	value, err := number.Float64()
+	return value, err == nil
+}
+
+// inEnum compares the values by their text since the enums of the tags are json.Number or string
+// while the arguments are decoded as float64
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, candidate := range enum {
+		if sameValue(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameValue(expected interface{}, value interface{}) bool {
+	return fmt.Sprint(expected) == fmt.Sprint(value)
+}
+
+func joinValues(values []interface{}) string {
+	texts := make([]string, 0, len(values))
+	for _, value := range values {
+		texts = append(texts, fmt.Sprint(value))
+	}
+	return strings.Join(texts, ", ")
+}
+
+func joinPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func withArticle(schemaType string) string {
+	switch schemaType {
+	case "object", "array", "integer":
+		return "an " + schemaType
+	}
+	return "a " + schemaType
+}
@@ -0,0 +1,113 @@
+package llm
+
+import (
+	"encoding/json"
+	"github.com/invopop/jsonschema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type validationTestArgs struct {
+	Code      string            `json:"code" jsonschema:"pattern=^[A-Z]{3}[0-9]{4}$"`
+	Semester  string            `json:"semester,omitempty" jsonschema:"enum=2024-2025-1,enum=2024-2025-2"`
+	Credits   int               `json:"credits,omitempty" jsonschema:"minimum=1,maximum=10"`
+	Score     float64           `json:"score,omitempty" jsonschema:"exclusiveMinimum=0"`
+	Note      string            `json:"note,omitempty" jsonschema:"minLength=2,maxLength=5"`
+	Date      string            `json:"date,omitempty" jsonschema:"format=date"`
+	Email     string            `json:"email,omitempty" jsonschema:"format=email"`
+	Tags      []string          `json:"tags,omitempty" jsonschema:"maxItems=2"`
+	Items     []validationItem  `json:"items,omitempty"`
+	StudentId *int              `json:"student_id,omitempty"`
+	Extra     map[string]string `json:"extra,omitempty"`
+}
+
+type validationItem struct {
+	Quantity int `json:"quantity" jsonschema:"minimum=1"`
+}
+
+func TestValidateArgs(t *testing.T) {
+	reflector := jsonschema.Reflector{ExpandedStruct: true, DoNotReference: true}
+	schema := reflector.Reflect(new(validationTestArgs))
+
+	tests := []struct {
+		name      string
+		arguments string
+		expected  []FieldError
+	}{
+		{
+			name:      "Valid arguments",
+			arguments: `{"code": "INT3306", "semester": "2024-2025-2", "credits": 3, "score": 8.5, "date": "2025-03-14", "email": "an@vnu.edu.vn", "tags": ["ai"], "items": [{"quantity": 1}], "extra": {"a": "b"}}`,
+		},
+		{
+			name:      "Null optional field",
+			arguments: `{"code": "INT3306", "student_id": null}`,
+		},
+		{
+			name:      "Missing and null required field",
+			arguments: `{"code": null}`,
+			expected:  []FieldError{{Field: "code", Message: "is required"}},
+		},
+		{
+			name:      "Enum",
+			arguments: `{"code": "INT3306", "semester": "2025"}`,
+			expected:  []FieldError{{Field: "semester", Message: "must be one of 2024-2025-1, 2024-2025-2"}},
+		},
+		{
+			name:      "Ranges",
+			arguments: `{"code": "INT3306", "credits": 11, "score": 0}`,
+			expected: []FieldError{
+				{Field: "credits", Message: "must be at most 10"},
+				{Field: "score", Message: "must be greater than 0"},
+			},
+		},
+		{
+			name:      "Integer with a fraction",
+			arguments: `{"code": "INT3306", "credits": 2.5}`,
+			expected:  []FieldError{{Field: "credits", Message: "must be an integer, got number"}},
+		},
+		{
+			name:      "Lengths and formats",
+			arguments: `{"code": "INT3306", "note": "ghi chú dài", "date": "14/03/2025", "email": "an"}`,
+			expected: []FieldError{
+				{Field: "note", Message: "must have at most 5 characters"},
+				{Field: "date", Message: "must be a valid date like 2025-03-14"},
+				{Field: "email", Message: "must be a valid email"},
+			},
+		},
+		{
+			name:      "Arrays",
+			arguments: `{"code": "INT3306", "tags": ["a", "b", 3], "items": [{"quantity": 1}, {"quantity": 0}]}`,
+			expected: []FieldError{
+				{Field: "tags", Message: "must have at most 2 items"},
+				{Field: "tags[2]", Message: "must be a string, got integer"},
+				{Field: "items[1].quantity", Message: "must be at least 1"},
+			},
+		},
+		{
+			name:      "Unknown arguments and map values",
+			arguments: `{"code": "INT3306", "semestr": "2024-2025-1", "extra": {"a": 1}, "limit": 5}`,
+			expected: []FieldError{
+				{Field: "extra.a", Message: "must be a string, got integer"},
+				{Field: "limit", Message: "is not a known argument"},
+				{Field: "semestr", Message: "is not a known argument"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var args map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(tt.arguments), &args))
+			assert.Equal(t, tt.expected, ValidateArgs(schema, args))
+		})
+	}
+}
+
+func TestValidationError_Error(t *testing.T) {
+	err := &ValidationError{Function: "ExecuteQuery", Errors: []FieldError{
+		{Field: "query", Message: "is required"},
+		{Message: "does not match any of the allowed schemas"},
+	}}
+	assert.Equal(t, "invalid arguments for ExecuteQuery: query: is required; does not match any of the allowed schemas", err.Error())
+}
@@ -2,62 +2,88 @@ package llm
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/google/generative-ai-go/genai"
 	"github.com/invopop/jsonschema"
+	"github.com/sashabaranov/go-openai"
 	"google.golang.org/api/iterator"
 	"log"
+	"strings"
 )
 
+// DefaultGeminiModel is used when the model of the request isn't a Gemini model, e.g. the OpenAI models of the chatbot
+const DefaultGeminiModel = "gemini-2.0-flash"
+
 type GeminiProvider struct {
 	client *genai.Client
+	model  string
 }
 
-func NewGeminiAIProvider(client *genai.Client) *GeminiProvider {
-	return &GeminiProvider{client: client}
+func NewGeminiAIProvider(client *genai.Client, model string) *GeminiProvider {
+	if model == "" {
+		model = DefaultGeminiModel
+	}
+	return &GeminiProvider{client: client, model: model}
 }
 
 func (p *GeminiProvider) Complete(ctx context.Context, req CompletionRequest) (Message, error) {
-	model := p.client.GenerativeModel("gemini-2.0-pro-exp-02-05")
-	if req.ResponseFormat != nil {
-		model.ResponseMIMEType = toResponseMIMEType(req.ResponseFormat.Type)
-		model.ResponseSchema = convertJsonSchemaToGeminiSchema(req.ResponseFormat.Schema)
+	chatSession, lastParts, err := p.startChat(req)
+	if err != nil {
+		return Message{}, err
 	}
-	chatStream := model.StartChat()
-	res, err := chatStream.SendMessage(ctx, p.extractParts(req.Messages)...)
+	res, err := chatSession.SendMessage(ctx, lastParts...)
 	if err != nil {
 		return Message{}, err
 	}
+	if len(res.Candidates) == 0 || res.Candidates[0].Content == nil {
+		return Message{}, errors.New("no candidates found")
+	}
 
-	return Message{
-		Content: fmt.Sprintf("%v", res.Candidates[0].Content.Parts[0]),
-	}, nil
+	message := fromGeminiContent(res.Candidates[0].Content)
+	message.Usage = fromGeminiUsage(p.modelName(req.Model), res.UsageMetadata)
+	return message, nil
 }
 
 func (p *GeminiProvider) StreamComplete(ctx context.Context, req CompletionRequest) (<-chan StreamChunk, error) {
-	model := p.client.GenerativeModel("gemini-2.0-pro-exp-02-05")
-	chatStream := model.StartChat()
-	resIterator := chatStream.SendMessageStream(ctx, p.extractParts(req.Messages)...)
+	chatSession, lastParts, err := p.startChat(req)
+	if err != nil {
+		return nil, err
+	}
+	resIterator := chatSession.SendMessageStream(ctx, lastParts...)
 
 	chunks := make(chan StreamChunk)
 
 	go func() {
 		defer close(chunks)
 
+		// Each response has the usage of the stream so far
+		var usage *Usage
 		for {
 			resp, err := resIterator.Next()
 			if errors.Is(err, iterator.Done) {
-				chunks <- StreamChunk{Done: true}
+				chunks <- StreamChunk{Usage: usage, Done: true}
 				return
 			}
 			if err != nil {
 				log.Printf("Error in StreamComplete: %v", err)
 				return
 			}
+			if resp.UsageMetadata != nil {
+				usage = fromGeminiUsage(p.modelName(req.Model), resp.UsageMetadata)
+			}
+			if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+				continue
+			}
 
+			// Gemini streams the function calls whole, so they are sent in the chunk they come in
+			message := fromGeminiContent(resp.Candidates[0].Content)
 			chunks <- StreamChunk{
-				Content: fmt.Sprintf("%v", resp.Candidates[0].Content.Parts[0]),
+				Content:   message.Content,
+				ToolCalls: message.ToolCalls,
 			}
 		}
 	}()
@@ -66,12 +92,199 @@ func (p *GeminiProvider) StreamComplete(ctx context.Context, req CompletionReque
 }
 
 // -----------------Private Helper Functions-----------------
-func (p *GeminiProvider) extractParts(messages []Message) []genai.Part {
-	var parts []genai.Part
+
+// startChat configures the model for the request and returns the chat session holding the previous turns,
+// with the parts of the last turn to send
+func (p *GeminiProvider) startChat(req CompletionRequest) (*genai.ChatSession, []genai.Part, error) {
+	model := p.client.GenerativeModel(p.modelName(req.Model))
+	contents, err := configureModel(model, req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	chatSession := model.StartChat()
+	chatSession.History = contents[:len(contents)-1]
+	return chatSession, contents[len(contents)-1].Parts, nil
+}
+
+func fromGeminiUsage(model string, usage *genai.UsageMetadata) *Usage {
+	if usage == nil {
+		return nil
+	}
+	return &Usage{
+		Model:            model,
+		PromptTokens:     int(usage.PromptTokenCount),
+		CompletionTokens: int(usage.CandidatesTokenCount),
+		TotalTokens:      int(usage.TotalTokenCount),
+	}
+}
+
+// modelName returns the requested model if it is a Gemini model, otherwise the model of the provider
+func (p *GeminiProvider) modelName(requested string) string {
+	if strings.HasPrefix(requested, "gemini") {
+		return requested
+	}
+	return p.model
+}
+
+// configureModel sets the response format, the tools and the system instruction of the request on the model
+// and returns the turns of the conversation
+func configureModel(model *genai.GenerativeModel, req CompletionRequest) ([]*genai.Content, error) {
+	if req.ResponseFormat != nil {
+		model.ResponseMIMEType = toResponseMIMEType(req.ResponseFormat.Type)
+		model.ResponseSchema = convertJsonSchemaToGeminiSchema(req.ResponseFormat.Schema)
+	}
+	model.Tools = toGeminiTools(req.Tools)
+	model.ToolConfig = toGeminiToolConfig(req.FunctionCallingMode)
+
+	systemInstruction, contents, err := toGeminiContents(req.Messages)
+	if err != nil {
+		return nil, err
+	}
+	if len(contents) == 0 {
+		return nil, errors.New("no user or assistant message to send")
+	}
+	model.SystemInstruction = systemInstruction
+	return contents, nil
+}
+
+// toGeminiContents converts the messages to the system instruction and the turns of the conversation.
+// The system messages are joined into the system instruction, the assistant messages are the turns of the model
+// and the tool messages are function responses of the user turn, named after the tool call they answer.
+// The consecutive messages of the same role are merged, as Gemini expects the user and the model to alternate.
+func toGeminiContents(messages []Message) (*genai.Content, []*genai.Content, error) {
+	var systemInstruction *genai.Content
+	var contents []*genai.Content
+	toolCallNames := make(map[string]string)
+
 	for _, msg := range messages {
-		parts = append(parts, genai.Text(msg.Content))
+		var role string
+		var parts []genai.Part
+		switch msg.Role {
+		case openai.ChatMessageRoleSystem:
+			if systemInstruction == nil {
+				systemInstruction = &genai.Content{}
+			}
+			systemInstruction.Parts = append(systemInstruction.Parts, genai.Text(msg.Content))
+			continue
+		case openai.ChatMessageRoleAssistant:
+			role = "model"
+			if msg.Content != "" {
+				parts = append(parts, genai.Text(msg.Content))
+			}
+			for _, toolCall := range msg.ToolCalls {
+				if toolCall.Function == nil {
+					continue
+				}
+				args := make(map[string]any)
+				if toolCall.Function.Arguments != "" {
+					if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &args); err != nil {
+						return nil, nil, fmt.Errorf("invalid arguments of tool call %s: %w", toolCall.ID, err)
+					}
+				}
+				toolCallNames[toolCall.ID] = toolCall.Function.Name
+				parts = append(parts, genai.FunctionCall{Name: toolCall.Function.Name, Args: args})
+			}
+		case openai.ChatMessageRoleTool:
+			role = "user"
+			name, ok := toolCallNames[msg.ToolCallId]
+			if !ok {
+				return nil, nil, fmt.Errorf("tool message answers unknown tool call %s", msg.ToolCallId)
+			}
+			parts = append(parts, genai.FunctionResponse{Name: name, Response: toFunctionResponse(msg.Content)})
+		default:
+			role = "user"
+			parts = append(parts, genai.Text(msg.Content))
+		}
+
+		if len(parts) == 0 {
+			continue
+		}
+		if len(contents) > 0 && contents[len(contents)-1].Role == role {
+			contents[len(contents)-1].Parts = append(contents[len(contents)-1].Parts, parts...)
+			continue
+		}
+		contents = append(contents, &genai.Content{Role: role, Parts: parts})
+	}
+	return systemInstruction, contents, nil
+}
+
+// toFunctionResponse converts the result of a tool to the JSON object of a function response,
+// the results which aren't JSON objects are wrapped in a "result" field
+func toFunctionResponse(content string) map[string]any {
+	var result any
+	if err := json.Unmarshal([]byte(content), &result); err != nil {
+		return map[string]any{"result": content}
+	}
+	if object, ok := result.(map[string]any); ok {
+		return object
+	}
+	return map[string]any{"result": result}
+}
+
+// fromGeminiContent converts a turn of the model to an assistant message.
+// Gemini doesn't identify the function calls, so they are given ids to match the tool messages answering them.
+func fromGeminiContent(content *genai.Content) Message {
+	message := Message{Role: openai.ChatMessageRoleAssistant}
+	var text strings.Builder
+	for _, part := range content.Parts {
+		switch part := part.(type) {
+		case genai.Text:
+			text.WriteString(string(part))
+		case genai.FunctionCall:
+			arguments, _ := json.Marshal(part.Args)
+			message.ToolCalls = append(message.ToolCalls, ToolCall{
+				ID:       newToolCallID(),
+				Type:     ToolTypeFunction,
+				Function: &FunctionCall{Name: part.Name, Arguments: string(arguments)},
+			})
+		}
+	}
+	message.Content = text.String()
+	return message
+}
+
+func newToolCallID() string {
+	id := make([]byte, 12)
+	_, _ = rand.Read(id)
+	return "call_" + hex.EncodeToString(id)
+}
+
+func toGeminiTools(tools []Tool) []*genai.Tool {
+	if len(tools) == 0 {
+		return nil
+	}
+	declarations := make([]*genai.FunctionDeclaration, 0, len(tools))
+	for _, tool := range tools {
+		if tool.Function == nil {
+			continue
+		}
+		declaration := &genai.FunctionDeclaration{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+		}
+		// Gemini rejects the object parameters without properties
+		if tool.Function.Parameters != nil && tool.Function.Parameters.Properties != nil && tool.Function.Parameters.Properties.Len() > 0 {
+			declaration.Parameters = convertJsonSchemaToGeminiSchema(tool.Function.Parameters)
+		}
+		declarations = append(declarations, declaration)
+	}
+	return []*genai.Tool{{FunctionDeclarations: declarations}}
+}
+
+func toGeminiToolConfig(mode FunctionCallingMode) *genai.ToolConfig {
+	var geminiMode genai.FunctionCallingMode
+	switch mode {
+	case Auto:
+		geminiMode = genai.FunctionCallingAuto
+	case Required:
+		geminiMode = genai.FunctionCallingAny
+	case None:
+		geminiMode = genai.FunctionCallingNone
+	default:
+		return nil
 	}
-	return parts
+	return &genai.ToolConfig{FunctionCallingConfig: &genai.FunctionCallingConfig{Mode: geminiMode}}
 }
 
 func toResponseMIMEType(formatType ResponseFormatType) string {
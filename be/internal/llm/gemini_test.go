@@ -0,0 +1,126 @@
+package llm
+
+import (
+	"context"
+	"github.com/google/generative-ai-go/genai"
+	"github.com/invopop/jsonschema"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+	"strings"
+	"testing"
+)
+
+func TestToGeminiContents(t *testing.T) {
+	messages := []Message{
+		{Role: openai.ChatMessageRoleSystem, Content: "Summary of the earlier conversation: ..."},
+		{Role: openai.ChatMessageRoleUser, Content: "Điểm của tôi?"},
+		{Role: openai.ChatMessageRoleAssistant, ToolCalls: []ToolCall{
+			{ID: "call_a", Type: ToolTypeFunction, Function: &FunctionCall{Name: "ExecuteQuery", Arguments: `{"query":"SELECT 1"}`}},
+			{ID: "call_b", Type: ToolTypeFunction, Function: &FunctionCall{Name: "GetCurrentGpaOfStudent", Arguments: `{"student_id":1}`}},
+		}},
+		{Role: openai.ChatMessageRoleTool, ToolCallId: "call_a", Content: `{"data":[{"?column?":1}]}`},
+		{Role: openai.ChatMessageRoleTool, ToolCallId: "call_b", Content: "Error: student not found"},
+		{Role: openai.ChatMessageRoleUser, Content: "Trả lời ngắn gọn"},
+	}
+
+	systemInstruction, contents, err := toGeminiContents(messages)
+	require.NoError(t, err)
+	assert.Equal(t, &genai.Content{Parts: []genai.Part{genai.Text("Summary of the earlier conversation: ...")}}, systemInstruction)
+
+	// The function responses and the next user message are merged into one user turn
+	assert.Equal(t, []*genai.Content{
+		{Role: "user", Parts: []genai.Part{genai.Text("Điểm của tôi?")}},
+		{Role: "model", Parts: []genai.Part{
+			genai.FunctionCall{Name: "ExecuteQuery", Args: map[string]any{"query": "SELECT 1"}},
+			genai.FunctionCall{Name: "GetCurrentGpaOfStudent", Args: map[string]any{"student_id": float64(1)}},
+		}},
+		{Role: "user", Parts: []genai.Part{
+			genai.FunctionResponse{Name: "ExecuteQuery", Response: map[string]any{"data": []any{map[string]any{"?column?": float64(1)}}}},
+			genai.FunctionResponse{Name: "GetCurrentGpaOfStudent", Response: map[string]any{"result": "Error: student not found"}},
+			genai.Text("Trả lời ngắn gọn"),
+		}},
+	}, contents)
+
+	// A tool message must answer a tool call of the assistant
+	_, _, err = toGeminiContents([]Message{{Role: openai.ChatMessageRoleTool, ToolCallId: "call_x", Content: "{}"}})
+	assert.Error(t, err)
+}
+
+func TestFromGeminiContent(t *testing.T) {
+	message := fromGeminiContent(&genai.Content{Role: "model", Parts: []genai.Part{
+		genai.Text("Let me check. "),
+		genai.FunctionCall{Name: "ExecuteQuery", Args: map[string]any{"query": "SELECT 1"}},
+		genai.FunctionCall{Name: "ExecuteQuery", Args: map[string]any{"query": "SELECT 2"}},
+	}})
+
+	assert.Equal(t, openai.ChatMessageRoleAssistant, message.Role)
+	assert.Equal(t, "Let me check. ", message.Content)
+	require.Len(t, message.ToolCalls, 2)
+	assert.Equal(t, &FunctionCall{Name: "ExecuteQuery", Arguments: `{"query":"SELECT 2"}`}, message.ToolCalls[1].Function)
+	assert.True(t, strings.HasPrefix(message.ToolCalls[0].ID, "call_"))
+	assert.NotEqual(t, message.ToolCalls[0].ID, message.ToolCalls[1].ID)
+}
+
+func TestToGeminiTools(t *testing.T) {
+	type queryArgs struct {
+		Query string `json:"query" jsonschema:"description=The SQL query"`
+	}
+	type noArgs struct{}
+	reflector := jsonschema.Reflector{ExpandedStruct: true, DoNotReference: true}
+
+	tools := toGeminiTools([]Tool{
+		{Type: ToolTypeFunction, Function: &FuncDefinition{Name: "ExecuteQuery", Description: "Run a SQL query", Parameters: reflector.Reflect(new(queryArgs))}},
+		{Type: ToolTypeFunction, Function: &FuncDefinition{Name: "Now", Description: "Current time", Parameters: reflector.Reflect(new(noArgs))}},
+	})
+
+	require.Len(t, tools, 1)
+	require.Len(t, tools[0].FunctionDeclarations, 2)
+	declaration := tools[0].FunctionDeclarations[0]
+	assert.Equal(t, "ExecuteQuery", declaration.Name)
+	assert.Equal(t, genai.TypeObject, declaration.Parameters.Type)
+	assert.Equal(t, &genai.Schema{Type: genai.TypeString, Description: "The SQL query"}, declaration.Parameters.Properties["query"])
+	assert.Equal(t, []string{"query"}, declaration.Parameters.Required)
+	assert.Nil(t, tools[0].FunctionDeclarations[1].Parameters)
+
+	assert.Nil(t, toGeminiTools(nil))
+	assert.Nil(t, toGeminiToolConfig(""))
+	assert.Equal(t, genai.FunctionCallingAny, toGeminiToolConfig(Required).FunctionCallingConfig.Mode)
+}
+
+func TestGeminiProvider_ConfigureModel(t *testing.T) {
+	client, err := genai.NewClient(context.Background(), option.WithAPIKey("test"))
+	require.NoError(t, err)
+	defer client.Close()
+	provider := NewGeminiAIProvider(client, "")
+
+	// The OpenAI models of the chatbot are replaced by the model of the provider
+	assert.Equal(t, DefaultGeminiModel, provider.modelName(openai.O3Mini20250131))
+	assert.Equal(t, "gemini-1.5-pro", provider.modelName("gemini-1.5-pro"))
+
+	type queryArgs struct {
+		Query string `json:"query"`
+	}
+	reflector := jsonschema.Reflector{ExpandedStruct: true, DoNotReference: true}
+	model := client.GenerativeModel(DefaultGeminiModel)
+	contents, err := configureModel(model, CompletionRequest{
+		Messages: []Message{
+			{Role: openai.ChatMessageRoleSystem, Content: "You are a chatbot"},
+			{Role: openai.ChatMessageRoleUser, Content: "How many students?"},
+		},
+		Tools:               []Tool{{Type: ToolTypeFunction, Function: &FuncDefinition{Name: "ExecuteQuery", Description: "Run a SQL query", Parameters: reflector.Reflect(new(queryArgs))}}},
+		FunctionCallingMode: Required,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []*genai.Content{{Role: "user", Parts: []genai.Part{genai.Text("How many students?")}}}, contents)
+	assert.Equal(t, &genai.Content{Parts: []genai.Part{genai.Text("You are a chatbot")}}, model.SystemInstruction)
+	require.Len(t, model.Tools, 1)
+	assert.Equal(t, "ExecuteQuery", model.Tools[0].FunctionDeclarations[0].Name)
+	assert.Equal(t, genai.FunctionCallingAny, model.ToolConfig.FunctionCallingConfig.Mode)
+
+	// A request with only system messages has nothing to send
+	_, err = configureModel(client.GenerativeModel(DefaultGeminiModel), CompletionRequest{Messages: []Message{{Role: openai.ChatMessageRoleSystem, Content: "You are a chatbot"}}})
+	assert.Error(t, err)
+}
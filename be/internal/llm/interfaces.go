@@ -36,6 +36,16 @@ type Message struct {
 	ToolCalls  []ToolCall `json:"tool_call,omitempty"`
 	ToolCallId string     `json:"tool_call_id,omitempty"`
 	Id         string     `json:"id"`
+	// Usage is only set on the responses of the providers which report it
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+// Usage is the token usage of a completion, Model is the model which answered, e.g. a fallback model
+type Usage struct {
+	Model            string `json:"model,omitempty"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	TotalTokens      int    `json:"total_tokens"`
 }
 
 // ToolCall represents an actual tool invocation by the model
@@ -65,8 +75,10 @@ type ResponseFormat struct {
 }
 
 type CompletionRequest struct {
-	Messages            []Message
-	Model               string
+	Messages []Message
+	Model    string
+	// Provider is the name of the provider the router tries first for the model, the order of the router is kept if empty
+	Provider            string
 	ResponseFormat      *ResponseFormat
 	Tools               []Tool
 	FunctionCallingMode FunctionCallingMode
@@ -74,5 +86,9 @@ type CompletionRequest struct {
 
 type StreamChunk struct {
 	Content string
-	Done    bool
+	// ToolCalls are sent complete, the providers streaming them in pieces send them with the Done chunk
+	ToolCalls []ToolCall
+	// Usage is sent with the Done chunk if the provider reports it
+	Usage *Usage
+	Done  bool
 }
@@ -0,0 +1,277 @@
+package llm
+
+import (
+	"HNLP/be/internal/config"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ToolCallingAuto prompts for the tool calls once the model rejects the tools
+	ToolCallingAuto = "auto"
+	// ToolCallingNative always sends the tools to the model
+	ToolCallingNative = "native"
+	// ToolCallingPrompt always describes the tools in the prompt and parses the tool calls from the JSON answer
+	ToolCallingPrompt = "prompt"
+
+	// LocalToolPromptTemplate describes the tools to the models without tool calling support
+	LocalToolPromptTemplate = `You can call the following tools, the arguments of a tool are a JSON object matching its parameters schema:
+%s
+To call tools, answer only with the JSON object {"tool_calls": [{"name": "<tool name>", "arguments": {<arguments>}}]}.
+To answer without calling a tool, answer only with the JSON object {"content": "<your answer>"}.
+%s`
+	// LocalToolPromptRequired is added to the tool prompt when the model must call a tool
+	LocalToolPromptRequired = "You must call at least one tool."
+)
+
+// LocalProvider talks to a self-hosted LLM server, either through its OpenAI-compatible API or the native Ollama API.
+// The models requested by the chatbot are mapped to the local models and the models without tool calling support
+// are prompted to answer the tool calls in JSON.
+type LocalProvider struct {
+	backend     AIProvider
+	cfg         config.LocalLLMConfig
+	toolCalling string
+
+	// noToolSupport remembers the models which rejected the tools in the auto mode
+	noToolSupport      map[string]bool
+	noToolSupportMutex sync.RWMutex
+}
+
+func NewLocalProvider(cfg config.LocalLLMConfig) *LocalProvider {
+	httpClient := &http.Client{Timeout: time.Duration(cfg.TimeoutSeconds) * time.Second}
+
+	var backend AIProvider
+	if cfg.API == "ollama" {
+		backend = NewOllamaProvider(cfg.BaseURL, httpClient)
+	} else {
+		clientConfig := openai.DefaultConfig(cfg.APIKey)
+		clientConfig.BaseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+		clientConfig.HTTPClient = httpClient
+		backend = NewOpenAIProvider(openai.NewClientWithConfig(clientConfig))
+	}
+
+	toolCalling := cfg.ToolCalling
+	if toolCalling == "" {
+		toolCalling = ToolCallingAuto
+	}
+	return &LocalProvider{
+		backend:       backend,
+		cfg:           cfg,
+		toolCalling:   toolCalling,
+		noToolSupport: make(map[string]bool),
+	}
+}
+
+func (p *LocalProvider) Complete(ctx context.Context, req CompletionRequest) (Message, error) {
+	req.Model = p.modelName(req.Model)
+	if !p.promptsTools(req) {
+		response, err := p.backend.Complete(ctx, p.withoutToolMessages(req))
+		if err == nil || !p.fallsBack(req, err) {
+			return response, err
+		}
+	}
+	return p.completeWithToolPrompt(ctx, req)
+}
+
+func (p *LocalProvider) StreamComplete(ctx context.Context, req CompletionRequest) (<-chan StreamChunk, error) {
+	req.Model = p.modelName(req.Model)
+	if !p.promptsTools(req) {
+		chunks, err := p.backend.StreamComplete(ctx, p.withoutToolMessages(req))
+		if err == nil || !p.fallsBack(req, err) {
+			return chunks, err
+		}
+	}
+
+	// The JSON answer is parsed whole, so it is sent in a single chunk
+	response, err := p.completeWithToolPrompt(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	chunks := make(chan StreamChunk, 2)
+	chunks <- StreamChunk{Content: response.Content, ToolCalls: response.ToolCalls}
+	chunks <- StreamChunk{Usage: response.Usage, Done: true}
+	close(chunks)
+	return chunks, nil
+}
+
+// ------------------Private helper function------------------
+
+func (p *LocalProvider) modelName(requested string) string {
+	if model, ok := p.cfg.Models[requested]; ok {
+		return model
+	}
+	if p.cfg.DefaultModel != "" {
+		return p.cfg.DefaultModel
+	}
+	return requested
+}
+
+// promptsTools reports whether the tools of the request are described in the prompt instead of sent to the model
+func (p *LocalProvider) promptsTools(req CompletionRequest) bool {
+	return len(req.Tools) > 0 && req.FunctionCallingMode != None && p.promptedModel(req.Model)
+}
+
+// promptedModel reports whether the tools are described in the prompt of the model
+func (p *LocalProvider) promptedModel(model string) bool {
+	switch p.toolCalling {
+	case ToolCallingPrompt:
+		return true
+	case ToolCallingNative:
+		return false
+	default:
+		p.noToolSupportMutex.RLock()
+		defer p.noToolSupportMutex.RUnlock()
+		return p.noToolSupport[model]
+	}
+}
+
+// withoutToolMessages converts the previous tool calls of a request without tool calls to the prompted form
+// if the tools of the model are prompted, as such a model doesn't know the tool messages
+func (p *LocalProvider) withoutToolMessages(req CompletionRequest) CompletionRequest {
+	if !p.promptedModel(req.Model) {
+		return req
+	}
+	req.Tools = nil
+	req.FunctionCallingMode = ""
+	req.Messages = toPromptedMessages(req.Messages)
+	return req
+}
+
+// fallsBack reports whether the failed request is retried with the tool prompt, which is the case in the auto mode
+// when the server rejected the tools of the request. The model is then prompted for the next requests as well.
+func (p *LocalProvider) fallsBack(req CompletionRequest, err error) bool {
+	if p.toolCalling != ToolCallingAuto || len(req.Tools) == 0 || req.FunctionCallingMode == None {
+		return false
+	}
+	// e.g. "model does not support tools" of Ollama or "auto tool choice requires --enable-auto-tool-choice" of vLLM
+	if !strings.Contains(strings.ToLower(err.Error()), "tool") {
+		return false
+	}
+	log.Printf("Model %s rejected the tools, prompting for the tool calls instead: %v", req.Model, err)
+	p.noToolSupportMutex.Lock()
+	defer p.noToolSupportMutex.Unlock()
+	p.noToolSupport[req.Model] = true
+	return true
+}
+
+func (p *LocalProvider) completeWithToolPrompt(ctx context.Context, req CompletionRequest) (Message, error) {
+	promptRequest, err := toToolPromptRequest(req)
+	if err != nil {
+		return Message{}, err
+	}
+	response, err := p.backend.Complete(ctx, promptRequest)
+	if err != nil {
+		return Message{}, err
+	}
+	answer := parseToolPromptAnswer(response.Content)
+	answer.Usage = response.Usage
+	return answer, nil
+}
+
+// toToolPromptRequest describes the tools in a system message and asks for a JSON answer
+func toToolPromptRequest(req CompletionRequest) (CompletionRequest, error) {
+	var tools strings.Builder
+	for _, tool := range req.Tools {
+		if tool.Function == nil {
+			continue
+		}
+		parameters, err := json.Marshal(tool.Function.Parameters)
+		if err != nil {
+			return CompletionRequest{}, err
+		}
+		tools.WriteString(fmt.Sprintf("- %s: %s\n  parameters: %s\n", tool.Function.Name, tool.Function.Description, parameters))
+	}
+	required := ""
+	if req.FunctionCallingMode == Required {
+		required = LocalToolPromptRequired
+	}
+
+	return CompletionRequest{
+		Messages: append(
+			[]Message{{Role: openai.ChatMessageRoleSystem, Content: fmt.Sprintf(LocalToolPromptTemplate, tools.String(), required)}},
+			toPromptedMessages(req.Messages)...,
+		),
+		Model:          req.Model,
+		ResponseFormat: &ResponseFormat{Type: ResponseFormatTypeJson},
+	}, nil
+}
+
+// toPromptedMessages converts the previous tool calls and their results to the JSON answers of the tool prompt
+// and to user messages
+func toPromptedMessages(messages []Message) []Message {
+	result := make([]Message, 0, len(messages))
+	toolCallNames := make(map[string]string)
+	for _, msg := range messages {
+		switch {
+		case len(msg.ToolCalls) > 0:
+			answer := toolPromptAnswer{Content: msg.Content}
+			for _, toolCall := range msg.ToolCalls {
+				if toolCall.Function == nil {
+					continue
+				}
+				toolCallNames[toolCall.ID] = toolCall.Function.Name
+				arguments := json.RawMessage(toolCall.Function.Arguments)
+				if !json.Valid(arguments) {
+					arguments = json.RawMessage("{}")
+				}
+				answer.ToolCalls = append(answer.ToolCalls, toolPromptCall{Name: toolCall.Function.Name, Arguments: arguments})
+			}
+			content, _ := json.Marshal(answer)
+			result = append(result, Message{Role: openai.ChatMessageRoleAssistant, Content: string(content)})
+		case msg.Role == openai.ChatMessageRoleTool:
+			result = append(result, Message{
+				Role:    openai.ChatMessageRoleUser,
+				Content: fmt.Sprintf("Result of the tool call %s: %s", toolCallNames[msg.ToolCallId], msg.Content),
+			})
+		default:
+			result = append(result, Message{Role: msg.Role, Content: msg.Content})
+		}
+	}
+	return result
+}
+
+type toolPromptAnswer struct {
+	ToolCalls []toolPromptCall `json:"tool_calls,omitempty"`
+	Content   string           `json:"content,omitempty"`
+}
+
+type toolPromptCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// parseToolPromptAnswer reads the tool calls of the JSON answer, an answer which isn't JSON is the content itself
+func parseToolPromptAnswer(content string) Message {
+	message := Message{Role: openai.ChatMessageRoleAssistant, Content: content}
+
+	// The models often wrap the JSON in a markdown code block
+	trimmed := strings.TrimSpace(content)
+	trimmed = strings.TrimPrefix(trimmed, "```json")
+	trimmed = strings.TrimPrefix(trimmed, "```")
+	trimmed = strings.TrimSpace(strings.TrimSuffix(trimmed, "```"))
+
+	var answer toolPromptAnswer
+	if err := json.Unmarshal([]byte(trimmed), &answer); err != nil {
+		return message
+	}
+	message.Content = answer.Content
+	for _, toolCall := range answer.ToolCalls {
+		arguments := string(toolCall.Arguments)
+		if arguments == "" || arguments == "null" {
+			arguments = "{}"
+		}
+		message.ToolCalls = append(message.ToolCalls, ToolCall{
+			ID:       newToolCallID(),
+			Type:     ToolTypeFunction,
+			Function: &FunctionCall{Name: toolCall.Name, Arguments: arguments},
+		})
+	}
+	return message
+}
@@ -0,0 +1,201 @@
+package llm
+
+import (
+	"HNLP/be/internal/config"
+	"context"
+	"encoding/json"
+	"github.com/invopop/jsonschema"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// stubServer records the JSON bodies of the requests and answers them with the handler
+type stubServer struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	requests []map[string]any
+}
+
+func newStubServer(t *testing.T, handler func(w http.ResponseWriter, body map[string]any)) *stubServer {
+	stub := &stubServer{}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		raw, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(raw, &body)
+		stub.mutex.Lock()
+		stub.requests = append(stub.requests, body)
+		stub.mutex.Unlock()
+		handler(w, body)
+	}))
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+func queryTool() Tool {
+	type queryArgs struct {
+		Query string `json:"query"`
+	}
+	reflector := jsonschema.Reflector{ExpandedStruct: true, DoNotReference: true}
+	return Tool{Type: ToolTypeFunction, Function: &FuncDefinition{Name: "ExecuteQuery", Description: "Run a SQL query", Parameters: reflector.Reflect(new(queryArgs))}}
+}
+
+func openAICompletion(message string) string {
+	return `{"id":"1","object":"chat.completion","choices":[{"index":0,"finish_reason":"stop","message":` + message + `}]}`
+}
+
+func TestLocalProvider_Complete_NativeTools(t *testing.T) {
+	stub := newStubServer(t, func(w http.ResponseWriter, body map[string]any) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(openAICompletion(`{"role":"assistant","tool_calls":[{"id":"call_1","type":"function","function":{"name":"ExecuteQuery","arguments":"{\"query\":\"SELECT 1\"}"}}]}`)))
+	})
+	provider := NewLocalProvider(config.LocalLLMConfig{
+		BaseURL: stub.URL + "/v1",
+		Models:  map[string]string{openai.O3Mini20250131: "qwen2.5:14b"},
+	})
+
+	response, err := provider.Complete(context.Background(), CompletionRequest{
+		Messages:            []Message{{Role: openai.ChatMessageRoleUser, Content: "How many students?"}},
+		Model:               openai.O3Mini20250131,
+		Tools:               []Tool{queryTool()},
+		FunctionCallingMode: Required,
+	})
+	require.NoError(t, err)
+
+	require.Len(t, stub.requests, 1)
+	assert.Equal(t, "qwen2.5:14b", stub.requests[0]["model"])
+	assert.Len(t, stub.requests[0]["tools"], 1)
+	require.Len(t, response.ToolCalls, 1)
+	assert.Equal(t, &FunctionCall{Name: "ExecuteQuery", Arguments: `{"query":"SELECT 1"}`}, response.ToolCalls[0].Function)
+}
+
+func TestLocalProvider_Complete_FallsBackToToolPrompt(t *testing.T) {
+	stub := newStubServer(t, func(w http.ResponseWriter, body map[string]any) {
+		w.Header().Set("Content-Type", "application/json")
+		if _, ok := body["tools"]; ok {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":{"message":"gemma:2b does not support tools","type":"api_error"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(openAICompletion(`{"role":"assistant","content":"` + "```json\\n" + `{\"tool_calls\":[{\"name\":\"ExecuteQuery\",\"arguments\":{\"query\":\"SELECT 2\"}}]}` + "\\n```" + `"}`)))
+	})
+	provider := NewLocalProvider(config.LocalLLMConfig{BaseURL: stub.URL + "/v1", DefaultModel: "gemma:2b"})
+	req := CompletionRequest{
+		Messages: []Message{
+			{Role: openai.ChatMessageRoleUser, Content: "How many students?"},
+			{Role: openai.ChatMessageRoleAssistant, ToolCalls: []ToolCall{
+				{ID: "call_a", Type: ToolTypeFunction, Function: &FunctionCall{Name: "ExecuteQuery", Arguments: `{"query":"SELECT 1"}`}},
+			}},
+			{Role: openai.ChatMessageRoleTool, ToolCallId: "call_a", Content: `{"error":"syntax error"}`},
+		},
+		Model:               openai.O3Mini20250131,
+		Tools:               []Tool{queryTool()},
+		FunctionCallingMode: Required,
+	}
+
+	response, err := provider.Complete(context.Background(), req)
+	require.NoError(t, err)
+	require.Len(t, response.ToolCalls, 1)
+	assert.Equal(t, &FunctionCall{Name: "ExecuteQuery", Arguments: `{"query":"SELECT 2"}`}, response.ToolCalls[0].Function)
+
+	// The tools are described in the system message and the tool messages are converted to text
+	require.Len(t, stub.requests, 2)
+	messages := stub.requests[1]["messages"].([]any)
+	require.Len(t, messages, 4)
+	assert.Contains(t, messages[0].(map[string]any)["content"], "- ExecuteQuery: Run a SQL query")
+	assert.Contains(t, messages[0].(map[string]any)["content"], LocalToolPromptRequired)
+	assert.Equal(t, `{"tool_calls":[{"name":"ExecuteQuery","arguments":{"query":"SELECT 1"}}]}`, messages[2].(map[string]any)["content"])
+	assert.Equal(t, openai.ChatMessageRoleUser, messages[3].(map[string]any)["role"])
+	assert.Equal(t, "json_object", stub.requests[1]["response_format"].(map[string]any)["type"])
+
+	// The model is remembered, the next requests go straight to the tool prompt
+	_, err = provider.Complete(context.Background(), req)
+	require.NoError(t, err)
+	assert.Len(t, stub.requests, 3)
+
+	// The answer request without tools doesn't send the tool messages either
+	_, err = provider.Complete(context.Background(), CompletionRequest{Messages: req.Messages, Model: openai.GPT4oMini20240718})
+	require.NoError(t, err)
+	require.Len(t, stub.requests, 4)
+	assert.Len(t, stub.requests[3]["messages"], 3)
+	assert.NotContains(t, stub.requests[3], "response_format")
+}
+
+func TestLocalProvider_Complete_NativeModeDoesNotFallBack(t *testing.T) {
+	stub := newStubServer(t, func(w http.ResponseWriter, body map[string]any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":{"message":"model does not support tools"}}`))
+	})
+	provider := NewLocalProvider(config.LocalLLMConfig{BaseURL: stub.URL, ToolCalling: ToolCallingNative})
+
+	_, err := provider.Complete(context.Background(), CompletionRequest{
+		Messages: []Message{{Role: openai.ChatMessageRoleUser, Content: "How many students?"}},
+		Tools:    []Tool{queryTool()},
+	})
+	assert.Error(t, err)
+	assert.Len(t, stub.requests, 1)
+}
+
+func TestLocalProvider_Ollama(t *testing.T) {
+	stub := newStubServer(t, func(w http.ResponseWriter, body map[string]any) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		if body["stream"] == true {
+			_, _ = w.Write([]byte(`{"message":{"role":"assistant","content":"Có "},"done":false}` + "\n"))
+			_, _ = w.Write([]byte(`{"message":{"role":"assistant","content":"3 sinh viên"},"done":false}` + "\n"))
+			_, _ = w.Write([]byte(`{"model":"llama3.1","message":{"role":"assistant","content":""},"done":true,"prompt_eval_count":42,"eval_count":8}` + "\n"))
+			return
+		}
+		_, _ = w.Write([]byte(`{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"ExecuteQuery","arguments":{"query":"SELECT 3"}}}]},"done":true}`))
+	})
+	provider := NewLocalProvider(config.LocalLLMConfig{BaseURL: stub.URL, API: "ollama", DefaultModel: "llama3.1"})
+
+	response, err := provider.Complete(context.Background(), CompletionRequest{
+		Messages: []Message{{Role: openai.ChatMessageRoleUser, Content: "How many students?"}},
+		Tools:    []Tool{queryTool()},
+	})
+	require.NoError(t, err)
+	require.Len(t, response.ToolCalls, 1)
+	assert.Equal(t, &FunctionCall{Name: "ExecuteQuery", Arguments: `{"query":"SELECT 3"}`}, response.ToolCalls[0].Function)
+	assert.Equal(t, "llama3.1", stub.requests[0]["model"])
+	assert.Equal(t, "ExecuteQuery", stub.requests[0]["tools"].([]any)[0].(map[string]any)["function"].(map[string]any)["name"])
+
+	chunks, err := provider.StreamComplete(context.Background(), CompletionRequest{
+		Messages: []Message{
+			{Role: openai.ChatMessageRoleUser, Content: "How many students?"},
+			{Role: openai.ChatMessageRoleAssistant, ToolCalls: response.ToolCalls},
+			{Role: openai.ChatMessageRoleTool, ToolCallId: response.ToolCalls[0].ID, Content: `{"count":3}`},
+		},
+	})
+	require.NoError(t, err)
+	var content strings.Builder
+	var usage *Usage
+	for chunk := range chunks {
+		content.WriteString(chunk.Content)
+		if chunk.Done {
+			usage = chunk.Usage
+		}
+	}
+	assert.Equal(t, "Có 3 sinh viên", content.String())
+	// The usage comes with the last response
+	assert.Equal(t, &Usage{Model: "llama3.1", PromptTokens: 42, CompletionTokens: 8, TotalTokens: 50}, usage)
+
+	// The tool message is named after the tool call it answers
+	toolMessage := stub.requests[1]["messages"].([]any)[2].(map[string]any)
+	assert.Equal(t, "ExecuteQuery", toolMessage["tool_name"])
+}
+
+func TestParseToolPromptAnswer(t *testing.T) {
+	assert.Equal(t, Message{Role: openai.ChatMessageRoleAssistant, Content: "Có 3 sinh viên"}, parseToolPromptAnswer(`{"content":"Có 3 sinh viên"}`))
+	assert.Equal(t, Message{Role: openai.ChatMessageRoleAssistant, Content: "Not JSON"}, parseToolPromptAnswer("Not JSON"))
+
+	message := parseToolPromptAnswer(`{"tool_calls":[{"name":"Now"}]}`)
+	require.Len(t, message.ToolCalls, 1)
+	assert.Equal(t, "{}", message.ToolCalls[0].Function.Arguments)
+}
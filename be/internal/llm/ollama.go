@@ -0,0 +1,273 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// OllamaProvider talks to the native chat API of Ollama, which streams newline delimited JSON
+type OllamaProvider struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+func NewOllamaProvider(baseURL string, httpClient *http.Client) *OllamaProvider {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &OllamaProvider{baseURL: strings.TrimSuffix(baseURL, "/"), httpClient: httpClient}
+}
+
+// OllamaError is an error response of the Ollama server
+type OllamaError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *OllamaError) Error() string {
+	return fmt.Sprintf("ollama: %s (status %d)", e.Message, e.StatusCode)
+}
+
+type ollamaChatRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Tools    []ollamaTool    `json:"tools,omitempty"`
+	Stream   bool            `json:"stream"`
+	// Format is "json" or a JSON schema
+	Format any `json:"format,omitempty"`
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string         `json:"name"`
+		Arguments map[string]any `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaTool struct {
+	Type     ToolType `json:"type"`
+	Function struct {
+		Name        string `json:"name"`
+		Description string `json:"description,omitempty"`
+		Parameters  any    `json:"parameters,omitempty"`
+	} `json:"function"`
+}
+
+type ollamaChatResponse struct {
+	Model   string        `json:"model"`
+	Message ollamaMessage `json:"message"`
+	Done    bool          `json:"done"`
+	Error   string        `json:"error,omitempty"`
+	// The token counts are only sent with the last response
+	PromptEvalCount int `json:"prompt_eval_count,omitempty"`
+	EvalCount       int `json:"eval_count,omitempty"`
+}
+
+func (p *OllamaProvider) Complete(ctx context.Context, req CompletionRequest) (Message, error) {
+	body, err := p.postChat(ctx, req, false)
+	if err != nil {
+		return Message{}, err
+	}
+	defer body.Close()
+
+	var response ollamaChatResponse
+	if err := json.NewDecoder(body).Decode(&response); err != nil {
+		return Message{}, fmt.Errorf("failed to decode the Ollama response: %w", err)
+	}
+	if response.Error != "" {
+		return Message{}, fmt.Errorf("ollama: %s", response.Error)
+	}
+	message := fromOllamaMessage(response.Message)
+	message.Usage = response.usage()
+	return message, nil
+}
+
+func (p *OllamaProvider) StreamComplete(ctx context.Context, req CompletionRequest) (<-chan StreamChunk, error) {
+	body, err := p.postChat(ctx, req, true)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := make(chan StreamChunk)
+	go func() {
+		defer close(chunks)
+		defer body.Close()
+
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+				continue
+			}
+			var response ollamaChatResponse
+			if err := json.Unmarshal(scanner.Bytes(), &response); err != nil {
+				log.Printf("Error in StreamComplete: %v", err)
+				return
+			}
+			if response.Error != "" {
+				log.Printf("Error in StreamComplete: %s", response.Error)
+				return
+			}
+
+			// Ollama sends the tool calls whole
+			message := fromOllamaMessage(response.Message)
+			chunk := StreamChunk{
+				Content:   message.Content,
+				ToolCalls: message.ToolCalls,
+				Done:      response.Done,
+			}
+			if response.Done {
+				chunk.Usage = response.usage()
+			}
+			chunks <- chunk
+			if response.Done {
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			log.Printf("Error in StreamComplete: %v", err)
+		}
+	}()
+
+	return chunks, nil
+}
+
+// ------------------Private helper function------------------
+
+// postChat sends the request to the chat API and returns the body of the response, the errors of the server
+// are returned with their message, e.g. "model does not support tools"
+func (p *OllamaProvider) postChat(ctx context.Context, req CompletionRequest, stream bool) (io.ReadCloser, error) {
+	messages, err := toOllamaMessages(req.Messages)
+	if err != nil {
+		return nil, err
+	}
+	chatRequest := ollamaChatRequest{
+		Model:    req.Model,
+		Messages: messages,
+		Stream:   stream,
+		Format:   toOllamaFormat(req.ResponseFormat),
+	}
+	// Ollama has no tool choice, the tools are left out to forbid the tool calls
+	if req.FunctionCallingMode != None {
+		chatRequest.Tools = toOllamaTools(req.Tools)
+	}
+
+	requestBody, err := json.Marshal(chatRequest)
+	if err != nil {
+		return nil, err
+	}
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/api/chat", bytes.NewReader(requestBody))
+	if err != nil {
+		return nil, err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+
+	response, err := p.httpClient.Do(httpRequest)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		var errorResponse ollamaChatResponse
+		if err := json.NewDecoder(response.Body).Decode(&errorResponse); err != nil || errorResponse.Error == "" {
+			errorResponse.Error = "unexpected status"
+		}
+		return nil, &OllamaError{StatusCode: response.StatusCode, Message: errorResponse.Error}
+	}
+	return response.Body, nil
+}
+
+// toOllamaMessages converts the messages, the tool messages are named after the tool call they answer
+// as Ollama doesn't identify the tool calls
+func toOllamaMessages(messages []Message) ([]ollamaMessage, error) {
+	result := make([]ollamaMessage, 0, len(messages))
+	toolCallNames := make(map[string]string)
+	for _, msg := range messages {
+		message := ollamaMessage{Role: msg.Role, Content: msg.Content}
+		for _, toolCall := range msg.ToolCalls {
+			if toolCall.Function == nil {
+				continue
+			}
+			var ollamaCall ollamaToolCall
+			ollamaCall.Function.Name = toolCall.Function.Name
+			ollamaCall.Function.Arguments = make(map[string]any)
+			if toolCall.Function.Arguments != "" {
+				if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &ollamaCall.Function.Arguments); err != nil {
+					return nil, fmt.Errorf("invalid arguments of tool call %s: %w", toolCall.ID, err)
+				}
+			}
+			toolCallNames[toolCall.ID] = toolCall.Function.Name
+			message.ToolCalls = append(message.ToolCalls, ollamaCall)
+		}
+		if msg.Role == openai.ChatMessageRoleTool {
+			message.ToolName = toolCallNames[msg.ToolCallId]
+		}
+		result = append(result, message)
+	}
+	return result, nil
+}
+
+func (r ollamaChatResponse) usage() *Usage {
+	return &Usage{
+		Model:            r.Model,
+		PromptTokens:     r.PromptEvalCount,
+		CompletionTokens: r.EvalCount,
+		TotalTokens:      r.PromptEvalCount + r.EvalCount,
+	}
+}
+
+func fromOllamaMessage(msg ollamaMessage) Message {
+	message := Message{Role: openai.ChatMessageRoleAssistant, Content: msg.Content}
+	for _, toolCall := range msg.ToolCalls {
+		arguments, _ := json.Marshal(toolCall.Function.Arguments)
+		message.ToolCalls = append(message.ToolCalls, ToolCall{
+			ID:       newToolCallID(),
+			Type:     ToolTypeFunction,
+			Function: &FunctionCall{Name: toolCall.Function.Name, Arguments: string(arguments)},
+		})
+	}
+	return message
+}
+
+func toOllamaTools(tools []Tool) []ollamaTool {
+	result := make([]ollamaTool, 0, len(tools))
+	for _, tool := range tools {
+		if tool.Function == nil {
+			continue
+		}
+		var ollamaFunction ollamaTool
+		ollamaFunction.Type = ToolTypeFunction
+		ollamaFunction.Function.Name = tool.Function.Name
+		ollamaFunction.Function.Description = tool.Function.Description
+		if tool.Function.Parameters != nil {
+			ollamaFunction.Function.Parameters = tool.Function.Parameters
+		}
+		result = append(result, ollamaFunction)
+	}
+	return result
+}
+
+func toOllamaFormat(format *ResponseFormat) any {
+	if format == nil || format.Type != ResponseFormatTypeJson {
+		return nil
+	}
+	if format.Schema != nil {
+		return format.Schema
+	}
+	return "json"
+}
@@ -51,7 +51,9 @@ func (p *OpenAIProvider) Complete(ctx context.Context, req CompletionRequest) (M
 	if len(res.Choices) == 0 {
 		return Message{}, errors.New("no choices found")
 	}
-	return fromOpenAIMessage(res.Choices[0].Message), err
+	message := fromOpenAIMessage(res.Choices[0].Message)
+	message.Usage = toUsage(res.Model, res.Usage)
+	return message, nil
 }
 
 func (p *OpenAIProvider) StreamComplete(ctx context.Context, req CompletionRequest) (<-chan StreamChunk, error) {
@@ -61,6 +63,12 @@ func (p *OpenAIProvider) StreamComplete(ctx context.Context, req CompletionReque
 		Messages:       toOpenAIMessages(req.Messages),
 		ResponseFormat: toOpenAIResponseFormat(req.ResponseFormat),
 		Tools:          toOpenAITools(req.Tools),
+		// The usage is sent in a last chunk without choices
+		StreamOptions: &openai.StreamOptions{IncludeUsage: true},
+	}
+
+	if req.FunctionCallingMode != "" {
+		chatRequest.ToolChoice = req.FunctionCallingMode
 	}
 
 	// Marshal the request to JSON for debugging
@@ -77,18 +85,24 @@ func (p *OpenAIProvider) StreamComplete(ctx context.Context, req CompletionReque
 		defer close(chunks)
 		defer stream.Close()
 
+		var toolCalls []ToolCall
+		var usage *Usage
 		for {
 			response, err := stream.Recv()
 			if errors.Is(err, io.EOF) {
-				chunks <- StreamChunk{Done: true}
+				chunks <- StreamChunk{ToolCalls: toolCalls, Usage: usage, Done: true}
 				return
 			}
 			if err != nil {
 				// Consider error handling channel
 				return
 			}
+			if response.Usage != nil {
+				usage = toUsage(response.Model, *response.Usage)
+			}
 
 			if len(response.Choices) > 0 {
+				toolCalls = mergeToolCallDeltas(toolCalls, response.Choices[0].Delta.ToolCalls)
 				chunks <- StreamChunk{
 					Content: response.Choices[0].Delta.Content,
 				}
@@ -119,6 +133,15 @@ func fromOpenAIMessage(msg openai.ChatCompletionMessage) Message {
 	}
 }
 
+func toUsage(model string, usage openai.Usage) *Usage {
+	return &Usage{
+		Model:            model,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+	}
+}
+
 func toToolCall(toolCalls []openai.ToolCall) []ToolCall {
 	result := make([]ToolCall, len(toolCalls))
 	for i, toolCall := range toolCalls {
@@ -131,6 +154,26 @@ func toToolCall(toolCalls []openai.ToolCall) []ToolCall {
 	return result
 }
 
+// mergeToolCallDeltas adds the pieces of the streamed tool calls to the tool calls, the arguments of a tool call
+// are streamed in several deltas with the same index
+func mergeToolCallDeltas(toolCalls []ToolCall, deltas []openai.ToolCall) []ToolCall {
+	for i, delta := range deltas {
+		index := i
+		if delta.Index != nil {
+			index = *delta.Index
+		}
+		for len(toolCalls) <= index {
+			toolCalls = append(toolCalls, ToolCall{Type: ToolTypeFunction, Function: &FunctionCall{}})
+		}
+		if delta.ID != "" {
+			toolCalls[index].ID = delta.ID
+		}
+		toolCalls[index].Function.Name += delta.Function.Name
+		toolCalls[index].Function.Arguments += delta.Function.Arguments
+	}
+	return toolCalls
+}
+
 func toOpenAIMessages(messages []Message) []openai.ChatCompletionMessage {
 	result := make([]openai.ChatCompletionMessage, len(messages))
 	for i, msg := range messages {
@@ -191,6 +234,12 @@ func toOpenAIResponseFormat(format *ResponseFormat) *openai.ChatCompletionRespon
 			Type: openai.ChatCompletionResponseFormatTypeText,
 		}
 	case ResponseFormatTypeJson:
+		// Without a schema the model only has to answer with a JSON object
+		if format.Schema == nil {
+			return &openai.ChatCompletionResponseFormat{
+				Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+			}
+		}
 		return &openai.ChatCompletionResponseFormat{
 			Type:       openai.ChatCompletionResponseFormatTypeJSONSchema,
 			JSONSchema: convertJsonSchemaToOpenAISchema(format.Schema, format.Name),
@@ -76,7 +76,8 @@ func TestOpenAIProvider_Complete_WithTools(t *testing.T) {
 			"id": "test-id",
 			"object": "chat.completion",
 			"created": 1677825464,
-			"model": "gpt-3.5-turbo"
+			"model": "gpt-3.5-turbo",
+			"usage": {"prompt_tokens": 20, "completion_tokens": 7, "total_tokens": 27}
 		}`))
 	}))
 	defer server.Close()
@@ -122,6 +123,7 @@ func TestOpenAIProvider_Complete_WithTools(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "assistant", response.Role)
 	assert.Equal(t, "I'll help with that function call", response.Content)
+	assert.Equal(t, &Usage{Model: "gpt-3.5-turbo", PromptTokens: 20, CompletionTokens: 7, TotalTokens: 27}, response.Usage)
 }
 
 func TestOpenAIProvider_StreamComplete_WithTools(t *testing.T) {
@@ -134,6 +136,8 @@ func TestOpenAIProvider_StreamComplete_WithTools(t *testing.T) {
 		// Write two chunks and EOF
 		_, _ = w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"I'll \"}}]}\n\n"))
 		_, _ = w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"help with that function call\"}}]}\n\n"))
+		// The usage comes in a last chunk without choices
+		_, _ = w.Write([]byte("data: {\"model\":\"gpt-3.5-turbo\",\"choices\":[],\"usage\":{\"prompt_tokens\":20,\"completion_tokens\":7,\"total_tokens\":27}}\n\n"))
 		_, _ = w.Write([]byte("data: [DONE]\n\n"))
 	}))
 	defer server.Close()
@@ -179,10 +183,12 @@ func TestOpenAIProvider_StreamComplete_WithTools(t *testing.T) {
 	// Collect all chunks
 	var chunks []string
 	var isDone bool
+	var usage *Usage
 
 	for chunk := range stream {
 		if chunk.Done {
 			isDone = true
+			usage = chunk.Usage
 			break
 		}
 		chunks = append(chunks, chunk.Content)
@@ -191,6 +197,7 @@ func TestOpenAIProvider_StreamComplete_WithTools(t *testing.T) {
 	// Assertions
 	assert.True(t, isDone)
 	assert.Equal(t, []string{"I'll ", "help with that function call"}, chunks)
+	assert.Equal(t, &Usage{Model: "gpt-3.5-turbo", PromptTokens: 20, CompletionTokens: 7, TotalTokens: 27}, usage)
 }
 
 func TestOpenAIProvider_RealAPI_Integration(t *testing.T) {
@@ -248,3 +255,15 @@ func TestOpenAIProvider_RealAPI_Integration(t *testing.T) {
 	println("Response from OpenAI API:", response.Content)
 
 }
+
+func TestMergeToolCallDeltas(t *testing.T) {
+	first, second := 0, 1
+	var toolCalls []ToolCall
+	toolCalls = mergeToolCallDeltas(toolCalls, []openai.ToolCall{{Index: &first, ID: "call_a", Function: openai.FunctionCall{Name: "ExecuteQuery", Arguments: `{"que`}}})
+	toolCalls = mergeToolCallDeltas(toolCalls, []openai.ToolCall{{Index: &first, Function: openai.FunctionCall{Arguments: `ry":"SELECT 1"}`}}})
+	toolCalls = mergeToolCallDeltas(toolCalls, []openai.ToolCall{{Index: &second, ID: "call_b", Function: openai.FunctionCall{Name: "ExecuteQuery", Arguments: `{}`}}})
+
+	require.Len(t, toolCalls, 2)
+	assert.Equal(t, ToolCall{ID: "call_a", Type: ToolTypeFunction, Function: &FunctionCall{Name: "ExecuteQuery", Arguments: `{"query":"SELECT 1"}`}}, toolCalls[0])
+	assert.Equal(t, "call_b", toolCalls[1].ID)
+}
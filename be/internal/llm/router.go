@@ -0,0 +1,371 @@
+package llm
+
+import (
+	"HNLP/be/internal/config"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"google.golang.org/api/googleapi"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultRouterTimeout     = 90 * time.Second
+	DefaultFailureThreshold  = 5
+	DefaultCircuitOpenPeriod = 30 * time.Second
+	DefaultInitialBackoff    = 500 * time.Millisecond
+	DefaultMaxBackoff        = 8 * time.Second
+)
+
+// CircuitState is the state of the circuit breaker of a provider
+type CircuitState string
+
+const (
+	// CircuitClosed lets the requests through
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen skips the provider until the open period ends
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen lets a single request through to probe the provider
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+// HealthReporter is implemented by the providers which track the health of the providers behind them
+type HealthReporter interface {
+	Health() []ProviderHealth
+}
+
+// ProviderHealth is the circuit breaker state of a provider of the router
+type ProviderHealth struct {
+	Name                string       `json:"name"`
+	State               CircuitState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	LastError           string       `json:"last_error,omitempty"`
+	LastFailureAt       *time.Time   `json:"last_failure_at,omitempty"`
+	OpenUntil           *time.Time   `json:"open_until,omitempty"`
+}
+
+// RoutedProvider is a provider of the router with its name in the logs and the health state
+type RoutedProvider struct {
+	Name     string
+	Provider AIProvider
+}
+
+// RouterProvider sends the requests to the first available provider of an ordered list.
+// A request is retried on the same provider with an exponential backoff when it fails with a transient error,
+// e.g. a rate limit, then falls back to the next provider. The circuit breaker of a provider skips it for a while
+// after consecutive transient failures.
+type RouterProvider struct {
+	providers      []*routedProvider
+	maxRetries     int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	timeout        time.Duration
+
+	// now and sleep are replaced in the tests
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+type routedProvider struct {
+	RoutedProvider
+	breaker *circuitBreaker
+}
+
+func NewRouterProvider(cfg config.RouterConfig, providers ...RoutedProvider) *RouterProvider {
+	router := &RouterProvider{
+		maxRetries:     cfg.MaxRetries,
+		initialBackoff: durationOrDefault(cfg.InitialBackoffMs, time.Millisecond, DefaultInitialBackoff),
+		maxBackoff:     durationOrDefault(cfg.MaxBackoffMs, time.Millisecond, DefaultMaxBackoff),
+		timeout:        durationOrDefault(cfg.TimeoutSeconds, time.Second, DefaultRouterTimeout),
+		now:            time.Now,
+		sleep:          sleepContext,
+	}
+	threshold := cfg.FailureThreshold
+	if threshold <= 0 {
+		threshold = DefaultFailureThreshold
+	}
+	openPeriod := durationOrDefault(cfg.OpenSeconds, time.Second, DefaultCircuitOpenPeriod)
+	for _, provider := range providers {
+		router.providers = append(router.providers, &routedProvider{
+			RoutedProvider: provider,
+			breaker:        &circuitBreaker{threshold: threshold, openPeriod: openPeriod, state: CircuitClosed},
+		})
+	}
+	return router
+}
+
+func (r *RouterProvider) Complete(ctx context.Context, req CompletionRequest) (Message, error) {
+	var response Message
+	err := r.route(ctx, req.Provider, func(provider *routedProvider) error {
+		return r.withRetries(ctx, provider, func(attemptCtx context.Context, cancel context.CancelFunc) error {
+			defer cancel()
+			var err error
+			response, err = provider.Provider.Complete(attemptCtx, req)
+			return err
+		})
+	})
+	return response, err
+}
+
+// StreamComplete falls back to the next provider only if the stream can't be started,
+// the chunks already sent can't be taken back
+func (r *RouterProvider) StreamComplete(ctx context.Context, req CompletionRequest) (<-chan StreamChunk, error) {
+	var chunks chan StreamChunk
+	err := r.route(ctx, req.Provider, func(provider *routedProvider) error {
+		return r.withRetries(ctx, provider, func(attemptCtx context.Context, cancel context.CancelFunc) error {
+			providerChunks, err := provider.Provider.StreamComplete(attemptCtx, req)
+			if err != nil {
+				cancel()
+				return err
+			}
+			// The attempt context lives until the end of the stream
+			chunks = make(chan StreamChunk)
+			go func() {
+				defer cancel()
+				defer close(chunks)
+				for chunk := range providerChunks {
+					select {
+					case chunks <- chunk:
+					case <-attemptCtx.Done():
+						// The consumer is gone, the provider stream is canceled and drained so that it can end too
+						cancel()
+						for range providerChunks {
+						}
+						return
+					}
+				}
+			}()
+			return nil
+		})
+	})
+	return chunks, err
+}
+
+// Health returns the circuit breaker states of the providers, in order of preference
+func (r *RouterProvider) Health() []ProviderHealth {
+	health := make([]ProviderHealth, 0, len(r.providers))
+	for _, provider := range r.providers {
+		health = append(health, provider.breaker.health(provider.Name, r.now()))
+	}
+	return health
+}
+
+// ------------------Private helper function------------------
+
+// route calls the providers in order, the preferred one first, until one succeeds, skipping the providers
+// with an open circuit
+func (r *RouterProvider) route(ctx context.Context, preferred string, call func(provider *routedProvider) error) error {
+	var errs []error
+	for _, provider := range r.ordered(preferred) {
+		if !provider.breaker.allow(r.now()) {
+			errs = append(errs, fmt.Errorf("%s: circuit open", provider.Name))
+			continue
+		}
+		err := call(provider)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("LLM provider %s failed, falling back to the next provider: %v", provider.Name, err)
+		errs = append(errs, fmt.Errorf("%s: %w", provider.Name, err))
+	}
+	if len(errs) == 0 {
+		return errors.New("no LLM provider configured")
+	}
+	return fmt.Errorf("all LLM providers failed: %w", errors.Join(errs...))
+}
+
+// ordered returns the providers with the preferred one first
+func (r *RouterProvider) ordered(preferred string) []*routedProvider {
+	providers := make([]*routedProvider, 0, len(r.providers))
+	for _, provider := range r.providers {
+		if provider.Name == preferred {
+			providers = append(providers, provider)
+		}
+	}
+	for _, provider := range r.providers {
+		if provider.Name != preferred {
+			providers = append(providers, provider)
+		}
+	}
+	return providers
+}
+
+// withRetries runs the attempt until it succeeds, fails with an error which isn't transient or runs out of retries.
+// The attempt gets a context bounded by the timeout and must call cancel once it doesn't need the context anymore.
+func (r *RouterProvider) withRetries(ctx context.Context, provider *routedProvider, attempt func(attemptCtx context.Context, cancel context.CancelFunc) error) error {
+	for retry := 0; ; retry++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, r.timeout)
+		err := attempt(attemptCtx, cancel)
+		if err == nil {
+			provider.breaker.recordSuccess()
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		// The provider answered, e.g. with a bad request, so it is available
+		if !IsTransientError(err) {
+			provider.breaker.recordSuccess()
+			return err
+		}
+
+		provider.breaker.recordFailure(err, r.now())
+		if retry >= r.maxRetries || !provider.breaker.allow(r.now()) {
+			return err
+		}
+		if err := r.sleep(ctx, r.backoff(retry)); err != nil {
+			return err
+		}
+	}
+}
+
+// backoff doubles the delay at each retry up to the maximum, with a jitter so the retries of the concurrent
+// requests don't hit the provider at the same time
+func (r *RouterProvider) backoff(retry int) time.Duration {
+	delay := r.initialBackoff << retry
+	if delay > r.maxBackoff || delay <= 0 {
+		delay = r.maxBackoff
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// IsTransientError reports whether the request can succeed if it is sent again: the rate limits, the server errors,
+// the timeouts and the network errors
+func IsTransientError(err error) bool {
+	if status := statusCodeOf(err); status != 0 {
+		return status == http.StatusTooManyRequests || status == http.StatusRequestTimeout || status >= http.StatusInternalServerError
+	}
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.As(err, &netErr)
+}
+
+// statusCodeOf returns the HTTP status of the error of a provider, or 0 if the error doesn't have one
+func statusCodeOf(err error) int {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode
+	}
+	var requestErr *openai.RequestError
+	if errors.As(err, &requestErr) {
+		return requestErr.HTTPStatusCode
+	}
+	var googleErr *googleapi.Error
+	if errors.As(err, &googleErr) {
+		return googleErr.Code
+	}
+	var ollamaErr *OllamaError
+	if errors.As(err, &ollamaErr) {
+		return ollamaErr.StatusCode
+	}
+	return 0
+}
+
+func durationOrDefault(value int, unit time.Duration, defaultValue time.Duration) time.Duration {
+	if value <= 0 {
+		return defaultValue
+	}
+	return time.Duration(value) * unit
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// circuitBreaker opens after threshold consecutive failures, then lets a single request probe the provider
+// once the open period is over. The probe closes the circuit if it succeeds and opens it again otherwise,
+// another probe is let through if it doesn't end within the open period, e.g. because its request was canceled.
+type circuitBreaker struct {
+	mutex      sync.Mutex
+	threshold  int
+	openPeriod time.Duration
+
+	state          CircuitState
+	failures       int
+	openUntil      time.Time
+	probeStartedAt time.Time
+	lastError      string
+	lastFailureAt  time.Time
+}
+
+func (b *circuitBreaker) allow(now time.Time) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	switch b.state {
+	case CircuitOpen:
+		if now.Before(b.openUntil) {
+			return false
+		}
+		b.state = CircuitHalfOpen
+		b.probeStartedAt = now
+		return true
+	case CircuitHalfOpen:
+		if now.Sub(b.probeStartedAt) < b.openPeriod {
+			return false
+		}
+		b.probeStartedAt = now
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *circuitBreaker) recordSuccess() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.state = CircuitClosed
+	b.failures = 0
+}
+
+func (b *circuitBreaker) recordFailure(err error, now time.Time) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.failures++
+	b.lastError = err.Error()
+	b.lastFailureAt = now
+	if b.state == CircuitHalfOpen || b.failures >= b.threshold {
+		b.state = CircuitOpen
+		b.openUntil = now.Add(b.openPeriod)
+	}
+}
+
+func (b *circuitBreaker) health(name string, now time.Time) ProviderHealth {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	health := ProviderHealth{
+		Name:                name,
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		LastError:           b.lastError,
+	}
+	if !b.lastFailureAt.IsZero() {
+		lastFailureAt := b.lastFailureAt
+		health.LastFailureAt = &lastFailureAt
+	}
+	if b.state == CircuitOpen && now.Before(b.openUntil) {
+		openUntil := b.openUntil
+		health.OpenUntil = &openUntil
+	}
+	return health
+}
@@ -0,0 +1,325 @@
+package llm
+
+import (
+	"HNLP/be/internal/config"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+	"io"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeProvider answers with the errors in order, then with its name
+type fakeProvider struct {
+	name  string
+	errs  []error
+	calls int
+}
+
+func (p *fakeProvider) Complete(ctx context.Context, req CompletionRequest) (Message, error) {
+	p.calls++
+	if p.calls <= len(p.errs) && p.errs[p.calls-1] != nil {
+		return Message{}, p.errs[p.calls-1]
+	}
+	return Message{Role: openai.ChatMessageRoleAssistant, Content: p.name}, nil
+}
+
+func (p *fakeProvider) StreamComplete(ctx context.Context, req CompletionRequest) (<-chan StreamChunk, error) {
+	response, err := p.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	chunks := make(chan StreamChunk, 2)
+	chunks <- StreamChunk{Content: response.Content}
+	chunks <- StreamChunk{Done: true}
+	close(chunks)
+	return chunks, nil
+}
+
+// endlessProvider streams chunks until its context is canceled, it blocks on each chunk like the real providers
+type endlessProvider struct {
+	stopped chan struct{}
+}
+
+func (p *endlessProvider) Complete(ctx context.Context, req CompletionRequest) (Message, error) {
+	return Message{}, errors.New("not supported")
+}
+
+func (p *endlessProvider) StreamComplete(ctx context.Context, req CompletionRequest) (<-chan StreamChunk, error) {
+	chunks := make(chan StreamChunk)
+	go func() {
+		defer close(p.stopped)
+		defer close(chunks)
+		for ctx.Err() == nil {
+			chunks <- StreamChunk{Content: "a"}
+		}
+	}()
+	return chunks, nil
+}
+
+func statusError(status int) error {
+	return &openai.APIError{HTTPStatusCode: status, Message: http.StatusText(status)}
+}
+
+func repeatError(err error, n int) []error {
+	errs := make([]error, n)
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
+
+// newTestRouter returns a router over the providers which doesn't sleep and whose clock is moved by the test
+func newTestRouter(cfg config.RouterConfig, providers ...*fakeProvider) (*RouterProvider, *time.Time) {
+	routed := make([]RoutedProvider, len(providers))
+	for i, provider := range providers {
+		routed[i] = RoutedProvider{Name: provider.name, Provider: provider}
+	}
+	router := NewRouterProvider(cfg, routed...)
+	now := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	router.now = func() time.Time { return now }
+	router.sleep = func(ctx context.Context, d time.Duration) error { return ctx.Err() }
+	return router, &now
+}
+
+func TestRouterProvider_Complete(t *testing.T) {
+	tests := []struct {
+		name          string
+		primaryErrs   []error
+		secondaryErrs []error
+		maxRetries    int
+		wantContent   string
+		wantErr       bool
+		wantPrimary   int
+		wantSecondary int
+	}{
+		{
+			name:        "Success",
+			maxRetries:  2,
+			wantContent: "primary",
+			wantPrimary: 1,
+		},
+		{
+			name:        "Retry after a rate limit",
+			primaryErrs: []error{statusError(http.StatusTooManyRequests)},
+			maxRetries:  2,
+			wantContent: "primary",
+			wantPrimary: 2,
+		},
+		{
+			name:          "Fall back after the retries of a server error",
+			primaryErrs:   repeatError(statusError(http.StatusServiceUnavailable), 3),
+			maxRetries:    2,
+			wantContent:   "secondary",
+			wantPrimary:   3,
+			wantSecondary: 1,
+		},
+		{
+			name:          "Fall back without retrying a bad request",
+			primaryErrs:   []error{statusError(http.StatusBadRequest)},
+			maxRetries:    2,
+			wantContent:   "secondary",
+			wantPrimary:   1,
+			wantSecondary: 1,
+		},
+		{
+			name:          "No retry",
+			primaryErrs:   []error{statusError(http.StatusTooManyRequests)},
+			maxRetries:    0,
+			wantContent:   "secondary",
+			wantPrimary:   1,
+			wantSecondary: 1,
+		},
+		{
+			name:          "All providers fail",
+			primaryErrs:   []error{statusError(http.StatusBadRequest)},
+			secondaryErrs: []error{statusError(http.StatusUnauthorized)},
+			maxRetries:    2,
+			wantErr:       true,
+			wantPrimary:   1,
+			wantSecondary: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary := &fakeProvider{name: "primary", errs: tt.primaryErrs}
+			secondary := &fakeProvider{name: "secondary", errs: tt.secondaryErrs}
+			router, _ := newTestRouter(config.RouterConfig{MaxRetries: tt.maxRetries}, primary, secondary)
+
+			response, err := router.Complete(context.Background(), CompletionRequest{})
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.wantContent, response.Content)
+			}
+			assert.Equal(t, tt.wantPrimary, primary.calls)
+			assert.Equal(t, tt.wantSecondary, secondary.calls)
+		})
+	}
+}
+
+func TestRouterProvider_PreferredProvider(t *testing.T) {
+	primary := &fakeProvider{name: "primary"}
+	secondary := &fakeProvider{name: "secondary", errs: []error{statusError(http.StatusServiceUnavailable)}}
+	router, _ := newTestRouter(config.RouterConfig{}, primary, secondary)
+
+	// The preferred provider is tried first, the others remain the fallbacks
+	response, err := router.Complete(context.Background(), CompletionRequest{Provider: "secondary"})
+	require.NoError(t, err)
+	assert.Equal(t, "primary", response.Content)
+	assert.Equal(t, 1, secondary.calls)
+
+	response, err = router.Complete(context.Background(), CompletionRequest{Provider: "secondary"})
+	require.NoError(t, err)
+	assert.Equal(t, "secondary", response.Content)
+	assert.Equal(t, 1, primary.calls)
+}
+
+func TestRouterProvider_CircuitBreaker(t *testing.T) {
+	primary := &fakeProvider{name: "primary", errs: repeatError(statusError(http.StatusBadGateway), 3)}
+	secondary := &fakeProvider{name: "secondary"}
+	router, now := newTestRouter(config.RouterConfig{FailureThreshold: 2, OpenSeconds: 30}, primary, secondary)
+
+	// The first failure leaves the circuit closed
+	response, err := router.Complete(context.Background(), CompletionRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "secondary", response.Content)
+	assert.Equal(t, CircuitClosed, router.Health()[0].State)
+
+	// The second one opens it, the primary is then skipped
+	_, err = router.Complete(context.Background(), CompletionRequest{})
+	require.NoError(t, err)
+	health := router.Health()[0]
+	assert.Equal(t, CircuitOpen, health.State)
+	assert.Equal(t, 2, health.ConsecutiveFailures)
+	assert.Contains(t, health.LastError, "Bad Gateway")
+	require.NotNil(t, health.OpenUntil)
+	assert.Equal(t, now.Add(30*time.Second), *health.OpenUntil)
+
+	_, err = router.Complete(context.Background(), CompletionRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, primary.calls)
+
+	// A failed probe opens the circuit again
+	*now = now.Add(31 * time.Second)
+	_, err = router.Complete(context.Background(), CompletionRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, primary.calls)
+	assert.Equal(t, CircuitOpen, router.Health()[0].State)
+
+	// A successful probe closes it
+	*now = now.Add(31 * time.Second)
+	response, err = router.Complete(context.Background(), CompletionRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "primary", response.Content)
+	assert.Equal(t, CircuitClosed, router.Health()[0].State)
+	assert.Equal(t, 0, router.Health()[0].ConsecutiveFailures)
+	assert.Equal(t, 4, secondary.calls)
+}
+
+func TestCircuitBreaker_HalfOpenLetsASingleProbeThrough(t *testing.T) {
+	now := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	breaker := &circuitBreaker{threshold: 1, openPeriod: 30 * time.Second, state: CircuitClosed}
+	breaker.recordFailure(errors.New("timeout"), now)
+	assert.False(t, breaker.allow(now))
+
+	now = now.Add(30 * time.Second)
+	assert.True(t, breaker.allow(now))
+	assert.False(t, breaker.allow(now))
+
+	// The probe never ended, another one is let through
+	now = now.Add(30 * time.Second)
+	assert.True(t, breaker.allow(now))
+}
+
+func TestRouterProvider_StreamComplete(t *testing.T) {
+	primary := &fakeProvider{name: "primary", errs: []error{statusError(http.StatusInternalServerError)}}
+	secondary := &fakeProvider{name: "secondary"}
+	router, _ := newTestRouter(config.RouterConfig{}, primary, secondary)
+
+	chunks, err := router.StreamComplete(context.Background(), CompletionRequest{})
+	require.NoError(t, err)
+	var content string
+	done := false
+	for chunk := range chunks {
+		content += chunk.Content
+		done = done || chunk.Done
+	}
+	assert.Equal(t, "secondary", content)
+	assert.True(t, done)
+}
+
+func TestRouterProvider_StreamComplete_ConsumerGone(t *testing.T) {
+	provider := &endlessProvider{stopped: make(chan struct{})}
+	router := NewRouterProvider(config.RouterConfig{}, RoutedProvider{Name: "endless", Provider: provider})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	chunks, err := router.StreamComplete(ctx, CompletionRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "a", (<-chunks).Content)
+	// The client disconnects and stops reading
+	cancel()
+
+	select {
+	case <-provider.stopped:
+	case <-time.After(time.Second):
+		t.Fatal("the provider stream wasn't canceled")
+	}
+	select {
+	case _, ok := <-chunks:
+		for ok {
+			_, ok = <-chunks
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the forwarding goroutine didn't end")
+	}
+}
+
+func TestRouterProvider_CanceledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	primary := &fakeProvider{name: "primary", errs: []error{context.Canceled}}
+	secondary := &fakeProvider{name: "secondary"}
+	router, _ := newTestRouter(config.RouterConfig{MaxRetries: 2}, primary, secondary)
+
+	_, err := router.Complete(ctx, CompletionRequest{})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, primary.calls)
+	assert.Equal(t, 0, secondary.calls)
+	assert.Equal(t, 0, router.Health()[0].ConsecutiveFailures)
+}
+
+func TestIsTransientError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "Rate limit", err: statusError(http.StatusTooManyRequests), want: true},
+		{name: "Server error", err: statusError(http.StatusInternalServerError), want: true},
+		{name: "Bad request", err: statusError(http.StatusBadRequest), want: false},
+		{name: "Unauthorized", err: statusError(http.StatusUnauthorized), want: false},
+		{name: "OpenAI request error", err: &openai.RequestError{HTTPStatusCode: http.StatusBadGateway, Err: io.EOF}, want: true},
+		{name: "Gemini error", err: fmt.Errorf("gemini: %w", &googleapi.Error{Code: http.StatusServiceUnavailable}), want: true},
+		{name: "Ollama error", err: &OllamaError{StatusCode: http.StatusNotFound, Message: "model not found"}, want: false},
+		{name: "Deadline", err: context.DeadlineExceeded, want: true},
+		{name: "Connection refused", err: fmt.Errorf("dial: %w", syscall.ECONNREFUSED), want: true},
+		{name: "Unexpected EOF", err: io.ErrUnexpectedEOF, want: true},
+		{name: "Other error", err: errors.New("no choices found"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsTransientError(tt.err))
+		})
+	}
+}
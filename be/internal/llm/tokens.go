@@ -0,0 +1,45 @@
+package llm
+
+const (
+	// asciiRunesPerToken is the number of ASCII characters of a token for the OpenAI tokenizers (cl100k and o200k),
+	// measured on English text, SQL and JSON arguments
+	asciiRunesPerToken = 4
+	// nonASCIITokensPerRune is the number of tokens of the other characters, e.g. the Vietnamese letters with diacritics
+	// are often split into their bytes, so they are counted as a token each
+	nonASCIITokensPerRune = 1
+	// messageOverheadTokens is the number of tokens used by the role and the separators of a message
+	messageOverheadTokens = 4
+	// safetyMarginPercent is added to the estimation, so that a budget is still kept when the text tokenizes worse
+	safetyMarginPercent = 10
+)
+
+// EstimateTokens approximates the number of tokens of the messages.
+// It is not exact, but good enough to enforce a budget without loading a tokenizer: the ASCII and the other characters
+// are counted with their own ratio and a safety margin is added, so the estimation is rather above the real count.
+func EstimateTokens(messages []Message) int {
+	tokens := 0
+	for _, message := range messages {
+		text := message.Content
+		for _, toolCall := range message.ToolCalls {
+			if toolCall.Function != nil {
+				text += toolCall.Function.Name + toolCall.Function.Arguments
+			}
+		}
+		tokens += messageOverheadTokens + estimateTextTokens(text)
+	}
+	return tokens + (tokens*safetyMarginPercent+99)/100
+}
+
+// ------------------Private helper function------------------
+
+func estimateTextTokens(text string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < 0x80 {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+asciiRunesPerToken-1)/asciiRunesPerToken + other*nonASCIITokensPerRune
+}
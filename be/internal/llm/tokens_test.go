@@ -0,0 +1,19 @@
+package llm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	assert.Equal(t, 0, EstimateTokens(nil))
+	// 3 tokens for the 10 ASCII characters, 2 for "à" and "ạ", 4 for the message and 1 of margin
+	assert.Equal(t, 10, EstimateTokens([]Message{{Role: "user", Content: "Xin chào bạn"}}))
+	assert.Equal(t, 14, EstimateTokens([]Message{{Role: "assistant", ToolCalls: []ToolCall{
+		{ID: "call_1", Function: &FunctionCall{Name: "ExecuteQuery", Arguments: `{"query":"SELECT"}`}},
+	}}}))
+	// The Vietnamese text takes more tokens than an ASCII text of the same length
+	assert.Greater(t,
+		EstimateTokens([]Message{{Role: "user", Content: "Điểm trung bình học kỳ trước của tôi"}}),
+		EstimateTokens([]Message{{Role: "user", Content: "Diem trung binh hoc ky truoc cua toi"}}))
+}
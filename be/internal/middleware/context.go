@@ -0,0 +1,14 @@
+package middleware
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+)
+
+// RequestContext puts the caller set by Authenticate in the context of the request as the "userId", "specificId" and
+// "userRole" values, the services read the caller from it like for the chatbot tools, see db.CallerFrom
+func RequestContext(ctx *gin.Context) context.Context {
+	reqCtx := context.WithValue(ctx.Request.Context(), "userId", int(ctx.GetFloat64("userId")))
+	reqCtx = context.WithValue(reqCtx, "specificId", int(ctx.GetFloat64("specificId")))
+	return context.WithValue(reqCtx, "userRole", ctx.GetString("userRole"))
+}
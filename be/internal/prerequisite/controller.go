@@ -0,0 +1,79 @@
+package prerequisite
+
+import (
+	"HNLP/be/internal/auth"
+	"HNLP/be/internal/db"
+	"HNLP/be/internal/middleware"
+	"errors"
+	"github.com/gin-gonic/gin"
+)
+
+type Controller struct {
+	service Service
+}
+
+func NewController(service Service) *Controller {
+	return &Controller{service: service}
+}
+
+// GetPrerequisites returns the requirements of a course, e.g. /api/v1/courses/INT3401/prerequisites
+func (c *Controller) GetPrerequisites(ctx *gin.Context) {
+	response, err := c.service.GetPrerequisites(ctx.Request.Context(), GetPrerequisitesRequest{Course: ctx.Param("code")})
+	if err != nil {
+		c.writeError(ctx, err)
+		return
+	}
+	ctx.JSON(200, response)
+}
+
+// GetUnlockedCourses returns the courses requiring a course, e.g. /api/v1/courses/INT2210/unlocks
+func (c *Controller) GetUnlockedCourses(ctx *gin.Context) {
+	response, err := c.service.GetUnlockedCourses(ctx.Request.Context(), GetUnlockedCoursesRequest{Course: ctx.Param("code")})
+	if err != nil {
+		c.writeError(ctx, err)
+		return
+	}
+	ctx.JSON(200, response)
+}
+
+// CheckEligibility checks if a student can take a course, e.g. /api/v1/courses/INT3401/eligibility?student_id=1
+func (c *Controller) CheckEligibility(ctx *gin.Context) {
+	var query struct {
+		StudentId *int `form:"student_id"`
+	}
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(400, gin.H{"error": "invalid request"})
+		return
+	}
+
+	// The services read the caller from the context like for the chatbot tools
+	reqCtx := middleware.RequestContext(ctx)
+
+	response, err := c.service.CheckEligibility(reqCtx, CheckEligibilityRequest{Course: ctx.Param("code"), StudentId: query.StudentId})
+	if err != nil {
+		c.writeError(ctx, err)
+		return
+	}
+	ctx.JSON(200, response)
+}
+
+func (c *Controller) RegisterRoutes(router *gin.Engine, jwtService *auth.ServiceImpl) {
+	router.GET("/api/v1/courses/:code/prerequisites", middleware.Authenticate(jwtService), c.GetPrerequisites)
+	router.GET("/api/v1/courses/:code/unlocks", middleware.Authenticate(jwtService), c.GetUnlockedCourses)
+	router.GET("/api/v1/courses/:code/eligibility", middleware.Authenticate(jwtService), c.CheckEligibility)
+}
+
+// ------------------Private helper function------------------
+
+func (c *Controller) writeError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrCourseNotFound):
+		ctx.JSON(404, gin.H{"error": err.Error()})
+	case errors.Is(err, db.ErrForbidden):
+		ctx.JSON(403, gin.H{"error": err.Error()})
+	case errors.Is(err, db.ErrStudentRequired):
+		ctx.JSON(400, gin.H{"error": err.Error()})
+	default:
+		ctx.JSON(500, gin.H{"error": "failed to check the prerequisites"})
+	}
+}
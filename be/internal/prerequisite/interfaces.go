@@ -0,0 +1,68 @@
+package prerequisite
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrCycle is returned when the prerequisites of the courses have a cycle
+	ErrCycle = errors.New("cycle of prerequisites")
+	// ErrCourseNotFound is returned when no course has the code asked
+	ErrCourseNotFound = errors.New("course not found")
+)
+
+type Service interface {
+	GetPrerequisites(ctx context.Context, req GetPrerequisitesRequest) (GetPrerequisitesResponse, error)
+	GetUnlockedCourses(ctx context.Context, req GetUnlockedCoursesRequest) (GetUnlockedCoursesResponse, error)
+	CheckEligibility(ctx context.Context, req CheckEligibilityRequest) (CheckEligibilityResponse, error)
+}
+
+type Repository interface {
+	GetCourses(ctx context.Context) ([]Course, error)
+	GetEdges(ctx context.Context) ([]Edge, error)
+}
+
+// StudentAccess checks that the caller can access the data of a student, course.ServiceImpl implements it
+type StudentAccess interface {
+	// AccessibleStudent returns the student asked by the caller, the caller themselves for a student by default.
+	// A professor must advise the student, the eligibility reads their whole record.
+	AccessibleStudent(ctx context.Context, studentId *int) (int, error)
+}
+
+type GetPrerequisitesRequest struct {
+	Course string `json:"course" jsonschema:"description=Code of the course, e.g. INT3401,minLength=1"`
+}
+
+type GetPrerequisitesResponse struct {
+	Course CourseRef `json:"course"`
+	// Requirements are the direct requirement groups of the course, one course of each group is required
+	Requirements []Group `json:"requirements"`
+	// Transitive are all the prerequisites of the chains of the course, each one after its own prerequisites
+	Transitive []CourseRef `json:"transitive"`
+}
+
+type GetUnlockedCoursesRequest struct {
+	Course string `json:"course" jsonschema:"description=Code of the passed course, e.g. INT2210,minLength=1"`
+}
+
+type GetUnlockedCoursesResponse struct {
+	Course CourseRef `json:"course"`
+	// Courses require the course as a prerequisite or a co-requisite
+	Courses []CourseRef `json:"courses"`
+}
+
+type CheckEligibilityRequest struct {
+	Course    string `json:"course" jsonschema:"description=Code of the course the student wants to take, e.g. INT3401,minLength=1"`
+	StudentId *int   `json:"student_id,omitempty" jsonschema:"description=Id of the student, the current student by default,minimum=1"`
+}
+
+type CheckEligibilityResponse struct {
+	StudentID int       `json:"student_id"`
+	Course    CourseRef `json:"course"`
+	Eligible  bool      `json:"eligible"`
+	// Passed is true if the student already passed the course
+	Passed bool `json:"passed"`
+	// Unmet are the requirement groups the student doesn't satisfy yet
+	Unmet []Group `json:"unmet"`
+}
@@ -0,0 +1,254 @@
+package prerequisite
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RequirementType tells when the required course is taken
+type RequirementType string
+
+const (
+	// Prerequisite courses are passed before taking the course
+	Prerequisite RequirementType = "prerequisite"
+	// Corequisite courses are passed before or taken in the same semester as the course
+	Corequisite RequirementType = "corequisite"
+)
+
+type Course struct {
+	ID      int    `json:"-" db:"id"`
+	Code    string `json:"code" db:"code"`
+	Name    string `json:"name" db:"name"`
+	Credits int    `json:"credits" db:"credits"`
+}
+
+type CourseRef struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+// Edge is a row of course_requirement: the course requires the required course in a group of its requirements
+type Edge struct {
+	CourseCode   string          `db:"course_code"`
+	RequiredCode string          `db:"required_code"`
+	Type         RequirementType `db:"type"`
+	GroupNo      int             `db:"group_no"`
+}
+
+// Group is a requirement of a course satisfied by any of its courses, every group of the course is required
+type Group struct {
+	Type    RequirementType `json:"type"`
+	Courses []CourseRef     `json:"courses"`
+}
+
+// Graph is the in-memory graph of the requirements of the courses, the prerequisites form a DAG
+type Graph struct {
+	// The maps are keyed by the uppercase course code
+	courses map[string]Course
+	groups  map[string][]Group
+	// dependents are the courses requiring each course, sorted by code
+	dependents map[string][]string
+}
+
+// NewGraph builds the graph of the courses and returns an ErrCycle error if the prerequisites have a cycle.
+// The co-requisites may require each other.
+func NewGraph(courses []Course, edges []Edge) (*Graph, error) {
+	graph := &Graph{
+		courses:    make(map[string]Course, len(courses)),
+		groups:     make(map[string][]Group),
+		dependents: make(map[string][]string),
+	}
+	for _, course := range courses {
+		graph.courses[normalize(course.Code)] = course
+	}
+
+	type groupKey struct {
+		Type    RequirementType
+		GroupNo int
+	}
+	keys := make(map[string][]groupKey)
+	members := make(map[string]map[groupKey][]CourseRef)
+	for _, edge := range edges {
+		code, requiredCode := normalize(edge.CourseCode), normalize(edge.RequiredCode)
+		required, ok := graph.courses[requiredCode]
+		if _, exists := graph.courses[code]; !exists || !ok {
+			return nil, fmt.Errorf("requirement of unknown course %s -> %s", edge.CourseCode, edge.RequiredCode)
+		}
+		if edge.Type != Prerequisite && edge.Type != Corequisite {
+			return nil, fmt.Errorf("unknown requirement type %q of course %s", edge.Type, edge.CourseCode)
+		}
+		key := groupKey{Type: edge.Type, GroupNo: edge.GroupNo}
+		if members[code] == nil {
+			members[code] = make(map[groupKey][]CourseRef)
+		}
+		if _, exists := members[code][key]; !exists {
+			keys[code] = append(keys[code], key)
+		}
+		members[code][key] = append(members[code][key], CourseRef{Code: required.Code, Name: required.Name})
+		if !containsString(graph.dependents[requiredCode], code) {
+			graph.dependents[requiredCode] = append(graph.dependents[requiredCode], code)
+		}
+	}
+
+	for code, courseKeys := range keys {
+		// The prerequisites come first, then the groups by number
+		sort.Slice(courseKeys, func(i, j int) bool {
+			if courseKeys[i].Type != courseKeys[j].Type {
+				return courseKeys[i].Type == Prerequisite
+			}
+			return courseKeys[i].GroupNo < courseKeys[j].GroupNo
+		})
+		for _, key := range courseKeys {
+			refs := members[code][key]
+			sort.Slice(refs, func(i, j int) bool { return refs[i].Code < refs[j].Code })
+			graph.groups[code] = append(graph.groups[code], Group{Type: key.Type, Courses: refs})
+		}
+	}
+	for _, dependents := range graph.dependents {
+		sort.Strings(dependents)
+	}
+
+	if err := graph.checkCycles(); err != nil {
+		return nil, err
+	}
+	return graph, nil
+}
+
+// Course returns the course of a code, the code is case-insensitive
+func (g *Graph) Course(code string) (Course, bool) {
+	course, ok := g.courses[normalize(code)]
+	return course, ok
+}
+
+// Groups returns the requirement groups of the course
+func (g *Graph) Groups(code string) []Group {
+	return g.groups[normalize(code)]
+}
+
+// TransitivePrerequisites returns every course reachable through the prerequisites of the course,
+// in an order they can be taken: each course comes after its own prerequisites
+func (g *Graph) TransitivePrerequisites(code string) []CourseRef {
+	var ordered []CourseRef
+	visited := map[string]bool{normalize(code): true}
+	var visit func(code string)
+	visit = func(code string) {
+		for _, group := range g.groups[code] {
+			if group.Type != Prerequisite {
+				continue
+			}
+			for _, course := range group.Courses {
+				required := normalize(course.Code)
+				if visited[required] {
+					continue
+				}
+				visited[required] = true
+				visit(required)
+				ordered = append(ordered, course)
+			}
+		}
+	}
+	visit(normalize(code))
+	return ordered
+}
+
+// Unlocks returns the courses requiring the course as a prerequisite or a co-requisite
+func (g *Graph) Unlocks(code string) []CourseRef {
+	dependents := g.dependents[normalize(code)]
+	refs := make([]CourseRef, 0, len(dependents))
+	for _, dependent := range dependents {
+		course := g.courses[dependent]
+		refs = append(refs, CourseRef{Code: course.Code, Name: course.Name})
+	}
+	return refs
+}
+
+// Unmet returns the requirement groups of the course the student doesn't satisfy. A prerequisite group needs a passed course,
+// a co-requisite group a passed course or a course in progress.
+func (g *Graph) Unmet(code string, passed map[string]bool, inProgress map[string]bool) []Group {
+	var unmet []Group
+	for _, group := range g.groups[normalize(code)] {
+		satisfied := false
+		for _, course := range group.Courses {
+			if passed[course.Code] || (group.Type == Corequisite && inProgress[course.Code]) {
+				satisfied = true
+				break
+			}
+		}
+		if !satisfied {
+			unmet = append(unmet, group)
+		}
+	}
+	return unmet
+}
+
+// ------------------Private helper function------------------
+
+// checkCycles walks the prerequisites depth first and reports the first cycle found
+func (g *Graph) checkCycles() error {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int, len(g.courses))
+	var path []string
+	var visit func(code string) error
+	visit = func(code string) error {
+		state[code] = visiting
+		path = append(path, g.courses[code].Code)
+		for _, group := range g.groups[code] {
+			if group.Type != Prerequisite {
+				continue
+			}
+			for _, course := range group.Courses {
+				required := normalize(course.Code)
+				switch state[required] {
+				case visiting:
+					start := 0
+					for i, pathCode := range path {
+						if normalize(pathCode) == required {
+							start = i
+						}
+					}
+					cycle := append(append([]string(nil), path[start:]...), course.Code)
+					return fmt.Errorf("%w: %s", ErrCycle, strings.Join(cycle, " -> "))
+				case unvisited:
+					if err := visit(required); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[code] = done
+		return nil
+	}
+
+	codes := make([]string, 0, len(g.groups))
+	for code := range g.groups {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		if state[code] == unvisited {
+			if err := visit(code); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
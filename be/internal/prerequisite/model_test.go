@@ -0,0 +1,133 @@
+package prerequisite
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+var testCourses = []Course{
+	{ID: 1, Code: "INT1008", Name: "Nhập môn lập trình", Credits: 3},
+	{ID: 2, Code: "INT1050", Name: "Toán rời rạc", Credits: 4},
+	{ID: 3, Code: "INT2210", Name: "Cấu trúc dữ liệu và giải thuật", Credits: 4},
+	{ID: 4, Code: "INT2215", Name: "Lập trình nâng cao", Credits: 4},
+	{ID: 5, Code: "INT3401", Name: "Trí tuệ nhân tạo", Credits: 3},
+	{ID: 6, Code: "INT3402", Name: "Thực hành trí tuệ nhân tạo", Credits: 1},
+	{ID: 7, Code: "MAT1093", Name: "Đại số", Credits: 4},
+}
+
+// testEdges: INT3401 requires INT2210 and (INT1050 or MAT1093), with the co-requisite INT3402 which requires it back
+var testEdges = []Edge{
+	{CourseCode: "INT2210", RequiredCode: "INT1008", Type: Prerequisite, GroupNo: 1},
+	{CourseCode: "INT2215", RequiredCode: "INT1008", Type: Prerequisite, GroupNo: 1},
+	{CourseCode: "INT3401", RequiredCode: "MAT1093", Type: Prerequisite, GroupNo: 2},
+	{CourseCode: "INT3401", RequiredCode: "INT1050", Type: Prerequisite, GroupNo: 2},
+	{CourseCode: "INT3401", RequiredCode: "INT3402", Type: Corequisite, GroupNo: 1},
+	{CourseCode: "INT3401", RequiredCode: "INT2210", Type: Prerequisite, GroupNo: 1},
+	{CourseCode: "INT3402", RequiredCode: "INT3401", Type: Corequisite, GroupNo: 1},
+}
+
+func TestGraph_Queries(t *testing.T) {
+	graph, err := NewGraph(testCourses, testEdges)
+	require.NoError(t, err)
+
+	assert.Equal(t, []Group{
+		{Type: Prerequisite, Courses: []CourseRef{{Code: "INT2210", Name: "Cấu trúc dữ liệu và giải thuật"}}},
+		{Type: Prerequisite, Courses: []CourseRef{{Code: "INT1050", Name: "Toán rời rạc"}, {Code: "MAT1093", Name: "Đại số"}}},
+		{Type: Corequisite, Courses: []CourseRef{{Code: "INT3402", Name: "Thực hành trí tuệ nhân tạo"}}},
+	}, graph.Groups("int3401"))
+
+	assert.Equal(t, []CourseRef{
+		{Code: "INT1008", Name: "Nhập môn lập trình"},
+		{Code: "INT2210", Name: "Cấu trúc dữ liệu và giải thuật"},
+		{Code: "INT1050", Name: "Toán rời rạc"},
+		{Code: "MAT1093", Name: "Đại số"},
+	}, graph.TransitivePrerequisites("INT3401"))
+	assert.Empty(t, graph.TransitivePrerequisites("INT1008"))
+
+	assert.Equal(t, []CourseRef{{Code: "INT2210", Name: "Cấu trúc dữ liệu và giải thuật"}, {Code: "INT2215", Name: "Lập trình nâng cao"}}, graph.Unlocks("INT1008"))
+	assert.Equal(t, []CourseRef{{Code: "INT3401", Name: "Trí tuệ nhân tạo"}}, graph.Unlocks("INT3402"))
+}
+
+func TestGraph_Unmet(t *testing.T) {
+	graph, err := NewGraph(testCourses, testEdges)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		passed     []string
+		inProgress []string
+		expected   []Group
+	}{
+		{
+			name:       "Alternative prerequisite and co-requisite in progress",
+			passed:     []string{"INT1008", "INT2210", "MAT1093"},
+			inProgress: []string{"INT3402"},
+		},
+		{
+			name:       "Prerequisite in progress",
+			passed:     []string{"INT1050"},
+			inProgress: []string{"INT2210", "INT3402"},
+			expected:   []Group{{Type: Prerequisite, Courses: []CourseRef{{Code: "INT2210", Name: "Cấu trúc dữ liệu và giải thuật"}}}},
+		},
+		{
+			name:   "Nothing passed",
+			passed: []string{"INT2210"},
+			expected: []Group{
+				{Type: Prerequisite, Courses: []CourseRef{{Code: "INT1050", Name: "Toán rời rạc"}, {Code: "MAT1093", Name: "Đại số"}}},
+				{Type: Corequisite, Courses: []CourseRef{{Code: "INT3402", Name: "Thực hành trí tuệ nhân tạo"}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, graph.Unmet("INT3401", toSet(tt.passed), toSet(tt.inProgress)))
+		})
+	}
+}
+
+func TestNewGraph_Errors(t *testing.T) {
+	tests := []struct {
+		name      string
+		edges     []Edge
+		errSubstr string
+	}{
+		{
+			name: "Cycle of prerequisites",
+			edges: append([]Edge{
+				{CourseCode: "INT1008", RequiredCode: "INT3401", Type: Prerequisite, GroupNo: 1},
+			}, testEdges...),
+			errSubstr: "INT1008 -> INT3401 -> INT2210 -> INT1008",
+		},
+		{
+			name:      "Unknown course",
+			edges:     []Edge{{CourseCode: "INT9999", RequiredCode: "INT1008", Type: Prerequisite, GroupNo: 1}},
+			errSubstr: "unknown course INT9999",
+		},
+		{
+			name:      "Unknown type",
+			edges:     []Edge{{CourseCode: "INT2210", RequiredCode: "INT1008", Type: "recommended", GroupNo: 1}},
+			errSubstr: `unknown requirement type "recommended"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewGraph(testCourses, tt.edges)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errSubstr)
+		})
+	}
+
+	_, err := NewGraph(testCourses, append([]Edge{{CourseCode: "INT1008", RequiredCode: "INT1008", Type: Prerequisite, GroupNo: 1}}, testEdges...))
+	assert.ErrorIs(t, err, ErrCycle)
+}
+
+func toSet(codes []string) map[string]bool {
+	set := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		set[code] = true
+	}
+	return set
+}
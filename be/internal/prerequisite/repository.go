@@ -0,0 +1,35 @@
+package prerequisite
+
+import (
+	"HNLP/be/internal/db"
+	"context"
+)
+
+type RepositoryImpl struct {
+	db db.HDb
+}
+
+func NewRepositoryImpl(db db.HDb) *RepositoryImpl {
+	return &RepositoryImpl{db: db}
+}
+
+func (r *RepositoryImpl) GetCourses(ctx context.Context) ([]Course, error) {
+	var courses []Course
+	err := r.db.SelectContext(ctx, &courses, `SELECT id, code, COALESCE(name, '') AS name, COALESCE(credits, 0) AS credits
+FROM course
+ORDER BY code`)
+	return courses, err
+}
+
+func (r *RepositoryImpl) GetEdges(ctx context.Context) ([]Edge, error) {
+	var edges []Edge
+	err := r.db.SelectContext(ctx, &edges, `SELECT c.code  AS course_code,
+       rc.code AS required_code,
+       cr.type,
+       cr.group_no
+FROM course_requirement cr
+         JOIN course c ON c.id = cr.course_id
+         JOIN course rc ON rc.id = cr.required_course_id
+ORDER BY c.code, cr.type, cr.group_no, rc.code`)
+	return edges, err
+}
@@ -0,0 +1,149 @@
+package prerequisite
+
+import (
+	"HNLP/be/internal/grade"
+	"HNLP/be/internal/semester"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultGraphTTL is how long the graph of the courses is cached before being loaded again
+const DefaultGraphTTL = 10 * time.Minute
+
+type ServiceImpl struct {
+	repo        Repository
+	gradeRepo   grade.Repository
+	students    StudentAccess
+	semesterSrv semester.Service
+	scale       grade.Scale
+
+	// graph is loaded again once it is older than graphTTL
+	graph         *Graph
+	graphLoadedAt time.Time
+	graphTTL      time.Duration
+	graphMutex    sync.Mutex
+}
+
+func NewServiceImpl(repo Repository, gradeRepo grade.Repository, students StudentAccess, semesterSrv semester.Service, scale grade.Scale) *ServiceImpl {
+	return &ServiceImpl{
+		repo:        repo,
+		gradeRepo:   gradeRepo,
+		students:    students,
+		semesterSrv: semesterSrv,
+		scale:       scale,
+		graphTTL:    DefaultGraphTTL,
+	}
+}
+
+// GetGraph returns the graph of the courses, it is cached for the TTL of the service
+func (s *ServiceImpl) GetGraph(ctx context.Context) (*Graph, error) {
+	s.graphMutex.Lock()
+	defer s.graphMutex.Unlock()
+
+	if s.graph != nil && time.Since(s.graphLoadedAt) < s.graphTTL {
+		return s.graph, nil
+	}
+	courses, err := s.repo.GetCourses(ctx)
+	if err != nil {
+		return nil, err
+	}
+	edges, err := s.repo.GetEdges(ctx)
+	if err != nil {
+		return nil, err
+	}
+	graph, err := NewGraph(courses, edges)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the prerequisites: %w", err)
+	}
+	s.graph = graph
+	s.graphLoadedAt = time.Now()
+	return graph, nil
+}
+
+// Invalidate clears the cached graph, e.g. after the requirements of a course changed
+func (s *ServiceImpl) Invalidate() {
+	s.graphMutex.Lock()
+	s.graph = nil
+	s.graphMutex.Unlock()
+}
+
+// GetPrerequisites returns the requirement groups of a course and all the prerequisites of its chains
+func (s *ServiceImpl) GetPrerequisites(ctx context.Context, req GetPrerequisitesRequest) (GetPrerequisitesResponse, error) {
+	graph, course, err := s.findCourse(ctx, req.Course)
+	if err != nil {
+		return GetPrerequisitesResponse{}, err
+	}
+	response := GetPrerequisitesResponse{
+		Course:       CourseRef{Code: course.Code, Name: course.Name},
+		Requirements: graph.Groups(course.Code),
+		Transitive:   graph.TransitivePrerequisites(course.Code),
+	}
+	if response.Requirements == nil {
+		response.Requirements = []Group{}
+	}
+	if response.Transitive == nil {
+		response.Transitive = []CourseRef{}
+	}
+	return response, nil
+}
+
+// GetUnlockedCourses returns the courses requiring a course, which passing it helps to take
+func (s *ServiceImpl) GetUnlockedCourses(ctx context.Context, req GetUnlockedCoursesRequest) (GetUnlockedCoursesResponse, error) {
+	graph, course, err := s.findCourse(ctx, req.Course)
+	if err != nil {
+		return GetUnlockedCoursesResponse{}, err
+	}
+	return GetUnlockedCoursesResponse{
+		Course:  CourseRef{Code: course.Code, Name: course.Name},
+		Courses: graph.Unlocks(course.Code),
+	}, nil
+}
+
+// CheckEligibility checks the requirements of a course against the courses passed by a student and the ones they take this semester
+func (s *ServiceImpl) CheckEligibility(ctx context.Context, req CheckEligibilityRequest) (CheckEligibilityResponse, error) {
+	studentId, err := s.students.AccessibleStudent(ctx, req.StudentId)
+	if err != nil {
+		return CheckEligibilityResponse{}, err
+	}
+	graph, course, err := s.findCourse(ctx, req.Course)
+	if err != nil {
+		return CheckEligibilityResponse{}, err
+	}
+	attempts, err := s.gradeRepo.GetAttempts(ctx, studentId)
+	if err != nil {
+		return CheckEligibilityResponse{}, err
+	}
+	current, err := s.semesterSrv.GetCurrentSemester(ctx)
+	if err != nil {
+		return CheckEligibilityResponse{}, err
+	}
+
+	passed, inProgress := s.scale.CourseStatuses(attempts, current.Code)
+	response := CheckEligibilityResponse{
+		StudentID: studentId,
+		Course:    CourseRef{Code: course.Code, Name: course.Name},
+		Passed:    passed[course.Code],
+		Unmet:     graph.Unmet(course.Code, passed, inProgress),
+	}
+	if response.Unmet == nil {
+		response.Unmet = []Group{}
+	}
+	response.Eligible = len(response.Unmet) == 0
+	return response, nil
+}
+
+// ------------------Private helper function------------------
+
+func (s *ServiceImpl) findCourse(ctx context.Context, code string) (*Graph, Course, error) {
+	graph, err := s.GetGraph(ctx)
+	if err != nil {
+		return nil, Course{}, err
+	}
+	course, ok := graph.Course(code)
+	if !ok {
+		return nil, Course{}, fmt.Errorf("%w: %s", ErrCourseNotFound, code)
+	}
+	return graph, course, nil
+}
@@ -0,0 +1,119 @@
+package prerequisite
+
+import (
+	"HNLP/be/internal/db"
+	"HNLP/be/internal/grade"
+	"HNLP/be/internal/semester"
+	"HNLP/be/internal/testutil"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// MockRepository implements the Repository interface for testing
+type MockRepository struct {
+	mock.Mock
+}
+
+func (m *MockRepository) GetCourses(ctx context.Context) ([]Course, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]Course), args.Error(1)
+}
+
+func (m *MockRepository) GetEdges(ctx context.Context) ([]Edge, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]Edge), args.Error(1)
+}
+
+func newTestService(repo Repository, gradeRepo grade.Repository, students StudentAccess) *ServiceImpl {
+	semesterSrv := &testutil.MockSemesterService{}
+	semesterSrv.On("GetCurrentSemester", mock.Anything).Return(semester.Semester{Code: "2024-2025-1"}, nil)
+	return NewServiceImpl(repo, gradeRepo, students, semesterSrv, grade.NewScale(nil))
+}
+
+func newTestRepository() *MockRepository {
+	repo := &MockRepository{}
+	repo.On("GetCourses", mock.Anything).Return(testCourses, nil)
+	repo.On("GetEdges", mock.Anything).Return(testEdges, nil)
+	return repo
+}
+
+func TestServiceImpl_GetPrerequisites(t *testing.T) {
+	repo := newTestRepository()
+	service := newTestService(repo, &testutil.MockGradeRepository{}, &testutil.MockStudentAccess{})
+
+	response, err := service.GetPrerequisites(context.Background(), GetPrerequisitesRequest{Course: "int2210"})
+	require.NoError(t, err)
+	assert.Equal(t, GetPrerequisitesResponse{
+		Course:       CourseRef{Code: "INT2210", Name: "Cấu trúc dữ liệu và giải thuật"},
+		Requirements: []Group{{Type: Prerequisite, Courses: []CourseRef{{Code: "INT1008", Name: "Nhập môn lập trình"}}}},
+		Transitive:   []CourseRef{{Code: "INT1008", Name: "Nhập môn lập trình"}},
+	}, response)
+
+	unlocked, err := service.GetUnlockedCourses(context.Background(), GetUnlockedCoursesRequest{Course: "INT2210"})
+	require.NoError(t, err)
+	assert.Equal(t, []CourseRef{{Code: "INT3401", Name: "Trí tuệ nhân tạo"}}, unlocked.Courses)
+
+	_, err = service.GetPrerequisites(context.Background(), GetPrerequisitesRequest{Course: "INT9999"})
+	assert.ErrorIs(t, err, ErrCourseNotFound)
+
+	// The graph is loaded once for the TTL
+	repo.AssertNumberOfCalls(t, "GetCourses", 1)
+	service.Invalidate()
+	_, err = service.GetPrerequisites(context.Background(), GetPrerequisitesRequest{Course: "INT1008"})
+	require.NoError(t, err)
+	repo.AssertNumberOfCalls(t, "GetCourses", 2)
+}
+
+func TestServiceImpl_GetGraph_Cycle(t *testing.T) {
+	repo := &MockRepository{}
+	repo.On("GetCourses", mock.Anything).Return(testCourses, nil)
+	repo.On("GetEdges", mock.Anything).Return([]Edge{
+		{CourseCode: "INT2210", RequiredCode: "INT2215", Type: Prerequisite, GroupNo: 1},
+		{CourseCode: "INT2215", RequiredCode: "INT2210", Type: Prerequisite, GroupNo: 1},
+	}, nil)
+
+	_, err := newTestService(repo, &testutil.MockGradeRepository{}, &testutil.MockStudentAccess{}).GetPrerequisites(context.Background(), GetPrerequisitesRequest{Course: "INT2210"})
+	assert.ErrorIs(t, err, ErrCycle)
+}
+
+func TestServiceImpl_CheckEligibility(t *testing.T) {
+	score := func(value float64) *float64 { return &value }
+	gradeRepo := &testutil.MockGradeRepository{}
+	gradeRepo.On("GetAttempts", mock.Anything, 5).Return([]grade.Attempt{
+		{Semester: "2023-2024-1", CourseCode: "INT1008", FinalGrade: score(7)},
+		{Semester: "2023-2024-2", CourseCode: "INT2210", FinalGrade: score(3)},
+		{Semester: "2023-2024-2", CourseCode: "MAT1093", FinalGrade: score(8)},
+		{Semester: "2024-2025-1", CourseCode: "INT2210"},
+	}, nil)
+	students := &testutil.MockStudentAccess{}
+	students.On("AccessibleStudent", mock.Anything, (*int)(nil)).Return(5, nil)
+	students.On("AccessibleStudent", mock.Anything, intPtr(9)).Return(0, db.ErrForbidden)
+	service := newTestService(newTestRepository(), gradeRepo, students)
+
+	response, err := service.CheckEligibility(context.Background(), CheckEligibilityRequest{Course: "INT3401"})
+	require.NoError(t, err)
+	assert.Equal(t, CheckEligibilityResponse{
+		StudentID: 5,
+		Course:    CourseRef{Code: "INT3401", Name: "Trí tuệ nhân tạo"},
+		// INT2210 was failed and is retaken this semester
+		Unmet: []Group{
+			{Type: Prerequisite, Courses: []CourseRef{{Code: "INT2210", Name: "Cấu trúc dữ liệu và giải thuật"}}},
+			{Type: Corequisite, Courses: []CourseRef{{Code: "INT3402", Name: "Thực hành trí tuệ nhân tạo"}}},
+		},
+	}, response)
+
+	response, err = service.CheckEligibility(context.Background(), CheckEligibilityRequest{Course: "INT2215"})
+	require.NoError(t, err)
+	assert.True(t, response.Eligible)
+	assert.Empty(t, response.Unmet)
+
+	_, err = service.CheckEligibility(context.Background(), CheckEligibilityRequest{Course: "INT2215", StudentId: intPtr(9)})
+	assert.ErrorIs(t, err, db.ErrForbidden)
+}
+
+func intPtr(value int) *int {
+	return &value
+}
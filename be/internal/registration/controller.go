@@ -0,0 +1,81 @@
+package registration
+
+import (
+	"HNLP/be/internal/auth"
+	"HNLP/be/internal/middleware"
+	"errors"
+	"github.com/gin-gonic/gin"
+)
+
+type Controller struct {
+	service Service
+}
+
+func NewController(service Service) *Controller {
+	return &Controller{service: service}
+}
+
+// Register registers the student for a class, e.g. POST /api/v1/registrations {"class_code": "INT3306 1", "group": "2"}
+func (c *Controller) Register(ctx *gin.Context) {
+	var request RegisterRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(400, gin.H{"error": "invalid request"})
+		return
+	}
+
+	response, err := c.service.Register(middleware.RequestContext(ctx), request)
+	if err != nil {
+		c.writeError(ctx, err)
+		return
+	}
+	ctx.JSON(201, response)
+}
+
+// Drop drops a class or leaves its waitlist, e.g. DELETE /api/v1/registrations/INT3306%201?semester=2024-2025-2
+func (c *Controller) Drop(ctx *gin.Context) {
+	response, err := c.service.Drop(middleware.RequestContext(ctx), DropRequest{ClassCode: ctx.Param("class_code"), Semester: ctx.Query("semester")})
+	if err != nil {
+		c.writeError(ctx, err)
+		return
+	}
+	ctx.JSON(200, response)
+}
+
+// ListRegistrations returns the classes registered by the student, e.g. /api/v1/registrations?semester=2024-2025-2
+func (c *Controller) ListRegistrations(ctx *gin.Context) {
+	var request ListRegistrationsRequest
+	if err := ctx.ShouldBindQuery(&request); err != nil {
+		ctx.JSON(400, gin.H{"error": "invalid request"})
+		return
+	}
+
+	response, err := c.service.ListRegistrations(middleware.RequestContext(ctx), request)
+	if err != nil {
+		c.writeError(ctx, err)
+		return
+	}
+	ctx.JSON(200, response)
+}
+
+func (c *Controller) RegisterRoutes(router *gin.Engine, jwtService *auth.ServiceImpl) {
+	router.GET("/api/v1/registrations", middleware.Authenticate(jwtService), c.ListRegistrations)
+	router.POST("/api/v1/registrations", middleware.Authenticate(jwtService), c.Register)
+	router.DELETE("/api/v1/registrations/:class_code", middleware.Authenticate(jwtService), c.Drop)
+}
+
+// ------------------Private helper function------------------
+
+func (c *Controller) writeError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrNotStudent), errors.Is(err, ErrRegistrationClosed):
+		ctx.JSON(403, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrClassNotFound), errors.Is(err, ErrNotRegistered):
+		ctx.JSON(404, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrInvalidGroup):
+		ctx.JSON(400, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrAlreadyRegistered), errors.Is(err, ErrRequirementsUnmet), errors.Is(err, ErrScheduleConflict), errors.Is(err, ErrCreditLimit):
+		ctx.JSON(409, gin.H{"error": err.Error()})
+	default:
+		ctx.JSON(500, gin.H{"error": "failed to process the registration"})
+	}
+}
@@ -0,0 +1,103 @@
+package registration
+
+import (
+	"HNLP/be/courseclass"
+	"HNLP/be/internal/prerequisite"
+	"context"
+	"errors"
+)
+
+var (
+	// ErrNotStudent is returned when a professor or an admin tries to register
+	ErrNotStudent = errors.New("only the students can register for the course classes")
+	// ErrRegistrationClosed is returned outside the registration window of the semester
+	ErrRegistrationClosed = errors.New("the registration is closed")
+	ErrClassNotFound      = errors.New("course class not found")
+	// ErrInvalidGroup is returned when the practice group is missing or isn't a group of the class
+	ErrInvalidGroup      = errors.New("invalid practice group")
+	ErrAlreadyRegistered = errors.New("already registered")
+	ErrNotRegistered     = errors.New("not registered")
+	ErrRequirementsUnmet = errors.New("the requirements of the course are not met")
+	ErrScheduleConflict  = errors.New("schedule conflict")
+	ErrCreditLimit       = errors.New("credit limit exceeded")
+)
+
+// Requirements is the prerequisite graph of the courses
+type Requirements interface {
+	GetGraph(ctx context.Context) (*prerequisite.Graph, error)
+}
+
+type Repository interface {
+	// GetClass returns the class with the code in the semester
+	GetClass(ctx context.Context, code string, semester string) (Class, error)
+	// GetSessions returns the weekly sessions of the class
+	GetSessions(ctx context.Context, classId int) ([]courseclass.ClassSchedule, error)
+	// GetRegistrations returns the classes registered and waitlisted by the student in the semester
+	GetRegistrations(ctx context.Context, studentId int, semester string) ([]Registration, error)
+	// Transaction runs fn in a transaction, committed if fn returns no error and rolled back otherwise
+	Transaction(ctx context.Context, fn func(tx Tx) error) error
+}
+
+// Tx is the registration data read and written in a transaction. The locks are held until the end of the transaction,
+// the registrations of a student are serialized by LockStudent and the seats of a class by LockClass.
+type Tx interface {
+	LockStudent(ctx context.Context, studentId int) error
+	// LockClass locks the class and returns its capacity, nil if it is unlimited
+	LockClass(ctx context.Context, classId int) (*int, error)
+	GetRegistrations(ctx context.Context, studentId int, semester string) ([]Registration, error)
+	// GetSessionsOfStudent returns the sessions of the classes registered and waitlisted by the student in the semester
+	GetSessionsOfStudent(ctx context.Context, studentId int, semester string) ([]courseclass.ScheduleEntry, error)
+	CountEnrolled(ctx context.Context, classId int) (int, error)
+	// InsertEnrollment enrolls the student in the class and in its sessions
+	InsertEnrollment(ctx context.Context, studentId int, classId int, scheduleIds []int) error
+	// InsertWaitlist puts the student at the end of the waitlist of the class and returns their position
+	InsertWaitlist(ctx context.Context, studentId int, classId int, group *string) (int, error)
+	// DeleteEnrollment removes the enrollment of the student in the class if it has no grade yet
+	DeleteEnrollment(ctx context.Context, studentId int, classId int) (bool, error)
+	DeleteWaitlist(ctx context.Context, studentId int, classId int) (bool, error)
+	// NextWaitlisted returns the first student of the waitlist of the class, nil if it is empty
+	NextWaitlisted(ctx context.Context, classId int) (*WaitlistEntry, error)
+}
+
+type RegisterRequest struct {
+	ClassCode string  `json:"class_code" binding:"required"`
+	Group     *string `json:"group,omitempty"`
+	Semester  string  `json:"semester,omitempty"`
+}
+
+type RegisterResponse struct {
+	Registration Registration `json:"registration"`
+}
+
+type DropRequest struct {
+	ClassCode string `json:"class_code"`
+	Semester  string `json:"semester,omitempty"`
+}
+
+type DropResponse struct {
+	ClassCode string `json:"class_code"`
+	// Status is the status of the registration before it was dropped
+	Status Status `json:"status"`
+}
+
+type ListRegistrationsRequest struct {
+	Semester string `json:"semester,omitempty" form:"semester" jsonschema:"description=A semester code like 2024-2025-2 or the words of the user like 'kỳ sau', the current semester by default"`
+}
+
+type ListRegistrationsResponse struct {
+	Semester          string         `json:"semester"`
+	RegistrationStart string         `json:"registration_start,omitempty"`
+	RegistrationEnd   string         `json:"registration_end,omitempty"`
+	RegistrationOpen  bool           `json:"registration_open"`
+	Credits           int            `json:"credits"`
+	MaxCredits        int            `json:"max_credits"`
+	Registrations     []Registration `json:"registrations"`
+}
+
+type Service interface {
+	// Register registers the caller for a class, they are put on its waitlist if it is full
+	Register(ctx context.Context, req RegisterRequest) (RegisterResponse, error)
+	// Drop drops a class or leaves its waitlist, the freed seat goes to the first student of the waitlist
+	Drop(ctx context.Context, req DropRequest) (DropResponse, error)
+	ListRegistrations(ctx context.Context, req ListRegistrationsRequest) (ListRegistrationsResponse, error)
+}
@@ -0,0 +1,102 @@
+package registration
+
+import (
+	"HNLP/be/courseclass"
+	"fmt"
+	"strings"
+)
+
+// Status is the status of a registration of a student for a class
+type Status string
+
+const (
+	Registered Status = "registered"
+	Waitlisted Status = "waitlisted"
+)
+
+// theoryGroup is the group_identifier of the theory sessions attended by every student of a class
+const theoryGroup = "CL"
+
+// Class is a course class with the course counted by the registration
+type Class struct {
+	ID         int    `db:"id"`
+	Code       string `db:"code"`
+	Semester   string `db:"semester_id"`
+	CourseCode string `db:"course_code"`
+	CourseName string `db:"course_name"`
+	Credits    int    `db:"credits"`
+	Capacity   *int   `db:"capacity"`
+}
+
+// Registration is a class registered or waitlisted by a student, WaitlistPosition starts from 1
+type Registration struct {
+	ClassID          int     `json:"-" db:"course_class_id"`
+	ClassCode        string  `json:"class_code" db:"class_code"`
+	CourseCode       string  `json:"course_code" db:"course_code"`
+	CourseName       string  `json:"course_name" db:"course_name"`
+	Credits          int     `json:"credits" db:"credits"`
+	Status           Status  `json:"status" db:"status"`
+	Group            *string `json:"group,omitempty" db:"group_identifier"`
+	WaitlistPosition *int    `json:"waitlist_position,omitempty" db:"waitlist_position"`
+}
+
+// WaitlistEntry is a student waiting for a seat of a class
+type WaitlistEntry struct {
+	StudentID int     `db:"student_id"`
+	Group     *string `db:"group_identifier"`
+}
+
+// selectSessions returns the sessions attended with the practice group after checking the group,
+// it must be one of the practice groups of the class or empty if it has none
+func selectSessions(sessions []courseclass.ClassSchedule, group *string) ([]courseclass.ClassSchedule, error) {
+	chosen := ""
+	if group != nil {
+		chosen = strings.TrimSpace(*group)
+	}
+	var groups []string
+	for _, session := range sessions {
+		if !isTheory(session) && !containsString(groups, *session.Group) {
+			groups = append(groups, *session.Group)
+		}
+	}
+	if len(groups) == 0 && chosen != "" {
+		return nil, fmt.Errorf("%w: the class has no practice group", ErrInvalidGroup)
+	}
+	if len(groups) > 0 && !containsFold(groups, chosen) {
+		return nil, fmt.Errorf("%w %q, choose one of the practice groups %s", ErrInvalidGroup, chosen, strings.Join(groups, ", "))
+	}
+	return attendedSessions(sessions, &chosen), nil
+}
+
+// attendedSessions returns the theory sessions and the sessions of the practice group
+func attendedSessions(sessions []courseclass.ClassSchedule, group *string) []courseclass.ClassSchedule {
+	var attended []courseclass.ClassSchedule
+	for _, session := range sessions {
+		if isTheory(session) || (group != nil && strings.EqualFold(*session.Group, strings.TrimSpace(*group))) {
+			attended = append(attended, session)
+		}
+	}
+	return attended
+}
+
+func isTheory(session courseclass.ClassSchedule) bool {
+	return session.Group == nil || *session.Group == "" || strings.EqualFold(*session.Group, theoryGroup)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,245 @@
+package registration
+
+import (
+	"HNLP/be/courseclass"
+	"HNLP/be/internal/db"
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// querier runs the statements on the database or in a transaction
+type querier interface {
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+const sessionColumns = `ccs.id,
+       ccs.course_class_id,
+       ccs.day_of_week,
+       ccs.lesson_range,
+       ccs.session_type,
+       ccs.group_identifier,
+       ccs.location`
+
+// theorySessionCondition matches the sessions of a class attended by every student, the theory sessions
+const theorySessionCondition = `(ccs.group_identifier IS NULL OR ccs.group_identifier = '' OR ccs.group_identifier = 'CL')`
+
+type RepositoryImpl struct {
+	db db.HDb
+}
+
+func NewRepositoryImpl(db db.HDb) *RepositoryImpl {
+	return &RepositoryImpl{db: db}
+}
+
+func (r *RepositoryImpl) GetClass(ctx context.Context, code string, semester string) (Class, error) {
+	var class Class
+	err := r.db.GetContext(ctx, &class, `SELECT cc.id,
+       cc.code,
+       cc.semester_id,
+       c.code                 AS course_code,
+       COALESCE(c.name, '')   AS course_name,
+       COALESCE(c.credits, 0) AS credits,
+       cc.capacity
+FROM course_class cc
+         JOIN course c ON c.id = cc.course_id
+WHERE UPPER(cc.code) = UPPER($1)
+  AND cc.semester_id = $2`, code, semester)
+	return class, err
+}
+
+func (r *RepositoryImpl) GetSessions(ctx context.Context, classId int) ([]courseclass.ClassSchedule, error) {
+	var sessions []courseclass.ClassSchedule
+	err := r.db.SelectContext(ctx, &sessions, `SELECT `+sessionColumns+`
+FROM course_class_schedule ccs
+WHERE ccs.course_class_id = $1
+ORDER BY ccs.id`, classId)
+	return sessions, err
+}
+
+func (r *RepositoryImpl) GetRegistrations(ctx context.Context, studentId int, semester string) ([]Registration, error) {
+	return getRegistrations(ctx, r.db, studentId, semester)
+}
+
+func (r *RepositoryImpl) Transaction(ctx context.Context, fn func(tx Tx) error) error {
+	sqlTx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(&txImpl{tx: sqlTx}); err != nil {
+		_ = sqlTx.Rollback()
+		return err
+	}
+	return sqlTx.Commit()
+}
+
+// txImpl implements Tx on a database transaction
+type txImpl struct {
+	tx *sqlx.Tx
+}
+
+func (t *txImpl) LockStudent(ctx context.Context, studentId int) error {
+	var id int
+	return t.tx.GetContext(ctx, &id, `SELECT id FROM student WHERE id = $1 FOR UPDATE`, studentId)
+}
+
+func (t *txImpl) LockClass(ctx context.Context, classId int) (*int, error) {
+	var capacity *int
+	err := t.tx.GetContext(ctx, &capacity, `SELECT capacity FROM course_class WHERE id = $1 FOR UPDATE`, classId)
+	return capacity, err
+}
+
+func (t *txImpl) GetRegistrations(ctx context.Context, studentId int, semester string) ([]Registration, error) {
+	return getRegistrations(ctx, t.tx, studentId, semester)
+}
+
+func (t *txImpl) GetSessionsOfStudent(ctx context.Context, studentId int, semester string) ([]courseclass.ScheduleEntry, error) {
+	var entries []courseclass.ScheduleEntry
+	err := t.tx.SelectContext(ctx, &entries, `SELECT `+sessionColumns+`, cc.code AS class_code, c.code AS course_code, COALESCE(c.name, '') AS course_name
+FROM course_class_enrollment cce
+         JOIN student_course_class_schedule sccs ON sccs.course_class_enrollment_id = cce.id
+         JOIN course_class_schedule ccs ON ccs.id = sccs.course_class_schedule_id
+         JOIN course_class cc ON cc.id = cce.course_class_id
+         JOIN course c ON c.id = cc.course_id
+WHERE cce.student_id = $1
+  AND cc.semester_id = $2
+UNION ALL
+SELECT `+sessionColumns+`, cc.code AS class_code, c.code AS course_code, COALESCE(c.name, '') AS course_name
+FROM course_class_waitlist w
+         JOIN course_class_schedule ccs ON ccs.course_class_id = w.course_class_id
+         JOIN course_class cc ON cc.id = w.course_class_id
+         JOIN course c ON c.id = cc.course_id
+WHERE w.student_id = $1
+  AND cc.semester_id = $2
+  AND (`+theorySessionCondition+` OR ccs.group_identifier = w.group_identifier)`, studentId, semester)
+	return entries, err
+}
+
+func (t *txImpl) CountEnrolled(ctx context.Context, classId int) (int, error) {
+	var count int
+	err := t.tx.GetContext(ctx, &count, `SELECT COUNT(*) FROM course_class_enrollment WHERE course_class_id = $1`, classId)
+	return count, err
+}
+
+func (t *txImpl) InsertEnrollment(ctx context.Context, studentId int, classId int, scheduleIds []int) error {
+	var enrollmentId int
+	err := t.tx.GetContext(ctx, &enrollmentId, `INSERT INTO course_class_enrollment (student_id, course_class_id)
+VALUES ($1, $2)
+RETURNING id`, studentId, classId)
+	if err != nil {
+		return err
+	}
+	_, err = t.tx.ExecContext(ctx, `INSERT INTO student_course_class_schedule (course_class_enrollment_id, course_class_schedule_id)
+SELECT $1, UNNEST($2::INT[])`, enrollmentId, pq.Array(scheduleIds))
+	return err
+}
+
+func (t *txImpl) InsertWaitlist(ctx context.Context, studentId int, classId int, group *string) (int, error) {
+	// The count doesn't see the inserted row, the new student comes after the ones waiting
+	var position int
+	err := t.tx.GetContext(ctx, &position, `WITH inserted AS (
+    INSERT INTO course_class_waitlist (student_id, course_class_id, group_identifier)
+        VALUES ($1, $2, $3)
+        RETURNING id)
+SELECT COUNT(*) + 1
+FROM course_class_waitlist
+WHERE course_class_id = $2`, studentId, classId, group)
+	return position, err
+}
+
+func (t *txImpl) DeleteEnrollment(ctx context.Context, studentId int, classId int) (bool, error) {
+	// The enrollments with a grade are the history of the student and are kept
+	_, err := t.tx.ExecContext(ctx, `DELETE
+FROM student_course_class_schedule
+WHERE course_class_enrollment_id IN (SELECT id
+                                     FROM course_class_enrollment
+                                     WHERE student_id = $1
+                                       AND course_class_id = $2
+                                       AND final_grade IS NULL
+                                       AND grade IS NULL)`, studentId, classId)
+	if err != nil {
+		return false, err
+	}
+	result, err := t.tx.ExecContext(ctx, `DELETE
+FROM course_class_enrollment
+WHERE student_id = $1
+  AND course_class_id = $2
+  AND final_grade IS NULL
+  AND grade IS NULL`, studentId, classId)
+	return rowsAffected(result, err)
+}
+
+func (t *txImpl) DeleteWaitlist(ctx context.Context, studentId int, classId int) (bool, error) {
+	result, err := t.tx.ExecContext(ctx, `DELETE FROM course_class_waitlist WHERE student_id = $1 AND course_class_id = $2`, studentId, classId)
+	return rowsAffected(result, err)
+}
+
+func (t *txImpl) NextWaitlisted(ctx context.Context, classId int) (*WaitlistEntry, error) {
+	var entry WaitlistEntry
+	err := t.tx.GetContext(ctx, &entry, `SELECT student_id, group_identifier
+FROM course_class_waitlist
+WHERE course_class_id = $1
+ORDER BY created_at, id
+LIMIT 1`, classId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// ------------------Private helper function------------------
+
+func getRegistrations(ctx context.Context, q querier, studentId int, semester string) ([]Registration, error) {
+	var registrations []Registration
+	err := q.SelectContext(ctx, &registrations, `SELECT cc.id                  AS course_class_id,
+       cc.code                AS class_code,
+       c.code                 AS course_code,
+       COALESCE(c.name, '')   AS course_name,
+       COALESCE(c.credits, 0) AS credits,
+       'registered'           AS status,
+       (SELECT MIN(ccs.group_identifier)
+        FROM student_course_class_schedule sccs
+                 JOIN course_class_schedule ccs ON ccs.id = sccs.course_class_schedule_id
+        WHERE sccs.course_class_enrollment_id = cce.id
+          AND NOT `+theorySessionCondition+`) AS group_identifier,
+       NULL::INT              AS waitlist_position
+FROM course_class_enrollment cce
+         JOIN course_class cc ON cc.id = cce.course_class_id
+         JOIN course c ON c.id = cc.course_id
+WHERE cce.student_id = $1
+  AND cc.semester_id = $2
+UNION ALL
+SELECT cc.id,
+       cc.code,
+       c.code,
+       COALESCE(c.name, ''),
+       COALESCE(c.credits, 0),
+       'waitlisted',
+       w.group_identifier,
+       (SELECT COUNT(*)::INT
+        FROM course_class_waitlist other
+        WHERE other.course_class_id = w.course_class_id
+          AND (other.created_at, other.id) <= (w.created_at, w.id))
+FROM course_class_waitlist w
+         JOIN course_class cc ON cc.id = w.course_class_id
+         JOIN course c ON c.id = cc.course_id
+WHERE w.student_id = $1
+  AND cc.semester_id = $2
+ORDER BY course_code, class_code`, studentId, semester)
+	return registrations, err
+}
+
+func rowsAffected(result sql.Result, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
@@ -0,0 +1,359 @@
+package registration
+
+import (
+	"HNLP/be/courseclass"
+	"HNLP/be/internal/config"
+	"HNLP/be/internal/db"
+	"HNLP/be/internal/grade"
+	"HNLP/be/internal/prerequisite"
+	"HNLP/be/internal/semester"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultMaxCredits is the credit limit of a semester if the config has none
+const DefaultMaxCredits = 24
+
+type ServiceImpl struct {
+	repo         Repository
+	gradeRepo    grade.Repository
+	requirements Requirements
+	semesterSrv  semester.Service
+	scale        grade.Scale
+	timetable    *courseclass.Timetable
+	maxCredits   int
+	// now returns the current time, it is replaced in the tests
+	now func() time.Time
+}
+
+func NewServiceImpl(repo Repository, gradeRepo grade.Repository, requirements Requirements, semesterSrv semester.Service, scale grade.Scale, timetable *courseclass.Timetable, cfg config.RegistrationConfig) *ServiceImpl {
+	maxCredits := cfg.MaxCredits
+	if maxCredits <= 0 {
+		maxCredits = DefaultMaxCredits
+	}
+	return &ServiceImpl{
+		repo:         repo,
+		gradeRepo:    gradeRepo,
+		requirements: requirements,
+		semesterSrv:  semesterSrv,
+		scale:        scale,
+		timetable:    timetable,
+		maxCredits:   maxCredits,
+		now:          time.Now,
+	}
+}
+
+// Register registers the caller for a class after checking the prerequisites, the credit limit and the conflicts with
+// their schedule. The classes waitlisted count in the credits and the schedule, so a student always fits the class
+// when they get a seat. The checks and the seat are taken in a transaction holding the locks of the student and the class.
+func (s *ServiceImpl) Register(ctx context.Context, req RegisterRequest) (RegisterResponse, error) {
+	studentId, err := studentOf(ctx)
+	if err != nil {
+		return RegisterResponse{}, err
+	}
+	sem, err := s.openSemester(ctx, req.Semester)
+	if err != nil {
+		return RegisterResponse{}, err
+	}
+	class, sessions, err := s.findClass(ctx, req.ClassCode, sem)
+	if err != nil {
+		return RegisterResponse{}, err
+	}
+	selected, err := selectSessions(sessions, req.Group)
+	if err != nil {
+		return RegisterResponse{}, err
+	}
+	graph, err := s.requirements.GetGraph(ctx)
+	if err != nil {
+		return RegisterResponse{}, err
+	}
+	attempts, err := s.gradeRepo.GetAttempts(ctx, studentId)
+	if err != nil {
+		return RegisterResponse{}, err
+	}
+	passed, inProgress := s.scale.CourseStatuses(attempts, sem.Code)
+
+	registration := Registration{
+		ClassID:    class.ID,
+		ClassCode:  class.Code,
+		CourseCode: class.CourseCode,
+		CourseName: class.CourseName,
+		Credits:    class.Credits,
+		Group:      groupOf(selected),
+	}
+	err = s.repo.Transaction(ctx, func(tx Tx) error {
+		if err := tx.LockStudent(ctx, studentId); err != nil {
+			return err
+		}
+		registrations, err := tx.GetRegistrations(ctx, studentId, sem.Code)
+		if err != nil {
+			return err
+		}
+		credits := 0
+		for _, other := range registrations {
+			if strings.EqualFold(other.CourseCode, class.CourseCode) {
+				return fmt.Errorf("%w: the course %s is %s in the class %s", ErrAlreadyRegistered, other.CourseCode, other.Status, other.ClassCode)
+			}
+			credits += other.Credits
+			// The co-requisites can be taken in the same semester
+			inProgress[other.CourseCode] = true
+		}
+		if unmet := graph.Unmet(class.CourseCode, passed, inProgress); len(unmet) > 0 {
+			return fmt.Errorf("%w: %s", ErrRequirementsUnmet, describeGroups(unmet))
+		}
+		if credits+class.Credits > s.maxCredits {
+			return fmt.Errorf("%w: %d credits are registered, %d more would exceed the limit of %d credits", ErrCreditLimit, credits, class.Credits, s.maxCredits)
+		}
+		schedule, err := tx.GetSessionsOfStudent(ctx, studentId, sem.Code)
+		if err != nil {
+			return err
+		}
+		if err := s.checkConflicts(schedule, selected); err != nil {
+			return err
+		}
+
+		capacity, err := tx.LockClass(ctx, class.ID)
+		if err != nil {
+			return err
+		}
+		// The students waiting get the free seats first, e.g. after the capacity was raised
+		enrolled, err := s.promote(ctx, tx, class.ID, capacity, sessions)
+		if err != nil {
+			return err
+		}
+		if capacity == nil || enrolled < *capacity {
+			registration.Status = Registered
+			return tx.InsertEnrollment(ctx, studentId, class.ID, scheduleIds(selected))
+		}
+		position, err := tx.InsertWaitlist(ctx, studentId, class.ID, registration.Group)
+		if err != nil {
+			return err
+		}
+		registration.Status = Waitlisted
+		registration.WaitlistPosition = &position
+		return nil
+	})
+	if err != nil {
+		return RegisterResponse{}, err
+	}
+	return RegisterResponse{Registration: registration}, nil
+}
+
+// Drop drops a class registered by the caller or removes them from its waitlist. The seat freed by a drop goes to the
+// first student of the waitlist in the same transaction.
+func (s *ServiceImpl) Drop(ctx context.Context, req DropRequest) (DropResponse, error) {
+	studentId, err := studentOf(ctx)
+	if err != nil {
+		return DropResponse{}, err
+	}
+	sem, err := s.openSemester(ctx, req.Semester)
+	if err != nil {
+		return DropResponse{}, err
+	}
+	class, sessions, err := s.findClass(ctx, req.ClassCode, sem)
+	if err != nil {
+		return DropResponse{}, err
+	}
+
+	response := DropResponse{ClassCode: class.Code}
+	err = s.repo.Transaction(ctx, func(tx Tx) error {
+		if err := tx.LockStudent(ctx, studentId); err != nil {
+			return err
+		}
+		capacity, err := tx.LockClass(ctx, class.ID)
+		if err != nil {
+			return err
+		}
+		dropped, err := tx.DeleteEnrollment(ctx, studentId, class.ID)
+		if err != nil {
+			return err
+		}
+		if dropped {
+			response.Status = Registered
+			_, err = s.promote(ctx, tx, class.ID, capacity, sessions)
+			return err
+		}
+		left, err := tx.DeleteWaitlist(ctx, studentId, class.ID)
+		if err != nil {
+			return err
+		}
+		if !left {
+			return fmt.Errorf("%w in the class %s", ErrNotRegistered, class.Code)
+		}
+		response.Status = Waitlisted
+		return nil
+	})
+	if err != nil {
+		return DropResponse{}, err
+	}
+	return response, nil
+}
+
+// ListRegistrations returns the classes registered and waitlisted by the caller in a semester with its registration window
+func (s *ServiceImpl) ListRegistrations(ctx context.Context, req ListRegistrationsRequest) (ListRegistrationsResponse, error) {
+	studentId, err := studentOf(ctx)
+	if err != nil {
+		return ListRegistrationsResponse{}, err
+	}
+	sem, err := s.resolveSemester(ctx, req.Semester)
+	if err != nil {
+		return ListRegistrationsResponse{}, err
+	}
+	registrations, err := s.repo.GetRegistrations(ctx, studentId, sem.Code)
+	if err != nil {
+		return ListRegistrationsResponse{}, err
+	}
+
+	response := ListRegistrationsResponse{
+		Semester:         sem.Code,
+		RegistrationOpen: sem.RegistrationOpen(s.now()),
+		MaxCredits:       s.maxCredits,
+		Registrations:    []Registration{},
+	}
+	if sem.RegistrationStart != nil && sem.RegistrationEnd != nil {
+		response.RegistrationStart = sem.RegistrationStart.Format(semester.DateLayout)
+		response.RegistrationEnd = sem.RegistrationEnd.Format(semester.DateLayout)
+	}
+	for _, registration := range registrations {
+		response.Credits += registration.Credits
+		response.Registrations = append(response.Registrations, registration)
+	}
+	return response, nil
+}
+
+// ------------------Private helper function------------------
+
+func studentOf(ctx context.Context) (int, error) {
+	caller := db.CallerFrom(ctx)
+	if caller.Role != "student" {
+		return 0, ErrNotStudent
+	}
+	return caller.SpecificID, nil
+}
+
+// resolveSemester resolves the semester expression of the user, the current semester if it is empty
+func (s *ServiceImpl) resolveSemester(ctx context.Context, expression string) (semester.Semester, error) {
+	if strings.TrimSpace(expression) == "" {
+		return s.semesterSrv.GetCurrentSemester(ctx)
+	}
+	resolved, err := s.semesterSrv.ResolveSemester(ctx, semester.ResolveSemesterRequest{Expression: expression})
+	if err != nil {
+		return semester.Semester{}, err
+	}
+	if len(resolved.Semesters) != 1 {
+		return semester.Semester{}, fmt.Errorf("%q is %d semesters, a single semester is expected", expression, len(resolved.Semesters))
+	}
+	return resolved.Semesters[0], nil
+}
+
+// openSemester resolves a semester whose registration window is open today
+func (s *ServiceImpl) openSemester(ctx context.Context, expression string) (semester.Semester, error) {
+	sem, err := s.resolveSemester(ctx, expression)
+	if err != nil {
+		return semester.Semester{}, err
+	}
+	if sem.RegistrationOpen(s.now()) {
+		return sem, nil
+	}
+	if sem.RegistrationStart == nil || sem.RegistrationEnd == nil {
+		return semester.Semester{}, fmt.Errorf("%w: the semester %s has no registration window", ErrRegistrationClosed, sem.Code)
+	}
+	return semester.Semester{}, fmt.Errorf("%w: the registration of the semester %s is from %s to %s", ErrRegistrationClosed, sem.Code,
+		sem.RegistrationStart.Format(semester.DateLayout), sem.RegistrationEnd.Format(semester.DateLayout))
+}
+
+func (s *ServiceImpl) findClass(ctx context.Context, code string, sem semester.Semester) (Class, []courseclass.ClassSchedule, error) {
+	class, err := s.repo.GetClass(ctx, strings.TrimSpace(code), sem.Code)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Class{}, nil, fmt.Errorf("%w: %s in the semester %s", ErrClassNotFound, code, sem.Code)
+	}
+	if err != nil {
+		return Class{}, nil, err
+	}
+	sessions, err := s.repo.GetSessions(ctx, class.ID)
+	if err != nil {
+		return Class{}, nil, err
+	}
+	return class, sessions, nil
+}
+
+// checkConflicts returns an ErrScheduleConflict error listing the sessions of the class overlapping the schedule
+func (s *ServiceImpl) checkConflicts(schedule []courseclass.ScheduleEntry, sessions []courseclass.ClassSchedule) error {
+	var conflicts []string
+	for _, session := range sessions {
+		for _, entry := range schedule {
+			if s.timetable.Overlaps(session, entry.ClassSchedule) {
+				conflicts = append(conflicts, fmt.Sprintf("the lessons %s of day %s overlap the class %s (%s)", *session.LessonRange, session.DayOfWeek, entry.ClassCode, entry.CourseName))
+			}
+		}
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("%w: %s", ErrScheduleConflict, strings.Join(conflicts, "; "))
+	}
+	return nil
+}
+
+// promote enrolls the students of the waitlist in order while the class has free seats and returns the students enrolled
+func (s *ServiceImpl) promote(ctx context.Context, tx Tx, classId int, capacity *int, sessions []courseclass.ClassSchedule) (int, error) {
+	enrolled, err := tx.CountEnrolled(ctx, classId)
+	if err != nil {
+		return 0, err
+	}
+	for capacity == nil || enrolled < *capacity {
+		next, err := tx.NextWaitlisted(ctx, classId)
+		if err != nil {
+			return 0, err
+		}
+		if next == nil {
+			break
+		}
+		if _, err := tx.DeleteWaitlist(ctx, next.StudentID, classId); err != nil {
+			return 0, err
+		}
+		// The practice group was checked when the student joined the waitlist
+		if err := tx.InsertEnrollment(ctx, next.StudentID, classId, scheduleIds(attendedSessions(sessions, next.Group))); err != nil {
+			return 0, err
+		}
+		enrolled++
+	}
+	return enrolled, nil
+}
+
+// describeGroups describes the requirement groups, e.g. "prerequisite INT2210; prerequisite one of INT1050, MAT1093"
+func describeGroups(groups []prerequisite.Group) string {
+	descriptions := make([]string, 0, len(groups))
+	for _, group := range groups {
+		codes := make([]string, 0, len(group.Courses))
+		for _, course := range group.Courses {
+			codes = append(codes, course.Code)
+		}
+		if len(codes) == 1 {
+			descriptions = append(descriptions, fmt.Sprintf("%s %s", group.Type, codes[0]))
+		} else {
+			descriptions = append(descriptions, fmt.Sprintf("%s one of %s", group.Type, strings.Join(codes, ", ")))
+		}
+	}
+	return strings.Join(descriptions, "; ")
+}
+
+// groupOf returns the practice group of the sessions, nil if they are only theory sessions
+func groupOf(sessions []courseclass.ClassSchedule) *string {
+	for _, session := range sessions {
+		if !isTheory(session) {
+			return session.Group
+		}
+	}
+	return nil
+}
+
+func scheduleIds(sessions []courseclass.ClassSchedule) []int {
+	ids := make([]int, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, session.ID)
+	}
+	return ids
+}
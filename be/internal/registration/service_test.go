@@ -0,0 +1,371 @@
+package registration
+
+import (
+	"HNLP/be/courseclass"
+	"HNLP/be/internal/config"
+	"HNLP/be/internal/grade"
+	"HNLP/be/internal/prerequisite"
+	"HNLP/be/internal/semester"
+	"HNLP/be/internal/testutil"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// MockRepository implements the Repository interface for testing, its transactions run on tx
+type MockRepository struct {
+	mock.Mock
+	tx *MockTx
+}
+
+func (m *MockRepository) GetClass(ctx context.Context, code string, semester string) (Class, error) {
+	args := m.Called(ctx, code, semester)
+	return args.Get(0).(Class), args.Error(1)
+}
+
+func (m *MockRepository) GetSessions(ctx context.Context, classId int) ([]courseclass.ClassSchedule, error) {
+	args := m.Called(ctx, classId)
+	return args.Get(0).([]courseclass.ClassSchedule), args.Error(1)
+}
+
+func (m *MockRepository) GetRegistrations(ctx context.Context, studentId int, semester string) ([]Registration, error) {
+	args := m.Called(ctx, studentId, semester)
+	return args.Get(0).([]Registration), args.Error(1)
+}
+
+func (m *MockRepository) Transaction(ctx context.Context, fn func(tx Tx) error) error {
+	m.Called(ctx)
+	return fn(m.tx)
+}
+
+// MockTx implements the Tx interface for testing
+type MockTx struct {
+	mock.Mock
+}
+
+func (m *MockTx) LockStudent(ctx context.Context, studentId int) error {
+	return m.Called(ctx, studentId).Error(0)
+}
+
+func (m *MockTx) LockClass(ctx context.Context, classId int) (*int, error) {
+	args := m.Called(ctx, classId)
+	return args.Get(0).(*int), args.Error(1)
+}
+
+func (m *MockTx) GetRegistrations(ctx context.Context, studentId int, semester string) ([]Registration, error) {
+	args := m.Called(ctx, studentId, semester)
+	return args.Get(0).([]Registration), args.Error(1)
+}
+
+func (m *MockTx) GetSessionsOfStudent(ctx context.Context, studentId int, semester string) ([]courseclass.ScheduleEntry, error) {
+	args := m.Called(ctx, studentId, semester)
+	return args.Get(0).([]courseclass.ScheduleEntry), args.Error(1)
+}
+
+func (m *MockTx) CountEnrolled(ctx context.Context, classId int) (int, error) {
+	args := m.Called(ctx, classId)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockTx) InsertEnrollment(ctx context.Context, studentId int, classId int, scheduleIds []int) error {
+	return m.Called(ctx, studentId, classId, scheduleIds).Error(0)
+}
+
+func (m *MockTx) InsertWaitlist(ctx context.Context, studentId int, classId int, group *string) (int, error) {
+	args := m.Called(ctx, studentId, classId, group)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockTx) DeleteEnrollment(ctx context.Context, studentId int, classId int) (bool, error) {
+	args := m.Called(ctx, studentId, classId)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockTx) DeleteWaitlist(ctx context.Context, studentId int, classId int) (bool, error) {
+	args := m.Called(ctx, studentId, classId)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockTx) NextWaitlisted(ctx context.Context, classId int) (*WaitlistEntry, error) {
+	args := m.Called(ctx, classId)
+	return args.Get(0).(*WaitlistEntry), args.Error(1)
+}
+
+// staticRequirements implements the Requirements interface with a fixed graph
+type staticRequirements struct {
+	graph *prerequisite.Graph
+}
+
+func (r staticRequirements) GetGraph(ctx context.Context) (*prerequisite.Graph, error) {
+	return r.graph, nil
+}
+
+var (
+	registrationStart = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+	registrationEnd   = time.Date(2025, time.January, 20, 0, 0, 0, 0, time.UTC)
+	testSemester      = semester.Semester{
+		Code:              "2024-2025-2",
+		StartDate:         time.Date(2025, time.February, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:           time.Date(2025, time.June, 30, 0, 0, 0, 0, time.UTC),
+		RegistrationStart: &registrationStart,
+		RegistrationEnd:   &registrationEnd,
+	}
+
+	// INT2210 1 has a theory session on Monday and a practice session for each of its groups
+	testClass    = Class{ID: 1, Code: "INT2210 1", Semester: "2024-2025-2", CourseCode: "INT2210", CourseName: "Cấu trúc dữ liệu và giải thuật", Credits: 4}
+	testSessions = []courseclass.ClassSchedule{
+		{ID: 10, CourseClassID: 1, DayOfWeek: "2", LessonRange: strPtr("1-2"), Group: strPtr("CL"), Location: "208-GĐ3"},
+		{ID: 11, CourseClassID: 1, DayOfWeek: "3", LessonRange: strPtr("1-2"), Group: strPtr("1"), Location: "PM 313-G2"},
+		{ID: 12, CourseClassID: 1, DayOfWeek: "4", LessonRange: strPtr("1-2"), Group: strPtr("2"), Location: "PM 313-G2"},
+	}
+	testAiClass = Class{ID: 2, Code: "INT3401 1", Semester: "2024-2025-2", CourseCode: "INT3401", CourseName: "Trí tuệ nhân tạo", Credits: 3}
+)
+
+func newTestService(t *testing.T, repo *MockRepository, now time.Time) *ServiceImpl {
+	graph, err := prerequisite.NewGraph([]prerequisite.Course{
+		{ID: 1, Code: "INT1008", Credits: 3},
+		{ID: 2, Code: "INT2210", Credits: 4},
+		{ID: 3, Code: "INT3401", Credits: 3},
+		{ID: 4, Code: "INT3402", Credits: 1},
+	}, []prerequisite.Edge{
+		{CourseCode: "INT2210", RequiredCode: "INT1008", Type: prerequisite.Prerequisite, GroupNo: 1},
+		{CourseCode: "INT3401", RequiredCode: "INT2210", Type: prerequisite.Prerequisite, GroupNo: 1},
+		{CourseCode: "INT3401", RequiredCode: "INT3402", Type: prerequisite.Corequisite, GroupNo: 1},
+	})
+	require.NoError(t, err)
+	score := 7.0
+	gradeRepo := &testutil.MockGradeRepository{}
+	gradeRepo.On("GetAttempts", mock.Anything, 5).Return([]grade.Attempt{{Semester: "2023-2024-1", CourseCode: "INT1008", Credits: 3, FinalGrade: &score}}, nil)
+	semesterSrv := &testutil.MockSemesterService{}
+	semesterSrv.On("GetCurrentSemester", mock.Anything).Return(testSemester, nil)
+	timetable, err := courseclass.NewTimetable(config.ScheduleConfig{})
+	require.NoError(t, err)
+
+	service := NewServiceImpl(repo, gradeRepo, staticRequirements{graph: graph}, semesterSrv, grade.NewScale(nil), timetable, config.RegistrationConfig{})
+	service.now = func() time.Time { return now }
+	return service
+}
+
+func newTestRepository() *MockRepository {
+	repo := &MockRepository{tx: &MockTx{}}
+	repo.On("GetClass", mock.Anything, "INT2210 1", "2024-2025-2").Return(testClass, nil)
+	repo.On("GetClass", mock.Anything, "INT3401 1", "2024-2025-2").Return(testAiClass, nil)
+	repo.On("GetSessions", mock.Anything, 1).Return(testSessions, nil)
+	repo.On("GetSessions", mock.Anything, 2).Return([]courseclass.ClassSchedule{}, nil)
+	repo.On("Transaction", mock.Anything).Return()
+	repo.tx.On("LockStudent", mock.Anything, 5).Return(nil)
+	return repo
+}
+
+func callerContext(role string, specificId int) context.Context {
+	ctx := context.WithValue(context.Background(), "userRole", role)
+	return context.WithValue(ctx, "specificId", specificId)
+}
+
+func TestServiceImpl_Register(t *testing.T) {
+	duringRegistration := time.Date(2025, time.January, 10, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		role          string
+		now           time.Time
+		request       RegisterRequest
+		registrations []Registration
+		schedule      []courseclass.ScheduleEntry
+		capacity      *int
+		enrolled      int
+		expected      Registration
+		wantErr       error
+		errSubstr     string
+	}{
+		{
+			name:     "Registered with a practice group",
+			request:  RegisterRequest{ClassCode: " INT2210 1 ", Group: strPtr("2")},
+			capacity: intPtr(40),
+			enrolled: 10,
+			expected: Registration{ClassID: 1, ClassCode: "INT2210 1", CourseCode: "INT2210", CourseName: "Cấu trúc dữ liệu và giải thuật", Credits: 4, Status: Registered, Group: strPtr("2")},
+		},
+		{
+			name:     "Waitlisted when the class is full",
+			request:  RegisterRequest{ClassCode: "INT2210 1", Group: strPtr("1")},
+			capacity: intPtr(40),
+			enrolled: 40,
+			expected: Registration{ClassID: 1, ClassCode: "INT2210 1", CourseCode: "INT2210", CourseName: "Cấu trúc dữ liệu và giải thuật", Credits: 4, Status: Waitlisted, Group: strPtr("1"), WaitlistPosition: intPtr(3)},
+		},
+		{
+			name:      "Practice group missing",
+			request:   RegisterRequest{ClassCode: "INT2210 1"},
+			wantErr:   ErrInvalidGroup,
+			errSubstr: "choose one of the practice groups 1, 2",
+		},
+		{
+			name:          "Course already registered",
+			request:       RegisterRequest{ClassCode: "INT2210 1", Group: strPtr("1")},
+			registrations: []Registration{{ClassCode: "INT2210 2", CourseCode: "INT2210", Credits: 4, Status: Waitlisted}},
+			wantErr:       ErrAlreadyRegistered,
+			errSubstr:     "waitlisted in the class INT2210 2",
+		},
+		{
+			// The co-requisite registered in the semester counts
+			name:          "Prerequisite not passed",
+			request:       RegisterRequest{ClassCode: "INT3401 1"},
+			registrations: []Registration{{ClassCode: "INT3402 1", CourseCode: "INT3402", Credits: 1, Status: Registered}},
+			wantErr:       ErrRequirementsUnmet,
+			errSubstr:     "not met: prerequisite INT2210",
+		},
+		{
+			name:      "Prerequisite and co-requisite missing",
+			request:   RegisterRequest{ClassCode: "INT3401 1"},
+			wantErr:   ErrRequirementsUnmet,
+			errSubstr: "not met: prerequisite INT2210; corequisite INT3402",
+		},
+		{
+			name:          "Credit limit",
+			request:       RegisterRequest{ClassCode: "INT2210 1", Group: strPtr("1")},
+			registrations: []Registration{{CourseCode: "MAT1093", Credits: 4}, {CourseCode: "INT3306", Credits: 18}},
+			wantErr:       ErrCreditLimit,
+			errSubstr:     "22 credits are registered, 4 more would exceed the limit of 24 credits",
+		},
+		{
+			name:      "Schedule conflict",
+			request:   RegisterRequest{ClassCode: "INT2210 1", Group: strPtr("1")},
+			schedule:  []courseclass.ScheduleEntry{{ClassSchedule: courseclass.ClassSchedule{DayOfWeek: "3", LessonRange: strPtr("2-3")}, ClassCode: "MAT1093 2", CourseName: "Đại số"}},
+			wantErr:   ErrScheduleConflict,
+			errSubstr: "the lessons 1-2 of day 3 overlap the class MAT1093 2 (Đại số)",
+		},
+		{
+			name:      "Registration closed",
+			now:       time.Date(2025, time.January, 21, 9, 0, 0, 0, time.UTC),
+			request:   RegisterRequest{ClassCode: "INT2210 1", Group: strPtr("1")},
+			wantErr:   ErrRegistrationClosed,
+			errSubstr: "from 2025-01-01 to 2025-01-20",
+		},
+		{
+			name:    "Professor",
+			role:    "professor",
+			request: RegisterRequest{ClassCode: "INT2210 1", Group: strPtr("1")},
+			wantErr: ErrNotStudent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newTestRepository()
+			repo.tx.On("GetRegistrations", mock.Anything, 5, "2024-2025-2").Return(tt.registrations, nil)
+			repo.tx.On("GetSessionsOfStudent", mock.Anything, 5, "2024-2025-2").Return(tt.schedule, nil)
+			repo.tx.On("LockClass", mock.Anything, 1).Return(tt.capacity, nil)
+			repo.tx.On("CountEnrolled", mock.Anything, 1).Return(tt.enrolled, nil)
+			repo.tx.On("NextWaitlisted", mock.Anything, 1).Return((*WaitlistEntry)(nil), nil)
+			repo.tx.On("InsertEnrollment", mock.Anything, 5, 1, []int{10, 12}).Return(nil)
+			repo.tx.On("InsertWaitlist", mock.Anything, 5, 1, strPtr("1")).Return(3, nil)
+			now, role := tt.now, tt.role
+			if now.IsZero() {
+				now = duringRegistration
+			}
+			if role == "" {
+				role = "student"
+			}
+
+			response, err := newTestService(t, repo, now).Register(callerContext(role, 5), tt.request)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Contains(t, err.Error(), tt.errSubstr)
+				repo.tx.AssertNotCalled(t, "InsertEnrollment", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+				repo.tx.AssertNotCalled(t, "InsertWaitlist", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, response.Registration)
+			repo.tx.AssertCalled(t, "LockStudent", mock.Anything, 5)
+		})
+	}
+}
+
+func TestServiceImpl_Register_PromotesWaitlistFirst(t *testing.T) {
+	// A seat was added to the full class, the student waiting takes it before the new registration
+	repo := newTestRepository()
+	repo.tx.On("GetRegistrations", mock.Anything, 5, "2024-2025-2").Return([]Registration(nil), nil)
+	repo.tx.On("GetSessionsOfStudent", mock.Anything, 5, "2024-2025-2").Return([]courseclass.ScheduleEntry(nil), nil)
+	repo.tx.On("LockClass", mock.Anything, 1).Return(intPtr(41), nil)
+	repo.tx.On("CountEnrolled", mock.Anything, 1).Return(40, nil)
+	repo.tx.On("NextWaitlisted", mock.Anything, 1).Return(&WaitlistEntry{StudentID: 8, Group: strPtr("1")}, nil)
+	repo.tx.On("DeleteWaitlist", mock.Anything, 8, 1).Return(true, nil)
+	repo.tx.On("InsertEnrollment", mock.Anything, 8, 1, []int{10, 11}).Return(nil)
+	repo.tx.On("InsertWaitlist", mock.Anything, 5, 1, strPtr("2")).Return(1, nil)
+
+	response, err := newTestService(t, repo, time.Date(2025, time.January, 10, 9, 0, 0, 0, time.UTC)).
+		Register(callerContext("student", 5), RegisterRequest{ClassCode: "INT2210 1", Group: strPtr("2")})
+	require.NoError(t, err)
+	assert.Equal(t, Waitlisted, response.Registration.Status)
+	assert.Equal(t, intPtr(1), response.Registration.WaitlistPosition)
+	repo.tx.AssertNumberOfCalls(t, "NextWaitlisted", 1)
+}
+
+func TestServiceImpl_Drop(t *testing.T) {
+	now := time.Date(2025, time.January, 10, 9, 0, 0, 0, time.UTC)
+
+	t.Run("Seat given to the first student of the waitlist", func(t *testing.T) {
+		repo := newTestRepository()
+		repo.tx.On("LockClass", mock.Anything, 1).Return(intPtr(40), nil)
+		repo.tx.On("DeleteEnrollment", mock.Anything, 5, 1).Return(true, nil)
+		repo.tx.On("CountEnrolled", mock.Anything, 1).Return(39, nil)
+		repo.tx.On("NextWaitlisted", mock.Anything, 1).Return(&WaitlistEntry{StudentID: 8, Group: strPtr("1")}, nil).Once()
+		repo.tx.On("DeleteWaitlist", mock.Anything, 8, 1).Return(true, nil)
+		repo.tx.On("InsertEnrollment", mock.Anything, 8, 1, []int{10, 11}).Return(nil)
+
+		response, err := newTestService(t, repo, now).Drop(callerContext("student", 5), DropRequest{ClassCode: "INT2210 1"})
+		require.NoError(t, err)
+		assert.Equal(t, DropResponse{ClassCode: "INT2210 1", Status: Registered}, response)
+		repo.tx.AssertExpectations(t)
+	})
+
+	t.Run("Waitlist left", func(t *testing.T) {
+		repo := newTestRepository()
+		repo.tx.On("LockClass", mock.Anything, 1).Return(intPtr(40), nil)
+		repo.tx.On("DeleteEnrollment", mock.Anything, 5, 1).Return(false, nil)
+		repo.tx.On("DeleteWaitlist", mock.Anything, 5, 1).Return(true, nil)
+
+		response, err := newTestService(t, repo, now).Drop(callerContext("student", 5), DropRequest{ClassCode: "INT2210 1"})
+		require.NoError(t, err)
+		assert.Equal(t, Waitlisted, response.Status)
+		repo.tx.AssertNotCalled(t, "NextWaitlisted", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Not registered", func(t *testing.T) {
+		repo := newTestRepository()
+		repo.tx.On("LockClass", mock.Anything, 1).Return(intPtr(40), nil)
+		repo.tx.On("DeleteEnrollment", mock.Anything, 5, 1).Return(false, nil)
+		repo.tx.On("DeleteWaitlist", mock.Anything, 5, 1).Return(false, nil)
+
+		_, err := newTestService(t, repo, now).Drop(callerContext("student", 5), DropRequest{ClassCode: "INT2210 1"})
+		assert.ErrorIs(t, err, ErrNotRegistered)
+	})
+}
+
+func TestServiceImpl_ListRegistrations(t *testing.T) {
+	repo := newTestRepository()
+	repo.On("GetRegistrations", mock.Anything, 5, "2024-2025-2").Return([]Registration{
+		{ClassCode: "INT2210 1", CourseCode: "INT2210", Credits: 4, Status: Registered},
+		{ClassCode: "INT3401 1", CourseCode: "INT3401", Credits: 3, Status: Waitlisted, WaitlistPosition: intPtr(2)},
+	}, nil)
+
+	response, err := newTestService(t, repo, time.Date(2025, time.January, 25, 9, 0, 0, 0, time.UTC)).ListRegistrations(callerContext("student", 5), ListRegistrationsRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "2024-2025-2", response.Semester)
+	assert.False(t, response.RegistrationOpen)
+	assert.Equal(t, "2025-01-20", response.RegistrationEnd)
+	assert.Equal(t, 7, response.Credits)
+	assert.Equal(t, DefaultMaxCredits, response.MaxCredits)
+	assert.Len(t, response.Registrations, 2)
+}
+
+func strPtr(value string) *string {
+	return &value
+}
+
+func intPtr(value int) *int {
+	return &value
+}
@@ -0,0 +1,25 @@
+package semester
+
+import (
+	"context"
+)
+
+type ResolveSemesterRequest struct {
+	Expression string `json:"expression" jsonschema:"description=The semester mentioned by the user, e.g. 'kỳ này', 'kỳ trước', 'học kỳ 2 năm ngoái', 'last semester', 'năm học 2023-2024' or a code like '2024-2025-1'"`
+}
+
+type ResolveSemesterResponse struct {
+	// Semesters has one semester for a semester expression and all the semesters of the academic year for a year expression
+	Semesters []Semester `json:"semesters"`
+	Current   Semester   `json:"current"`
+}
+
+type Service interface {
+	GetCurrentSemester(ctx context.Context) (Semester, error)
+	ResolveSemester(ctx context.Context, req ResolveSemesterRequest) (ResolveSemesterResponse, error)
+}
+
+type Repository interface {
+	// GetAll returns the semesters ordered by their start date
+	GetAll(ctx context.Context) ([]Semester, error)
+}
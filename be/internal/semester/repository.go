@@ -0,0 +1,20 @@
+package semester
+
+import (
+	"HNLP/be/internal/db"
+	"context"
+)
+
+type RepositoryImpl struct {
+	db db.HDb
+}
+
+func NewRepositoryImpl(db db.HDb) *RepositoryImpl {
+	return &RepositoryImpl{db: db}
+}
+
+func (r *RepositoryImpl) GetAll(ctx context.Context) ([]Semester, error) {
+	var semesters []Semester
+	err := r.db.SelectContext(ctx, &semesters, "SELECT * FROM semester ORDER BY start_date, code")
+	return semesters, err
+}
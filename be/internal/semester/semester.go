@@ -0,0 +1,77 @@
+package semester
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// DateLayout is the format of the dates of the semesters given to the LLM
+const DateLayout = "2006-01-02"
+
+var codePattern = regexp.MustCompile(`^(\d{4})-(\d{4})-(\d)$`)
+
+// Semester is a semester of an academic year. Its code is yyyy-yyyy-x where x is 1, 2 or 3 for the summer semester,
+// course_class.semester_id references it.
+type Semester struct {
+	ID                int        `json:"id" db:"id"`
+	Code              string     `json:"code" db:"code"`
+	Name              string     `json:"name" db:"name"`
+	StartDate         time.Time  `json:"start_date" db:"start_date"`
+	EndDate           time.Time  `json:"end_date" db:"end_date"`
+	RegistrationStart *time.Time `json:"registration_start,omitempty" db:"registration_start"`
+	RegistrationEnd   *time.Time `json:"registration_end,omitempty" db:"registration_end"`
+	// GradeDeadline is the last day the professors can enter the grades of the semester
+	GradeDeadline *time.Time `json:"grade_deadline,omitempty" db:"grade_deadline"`
+}
+
+// Contains reports whether the day is between the start and the end dates of the semester, both included
+func (s Semester) Contains(day time.Time) bool {
+	day = dateOf(day)
+	return !day.Before(s.StartDate) && !day.After(s.EndDate)
+}
+
+// RegistrationOpen reports whether the day is in the course registration window of the semester
+func (s Semester) RegistrationOpen(day time.Time) bool {
+	if s.RegistrationStart == nil || s.RegistrationEnd == nil {
+		return false
+	}
+	day = dateOf(day)
+	return !day.Before(*s.RegistrationStart) && !day.After(*s.RegistrationEnd)
+}
+
+// GradesLocked reports whether the grade deadline of the semester is before the day
+func (s Semester) GradesLocked(day time.Time) bool {
+	return s.GradeDeadline != nil && dateOf(day).After(*s.GradeDeadline)
+}
+
+// String describes the semester for the prompt, e.g. "2024-2025-1 (Học kỳ 1 năm học 2024-2025, from 2024-09-01 to 2025-01-15)"
+func (s Semester) String() string {
+	return fmt.Sprintf("%s (%s, from %s to %s)", s.Code, s.Name, s.StartDate.Format(DateLayout), s.EndDate.Format(DateLayout))
+}
+
+// FormatCode returns the code of the given term of the academic year starting in startYear
+func FormatCode(startYear int, term int) string {
+	return fmt.Sprintf("%d-%d-%d", startYear, startYear+1, term)
+}
+
+// ParseCode returns the start year of the academic year and the term of a semester code
+func ParseCode(code string) (startYear int, term int, err error) {
+	match := codePattern.FindStringSubmatch(code)
+	if match == nil {
+		return 0, 0, fmt.Errorf("invalid semester code %q, expected yyyy-yyyy-x", code)
+	}
+	startYear, _ = strconv.Atoi(match[1])
+	endYear, _ := strconv.Atoi(match[2])
+	term, _ = strconv.Atoi(match[3])
+	if endYear != startYear+1 || term < 1 || term > 3 {
+		return 0, 0, fmt.Errorf("invalid semester code %q, expected yyyy-yyyy-x", code)
+	}
+	return startYear, term, nil
+}
+
+// dateOf returns the midnight UTC of the calendar day of t, the DATE columns are scanned this way
+func dateOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,199 @@
+package semester
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	academicYearPattern = regexp.MustCompile(`(\d{4}) ?- ?(\d{4})`)
+	yearPattern         = regexp.MustCompile(`(?:năm học|năm|year) (\d{4})`)
+	termPattern         = regexp.MustCompile(`(?:học kỳ|kỳ|hk|semester|term) ?([123])(?:$| )|([123])(?:st|nd|rd)? (?:semester|term)`)
+
+	// The phrases are matched on the normalized expression, the longest phrases first so "kỳ trước nữa" isn't read as "kỳ trước"
+	yearOffsets = []phraseOffset{
+		{"năm học trước", -1}, {"năm ngoái", -1}, {"năm trước", -1}, {"last year", -1}, {"previous year", -1},
+		{"năm học này", 0}, {"năm học hiện tại", 0}, {"năm nay", 0}, {"this year", 0}, {"current year", 0},
+		{"năm học sau", 1}, {"năm học tới", 1}, {"năm sau", 1}, {"năm tới", 1}, {"next year", 1},
+	}
+	semesterOffsets = []phraseOffset{
+		{"kỳ trước nữa", -2}, {"semester before last", -2},
+		{"kỳ trước", -1}, {"kỳ vừa rồi", -1}, {"last semester", -1}, {"previous semester", -1},
+		{"kỳ này", 0}, {"kỳ hiện tại", 0}, {"this semester", 0}, {"current semester", 0}, {"hiện tại", 0}, {"now", 0},
+		{"kỳ sau", 1}, {"kỳ tới", 1}, {"next semester", 1},
+	}
+	termWords = []phraseOffset{
+		{"kỳ một", 1}, {"kỳ hai", 2}, {"kỳ hè", 3}, {"hè", 3}, {"first semester", 1}, {"second semester", 2}, {"summer", 3},
+	}
+)
+
+type phraseOffset struct {
+	phrase string
+	offset int
+}
+
+type ServiceImpl struct {
+	repo Repository
+	// now returns the current time, it is replaced in the tests
+	now func() time.Time
+}
+
+func NewServiceImpl(repo Repository) *ServiceImpl {
+	return &ServiceImpl{
+		repo: repo,
+		now:  time.Now,
+	}
+}
+
+// GetCurrentSemester returns the semester of today, or the last started semester between two semesters
+func (s *ServiceImpl) GetCurrentSemester(ctx context.Context) (Semester, error) {
+	semesters, err := s.repo.GetAll(ctx)
+	if err != nil {
+		return Semester{}, err
+	}
+	if len(semesters) == 0 {
+		return Semester{}, errors.New("no semester found")
+	}
+	return semesters[currentIndex(semesters, s.now())], nil
+}
+
+// ResolveSemester resolves an expression of the user like "kỳ trước", "học kỳ 2 năm ngoái" or "2024-2025-1"
+// relative to the current semester
+func (s *ServiceImpl) ResolveSemester(ctx context.Context, req ResolveSemesterRequest) (ResolveSemesterResponse, error) {
+	semesters, err := s.repo.GetAll(ctx)
+	if err != nil {
+		return ResolveSemesterResponse{}, err
+	}
+	if len(semesters) == 0 {
+		return ResolveSemesterResponse{}, errors.New("no semester found")
+	}
+	current := currentIndex(semesters, s.now())
+	response := ResolveSemesterResponse{Current: semesters[current]}
+
+	resolved, err := resolve(semesters, current, req.Expression)
+	if err != nil {
+		return ResolveSemesterResponse{}, err
+	}
+	response.Semesters = resolved
+	return response, nil
+}
+
+func resolve(semesters []Semester, current int, expression string) ([]Semester, error) {
+	expression = normalizeExpression(expression)
+	if expression == "" {
+		return semesters[current : current+1], nil
+	}
+
+	// A semester code
+	for _, word := range strings.Fields(expression) {
+		if _, _, err := ParseCode(word); err == nil {
+			return findByCodes(semesters, word)
+		}
+	}
+
+	// The academic year, either explicit or relative to the current one
+	currentYear, _, err := ParseCode(semesters[current].Code)
+	if err != nil {
+		return nil, err
+	}
+	year, hasYear := 0, false
+	if match := academicYearPattern.FindStringSubmatch(expression); match != nil {
+		year, _ = strconv.Atoi(match[1])
+		hasYear = true
+		expression = strings.Replace(expression, match[0], " ", 1)
+	} else if match := yearPattern.FindStringSubmatch(expression); match != nil {
+		year, _ = strconv.Atoi(match[1])
+		hasYear = true
+		expression = strings.Replace(expression, match[0], " ", 1)
+	} else if phrase, ok := findPhrase(expression, yearOffsets); ok {
+		year = currentYear + phrase.offset
+		hasYear = true
+		expression = strings.Replace(" "+expression+" ", " "+phrase.phrase+" ", " ", 1)
+	}
+	expression = " " + strings.Join(strings.Fields(expression), " ") + " "
+
+	// The term of the academic year
+	term := 0
+	if match := termPattern.FindStringSubmatch(expression); match != nil {
+		term, _ = strconv.Atoi(match[1] + match[2])
+	} else if phrase, ok := findPhrase(expression, termWords); ok {
+		term = phrase.offset
+	}
+
+	switch {
+	case term != 0:
+		if !hasYear {
+			year = currentYear
+		}
+		return findByCodes(semesters, FormatCode(year, term))
+	case hasYear:
+		return findByCodes(semesters, FormatCode(year, 1), FormatCode(year, 2), FormatCode(year, 3))
+	}
+
+	// A semester relative to the current one
+	if phrase, ok := findPhrase(expression, semesterOffsets); ok {
+		index := current + phrase.offset
+		if index < 0 || index >= len(semesters) {
+			return nil, fmt.Errorf("no semester %s, the current semester is %s", phrase.phrase, semesters[current].Code)
+		}
+		return semesters[index : index+1], nil
+	}
+	return nil, fmt.Errorf("cannot resolve the semester of %q, use a semester code like %s", strings.TrimSpace(expression), semesters[current].Code)
+}
+
+// currentIndex returns the index of the semester containing the day.
+// Between two semesters it is the last started one, and before the first semester it is the first one.
+func currentIndex(semesters []Semester, day time.Time) int {
+	day = dateOf(day)
+	current := 0
+	for i, semester := range semesters {
+		if semester.Contains(day) {
+			return i
+		}
+		if !semester.StartDate.After(day) {
+			current = i
+		}
+	}
+	return current
+}
+
+// findByCodes returns the semesters with the codes, the codes which don't exist are ignored unless none exists
+func findByCodes(semesters []Semester, codes ...string) ([]Semester, error) {
+	var found []Semester
+	for _, semester := range semesters {
+		for _, code := range codes {
+			if semester.Code == code {
+				found = append(found, semester)
+			}
+		}
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("semester %s not found", strings.Join(codes, ", "))
+	}
+	return found, nil
+}
+
+func findPhrase(expression string, phrases []phraseOffset) (phraseOffset, bool) {
+	expression = " " + expression + " "
+	for _, phrase := range phrases {
+		if strings.Contains(expression, " "+phrase.phrase+" ") {
+			return phrase, true
+		}
+	}
+	return phraseOffset{}, false
+}
+
+// normalizeExpression lowercases the expression, uses "kỳ" for its "kì" spelling and keeps only the letters,
+// the digits and the dashes of the codes, separated by single spaces
+func normalizeExpression(expression string) string {
+	expression = strings.ReplaceAll(strings.ToLower(expression), "kì", "kỳ")
+	return strings.Join(strings.FieldsFunc(expression, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-'
+	}), " ")
+}
@@ -0,0 +1,120 @@
+package semester
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+type MockRepository struct {
+	mock.Mock
+}
+
+func (m *MockRepository) GetAll(ctx context.Context) ([]Semester, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]Semester), args.Error(1)
+}
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func testSemesters() []Semester {
+	var semesters []Semester
+	for year := 2022; year <= 2025; year++ {
+		semesters = append(semesters,
+			Semester{Code: FormatCode(year, 1), StartDate: date(year, time.September, 1), EndDate: date(year+1, time.January, 15)},
+			Semester{Code: FormatCode(year, 2), StartDate: date(year+1, time.February, 1), EndDate: date(year+1, time.June, 30)},
+		)
+	}
+	return semesters
+}
+
+func newTestService(now time.Time) *ServiceImpl {
+	repo := &MockRepository{}
+	repo.On("GetAll", mock.Anything).Return(testSemesters(), nil)
+	service := NewServiceImpl(repo)
+	service.now = func() time.Time { return now }
+	return service
+}
+
+func TestServiceImpl_GetCurrentSemester(t *testing.T) {
+	tests := []struct {
+		name     string
+		now      time.Time
+		expected string
+	}{
+		{name: "During the first semester", now: time.Date(2024, time.October, 17, 22, 0, 0, 0, time.Local), expected: "2024-2025-1"},
+		{name: "Last day of the semester", now: date(2025, time.June, 30), expected: "2024-2025-2"},
+		{name: "Between two semesters", now: date(2025, time.July, 20), expected: "2024-2025-2"},
+		{name: "Before the first semester", now: date(2020, time.January, 1), expected: "2022-2023-1"},
+		{name: "After the last semester", now: date(2030, time.January, 1), expected: "2025-2026-2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current, err := newTestService(tt.now).GetCurrentSemester(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, current.Code)
+		})
+	}
+}
+
+func TestServiceImpl_ResolveSemester(t *testing.T) {
+	tests := []struct {
+		name          string
+		expression    string
+		expected      []string
+		expectedError bool
+	}{
+		{name: "Empty expression", expression: "", expected: []string{"2024-2025-1"}},
+		{name: "Current semester", expression: "Kỳ này", expected: []string{"2024-2025-1"}},
+		{name: "Last semester", expression: "học kì trước?", expected: []string{"2023-2024-2"}},
+		{name: "Semester before last", expression: "kỳ trước nữa", expected: []string{"2023-2024-1"}},
+		{name: "Next semester in English", expression: "next semester", expected: []string{"2024-2025-2"}},
+		{name: "Term of last year", expression: "học kỳ 2 năm ngoái", expected: []string{"2023-2024-2"}},
+		{name: "Term of the current year", expression: "hk2", expected: []string{"2024-2025-2"}},
+		{name: "Term of an explicit year", expression: "học kỳ 1 năm học 2022 - 2023", expected: []string{"2022-2023-1"}},
+		{name: "Term of a year in English", expression: "2nd semester of year 2023", expected: []string{"2023-2024-2"}},
+		{name: "Whole academic year", expression: "năm học 2023-2024", expected: []string{"2023-2024-1", "2023-2024-2"}},
+		{name: "Whole last year", expression: "năm trước", expected: []string{"2023-2024-1", "2023-2024-2"}},
+		{name: "Semester code", expression: "2025-2026-1", expected: []string{"2025-2026-1"}},
+		{name: "Unknown semester code", expression: "2030-2031-1", expectedError: true},
+		{name: "Summer semester without data", expression: "kỳ hè năm nay", expectedError: true},
+		{name: "Unknown expression", expression: "hôm qua", expectedError: true},
+	}
+
+	service := newTestService(date(2024, time.October, 17))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := service.ResolveSemester(context.Background(), ResolveSemesterRequest{Expression: tt.expression})
+			if tt.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "2024-2025-1", response.Current.Code)
+			codes := make([]string, 0, len(response.Semesters))
+			for _, semester := range response.Semesters {
+				codes = append(codes, semester.Code)
+			}
+			assert.Equal(t, tt.expected, codes)
+		})
+	}
+
+	// There is no semester before the first one
+	_, err := newTestService(date(2022, time.October, 1)).ResolveSemester(context.Background(), ResolveSemesterRequest{Expression: "last semester"})
+	assert.Error(t, err)
+}
+
+func TestSemester_RegistrationOpen(t *testing.T) {
+	start, end := date(2024, time.August, 1), date(2024, time.August, 25)
+	semester := Semester{Code: "2024-2025-1", RegistrationStart: &start, RegistrationEnd: &end}
+
+	assert.True(t, semester.RegistrationOpen(time.Date(2024, time.August, 25, 23, 59, 0, 0, time.Local)))
+	assert.False(t, semester.RegistrationOpen(date(2024, time.August, 26)))
+	assert.False(t, Semester{}.RegistrationOpen(start))
+}
@@ -0,0 +1,50 @@
+// Package testutil has the test doubles shared by the tests of several packages
+package testutil
+
+import (
+	"HNLP/be/internal/db"
+	"HNLP/be/internal/grade"
+	"HNLP/be/internal/semester"
+	"context"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockSemesterService implements the semester.Service interface for testing
+type MockSemesterService struct {
+	mock.Mock
+}
+
+func (m *MockSemesterService) GetCurrentSemester(ctx context.Context) (semester.Semester, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(semester.Semester), args.Error(1)
+}
+
+func (m *MockSemesterService) ResolveSemester(ctx context.Context, req semester.ResolveSemesterRequest) (semester.ResolveSemesterResponse, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).(semester.ResolveSemesterResponse), args.Error(1)
+}
+
+// MockGradeRepository implements the grade.Repository interface for testing
+type MockGradeRepository struct {
+	mock.Mock
+}
+
+func (m *MockGradeRepository) GetAttempts(ctx context.Context, studentId int) ([]grade.Attempt, error) {
+	args := m.Called(ctx, studentId)
+	return args.Get(0).([]grade.Attempt), args.Error(1)
+}
+
+// MockStudentAccess implements the StudentAccess interfaces of the grade, audit and prerequisite services for testing
+type MockStudentAccess struct {
+	mock.Mock
+}
+
+func (m *MockStudentAccess) AccessibleStudent(ctx context.Context, studentId *int) (int, error) {
+	args := m.Called(ctx, studentId)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStudentAccess) StudentScope(ctx context.Context, studentId *int) (db.StudentScope, error) {
+	args := m.Called(ctx, studentId)
+	return args.Get(0).(db.StudentScope), args.Error(1)
+}
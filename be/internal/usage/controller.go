@@ -0,0 +1,41 @@
+package usage
+
+import (
+	"HNLP/be/internal/auth"
+	"HNLP/be/internal/middleware"
+	"errors"
+	"github.com/gin-gonic/gin"
+)
+
+type Controller struct {
+	service Service
+}
+
+func NewController(service Service) *Controller {
+	return &Controller{service: service}
+}
+
+// GetSpend returns the LLM usage and its cost of a period, e.g. /api/v1/usage?from=2025-03-01&to=2025-03-31&group_by=user
+func (c *Controller) GetSpend(ctx *gin.Context) {
+	var request GetSpendRequest
+	if err := ctx.ShouldBindQuery(&request); err != nil {
+		ctx.JSON(400, gin.H{"error": "invalid request"})
+		return
+	}
+
+	response, err := c.service.GetSpend(ctx.Request.Context(), request)
+	if errors.Is(err, ErrInvalidGroupBy) || errors.Is(err, ErrInvalidPeriod) {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(500, gin.H{"error": "failed to get usage"})
+		return
+	}
+
+	ctx.JSON(200, response)
+}
+
+func (c *Controller) RegisterRoutes(router *gin.Engine, jwtService *auth.ServiceImpl) {
+	router.GET("/api/v1/usage", middleware.Authenticate(jwtService), middleware.HasAnyRole("admin"), c.GetSpend)
+}
@@ -0,0 +1,75 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrQuotaExceeded is returned when the user reached the quota of their role
+	ErrQuotaExceeded = errors.New("LLM usage quota exceeded")
+	// ErrInvalidGroupBy is returned when the spend is grouped by an unknown field
+	ErrInvalidGroupBy = errors.New("invalid group by")
+	// ErrInvalidPeriod is returned when the spend period ends before it starts
+	ErrInvalidPeriod = errors.New("invalid period")
+)
+
+// GroupBy is the field the spend is grouped by
+type GroupBy string
+
+const (
+	GroupByUser  GroupBy = "user"
+	GroupByRole  GroupBy = "role"
+	GroupByModel GroupBy = "model"
+	GroupByStage GroupBy = "stage"
+	GroupByDay   GroupBy = "day"
+)
+
+type Service interface {
+	RecordUsage(ctx context.Context, req RecordUsageRequest) error
+	CheckQuota(ctx context.Context, req CheckQuotaRequest) error
+	GetSpend(ctx context.Context, req GetSpendRequest) (GetSpendResponse, error)
+}
+
+type Repository interface {
+	Insert(ctx context.Context, record *Record) error
+	GetTotalsSince(ctx context.Context, userId int, since time.Time) (Totals, error)
+	GetSpend(ctx context.Context, from time.Time, to time.Time, userId int, groupBy GroupBy) ([]SpendRow, error)
+}
+
+type RecordUsageRequest struct {
+	UserId int
+	Role   string
+	// ConversationId is 0 if the call isn't part of a saved conversation
+	ConversationId   int
+	Stage            string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	// TotalTokens is the sum of the prompt and completion tokens if 0
+	TotalTokens int
+}
+
+type CheckQuotaRequest struct {
+	UserId int
+	Role   string
+}
+
+type GetSpendRequest struct {
+	// From and To bound the days of the spend, To included. From is the first day of the month and To is today if empty
+	From time.Time `form:"from" time_format:"2006-01-02"`
+	To   time.Time `form:"to" time_format:"2006-01-02"`
+	// UserId filters the spend of a user, 0 for all the users
+	UserId int `form:"user_id"`
+	// GroupBy is user, role, model (default), stage or day
+	GroupBy GroupBy `form:"group_by"`
+}
+
+type GetSpendResponse struct {
+	From    time.Time  `json:"from"`
+	To      time.Time  `json:"to"`
+	GroupBy GroupBy    `json:"group_by"`
+	Rows    []SpendRow `json:"rows"`
+	Total   Totals     `json:"total"`
+}
@@ -0,0 +1,33 @@
+package usage
+
+import "time"
+
+// Record is an LLM call of the usage ledger
+type Record struct {
+	ID               int       `db:"id" json:"id"`
+	UserID           int       `db:"user_id" json:"user_id"`
+	Role             string    `db:"role" json:"role"`
+	ConversationID   *int      `db:"conversation_id" json:"conversation_id,omitempty"`
+	Stage            string    `db:"stage" json:"stage"`
+	Model            string    `db:"model" json:"model"`
+	PromptTokens     int       `db:"prompt_tokens" json:"prompt_tokens"`
+	CompletionTokens int       `db:"completion_tokens" json:"completion_tokens"`
+	TotalTokens      int       `db:"total_tokens" json:"total_tokens"`
+	Cost             float64   `db:"cost" json:"cost"`
+	CreatedAt        time.Time `db:"created_at" json:"created_at"`
+}
+
+// Totals sums the usage of LLM calls, the cost is in USD
+type Totals struct {
+	Calls            int     `db:"calls" json:"calls"`
+	PromptTokens     int     `db:"prompt_tokens" json:"prompt_tokens"`
+	CompletionTokens int     `db:"completion_tokens" json:"completion_tokens"`
+	TotalTokens      int     `db:"total_tokens" json:"total_tokens"`
+	Cost             float64 `db:"cost" json:"cost"`
+}
+
+// SpendRow is the usage of a group of LLM calls, e.g. of a model
+type SpendRow struct {
+	Key string `db:"key" json:"key"`
+	Totals
+}
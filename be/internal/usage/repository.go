@@ -0,0 +1,61 @@
+package usage
+
+import (
+	"HNLP/be/internal/db"
+	"context"
+	"fmt"
+	"time"
+)
+
+// groupByColumns are the expressions of the keys of the spend rows
+var groupByColumns = map[GroupBy]string{
+	GroupByUser:  "user_id::text",
+	GroupByRole:  "role",
+	GroupByModel: "model",
+	GroupByStage: "stage",
+	GroupByDay:   "to_char(created_at, 'YYYY-MM-DD')",
+}
+
+const totalsColumns = `COUNT(*) AS calls,
+       COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens,
+       COALESCE(SUM(completion_tokens), 0) AS completion_tokens,
+       COALESCE(SUM(total_tokens), 0) AS total_tokens,
+       COALESCE(SUM(cost), 0) AS cost`
+
+type RepositoryImpl struct {
+	db db.HDb
+}
+
+func NewRepositoryImpl(db db.HDb) *RepositoryImpl {
+	return &RepositoryImpl{db: db}
+}
+
+func (r *RepositoryImpl) Insert(ctx context.Context, record *Record) error {
+	return r.db.QueryRowx(
+		`INSERT INTO llm_usage (user_id, role, conversation_id, stage, model, prompt_tokens, completion_tokens, total_tokens, cost, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id`,
+		record.UserID, record.Role, record.ConversationID, record.Stage, record.Model,
+		record.PromptTokens, record.CompletionTokens, record.TotalTokens, record.Cost, record.CreatedAt,
+	).Scan(&record.ID)
+}
+
+func (r *RepositoryImpl) GetTotalsSince(ctx context.Context, userId int, since time.Time) (Totals, error) {
+	var totals Totals
+	err := r.db.GetContext(ctx, &totals, "SELECT "+totalsColumns+" FROM llm_usage WHERE user_id = $1 AND created_at >= $2", userId, since)
+	return totals, err
+}
+
+// GetSpend sums the usage between from included and to excluded, the most expensive groups first
+func (r *RepositoryImpl) GetSpend(ctx context.Context, from time.Time, to time.Time, userId int, groupBy GroupBy) ([]SpendRow, error) {
+	column, ok := groupByColumns[groupBy]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidGroupBy, groupBy)
+	}
+	var rows []SpendRow
+	err := r.db.SelectContext(ctx, &rows, fmt.Sprintf(`SELECT %s AS key, %s
+FROM llm_usage
+WHERE created_at >= $1 AND created_at < $2 AND ($3 = 0 OR user_id = $3)
+GROUP BY key
+ORDER BY cost DESC, key`, column, totalsColumns), from, to, userId)
+	return rows, err
+}
@@ -0,0 +1,132 @@
+package usage
+
+import (
+	"HNLP/be/internal/config"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type ServiceImpl struct {
+	repo Repository
+	cfg  config.UsageConfig
+	// now returns the current time, it is replaced in the tests
+	now func() time.Time
+}
+
+func NewServiceImpl(repo Repository, cfg config.UsageConfig) *ServiceImpl {
+	return &ServiceImpl{
+		repo: repo,
+		cfg:  cfg,
+		now:  time.Now,
+	}
+}
+
+// RecordUsage adds the call to the ledger with its cost at the current prices
+func (s *ServiceImpl) RecordUsage(ctx context.Context, req RecordUsageRequest) error {
+	record := Record{
+		UserID:           req.UserId,
+		Role:             req.Role,
+		Stage:            req.Stage,
+		Model:            req.Model,
+		PromptTokens:     req.PromptTokens,
+		CompletionTokens: req.CompletionTokens,
+		TotalTokens:      req.TotalTokens,
+		Cost:             s.cost(req.Model, req.PromptTokens, req.CompletionTokens),
+		CreatedAt:        s.now(),
+	}
+	if record.TotalTokens == 0 {
+		record.TotalTokens = req.PromptTokens + req.CompletionTokens
+	}
+	if req.ConversationId != 0 {
+		record.ConversationID = &req.ConversationId
+	}
+	return s.repo.Insert(ctx, &record)
+}
+
+// CheckQuota returns ErrQuotaExceeded if the user reached the daily or monthly quota of their role
+func (s *ServiceImpl) CheckQuota(ctx context.Context, req CheckQuotaRequest) error {
+	quota, ok := s.cfg.Quotas[strings.ToLower(req.Role)]
+	if !ok {
+		return nil
+	}
+
+	now := s.now()
+	if quota.DailyTokens > 0 || quota.DailyCost > 0 {
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		if err := s.checkPeriod(ctx, req.UserId, today, "daily", quota.DailyTokens, quota.DailyCost); err != nil {
+			return err
+		}
+	}
+	if quota.MonthlyTokens > 0 || quota.MonthlyCost > 0 {
+		month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		if err := s.checkPeriod(ctx, req.UserId, month, "monthly", quota.MonthlyTokens, quota.MonthlyCost); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetSpend sums the usage of the period by the group, the whole current month by default
+func (s *ServiceImpl) GetSpend(ctx context.Context, req GetSpendRequest) (GetSpendResponse, error) {
+	now := s.now()
+	if req.From.IsZero() {
+		req.From = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	}
+	if req.To.IsZero() {
+		req.To = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	}
+	if req.To.Before(req.From) {
+		return GetSpendResponse{}, fmt.Errorf("%w: %s is before %s", ErrInvalidPeriod, req.To.Format(time.DateOnly), req.From.Format(time.DateOnly))
+	}
+	if req.GroupBy == "" {
+		req.GroupBy = GroupByModel
+	}
+
+	// The last day is included
+	rows, err := s.repo.GetSpend(ctx, req.From, req.To.AddDate(0, 0, 1), req.UserId, req.GroupBy)
+	if err != nil {
+		return GetSpendResponse{}, err
+	}
+	response := GetSpendResponse{From: req.From, To: req.To, GroupBy: req.GroupBy, Rows: rows}
+	for _, row := range rows {
+		response.Total.Calls += row.Calls
+		response.Total.PromptTokens += row.PromptTokens
+		response.Total.CompletionTokens += row.CompletionTokens
+		response.Total.TotalTokens += row.TotalTokens
+		response.Total.Cost += row.Cost
+	}
+	return response, nil
+}
+
+// ------------------Private helper function------------------
+
+func (s *ServiceImpl) checkPeriod(ctx context.Context, userId int, since time.Time, period string, maxTokens int, maxCost float64) error {
+	totals, err := s.repo.GetTotalsSince(ctx, userId, since)
+	if err != nil {
+		return err
+	}
+	if maxTokens > 0 && totals.TotalTokens >= maxTokens {
+		return fmt.Errorf("%w: %s limit of %d tokens reached", ErrQuotaExceeded, period, maxTokens)
+	}
+	if maxCost > 0 && totals.Cost >= maxCost {
+		return fmt.Errorf("%w: %s limit of $%.2f reached", ErrQuotaExceeded, period, maxCost)
+	}
+	return nil
+}
+
+// cost returns the USD cost of the tokens at the price of the longest configured model name prefixing the model,
+// so "gpt-4o-mini-2024-07-18" is priced as "gpt-4o-mini" rather than "gpt-4o"
+func (s *ServiceImpl) cost(model string, promptTokens int, completionTokens int) float64 {
+	var price *config.ModelPriceConfig
+	for i, candidate := range s.cfg.Prices {
+		if strings.HasPrefix(model, candidate.Model) && (price == nil || len(candidate.Model) > len(price.Model)) {
+			price = &s.cfg.Prices[i]
+		}
+	}
+	if price == nil {
+		return 0
+	}
+	return (float64(promptTokens)*price.PromptPerMillion + float64(completionTokens)*price.CompletionPerMillion) / 1_000_000
+}
@@ -0,0 +1,165 @@
+package usage
+
+import (
+	"HNLP/be/internal/config"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// MockRepository implements the Repository interface for testing
+type MockRepository struct {
+	mock.Mock
+}
+
+func (m *MockRepository) Insert(ctx context.Context, record *Record) error {
+	args := m.Called(ctx, record)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetTotalsSince(ctx context.Context, userId int, since time.Time) (Totals, error) {
+	args := m.Called(ctx, userId, since)
+	return args.Get(0).(Totals), args.Error(1)
+}
+
+func (m *MockRepository) GetSpend(ctx context.Context, from time.Time, to time.Time, userId int, groupBy GroupBy) ([]SpendRow, error) {
+	args := m.Called(ctx, from, to, userId, groupBy)
+	return args.Get(0).([]SpendRow), args.Error(1)
+}
+
+var (
+	testNow        = time.Date(2025, time.March, 14, 15, 30, 0, 0, time.UTC)
+	testToday      = time.Date(2025, time.March, 14, 0, 0, 0, 0, time.UTC)
+	testMonthStart = time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC)
+	testUsageCfg   = config.UsageConfig{
+		Prices: []config.ModelPriceConfig{
+			{Model: "gpt-4o", PromptPerMillion: 2.5, CompletionPerMillion: 10},
+			{Model: "gpt-4o-mini", PromptPerMillion: 0.15, CompletionPerMillion: 0.6},
+		},
+		Quotas: map[string]config.QuotaConfig{
+			"student":   {DailyTokens: 1000, MonthlyCost: 1},
+			"professor": {MonthlyTokens: 50000},
+		},
+	}
+)
+
+func newTestService(repo Repository) *ServiceImpl {
+	service := NewServiceImpl(repo, testUsageCfg)
+	service.now = func() time.Time { return testNow }
+	return service
+}
+
+func TestServiceImpl_RecordUsage(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      RecordUsageRequest
+		expected Record
+	}{
+		{
+			name: "Longest price prefix",
+			req:  RecordUsageRequest{UserId: 7, Role: "student", ConversationId: 3, Stage: "answer", Model: "gpt-4o-mini-2024-07-18", PromptTokens: 1_000_000, CompletionTokens: 500_000, TotalTokens: 1_500_000},
+			expected: Record{
+				UserID: 7, Role: "student", ConversationID: intPtr(3), Stage: "answer", Model: "gpt-4o-mini-2024-07-18",
+				PromptTokens: 1_000_000, CompletionTokens: 500_000, TotalTokens: 1_500_000, Cost: 0.45, CreatedAt: testNow,
+			},
+		},
+		{
+			name: "Model without price and conversation",
+			req:  RecordUsageRequest{UserId: 7, Role: "student", Stage: "summarization", Model: "qwen2.5:14b", PromptTokens: 100, CompletionTokens: 20},
+			expected: Record{
+				UserID: 7, Role: "student", Stage: "summarization", Model: "qwen2.5:14b",
+				PromptTokens: 100, CompletionTokens: 20, TotalTokens: 120, CreatedAt: testNow,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &MockRepository{}
+			var inserted *Record
+			repo.On("Insert", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+				inserted = args.Get(1).(*Record)
+			}).Return(nil)
+
+			require.NoError(t, newTestService(repo).RecordUsage(context.Background(), tt.req))
+			require.NotNil(t, inserted)
+			assert.InDelta(t, tt.expected.Cost, inserted.Cost, 1e-9)
+			inserted.Cost = tt.expected.Cost
+			assert.Equal(t, tt.expected, *inserted)
+		})
+	}
+}
+
+func TestServiceImpl_CheckQuota(t *testing.T) {
+	tests := []struct {
+		name      string
+		role      string
+		daily     Totals
+		monthly   Totals
+		wantErr   bool
+		errSubstr string
+	}{
+		{name: "Under the quotas", role: "student", daily: Totals{TotalTokens: 999}, monthly: Totals{Cost: 0.99}},
+		{name: "Daily tokens reached", role: "student", daily: Totals{TotalTokens: 1000}, wantErr: true, errSubstr: "daily limit of 1000 tokens"},
+		{name: "Monthly cost reached", role: "student", daily: Totals{TotalTokens: 10}, monthly: Totals{Cost: 1.2}, wantErr: true, errSubstr: "monthly limit of $1.00"},
+		{name: "Monthly tokens only", role: "Professor", monthly: Totals{TotalTokens: 50000}, wantErr: true, errSubstr: "monthly limit of 50000 tokens"},
+		{name: "Role without quota", role: "admin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &MockRepository{}
+			repo.On("GetTotalsSince", mock.Anything, 7, testToday).Return(tt.daily, nil).Maybe()
+			repo.On("GetTotalsSince", mock.Anything, 7, testMonthStart).Return(tt.monthly, nil).Maybe()
+
+			err := newTestService(repo).CheckQuota(context.Background(), CheckQuotaRequest{UserId: 7, Role: tt.role})
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrQuotaExceeded)
+				assert.Contains(t, err.Error(), tt.errSubstr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestServiceImpl_GetSpend(t *testing.T) {
+	rows := []SpendRow{
+		{Key: "gpt-4o-mini-2024-07-18", Totals: Totals{Calls: 3, PromptTokens: 300, CompletionTokens: 30, TotalTokens: 330, Cost: 0.5}},
+		{Key: "o3-mini-2025-01-31", Totals: Totals{Calls: 2, PromptTokens: 200, CompletionTokens: 20, TotalTokens: 220, Cost: 0.25}},
+	}
+
+	t.Run("Current month by model", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("GetSpend", mock.Anything, testMonthStart, testToday.AddDate(0, 0, 1), 0, GroupByModel).Return(rows, nil)
+
+		response, err := newTestService(repo).GetSpend(context.Background(), GetSpendRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, testMonthStart, response.From)
+		assert.Equal(t, testToday, response.To)
+		assert.Equal(t, GroupByModel, response.GroupBy)
+		assert.Equal(t, rows, response.Rows)
+		assert.Equal(t, Totals{Calls: 5, PromptTokens: 500, CompletionTokens: 50, TotalTokens: 550, Cost: 0.75}, response.Total)
+	})
+
+	t.Run("Invalid period", func(t *testing.T) {
+		_, err := newTestService(&MockRepository{}).GetSpend(context.Background(), GetSpendRequest{From: testToday, To: testMonthStart})
+		assert.ErrorIs(t, err, ErrInvalidPeriod)
+	})
+
+	t.Run("Repository error", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("GetSpend", mock.Anything, mock.Anything, mock.Anything, 5, GroupByDay).Return([]SpendRow(nil), errors.New("connection refused"))
+
+		_, err := newTestService(repo).GetSpend(context.Background(), GetSpendRequest{UserId: 5, GroupBy: GroupByDay})
+		assert.Error(t, err)
+	})
+}
+
+func intPtr(value int) *int {
+	return &value
+}
@@ -4,10 +4,15 @@ import "context"
 
 type Service interface {
 	GetUserInfo(ctx context.Context, req GetUserInfoRequest) (*GetUserInfoResponse, error)
+	GetAdvisees(ctx context.Context, req GetAdviseesRequest) (GetAdviseesResponse, error)
 }
 
 type Repository interface {
 	GetUserInfo(ctx context.Context, req GetUserInfoRequest) (*GetUserInfoResponse, error)
+	// GetAdvisedClasses returns the administrative classes of the advisor ordered by name
+	GetAdvisedClasses(ctx context.Context, professorId int) ([]AdvisedClass, error)
+	GetClassByName(ctx context.Context, name string) (AdvisedClass, error)
+	GetStudentsOfClass(ctx context.Context, classId int) ([]Advisee, error)
 }
 
 type GetUserInfoRequest struct {
@@ -16,10 +21,36 @@ type GetUserInfoRequest struct {
 }
 
 type GetUserInfoResponse struct {
-	ID       int    `json:"id"`
-	Name     string `json:"name"`
-	Code     string `json:"code"`
-	Birthday string `json:"birthday"`
-	Email    string `json:"email"`
-	AdministrativeClassID int `json:"administrative_class_id"`
+	ID                    int    `json:"id" db:"id"`
+	Name                  string `json:"name" db:"name"`
+	Code                  string `json:"code" db:"code"`
+	Birthday              string `json:"birthday" db:"birthday"`
+	Email                 string `json:"email" db:"email"`
+	AdministrativeClassID int    `json:"administrative_class_id" db:"administrative_class_id"`
+}
+
+// AdvisedClass is an administrative class with its advisor, Students is set in the responses
+type AdvisedClass struct {
+	ID        int       `json:"-" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	Program   string    `json:"program" db:"program"`
+	AdvisorID *int      `json:"-" db:"advisor_id"`
+	Students  []Advisee `json:"students" db:"-"`
+}
+
+// Advisee is a student of an administrative class
+type Advisee struct {
+	ID       int     `json:"id" db:"id"`
+	Code     string  `json:"code" db:"code"`
+	Name     string  `json:"name" db:"name"`
+	Email    *string `json:"email,omitempty" db:"email"`
+	Birthday *string `json:"birthday,omitempty" db:"birthday"`
+}
+
+type GetAdviseesRequest struct {
+	ClassName *string `json:"class_name,omitempty" jsonschema:"description=Name of the administrative class, all the classes of the advisor by default,example=QH-2021-I/CQ-C-A-CLC1"`
+}
+
+type GetAdviseesResponse struct {
+	Classes []AdvisedClass `json:"classes"`
 }
@@ -2,6 +2,8 @@ package userinfo
 
 import (
 	"HNLP/be/internal/db"
+	"context"
+	"fmt"
 )
 
 type RepositoryImpl struct {
@@ -12,6 +14,59 @@ func NewUserInfoRepositoryImpl(db db.HDb) *RepositoryImpl {
 	return &RepositoryImpl{db: db}
 }
 
-//func (r RepositoryImpl) GetUserInfo(ctx context.Context, req GetUserInfoRequest) (*GetUserInfoResponse, error){
-//
-//}
+func (r *RepositoryImpl) GetUserInfo(ctx context.Context, req GetUserInfoRequest) (*GetUserInfoResponse, error) {
+	role := "student"
+	if req.Role != nil {
+		role = *req.Role
+	}
+
+	var userInfo GetUserInfoResponse
+	var err error
+	switch role {
+	case "student":
+		err = r.db.GetContext(ctx, &userInfo, `SELECT id,
+       COALESCE(name, '')                               AS name,
+       code,
+       COALESCE(to_char(birthday, 'YYYY-MM-DD'), '')    AS birthday,
+       COALESCE(email, '')                              AS email,
+       COALESCE(administrative_class_id, 0)             AS administrative_class_id
+FROM student
+WHERE id = $1`, req.UserID)
+	case "professor":
+		err = r.db.GetContext(ctx, &userInfo, "SELECT id, name, COALESCE(email, '') AS email FROM professor WHERE id = $1", req.UserID)
+	default:
+		return nil, fmt.Errorf("no information for the role %s", role)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &userInfo, nil
+}
+
+func (r *RepositoryImpl) GetAdvisedClasses(ctx context.Context, professorId int) ([]AdvisedClass, error) {
+	var classes []AdvisedClass
+	err := r.db.SelectContext(ctx, &classes, `SELECT ac.id, ac.name, COALESCE(p.name, '') AS program, ac.advisor_id
+FROM administrative_class ac
+         LEFT JOIN program p ON p.id = ac.program_id
+WHERE ac.advisor_id = $1
+ORDER BY ac.name`, professorId)
+	return classes, err
+}
+
+func (r *RepositoryImpl) GetClassByName(ctx context.Context, name string) (AdvisedClass, error) {
+	var class AdvisedClass
+	err := r.db.GetContext(ctx, &class, `SELECT ac.id, ac.name, COALESCE(p.name, '') AS program, ac.advisor_id
+FROM administrative_class ac
+         LEFT JOIN program p ON p.id = ac.program_id
+WHERE ac.name = $1`, name)
+	return class, err
+}
+
+func (r *RepositoryImpl) GetStudentsOfClass(ctx context.Context, classId int) ([]Advisee, error) {
+	var students []Advisee
+	err := r.db.SelectContext(ctx, &students, `SELECT id, code, COALESCE(name, '') AS name, email, to_char(birthday, 'YYYY-MM-DD') AS birthday
+FROM student
+WHERE administrative_class_id = $1
+ORDER BY code`, classId)
+	return students, err
+}
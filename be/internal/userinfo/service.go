@@ -1,19 +1,85 @@
 package userinfo
 
+import (
+	"HNLP/be/internal/db"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
 type ServiceImpl struct {
 	repo Repository
+	// policy masks the columns of the students read outside of ExecuteQuery
+	policy *db.AuthorizationPolicy
 }
 
-func NewServiceImpl(repo Repository) *ServiceImpl {
+func NewServiceImpl(repo Repository, policy *db.AuthorizationPolicy) *ServiceImpl {
 	return &ServiceImpl{
-		repo: repo,
+		repo:   repo,
+		policy: policy,
+	}
+}
+
+func (s *ServiceImpl) GetUserInfo(ctx context.Context, req GetUserInfoRequest) (*GetUserInfoResponse, error) {
+	return s.repo.GetUserInfo(ctx, req)
+}
+
+// GetAdvisees returns the students of the administrative classes advised by the caller, or of the given class.
+// A professor can only get the classes they advise, the email and the birthday of the students are masked like in the
+// query results by the column rules of the policy.
+func (s *ServiceImpl) GetAdvisees(ctx context.Context, req GetAdviseesRequest) (GetAdviseesResponse, error) {
+	caller := db.CallerFrom(ctx)
+	if caller.Role != "professor" && caller.Role != "admin" {
+		return GetAdviseesResponse{}, db.ErrForbidden
+	}
+
+	var classes []AdvisedClass
+	if req.ClassName != nil && *req.ClassName != "" {
+		class, err := s.repo.GetClassByName(ctx, *req.ClassName)
+		if errors.Is(err, sql.ErrNoRows) {
+			return GetAdviseesResponse{}, fmt.Errorf("class %s not found", *req.ClassName)
+		}
+		if err != nil {
+			return GetAdviseesResponse{}, err
+		}
+		if caller.Role == "professor" && (class.AdvisorID == nil || *class.AdvisorID != caller.SpecificID) {
+			return GetAdviseesResponse{}, db.ErrForbidden
+		}
+		classes = []AdvisedClass{class}
+	} else if caller.Role == "professor" {
+		var err error
+		classes, err = s.repo.GetAdvisedClasses(ctx, caller.SpecificID)
+		if err != nil {
+			return GetAdviseesResponse{}, err
+		}
+	} else {
+		return GetAdviseesResponse{}, errors.New("class_name is required")
+	}
+
+	for i := range classes {
+		students, err := s.repo.GetStudentsOfClass(ctx, classes[i].ID)
+		if err != nil {
+			return GetAdviseesResponse{}, err
+		}
+		classes[i].Students = s.maskAdvisees(students, caller.Role)
+		if classes[i].Students == nil {
+			classes[i].Students = []Advisee{}
+		}
+	}
+	if classes == nil {
+		classes = []AdvisedClass{}
 	}
+	return GetAdviseesResponse{Classes: classes}, nil
 }
 
-//func (s *ServiceImpl) GetUserInfo(req GetUserInfoRequest) (*GetUserInfoResponse, error) {
-//	userInfo, err := s.repo.GetUserInfo(req)
-//	if err != nil {
-//		return nil, err
-//	}
-//	return userInfo, nil
-//}
+// ------------------Private helper function------------------
+
+// maskAdvisees applies the column rules of the student table for the role
+func (s *ServiceImpl) maskAdvisees(students []Advisee, role string) []Advisee {
+	for i := range students {
+		students[i].Email = s.policy.MaskValue("student", role, "email", students[i].Email)
+		students[i].Birthday = s.policy.MaskValue("student", role, "birthday", students[i].Birthday)
+	}
+	return students
+}
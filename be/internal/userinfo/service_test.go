@@ -0,0 +1,130 @@
+package userinfo
+
+import (
+	"HNLP/be/internal/db"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// MockRepository implements the Repository interface for testing
+type MockRepository struct {
+	mock.Mock
+}
+
+func (m *MockRepository) GetUserInfo(ctx context.Context, req GetUserInfoRequest) (*GetUserInfoResponse, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).(*GetUserInfoResponse), args.Error(1)
+}
+
+func (m *MockRepository) GetAdvisedClasses(ctx context.Context, professorId int) ([]AdvisedClass, error) {
+	args := m.Called(ctx, professorId)
+	return args.Get(0).([]AdvisedClass), args.Error(1)
+}
+
+func (m *MockRepository) GetClassByName(ctx context.Context, name string) (AdvisedClass, error) {
+	args := m.Called(ctx, name)
+	return args.Get(0).(AdvisedClass), args.Error(1)
+}
+
+func (m *MockRepository) GetStudentsOfClass(ctx context.Context, classId int) ([]Advisee, error) {
+	args := m.Called(ctx, classId)
+	return args.Get(0).([]Advisee), args.Error(1)
+}
+
+func callerContext(role string, specificId int) context.Context {
+	ctx := context.WithValue(context.Background(), "userRole", role)
+	return context.WithValue(ctx, "specificId", specificId)
+}
+
+func TestServiceImpl_GetAdvisees(t *testing.T) {
+	advisor := 2
+	otherAdvisor := 3
+	classA := AdvisedClass{ID: 1, Name: "QH-2021-I/CQ-C-A-CLC1", Program: "Công nghệ thông tin", AdvisorID: &advisor}
+	classB := AdvisedClass{ID: 2, Name: "QH-2021-I/CQ-C-A-CLC2", Program: "Công nghệ thông tin", AdvisorID: &advisor}
+	classOther := AdvisedClass{ID: 3, Name: "QH-2022-I/CQ-C-A-CLC1", AdvisorID: &otherAdvisor}
+	studentsA := []Advisee{{ID: 5, Code: "21020005", Name: "Nguyễn Văn An"}}
+
+	tests := []struct {
+		name      string
+		role      string
+		className string
+		expected  []string
+		wantErr   error
+		errString string
+	}{
+		{name: "All the classes of the advisor", role: "professor", expected: []string{classA.Name, classB.Name}},
+		{name: "A class of the advisor", role: "professor", className: classA.Name, expected: []string{classA.Name}},
+		{name: "A class of another advisor", role: "professor", className: classOther.Name, wantErr: db.ErrForbidden},
+		{name: "Admin with a class", role: "admin", className: classOther.Name, expected: []string{classOther.Name}},
+		{name: "Admin without class", role: "admin", errString: "class_name is required"},
+		{name: "Student", role: "student", wantErr: db.ErrForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &MockRepository{}
+			repo.On("GetAdvisedClasses", mock.Anything, advisor).Return([]AdvisedClass{classA, classB}, nil)
+			repo.On("GetClassByName", mock.Anything, classA.Name).Return(classA, nil)
+			repo.On("GetClassByName", mock.Anything, classOther.Name).Return(classOther, nil)
+			repo.On("GetStudentsOfClass", mock.Anything, 1).Return(studentsA, nil)
+			repo.On("GetStudentsOfClass", mock.Anything, mock.Anything).Return([]Advisee(nil), nil)
+
+			var className *string
+			if tt.className != "" {
+				className = &tt.className
+			}
+			response, err := NewServiceImpl(repo, db.DefaultAuthorizationPolicy()).GetAdvisees(callerContext(tt.role, advisor), GetAdviseesRequest{ClassName: className})
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			if tt.errString != "" {
+				assert.EqualError(t, err, tt.errString)
+				return
+			}
+			require.NoError(t, err)
+			var names []string
+			for _, class := range response.Classes {
+				names = append(names, class.Name)
+				assert.NotNil(t, class.Students)
+			}
+			assert.Equal(t, tt.expected, names)
+			if tt.expected[0] == classA.Name {
+				assert.Equal(t, studentsA, response.Classes[0].Students)
+			}
+		})
+	}
+}
+
+func TestServiceImpl_GetAdvisees_MasksColumns(t *testing.T) {
+	email, birthday := "nguyenvanan@vnu.edu.vn", "2003-05-01"
+	tests := []struct {
+		name     string
+		role     string
+		expected Advisee
+	}{
+		{name: "Professor", role: "professor", expected: Advisee{ID: 5, Code: "21020005", Email: strPtr("n***@vnu.edu.vn")}},
+		{name: "Admin", role: "admin", expected: Advisee{ID: 5, Code: "21020005", Email: &email, Birthday: &birthday}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			advisor := 2
+			repo := &MockRepository{}
+			repo.On("GetClassByName", mock.Anything, "QH-2021-I/CQ-C-A-CLC1").Return(AdvisedClass{ID: 1, AdvisorID: &advisor}, nil)
+			repo.On("GetStudentsOfClass", mock.Anything, 1).Return([]Advisee{{ID: 5, Code: "21020005", Email: strPtr(email), Birthday: strPtr(birthday)}}, nil)
+
+			className := "QH-2021-I/CQ-C-A-CLC1"
+			response, err := NewServiceImpl(repo, db.DefaultAuthorizationPolicy()).GetAdvisees(callerContext(tt.role, advisor), GetAdviseesRequest{ClassName: &className})
+			require.NoError(t, err)
+			assert.Equal(t, []Advisee{tt.expected}, response.Classes[0].Students)
+		})
+	}
+}
+
+func strPtr(value string) *string {
+	return &value
+}
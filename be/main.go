@@ -1,21 +1,34 @@
 package main
 
 import (
+	"HNLP/be/courseclass"
+	"HNLP/be/internal/audit"
 	"HNLP/be/internal/auth"
 	"HNLP/be/internal/chatbot"
 	"HNLP/be/internal/chatmanagement"
 	"HNLP/be/internal/config"
 	"HNLP/be/internal/course"
 	HDb "HNLP/be/internal/db"
+	"HNLP/be/internal/grade"
+	"HNLP/be/internal/gradeentry"
 	"HNLP/be/internal/llm"
+	"HNLP/be/internal/prerequisite"
+	"HNLP/be/internal/registration"
 	"HNLP/be/internal/search"
+	"HNLP/be/internal/semester"
+	"HNLP/be/internal/usage"
 	"HNLP/be/internal/user"
+	"HNLP/be/internal/userinfo"
+	"context"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/google/generative-ai-go/genai"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 	"github.com/sashabaranov/go-openai"
+	"google.golang.org/api/option"
 	"log"
+	"time"
 )
 
 func main() {
@@ -51,9 +64,21 @@ func main() {
 	}()
 	// Initialize schema service
 	schemaService := HDb.NewSchemaServiceImpl(rawDb)
-	authService := HDb.NewAuthorizationServiceImpl(schemaService)
 
-	db, err := HDb.NewHDb("postgres", cfg.Database.URL, authService)
+	// Load the authorization policy and check it against the live schema
+	authPolicy := HDb.DefaultAuthorizationPolicy()
+	if cfg.Database.AuthorizationPolicyFile != "" {
+		authPolicy, err = HDb.LoadAuthorizationPolicy(cfg.Database.AuthorizationPolicyFile)
+		if err != nil {
+			log.Fatalf("Failed to load authorization policy: %v", err)
+		}
+	}
+	if err := authPolicy.Validate(schemaService); err != nil {
+		log.Fatalf("Invalid authorization policy: %v", err)
+	}
+	authService := HDb.NewAuthorizationServiceImplWithPolicy(schemaService, authPolicy)
+
+	db, err := HDb.NewHDb("postgres", cfg.Database.URL, authService, HDb.AuthorizationMode(cfg.Database.AuthorizationMode))
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
@@ -62,13 +87,35 @@ func main() {
 			log.Fatalf("Failed to close database: %v", err)
 		}
 	}()
+	// Share the schema cache with the authorization service
+	db.DDLLoader = HDb.NewPgDDLLoader(schemaService, cfg.Database.DDLExcludedTables)
 
-	// Initialize services
-	openAIClient := openai.NewClient(cfg.OpenAI.APIKey)
-	openAIProvider := llm.NewOpenAIProvider(openAIClient)
-
-	//geminiAIClient, err := genai.NewClient(context.Background(), option.WithAPIKey(cfg.GeminiAI.APIKey))
-	//geminiAIProvider := llm.NewGeminiAIProvider(geminiAIClient)
+	// Initialize services, the chatbot falls back to the next provider when one fails
+	providerNames := cfg.Chatbot.Providers
+	if len(providerNames) == 0 {
+		providerNames = []string{"openai"}
+	}
+	var providers []llm.RoutedProvider
+	for _, name := range providerNames {
+		var provider llm.AIProvider
+		switch name {
+		case "gemini":
+			geminiAIClient, err := genai.NewClient(context.Background(), option.WithAPIKey(cfg.GeminiAI.APIKey))
+			if err != nil {
+				log.Fatalf("Failed to create Gemini client: %v", err)
+			}
+			defer geminiAIClient.Close()
+			provider = llm.NewGeminiAIProvider(geminiAIClient, cfg.GeminiAI.Model)
+		case "local":
+			provider = llm.NewLocalProvider(cfg.LocalLLM)
+		case "openai":
+			provider = llm.NewOpenAIProvider(openai.NewClient(cfg.OpenAI.APIKey))
+		default:
+			log.Fatalf("Unknown chatbot provider %q", name)
+		}
+		providers = append(providers, llm.RoutedProvider{Name: name, Provider: provider})
+	}
+	aiProvider := llm.NewRouterProvider(cfg.Chatbot.Router, providers...)
 
 	// User management
 	jwtService := auth.NewServiceImpl(cfg.JWT)
@@ -81,23 +128,93 @@ func main() {
 	courseRepo := course.NewRepositoryImpl(db)
 	courseService := course.NewServiceImpl(courseRepo, db)
 
+	// Semesters, the chatbot resolves the semesters mentioned by the user through it
+	semesterRepo := semester.NewRepositoryImpl(db)
+	semesterService := semester.NewServiceImpl(semesterRepo)
+
+	// Course classes and their schedules
+	timetable, err := courseclass.NewTimetable(cfg.Schedule)
+	if err != nil {
+		log.Fatalf("Error loading the timetable: %v", err)
+	}
+	courseClassRepo := courseclass.NewRepositoryImpl(db)
+	courseClassService := courseclass.NewServiceImpl(courseClassRepo, semesterService, timetable, authPolicy)
+	courseClassController := courseclass.NewController(courseClassService)
+	courseClassController.RegisterRoutes(router, jwtService)
+
+	// Students and professors
+	userInfoRepo := userinfo.NewUserInfoRepositoryImpl(db)
+	userInfoService := userinfo.NewServiceImpl(userInfoRepo, authPolicy)
+
+	// Grades, the GPA is weighted by the credits under the grading rules of the university
+	gradeRepo := grade.NewRepositoryImpl(db)
+	gradeService := grade.NewServiceImpl(gradeRepo, courseService, semesterService, cfg.Grade)
+	gradeController := grade.NewController(gradeService)
+	gradeController.RegisterRoutes(router, jwtService)
+
+	// Prerequisite graph of the courses
+	prerequisiteRepo := prerequisite.NewRepositoryImpl(db)
+	prerequisiteService := prerequisite.NewServiceImpl(prerequisiteRepo, gradeRepo, courseService, semesterService, grade.NewScale(cfg.Grade.Scale))
+	prerequisiteController := prerequisite.NewController(prerequisiteService)
+	prerequisiteController.RegisterRoutes(router, jwtService)
+
+	// Degree audit of the students against the curriculum of their program
+	auditRepo := audit.NewRepositoryImpl(db)
+	auditService := audit.NewServiceImpl(auditRepo, gradeRepo, courseService, prerequisiteService, semesterService, grade.NewScale(cfg.Grade.Scale), cfg.Audit)
+	auditController := audit.NewController(auditService)
+	auditController.RegisterRoutes(router, jwtService)
+
+	// Course registration with the waitlists of the full classes
+	registrationRepo := registration.NewRepositoryImpl(db)
+	registrationService := registration.NewServiceImpl(registrationRepo, gradeRepo, prerequisiteService, semesterService, grade.NewScale(cfg.Grade.Scale), timetable, cfg.Registration)
+	registrationController := registration.NewController(registrationService)
+	registrationController.RegisterRoutes(router, jwtService)
+
+	// Grade entry of the professors with the grade history
+	gradeEntryRepo := gradeentry.NewRepositoryImpl(db)
+	gradeEntryService := gradeentry.NewServiceImpl(gradeEntryRepo, db, semesterService, grade.NewScale(cfg.Grade.Scale))
+	gradeEntryController := gradeentry.NewController(gradeEntryService)
+	gradeEntryController.RegisterRoutes(router, jwtService)
+
 	// Search
 	searchService := search.NewSearchService(cfg.SerpApi)
 
 	// Init function registry, after we inits all the services and before we inits the chatbot
 	funcRegistry := llm.NewFunctionRegistryImpl()
-	funcRegistry.Register(llm.FuncWrapper("ExecuteQuery", "Run a SQL query to my university database and return the result in a JSON format", db.ExecuteQuery))
-	funcRegistry.Register(llm.FuncWrapper("GetCurrentGpaOfStudent", "Get current gpa of a student by id or name", courseService.GetCurrentGpaOfStudent))
-
-	chatService := chatbot.NewChatService(openAIProvider, db, searchService, funcRegistry)
-	chatController := chatbot.NewChatController(chatService)
-	chatController.RegisterRoutes(router, jwtService)
+	funcRegistry.Register(llm.FuncWrapper("ExecuteQuery", "Run a SQL query to my university database and return the result in a JSON format", db.ExecuteQuery, llm.WithTimeout(30*time.Second)))
+	funcRegistry.Register(llm.FuncWrapper("ResolveSemester", "Resolve a semester mentioned by the user like 'kỳ trước', 'học kỳ 2 năm ngoái' or 'năm học 2023-2024' to the semesters with their code and dates, relative to the current semester", semesterService.ResolveSemester, llm.WithTimeout(5*time.Second)))
+	// The domain tools answer the common questions without writing SQL
+	funcRegistry.Register(llm.FuncWrapper("GetMySchedule", "Get the timetable of the current user in a semester: the classes attended by a student or taught by a professor with their clock times and the overlapping sessions, with the dates of the sessions for a week of the semester or only the sessions of a date, e.g. for 'what do I have on Tuesday?'", courseClassService.GetMySchedule, llm.WithTimeout(10*time.Second), llm.WithRoles("student", "professor")))
+	funcRegistry.Register(llm.FuncWrapper("GetTranscript", "Get the transcript of a student: the courses taken in each semester with their credits and grades", courseService.GetTranscript, llm.WithTimeout(10*time.Second), llm.WithRoles("student", "professor")))
+	funcRegistry.Register(llm.FuncWrapper("GetCourseInfo", "Get the credits, the theory, practice and self-learning hours and the prerequisites of a course", courseService.GetCourseInfo, llm.WithTimeout(5*time.Second)))
+	funcRegistry.Register(llm.FuncWrapper("FindCourseClasses", "Find the classes of a course opened in a semester with their sessions, rooms and professors", courseClassService.FindCourseClasses, llm.WithTimeout(10*time.Second)))
+	funcRegistry.Register(llm.FuncWrapper("ListStudentsInClass", "List the students enrolled in a course class taught by the professor", courseClassService.ListStudentsInClass, llm.WithTimeout(10*time.Second), llm.WithRoles("professor")))
+	funcRegistry.Register(llm.FuncWrapper("GetAdvisees", "Get the students of the administrative classes advised by the professor", userInfoService.GetAdvisees, llm.WithTimeout(10*time.Second), llm.WithRoles("professor")))
+	funcRegistry.Register(llm.FuncWrapper("GetGpa", "Get the GPA of a student on the 4-point scale weighted by the credits: the GPA of each semester and the cumulative GPA counting the best attempt of the retaken courses", gradeService.GetGpa, llm.WithTimeout(10*time.Second), llm.WithRoles("student", "professor")))
+	funcRegistry.Register(llm.FuncWrapper("ConvertGrade", "Convert a grade between the 10-point, letter and 4-point scales of the university", gradeService.ConvertGrade, llm.WithTimeout(5*time.Second)))
+	funcRegistry.Register(llm.FuncWrapper("GetPrerequisites", "Get the requirements of a course: its groups of prerequisites and co-requisites, one course of each group is required, and all the prerequisites of its chains in the order they can be taken", prerequisiteService.GetPrerequisites, llm.WithTimeout(10*time.Second)))
+	funcRegistry.Register(llm.FuncWrapper("GetUnlockedCourses", "Get the courses requiring a course as a prerequisite or a co-requisite, i.e. the courses passing it helps to take", prerequisiteService.GetUnlockedCourses, llm.WithTimeout(10*time.Second)))
+	funcRegistry.Register(llm.FuncWrapper("CheckEligibility", "Check if a student satisfies the prerequisites and co-requisites of a course and list the unmet requirements", prerequisiteService.CheckEligibility, llm.WithTimeout(10*time.Second), llm.WithRoles("student", "professor")))
+	funcRegistry.Register(llm.FuncWrapper("AuditProgress", "Audit the progress of a student toward graduation: the credits completed against the credits required by the program, the mandatory courses missing with their unmet prerequisites and the projected graduation semester. Use it for questions like 'am I on track to graduate?'", auditService.AuditProgress, llm.WithTimeout(10*time.Second), llm.WithRoles("student", "professor")))
+	funcRegistry.Register(llm.FuncWrapper("ListRegistrations", "List the course classes registered by the student in a semester and their waitlist positions, with the credits registered and the registration window", registrationService.ListRegistrations, llm.WithTimeout(10*time.Second), llm.WithRoles("student")))
+	funcRegistry.Register(llm.FuncWrapper("GetProgramCurriculum", "Get the courses and the credits of the curriculum of a training program, the program of the student by default", courseService.GetProgramCurriculum, llm.WithTimeout(10*time.Second)))
 
+	// Chat management, the chatbot saves the conversations through it
 	chatManagementRepository := chatmanagement.NewRepositoryImpl(db)
 	chatManagementService := chatmanagement.NewServiceImpl(chatManagementRepository)
 	chatManagementController := chatmanagement.NewController(chatManagementService)
 	chatManagementController.RegisterRoutes(router, jwtService)
 
+	// LLM usage ledger, the chatbot enforces the quotas of the roles through it
+	usageRepository := usage.NewRepositoryImpl(db)
+	usageService := usage.NewServiceImpl(usageRepository, cfg.Usage)
+	usageController := usage.NewController(usageService)
+	usageController.RegisterRoutes(router, jwtService)
+
+	chatService := chatbot.NewChatService(aiProvider, db, searchService, funcRegistry, chatManagementService, semesterService, usageService, cfg.Chatbot)
+	chatController := chatbot.NewChatController(chatService)
+	chatController.RegisterRoutes(router, jwtService)
+
 	// Start server
 	if err := router.Run(":" + cfg.Server.Port); err != nil {
 		log.Fatalf("Error starting server: %v", err)
@@ -16,7 +16,11 @@ export default function useBot({ index, chat }: Props) {
   const [error, setError] = useState("");
   const [isStreamCompleted, setIsStreamCompleted] = useState(false);
   const query = useChat((state) => state.chats[index - 1].content);
-  const [chats, addChat] = useChat((state) => [state.chats, state.addChat]);
+  const [chats, addChat, setCurrentConversation] = useChat((state) => [
+    state.chats,
+    state.addChat,
+    state.setCurrentConversation,
+  ]);
   const [sendHistory, selectedModal, systemMessage, useForAllChats] =
     useSettings((state) => [
       state.settings.sendChatHistory,
@@ -92,7 +96,8 @@ export default function useBot({ index, chat }: Props) {
           selectedModal,
           signal,
           handleOnData,
-          handleOnCompletion
+          handleOnCompletion,
+          setCurrentConversation
         );
       } catch (error) {
         if (error instanceof Error || typeof error === "string") {
@@ -107,6 +112,7 @@ export default function useBot({ index, chat }: Props) {
   }, [
     query,
     addChat,
+    setCurrentConversation,
     index,
     scrollToBottom,
     chat.content,
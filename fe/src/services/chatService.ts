@@ -1,4 +1,4 @@
-import { ChatMessageType, ModalList, AgentList, useSettings } from "../store/store";
+import useChat, { ChatMessageType, ModalList, AgentList, useSettings } from "../store/store";
 
 // Base API URL for the backend
 const BASE_API_URL = "http://127.0.0.1:8080/api/v1";
@@ -18,7 +18,8 @@ export async function fetchResults(
     model: string,
     signal: AbortSignal,
     onData: (data: string) => void,
-    onCompletion: () => void
+    onCompletion: () => void,
+    onConversation?: (conversationId: number) => void
 ) {
     try {
         // Get currently selected agent
@@ -33,7 +34,9 @@ export async function fetchResults(
             model: model,
             temperature: 0.7,
             stream: true,
-            messages: messages
+            messages: messages,
+            // The backend saves the messages in this conversation, or creates one if it is 0
+            conversation_id: useChat.getState().currentConversation
         };
 
         const response = await fetch(apiUrl, {
@@ -79,6 +82,10 @@ export async function fetchResults(
                 try {
                     const data = JSON.parse(chunk);
 
+                    if (data.conversation_id && onConversation) {
+                        onConversation(data.conversation_id);
+                    }
+
                     // Handle different response formats based on agent type
                     let content: string;
 
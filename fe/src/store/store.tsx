@@ -106,6 +106,7 @@ export interface ChatType {
     currentConversation: number;
     initChatHistory: () => void;
     addChat: (chat: ChatMessageType, index?: number) => void;
+    setCurrentConversation: (conversationId: number) => void;
     editChatMessage: (chat: string, updateIndex: number) => void;
     addNewChat: () => void;
     saveChats: () => void;
@@ -160,25 +161,30 @@ const useChat = create<ChatType>((set, get) => ({
                 }
             })
         );
-        let newConversationId = get().currentConversation;
-        if (chat.content) {
-            let res = await fetch(`${BASE_API_URL}/messages`, {
-                method: "POST",
-                headers: {
-                    "Content-Type": "application/json",
-                    Authorization: `Bearer ${useAuth.getState().accessToken}`,
-                },
-                body: JSON.stringify({...chat, conversation_id: get().currentConversation}),
-            })
-            newConversationId = (await res.json()).conversation_id;
-        }
+        // The text messages are saved by the chat completions endpoint
+        if (!chat.content || (chat as any).type === "text") return;
+
+        let res = await fetch(`${BASE_API_URL}/messages`, {
+            method: "POST",
+            headers: {
+                "Content-Type": "application/json",
+                Authorization: `Bearer ${useAuth.getState().accessToken}`,
+            },
+            body: JSON.stringify({...chat, conversation_id: get().currentConversation}),
+        })
+        get().setCurrentConversation((await res.json()).conversation_id);
 
+        // if (chat.role === "bot" && chat.content) {
+        //     get().saveChats();
+        // }
+    },
+    setCurrentConversation: (conversationId) => {
         let needRefreshConversations = false;
 
         set(
             produce((state: ChatType) => {
-                if (!state.currentConversation || state.currentConversation === 0 || state.currentConversation !== newConversationId) {
-                    state.currentConversation = newConversationId
+                if (!state.currentConversation || state.currentConversation === 0 || state.currentConversation !== conversationId) {
+                    state.currentConversation = conversationId
                     needRefreshConversations = true
                 }
             })
@@ -187,10 +193,6 @@ const useChat = create<ChatType>((set, get) => ({
         if (needRefreshConversations) {
             get().initChatHistory();
         }
-
-        // if (chat.role === "bot" && chat.content) {
-        //     get().saveChats();
-        // }
     },
     editChatMessage: (chat, updateIndex) => {
         set(